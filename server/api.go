@@ -76,6 +76,18 @@ func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Req
 		p.handleDeletionUnlock(w, r)
 	case "/api/v1/config":
 		p.handleGetConfig(w, r)
+	case "/api/v1/expiry/extend":
+		p.handleExpiryReminderAction(w, r, expiryActionExtend)
+	case "/api/v1/expiry/lock":
+		p.handleExpiryReminderAction(w, r, expiryActionLock)
+	case "/api/v1/expiry/dismiss":
+		p.handleExpiryReminderAction(w, r, expiryActionDismiss)
+	case "/api/v1/creation-failure/retry":
+		p.handleCreationFailureAction(w, r, creationFailureActionRetry)
+	case "/api/v1/creation-failure/delete":
+		p.handleCreationFailureAction(w, r, creationFailureActionDelete)
+	case versionsAutocompleteURL:
+		p.handleVersionsAutocomplete(w, r)
 	default:
 		http.NotFound(w, r)
 	}
@@ -25,6 +25,30 @@ func (p *Plugin) PostBotDM(userID, message string) error {
 	return appError
 }
 
+// resolvedActionPost returns the bot post with its buttons replaced by the
+// outcome of the chosen action.
+func (p *Plugin) resolvedActionPost(postID, status string) *model.Post {
+	if postID == "" {
+		return nil
+	}
+	post, appErr := p.API.GetPost(postID)
+	if appErr != nil {
+		p.API.LogWarn("Failed to get action post", "post", postID, "error", appErr.Error())
+		return nil
+	}
+
+	var text string
+	if attachments := post.Attachments(); len(attachments) > 0 {
+		text = attachments[0].Text
+	}
+	model.ParseSlackAttachment(post, []*model.SlackAttachment{{
+		Text:   text,
+		Fields: []*model.SlackAttachmentField{{Title: "Outcome", Value: status}},
+	}})
+
+	return post
+}
+
 // PostToChannelByIDAsBot posts a message to the provided channel.
 func (p *Plugin) PostToChannelByIDAsBot(channelID, message string) error {
 	_, appError := p.API.CreatePost(&model.Post{
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// cloneInstallationForUser creates a new installation configured like an
+// installation the user owns or that is shared. Options set in the input take
+// precedence over the configuration of the source installation. The sensitive
+// config overrides of an installation owned by another user are not copied,
+// the settings they were dropped for are returned.
+func (p *Plugin) cloneInstallationForUser(userID string, sourceRef InstallationRef, input CreateInstallationInput) (*Installation, []string, error) {
+	if sourceRef.Name != "" {
+		sourceRef.Name = standardizeName(sourceRef.Name)
+	}
+
+	source, err := p.findVisibleInstallationForUser(userID, sourceRef)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sourceInput, err := p.cloneInstallationInput(source, input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var dropped []string
+	if source.OwnerID != userID {
+		sourceInput.Config, dropped = dropSensitiveConfigOverrides(sourceInput.Config, input.Config)
+	}
+
+	install, err := p.createInstallationForUser(userID, mergeCreateInstallationInput(input, sourceInput))
+	if err != nil {
+		return nil, nil, err
+	}
+	p.recordInstallationAction(install.ID, userID, historyActionClone, "from "+source.Name)
+
+	return install, dropped, nil
+}
+
+// dropSensitiveConfigOverrides returns a copy of the config overrides without
+// the sensitive settings, and the sensitive settings which aren't set in the
+// explicit overrides.
+func dropSensitiveConfigOverrides(overrides, explicit map[string]string) (map[string]string, []string) {
+	if overrides == nil {
+		return nil, nil
+	}
+
+	kept := make(map[string]string, len(overrides))
+	dropped := []string{}
+	for _, key := range sortedStringMapKeys(overrides) {
+		if !isSensitiveConfigSetting(key) {
+			kept[key] = overrides[key]
+			continue
+		}
+		if _, ok := explicit[key]; !ok {
+			dropped = append(dropped, key)
+		}
+	}
+	return kept, dropped
+}
+
+// cloneInstallationInput returns the create options matching the
+// configuration of the source installation. Options already set in overrides
+// are not resolved from the source.
+func (p *Plugin) cloneInstallationInput(source *Installation, overrides CreateInstallationInput) (CreateInstallationInput, error) {
+	if source.Installation == nil {
+		return CreateInstallationInput{}, errors.Errorf("installation %s has no provisioner configuration to clone", source.Name)
+	}
+
+	input := CreateInstallationInput{
+		Version:   source.Tag,
+		Image:     source.Image,
+		Size:      source.Size,
+		Database:  source.Database,
+		Filestore: source.Filestore,
+		Affinity:  source.Affinity,
+		Plugins:   source.Plugins,
+		Users:     seedUserSpecs(source.SeedUsers),
+		Config:    source.ConfigOverrides,
+	}
+
+	// Installations created before tags were stored may only have a digest.
+	if input.Version == "" && !strings.HasPrefix(source.Version, "sha256:") {
+		input.Version = source.Version
+	}
+	if input.Version == "" && overrides.Version == "" {
+		return CreateInstallationInput{}, errors.Errorf("unable to determine the version tag of installation %s; specify one with --version", source.Name)
+	}
+
+	if overrides.License == "" {
+		licenseOption, ok := p.getLicenseOption(source.License)
+		if !ok {
+			return CreateInstallationInput{}, errors.Errorf("unable to determine the license option of installation %s; specify one with --license", source.Name)
+		}
+		input.License = licenseOption
+	}
+
+	for key, env := range source.PriorityEnv {
+		if env.Value == "" {
+			continue
+		}
+		if input.Env == nil {
+			input.Env = map[string]string{}
+		}
+		input.Env[key] = env.Value
+	}
+
+	return input, nil
+}
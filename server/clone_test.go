@@ -0,0 +1,150 @@
+package main
+
+import (
+	"testing"
+
+	cloud "github.com/mattermost/mattermost-cloud/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloneInstallationForUser(t *testing.T) {
+	sourceInstall := func(id, name, ownerID string) *Installation {
+		install := serviceTestInstall(id, name, ownerID)
+		install.Version = "sha256:source"
+		install.Tag = "9.3.1"
+		install.Size = "miniHA"
+		install.License = "e20-license"
+		install.Database = cloud.InstallationDatabaseMysqlOperator
+		install.Filestore = cloud.InstallationFilestoreAwsS3
+		install.Affinity = cloud.InstallationAffinityIsolated
+		install.PriorityEnv = cloud.EnvVarMap{
+			"MM_FEATUREFLAGS_X": cloud.EnvVar{Value: "true"},
+			"MM_SECRET":         cloud.EnvVar{Value: "secret-value"},
+		}
+		install.ConfigOverrides = map[string]string{
+			"ServiceSettings.EnableGifPicker": "false",
+			"EmailSettings.SMTPPassword":      "smtp-secret",
+		}
+		return install
+	}
+
+	t.Run("copies the configuration of the source", func(t *testing.T) {
+		plugin, cloudClient, _, kv := newServiceTestPluginWithKV(t, []*Installation{sourceInstall("source-id", "Source", "owner")})
+		plugin.dockerClient = &MockedDockerClient{tagExists: true, digest: "sha256:clone"}
+
+		install, droppedConfig, err := plugin.cloneInstallationForUser("owner", InstallationRef{Name: "SOURCE"}, CreateInstallationInput{Name: "copy"})
+		require.NoError(t, err)
+		assert.Empty(t, droppedConfig)
+		require.NotNil(t, cloudClient.creationRequest)
+		assert.Equal(t, "copy", cloudClient.creationRequest.Name)
+		assert.Equal(t, "sha256:clone", cloudClient.creationRequest.Version)
+		assert.Equal(t, imageEE, cloudClient.creationRequest.Image)
+		assert.Equal(t, "miniHA", cloudClient.creationRequest.Size)
+		assert.Equal(t, "e20-license", cloudClient.creationRequest.License)
+		assert.Equal(t, cloud.InstallationDatabaseMysqlOperator, cloudClient.creationRequest.Database)
+		assert.Equal(t, cloud.InstallationFilestoreAwsS3, cloudClient.creationRequest.Filestore)
+		assert.Equal(t, cloud.InstallationAffinityIsolated, cloudClient.creationRequest.Affinity)
+		assert.Equal(t, cloud.EnvVarMap{
+			"MM_FEATUREFLAGS_X": cloud.EnvVar{Value: "true"},
+			"MM_SECRET":         cloud.EnvVar{Value: "secret-value"},
+		}, cloudClient.creationRequest.PriorityEnv)
+		assert.Equal(t, "9.3.1", install.Tag)
+		require.NotNil(t, kv.getInstallation(t, install.ID))
+		assert.Equal(t, map[string]string{
+			"ServiceSettings.EnableGifPicker": "false",
+			"EmailSettings.SMTPPassword":      "smtp-secret",
+		}, kv.getInstallation(t, install.ID).ConfigOverrides)
+
+		events, err := plugin.getInstallationHistory(install.ID)
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		assert.Equal(t, historyActionClone, events[1].Action)
+		assert.Equal(t, "from Source", events[1].Details)
+	})
+
+	t.Run("explicit options override the source", func(t *testing.T) {
+		plugin, cloudClient, _, _ := newServiceTestPluginWithKV(t, []*Installation{sourceInstall("source-id", "Source", "owner")})
+
+		_, _, err := plugin.cloneInstallationForUser("owner", InstallationRef{Name: "source"}, CreateInstallationInput{
+			Name:    "copy",
+			Version: "9.5.0",
+			Size:    "miniSingleton",
+			License: licenseOptionEnterprise,
+			Env:     map[string]string{"MM_SECRET": "other-value"},
+		})
+		require.NoError(t, err)
+		require.NotNil(t, cloudClient.creationRequest)
+		assert.Equal(t, "miniSingleton", cloudClient.creationRequest.Size)
+		assert.Equal(t, "enterprise-license", cloudClient.creationRequest.License)
+		assert.Equal(t, cloud.EnvVar{Value: "other-value"}, cloudClient.creationRequest.PriorityEnv["MM_SECRET"])
+		assert.Equal(t, cloud.EnvVar{Value: "true"}, cloudClient.creationRequest.PriorityEnv["MM_FEATUREFLAGS_X"])
+	})
+
+	t.Run("clones shared installations of other users", func(t *testing.T) {
+		shared := sourceInstall("shared-id", "Shared", "other")
+		shared.Shared = true
+		plugin, cloudClient, _, kv := newServiceTestPluginWithKV(t, []*Installation{shared})
+
+		install, droppedConfig, err := plugin.cloneInstallationForUser("owner", InstallationRef{Name: "shared"}, CreateInstallationInput{Name: "copy"})
+		require.NoError(t, err)
+		require.NotNil(t, cloudClient.creationRequest)
+		assert.Equal(t, "owner", cloudClient.creationRequest.OwnerID)
+		assert.Equal(t, []string{"EmailSettings.SMTPPassword"}, droppedConfig)
+		assert.Equal(t, map[string]string{"ServiceSettings.EnableGifPicker": "false"}, kv.getInstallation(t, install.ID).ConfigOverrides)
+		assert.Equal(t, "smtp-secret", shared.ConfigOverrides["EmailSettings.SMTPPassword"])
+	})
+
+	t.Run("explicit sensitive overrides are kept for shared installations", func(t *testing.T) {
+		shared := sourceInstall("shared-id", "Shared", "other")
+		shared.Shared = true
+		plugin, _, _, kv := newServiceTestPluginWithKV(t, []*Installation{shared})
+
+		install, droppedConfig, err := plugin.cloneInstallationForUser("owner", InstallationRef{Name: "shared"}, CreateInstallationInput{
+			Name:   "copy",
+			Config: map[string]string{"EmailSettings.SMTPPassword": "my-secret"},
+		})
+		require.NoError(t, err)
+		assert.Empty(t, droppedConfig)
+		assert.Equal(t, "my-secret", kv.getInstallation(t, install.ID).ConfigOverrides["EmailSettings.SMTPPassword"])
+	})
+
+	t.Run("private installations of other users are not visible", func(t *testing.T) {
+		plugin, cloudClient, _, _ := newServiceTestPluginWithKV(t, []*Installation{sourceInstall("source-id", "Source", "other")})
+
+		_, _, err := plugin.cloneInstallationForUser("owner", InstallationRef{Name: "source"}, CreateInstallationInput{Name: "copy"})
+		require.EqualError(t, err, "no installation with the name source found")
+		assert.Nil(t, cloudClient.creationRequest)
+	})
+
+	t.Run("unknown license value requires an explicit license", func(t *testing.T) {
+		source := sourceInstall("source-id", "Source", "owner")
+		source.License = "retired-license"
+		plugin, cloudClient, _, _ := newServiceTestPluginWithKV(t, []*Installation{source})
+
+		_, _, err := plugin.cloneInstallationForUser("owner", InstallationRef{Name: "source"}, CreateInstallationInput{Name: "copy"})
+		require.EqualError(t, err, "unable to determine the license option of installation Source; specify one with --license")
+		assert.Nil(t, cloudClient.creationRequest)
+
+		_, _, err = plugin.cloneInstallationForUser("owner", InstallationRef{Name: "source"}, CreateInstallationInput{Name: "copy", License: licenseOptionTE})
+		require.NoError(t, err)
+		assert.Empty(t, cloudClient.creationRequest.License)
+	})
+
+	t.Run("digest only source requires an explicit version", func(t *testing.T) {
+		source := sourceInstall("source-id", "Source", "owner")
+		source.Tag = ""
+		plugin, _, _, _ := newServiceTestPluginWithKV(t, []*Installation{source})
+
+		_, _, err := plugin.cloneInstallationForUser("owner", InstallationRef{Name: "source"}, CreateInstallationInput{Name: "copy"})
+		require.EqualError(t, err, "unable to determine the version tag of installation Source; specify one with --version")
+	})
+
+	t.Run("new name is validated", func(t *testing.T) {
+		plugin, _, _, _ := newServiceTestPluginWithKV(t, []*Installation{sourceInstall("source-id", "Source", "owner")})
+
+		_, _, err := plugin.cloneInstallationForUser("owner", InstallationRef{Name: "source"}, CreateInstallationInput{Name: "source"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "Installation name source already exists")
+	})
+}
@@ -16,6 +16,21 @@ create [name] [flags]
 	Flags:
 %s
 	example: /cloud create myinstallation --license e10 --test-data
+	example: /cloud create myinstallation --preset loadtest --version 9.5.0
+	example: /cloud create myinstallation --test-data-profile medium --test-data-counts users=250,threads=100
+	example: /cloud create myinstallation --plugins com.mattermost.plugin-jira@4.1.0,com.mattermost.calls
+	example: /cloud create myinstallation --users alice:system_admin,bob:user_manager:qa,carol:guest:qa+support,ci:bot
+	example: /cloud create myinstallation --config ServiceSettings.EnableGifPicker=false --config TeamSettings.MaxUsersPerTeam=100
+
+create-matrix [prefix] --versions [versions] [flags]
+	Creates one Mattermost installation per version, named prefix-version, with the same create flags. Every version is validated before any installation is created.
+
+	example: /cloud create-matrix upgrade --versions 9.11.0,10.2.0,latest --license e20
+
+clone [source name] [new name] [flags]
+	Creates a Mattermost installation with the version, image, size, license, database, filestore, affinity, and environment variables of an installation you own or that is shared. Accepts the create flags, except --preset, to override the copied configuration.
+
+	example: /cloud clone myinstallation myinstallation-copy --version 9.5.0
 
 list
 	Lists the Mattermost installations created by you.
@@ -65,25 +80,73 @@ mmctl [name] [mmctl-subcommand]
 delete [name]
 	Deletes a Mattermost installation.
 
+extend [name] --by [duration]
+	Pushes back the scheduled deletion of an installation you own, up to the configured maximum.
+
+	example: /cloud extend myinstallation --by 48h
+
+restore [name]
+	Restores an installation you own that is pending deletion.
+
+preset save [name] [create flags] [--global]
+	Saves the given create flags as a named preset. Global presets are available to every user and can only be saved by system administrators.
+
+	example: /cloud preset save loadtest --size miniHA --database aws-rds --test-data
+
+preset list
+	Lists your presets and the global presets.
+
+preset delete [name] [--global]
+	Deletes a preset.
+
+versions [flags]
+	Lists the tags of a docker image repository, newest release first.
+	Flags:
+%s
+	example: /cloud versions --filter 10.
+	example: /cloud versions --image mattermostdevelopment/mattermost-enterprise-edition --filter pr-
+
+setup retry [name]
+	Resumes the failed or interrupted setup of an installation you own from the step it stopped at.
+
+credentials [name]
+	Sends you the admin and user passwords of an installation you own in a direct message.
+
+credentials rotate [name]
+	Resets the admin and user passwords of an installation you own and sends you the new ones.
+
+history [name]
+	Shows the state changes and actions recorded for an installation you own or that is shared.
+
 info
 	Shows basic cloud plugin information.
+
+admin migrations
+	Shows the KV schema version and migration status. System administrators only.
 `
 	return codeBlock(fmt.Sprintf(
 		help,
-		p.getCreateFlagSet().FlagUsages(),
+		p.getCreateCommandFlagSet().FlagUsages(),
 		getListFlagSet().FlagUsages(),
-		getUpdateFlagSet().FlagUsages(),
+		p.getUpdateFlagSet().FlagUsages(),
 		getShareFlagSet().FlagUsages(),
+		p.getVersionsFlagSet().FlagUsages(),
 	))
 }
 
 func (p *Plugin) getCommand() *model.Command {
+	config := p.getConfiguration()
+	sizes := config.installationSizes()
+	sizeSuggestions := installationSizeListItems(sizes)
+	images := config.allowedImages()
+	imageSuggestions := imageListItems(images)
+
 	return &model.Command{
 		Trigger:              "cloud",
 		DisplayName:          "Mattermost Private Cloud",
 		Description:          "This command allows spinning up and down Mattermost installations using Mattermost Private Cloud.",
-		AutoComplete:         p.getConfiguration().EnableCommandAutocompletion,
-		AutoCompleteDesc:     "Available commands: create, list, update, mmcli, mmctl, delete, share, unshare, restart, hibernate, wake-up, info, import",
+		AutoComplete:         config.EnableCommandAutocompletion,
+		AutoCompleteDesc:     "Available commands: create, create-matrix, clone, list, update, mmcli, mmctl, delete, extend, restore, preset, versions, history, setup, credentials, share, unshare, restart, hibernate, wake-up, info, import",
 		AutoCompleteHint:     "[command]",
 		AutocompleteIconData: p.appBarIconData,
 		AutocompleteData: &model.AutocompleteData{
@@ -137,6 +200,56 @@ func (p *Plugin) getCommand() *model.Command {
 							HelpText: "Set to pre-load the server with test data",
 							Required: false,
 						},
+						{
+							Type: model.AutocompleteArgTypeStaticList,
+							Data: &model.AutocompleteStaticListArg{
+								PossibleArguments: testDataProfileListItems(config.testDataProfiles()),
+							},
+							Name:     "test-data-profile",
+							HelpText: "Test data profile to pre-load the server with. Implies --test-data",
+							Required: false,
+						},
+						{
+							Type: model.AutocompleteArgTypeText,
+							Data: &model.AutocompleteTextArg{
+								Hint: "teams=2,users=50",
+							},
+							Name:     "test-data-counts",
+							HelpText: "Test data counts replacing those of the profile. Implies --test-data",
+							Required: false,
+						},
+						{
+							Type: model.AutocompleteArgTypeText,
+							Data: &model.AutocompleteTextArg{
+								Hint: "com.mattermost.plugin-jira@4.1.0",
+							},
+							Name:     "plugins",
+							HelpText: "Marketplace plugins to install and enable, optionally with a version",
+							Required: false,
+						},
+						{
+							Type: model.AutocompleteArgTypeText,
+							Data: &model.AutocompleteTextArg{
+								Hint: "alice:user_manager:qa,ci:bot",
+							},
+							Name:     "users",
+							HelpText: "Extra users to create with a role and teams. Role can be system_admin, user_manager, user, guest or bot. Guests require a license other than te",
+							Required: false,
+						},
+						{
+							Type: model.AutocompleteArgTypeText,
+							Data: &model.AutocompleteTextArg{
+								Hint: "Section.Setting=value",
+							},
+							Name:     "config",
+							HelpText: "Mattermost config setting to apply during setup. Can be repeated",
+							Required: false,
+						},
+						{
+							Name:     "dry-run",
+							HelpText: "Show the request that would be sent to the provisioner without creating the installation",
+							Required: false,
+						},
 						{
 							Type: model.AutocompleteArgTypeStaticList,
 							Data: &model.AutocompleteStaticListArg{
@@ -183,8 +296,21 @@ func (p *Plugin) getCommand() *model.Command {
 							Required: false,
 						},
 						{
-							Name:     "image",
-							HelpText: "Docker image repository, can be mattermost/mattermost-enterprise-edition, mattermost/mm-ee-cloud, mattermost/mm-te, mattermost/mattermost-team-edition, mattermostdevelopment/mm-ee-test, mattermostdevelopment/mm-te-test, mattermostdevelopment/mattermost-enterprise-edition, mattermostdevelopment/mattermost-team-edition, mattermost/mattermost-enterprise-edition-fips",
+							Type: model.AutocompleteArgTypeText,
+							Data: &model.AutocompleteTextArg{
+								Hint: "48h",
+							},
+							Name:     "ttl",
+							HelpText: "Time until the installation is automatically deleted, e.g. '48h' or '7d'",
+							Required: false,
+						},
+						{
+							Type: model.AutocompleteArgTypeText,
+							Data: &model.AutocompleteTextArg{
+								Hint: "[preset]",
+							},
+							Name:     "preset",
+							HelpText: "Name of a saved preset to apply. Flags set explicitly take precedence over the preset",
 							Required: false,
 						},
 						{
@@ -210,39 +336,30 @@ func (p *Plugin) getCommand() *model.Command {
 							Required: false,
 						},
 						{
-							Type: model.AutocompleteArgTypeText,
-							Data: &model.AutocompleteTextArg{
-								Hint: "image",
+							Type: model.AutocompleteArgTypeStaticList,
+							Data: &model.AutocompleteStaticListArg{
+								PossibleArguments: imageSuggestions,
 							},
 							Name:     "image",
-							HelpText: "Docker image repository. Can be mattermost/mattermost-enterprise-edition, mattermost/mm-ee-cloud, mattermost/mm-te, mattermost/mattermost-team-edition, mattermostdevelopment/mm-ee-test, mattermostdevelopment/mm-te-test, mattermostdevelopment/mattermost-enterprise-edition, mattermostdevelopment/mattermost-team-edition, mattermost/mattermost-enterprise-edition-fips (default \"mattermost/mattermost-enterprise-edition\")",
+							HelpText: fmt.Sprintf("Docker image repository. Can be %s (default \"%s\")", strings.Join(images, ", "), defaultImage),
 							Required: false,
 						},
 						{
 							Type: model.AutocompleteArgTypeStaticList,
 							Data: &model.AutocompleteStaticListArg{
-								PossibleArguments: []model.AutocompleteListItem{
-									{
-										Item:     "miniSingleton",
-										HelpText: "Mini Singleton instance",
-									},
-									{
-										Item:     "miniHA",
-										HelpText: "Mini cluster made of two servers",
-									},
-								},
+								PossibleArguments: sizeSuggestions,
 							},
 							Name:     "size",
-							HelpText: "Size of the Mattermost installation e.g. 'miniSingleton' or 'miniHA' (default \"miniSingleton\")",
+							HelpText: fmt.Sprintf("Size of the Mattermost installation. Can be %s (default \"%s\")", quotedList(sizes), sizes[0]),
 							Required: false,
 						},
 						{
-							Type: model.AutocompleteArgTypeText,
-							Data: &model.AutocompleteTextArg{
-								Hint: "version",
+							Type: model.AutocompleteArgTypeDynamicList,
+							Data: &model.AutocompleteDynamicListArg{
+								FetchURL: versionsAutocompleteURL,
 							},
 							Name:     "version",
-							HelpText: "Mattermost version to run, e.g. '9.1.0' (default \"latest\")",
+							HelpText: "Mattermost version to run, e.g. '9.1.0', '9.11.x', 'latest-esr', 'latest-rc', 'master' or 'pr-12345' (default \"latest\")",
 							Required: false,
 						},
 					},
@@ -272,8 +389,12 @@ func (p *Plugin) getCommand() *model.Command {
 							Required: true,
 						},
 						{
+							Type: model.AutocompleteArgTypeDynamicList,
+							Data: &model.AutocompleteDynamicListArg{
+								FetchURL: versionsAutocompleteURL,
+							},
 							Name:     "version",
-							HelpText: "Mattermost version to run, e.g. '9.1.0'",
+							HelpText: "Mattermost version to run, e.g. '9.1.0', '9.11.x', 'latest', 'latest-esr', 'latest-rc', 'master' or 'pr-12345'",
 							Required: false,
 						},
 						{
@@ -321,22 +442,27 @@ func (p *Plugin) getCommand() *model.Command {
 							HelpText: "Set this to true when attempting to update a shared installation",
 							Required: false,
 						},
+						{
+							Name:     "dry-run",
+							HelpText: "Show the request that would be sent to the provisioner without updating the installation",
+							Required: false,
+						},
 						{
 							Type: model.AutocompleteArgTypeStaticList,
 							Data: &model.AutocompleteStaticListArg{
-								PossibleArguments: []model.AutocompleteListItem{
-									{
-										Item:     "miniSingleton",
-										HelpText: "Mini Singleton instance",
-									},
-									{
-										Item:     "miniHA",
-										HelpText: "Mini cluster made of two servers",
-									},
-								},
+								PossibleArguments: sizeSuggestions,
 							},
 							Name:     "size",
-							HelpText: "Size of the Mattermost installation e.g. 'miniSingleton' or 'miniHA'",
+							HelpText: fmt.Sprintf("Size of the Mattermost installation. Can be %s", quotedList(sizes)),
+							Required: false,
+						},
+						{
+							Type: model.AutocompleteArgTypeStaticList,
+							Data: &model.AutocompleteStaticListArg{
+								PossibleArguments: imageSuggestions,
+							},
+							Name:     "image",
+							HelpText: fmt.Sprintf("Docker image repository, can be %s", strings.Join(images, ", ")),
 							Required: false,
 						},
 					},
@@ -497,10 +623,257 @@ func (p *Plugin) getCommand() *model.Command {
 						},
 					},
 				},
+				{
+					Trigger:  "extend",
+					HelpText: "Push back the scheduled deletion of a Mattermost installation",
+					Arguments: []*model.AutocompleteArg{
+						{
+							Type: model.AutocompleteArgTypeText,
+							Data: &model.AutocompleteTextArg{
+								Hint:    "[name]",
+								Pattern: "^[a-zA-Z0-9-]+$",
+							},
+							HelpText: "Name of the installation to extend",
+							Required: true,
+						},
+						{
+							Type: model.AutocompleteArgTypeText,
+							Data: &model.AutocompleteTextArg{
+								Hint: "48h",
+							},
+							Name:     "by",
+							HelpText: "How long to push back the scheduled deletion, e.g. '48h' or '7d'",
+							Required: true,
+						},
+					},
+				},
+				{
+					Trigger:  "restore",
+					HelpText: "Restore a Mattermost installation that is pending deletion",
+					Arguments: []*model.AutocompleteArg{
+						{
+							Type: model.AutocompleteArgTypeText,
+							Data: &model.AutocompleteTextArg{
+								Hint:    "[name]",
+								Pattern: "^[a-zA-Z0-9-]+$",
+							},
+							HelpText: "Name of the installation to restore",
+							Required: true,
+						},
+					},
+				},
+				{
+					Trigger:  "create-matrix",
+					HelpText: "Create one Mattermost installation per version with the same options",
+					Arguments: []*model.AutocompleteArg{
+						{
+							Type: model.AutocompleteArgTypeText,
+							Data: &model.AutocompleteTextArg{
+								Hint:    "[prefix]",
+								Pattern: "^[a-zA-Z0-9-]+$",
+							},
+							HelpText: "Name prefix of the installations",
+							Required: true,
+						},
+						{
+							Type: model.AutocompleteArgTypeText,
+							Data: &model.AutocompleteTextArg{
+								Hint: "9.11.0,10.2.0,latest",
+							},
+							Name:     "versions",
+							HelpText: "Mattermost versions to create an installation for",
+							Required: true,
+						},
+						{
+							Type: model.AutocompleteArgTypeText,
+							Data: &model.AutocompleteTextArg{
+								Hint: "[preset]",
+							},
+							Name:     "preset",
+							HelpText: "Name of a saved preset to apply. Flags set explicitly take precedence over the preset",
+							Required: false,
+						},
+					},
+				},
+				{
+					Trigger:  "clone",
+					HelpText: "Create a Mattermost installation with the configuration of another installation",
+					Arguments: []*model.AutocompleteArg{
+						{
+							Type: model.AutocompleteArgTypeText,
+							Data: &model.AutocompleteTextArg{
+								Hint:    "[source name]",
+								Pattern: "^[a-zA-Z0-9-]+$",
+							},
+							HelpText: "Name of the installation to clone",
+							Required: true,
+						},
+						{
+							Type: model.AutocompleteArgTypeText,
+							Data: &model.AutocompleteTextArg{
+								Hint:    "[new name]",
+								Pattern: "^[a-zA-Z0-9-]+$",
+							},
+							HelpText: "Name of the new installation",
+							Required: true,
+						},
+					},
+				},
+				{
+					Trigger:  "preset",
+					HelpText: "Save, list, and delete create presets",
+					SubCommands: []*model.AutocompleteData{
+						{
+							Trigger:  "save",
+							HelpText: "Save create flags as a named preset",
+							Arguments: []*model.AutocompleteArg{
+								{
+									Type: model.AutocompleteArgTypeText,
+									Data: &model.AutocompleteTextArg{
+										Hint:    "[name]",
+										Pattern: "^[a-zA-Z0-9-]+$",
+									},
+									HelpText: "Name of the preset",
+									Required: true,
+								},
+								{
+									Name:     "global",
+									HelpText: "Save the preset for every user. System administrators only",
+									Required: false,
+								},
+							},
+						},
+						{
+							Trigger:  "list",
+							HelpText: "List your presets and the global presets",
+						},
+						{
+							Trigger:  "delete",
+							HelpText: "Delete a preset",
+							Arguments: []*model.AutocompleteArg{
+								{
+									Type: model.AutocompleteArgTypeText,
+									Data: &model.AutocompleteTextArg{
+										Hint:    "[name]",
+										Pattern: "^[a-zA-Z0-9-]+$",
+									},
+									HelpText: "Name of the preset to delete",
+									Required: true,
+								},
+								{
+									Name:     "global",
+									HelpText: "Delete the global preset instead of your own. System administrators only",
+									Required: false,
+								},
+							},
+						},
+					},
+				},
+				{
+					Trigger:  "versions",
+					HelpText: "List the tags of a docker image repository",
+					Arguments: []*model.AutocompleteArg{
+						{
+							Type: model.AutocompleteArgTypeStaticList,
+							Data: &model.AutocompleteStaticListArg{
+								PossibleArguments: imageSuggestions,
+							},
+							Name:     "image",
+							HelpText: fmt.Sprintf("Docker image repository to list the tags of (default \"%s\")", defaultImage),
+							Required: false,
+						},
+						{
+							Type: model.AutocompleteArgTypeText,
+							Data: &model.AutocompleteTextArg{
+								Hint: "filter",
+							},
+							Name:     "filter",
+							HelpText: "Only list tags starting with the filter, e.g. '10.'",
+							Required: false,
+						},
+						{
+							Type: model.AutocompleteArgTypeText,
+							Data: &model.AutocompleteTextArg{
+								Hint: "limit",
+							},
+							Name:     "limit",
+							HelpText: "Maximum number of tags to list (default 50)",
+							Required: false,
+						},
+					},
+				},
+				{
+					Trigger:  "history",
+					HelpText: "Show the state changes and actions recorded for an installation",
+					Arguments: []*model.AutocompleteArg{
+						{
+							Type: model.AutocompleteArgTypeText,
+							Data: &model.AutocompleteTextArg{
+								Hint:    "[name]",
+								Pattern: "^[a-zA-Z0-9-]+$",
+							},
+							HelpText: "Name of the installation to show history for",
+							Required: true,
+						},
+					},
+				},
+				{
+					Trigger:  "setup",
+					HelpText: "Manage the setup of a Mattermost installation",
+					SubCommands: []*model.AutocompleteData{
+						{
+							Trigger:  "retry",
+							HelpText: "Resume the failed or interrupted setup of an installation from the step it stopped at",
+							Arguments: []*model.AutocompleteArg{
+								{
+									Type: model.AutocompleteArgTypeText,
+									Data: &model.AutocompleteTextArg{
+										Hint:    "[name]",
+										Pattern: "^[a-zA-Z0-9-]+$",
+									},
+									HelpText: "Name of the installation to retry the setup of",
+									Required: true,
+								},
+							},
+						},
+					},
+				},
+				{
+					Trigger:  "credentials",
+					Hint:     "[name]",
+					HelpText: "Send yourself the passwords of an installation you own",
+					SubCommands: []*model.AutocompleteData{
+						{
+							Trigger:  "rotate",
+							HelpText: "Reset the passwords of an installation you own",
+							Arguments: []*model.AutocompleteArg{
+								{
+									Type: model.AutocompleteArgTypeText,
+									Data: &model.AutocompleteTextArg{
+										Hint:    "[name]",
+										Pattern: "^[a-zA-Z0-9-]+$",
+									},
+									HelpText: "Name of the installation to reset the passwords of",
+									Required: true,
+								},
+							},
+						},
+					},
+				},
 				{
 					Trigger:  "info",
 					HelpText: "Show cloud plugin information",
 				},
+				{
+					Trigger:  "admin",
+					HelpText: "Cloud plugin administration for system administrators",
+					SubCommands: []*model.AutocompleteData{
+						{
+							Trigger:  "migrations",
+							HelpText: "Show the KV schema version and migration status",
+						},
+					},
+				},
 				{
 					Trigger:  "import",
 					HelpText: "Import an existing installation",
@@ -520,6 +893,37 @@ func (p *Plugin) getCommand() *model.Command {
 	}
 }
 
+// installationSizeDescriptions describes the installation sizes in the
+// autocomplete suggestions.
+var installationSizeDescriptions = map[string]string{
+	"miniSingleton": "Mini Singleton instance",
+	"miniHA":        "Mini cluster made of two servers",
+}
+
+func installationSizeListItems(sizes []string) []model.AutocompleteListItem {
+	suggestions := make([]model.AutocompleteListItem, 0, len(sizes))
+	for _, size := range sizes {
+		suggestions = append(suggestions, model.AutocompleteListItem{Item: size, HelpText: installationSizeDescriptions[size]})
+	}
+	return suggestions
+}
+
+func testDataProfileListItems(profiles []TestDataProfile) []model.AutocompleteListItem {
+	suggestions := make([]model.AutocompleteListItem, 0, len(profiles))
+	for _, profile := range profiles {
+		suggestions = append(suggestions, model.AutocompleteListItem{Item: profile.Name, HelpText: profile.describe()})
+	}
+	return suggestions
+}
+
+func imageListItems(images []string) []model.AutocompleteListItem {
+	suggestions := make([]model.AutocompleteListItem, 0, len(images))
+	for _, image := range images {
+		suggestions = append(suggestions, model.AutocompleteListItem{Item: image})
+	}
+	return suggestions
+}
+
 func getCommandResponse(responseType, text string, args *model.CommandArgs) *model.CommandResponse {
 	return &model.CommandResponse{
 		ResponseType: responseType,
@@ -548,6 +952,10 @@ func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*mo
 	switch command {
 	case "create":
 		handler = p.runCreateCommand
+	case "create-matrix":
+		handler = p.runCreateMatrixCommand
+	case "clone":
+		handler = p.runCloneCommand
 	case "mmcli":
 		handler = p.runMattermostCLICommand
 	case "mmctl":
@@ -568,6 +976,16 @@ func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*mo
 		handler = p.runWakeUpCommand
 	case "delete":
 		handler = p.runDeleteCommand
+	case "extend":
+		handler = p.runExtendCommand
+	case "restore":
+		handler = p.runRestoreCommand
+	case "preset":
+		handler = p.runPresetCommand
+	case "versions":
+		handler = p.runVersionsCommand
+	case "history":
+		handler = p.runHistoryCommand
 	case "status":
 		handler = p.runStatusCommand
 	case "info":
@@ -582,6 +1000,12 @@ func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*mo
 		handler = p.runDeletionLockCommand
 	case "deletion-unlock":
 		handler = p.runDeletionUnlockCommand
+	case "setup":
+		handler = p.runSetupCommand
+	case "credentials":
+		handler = p.runCredentialsCommand
+	case "admin":
+		handler = p.runAdminCommand
 	}
 
 	if handler == nil {
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+func (p *Plugin) runAdminCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	if !p.API.HasPermissionTo(extra.UserId, model.PermissionManageSystem) {
+		return nil, true, errors.New("the admin commands can only be run by system administrators")
+	}
+
+	if len(args) == 0 || len(args[0]) == 0 {
+		return nil, true, errors.New("must provide an admin subcommand")
+	}
+
+	switch args[0] {
+	case "migrations":
+		return p.runAdminMigrationsCommand(args[1:], extra)
+	}
+
+	return nil, true, errors.Errorf("unknown admin subcommand %s", args[0])
+}
+
+func (p *Plugin) runAdminMigrationsCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	version, err := p.getSchemaVersion()
+	if err != nil {
+		return nil, false, err
+	}
+
+	resp := fmt.Sprintf("KV schema version: %d (latest: %d)\n\n", version, latestSchemaVersion())
+	resp += "| Version | Migration | Status |\n| -- | -- | -- |\n"
+	for _, migration := range schemaMigrations {
+		status := "pending"
+		if migration.version <= version {
+			status = "applied"
+		}
+		resp += fmt.Sprintf("| %d | %s | %s |\n", migration.version, migration.description, status)
+	}
+
+	return getCommandResponse(model.CommandResponseTypeEphemeral, resp, extra), false, nil
+}
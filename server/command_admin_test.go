@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminCommand(t *testing.T) {
+	plugin, api, kv := newInstallationStoreTestPlugin()
+	api.On("HasPermissionTo", "adminid", model.PermissionManageSystem).Return(true)
+	api.On("HasPermissionTo", "userid", model.PermissionManageSystem).Return(false)
+
+	t.Run("non admin", func(t *testing.T) {
+		resp, isUserError, err := plugin.runAdminCommand([]string{"migrations"}, &model.CommandArgs{UserId: "userid"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "system administrators")
+		assert.True(t, isUserError)
+		assert.Nil(t, resp)
+	})
+
+	t.Run("no subcommand", func(t *testing.T) {
+		resp, isUserError, err := plugin.runAdminCommand([]string{}, &model.CommandArgs{UserId: "adminid"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "must provide an admin subcommand")
+		assert.True(t, isUserError)
+		assert.Nil(t, resp)
+	})
+
+	t.Run("unknown subcommand", func(t *testing.T) {
+		resp, isUserError, err := plugin.runAdminCommand([]string{"bogus"}, &model.CommandArgs{UserId: "adminid"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unknown admin subcommand bogus")
+		assert.True(t, isUserError)
+		assert.Nil(t, resp)
+	})
+
+	t.Run("migrations before migrating", func(t *testing.T) {
+		kv.reset()
+
+		resp, isUserError, err := plugin.runAdminCommand([]string{"migrations"}, &model.CommandArgs{UserId: "adminid"})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "KV schema version: 0")
+		assert.Contains(t, resp.Text, "| 1 | Move installations from the legacy blob to per-installation records | pending |")
+	})
+
+	t.Run("migrations after migrating", func(t *testing.T) {
+		kv.reset()
+		require.NoError(t, plugin.runSchemaMigrations())
+
+		resp, isUserError, err := plugin.runAdminCommand([]string{"migrations"}, &model.CommandArgs{UserId: "adminid"})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "KV schema version: 1 (latest: 1)")
+		assert.NotContains(t, resp.Text, "pending")
+	})
+}
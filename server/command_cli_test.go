@@ -18,7 +18,7 @@ func TestMattermostCLICommand(t *testing.T) {
 	plugin := Plugin{cloudClient: mockedCloudClient}
 
 	api := &plugintest.API{}
-	api.On("KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(true, nil)
+	kv := newFakeKVStore(api)
 	api.On("SendEphemeralPost", mock.AnythingOfType("string"), mock.Anything).Return(nil)
 	plugin.SetAPI(api)
 
@@ -28,7 +28,7 @@ func TestMattermostCLICommand(t *testing.T) {
 	mockedCloudClient.mockedCloudClusterInstallations = []*cloud.ClusterInstallation{ci1}
 
 	t.Run("run command successfully", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 
 		resp, isUserError, err := plugin.runMattermostCLICommand([]string{"gabesinstall", "version"}, &model.CommandArgs{UserId: "gabeid"})
 		require.NoError(t, err)
@@ -37,7 +37,7 @@ func TestMattermostCLICommand(t *testing.T) {
 	})
 
 	t.Run("run command successfully with caps in name to show name is case insensitive", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 
 		resp, isUserError, err := plugin.runMattermostCLICommand([]string{"GabesInstall", "version"}, &model.CommandArgs{UserId: "gabeid"})
 		require.NoError(t, err)
@@ -60,7 +60,7 @@ func TestMattermostCLICommand(t *testing.T) {
 	})
 
 	t.Run("no mattermost subcommand", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 
 		resp, isUserError, err := plugin.runMattermostCLICommand([]string{"gabesinstall"}, &model.CommandArgs{UserId: "gabeid"})
 		require.Error(t, err)
@@ -70,7 +70,7 @@ func TestMattermostCLICommand(t *testing.T) {
 	})
 
 	t.Run("no installations", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
+		kv.reset()
 
 		resp, isUserError, err := plugin.runMattermostCLICommand([]string{"gabesinstall2", "version"}, &model.CommandArgs{UserId: "gabeid2"})
 		require.Error(t, err)
@@ -80,7 +80,7 @@ func TestMattermostCLICommand(t *testing.T) {
 	})
 
 	t.Run("no cluster installations", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 		mockedCloudClient.mockedCloudClusterInstallations = []*cloud.ClusterInstallation{}
 
 		resp, isUserError, err := plugin.runMattermostCLICommand([]string{"gabesinstall", "version"}, &model.CommandArgs{UserId: "gabeid"})
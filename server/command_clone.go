@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+	flag "github.com/spf13/pflag"
+)
+
+func (p *Plugin) getCloneFlagSet() *flag.FlagSet {
+	cloneFlagSet := flag.NewFlagSet("clone", flag.ContinueOnError)
+	p.addCreateOptionFlags(cloneFlagSet)
+	return cloneFlagSet
+}
+
+func (p *Plugin) runCloneCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	if len(args) < 2 || args[0] == "" || args[1] == "" || strings.HasPrefix(args[0], "--") || strings.HasPrefix(args[1], "--") {
+		return nil, true, errors.New("must provide the name of the installation to clone and a name for the new installation")
+	}
+
+	cloneFlagSet := p.getCloneFlagSet()
+	if err := cloneFlagSet.Parse(args); err != nil {
+		return nil, true, err
+	}
+
+	input, err := createInstallationInputFromFlags(cloneFlagSet)
+	if err != nil {
+		return nil, true, err
+	}
+	input.Name = args[1]
+
+	install, droppedConfig, err := p.cloneInstallationForUser(extra.UserId, InstallationRef{Name: args[0]}, input)
+	if err != nil {
+		if isCreateUserError(err) || isCloneUserError(err) {
+			return nil, true, err
+		}
+		return nil, false, err
+	}
+
+	install = sanitizeInstallationCopy(install)
+
+	message := "Installation being created from " + standardizeName(args[0]) + ". You will receive a notification when it is ready. Use `/cloud list` to check on the status of your installations."
+	if len(droppedConfig) > 0 {
+		message += fmt.Sprintf("\n\nThe config overrides of %s were not copied as the installation belongs to another user. Set them with `--config` if needed.", strings.Join(droppedConfig, ", "))
+	}
+
+	return getCommandResponse(model.CommandResponseTypeEphemeral, message+"\n\n"+jsonCodeBlock(install.ToPrettyJSON()), extra), false, nil
+}
+
+func isCloneUserError(err error) bool {
+	errText := err.Error()
+	return strings.Contains(errText, "no installation with the name") ||
+		strings.Contains(errText, "unable to determine the version tag of installation") ||
+		strings.Contains(errText, "unable to determine the license option of installation")
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+
+	cloud "github.com/mattermost/mattermost-cloud/model"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloneCommand(t *testing.T) {
+	source := serviceTestInstall("source-id", "Source", "userid")
+	source.PriorityEnv = cloud.EnvVarMap{"MM_SECRET": cloud.EnvVar{Value: "secret-value"}}
+
+	t.Run("clones with flag overrides and hides env values", func(t *testing.T) {
+		plugin, cloudClient, _ := newServiceTestPlugin(t, []*Installation{source})
+
+		resp, isUserError, err := plugin.runCloneCommand([]string{"source", "copy", "--size", "miniHA"}, &model.CommandArgs{UserId: "userid"})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "Installation being created from source.")
+		assert.NotContains(t, resp.Text, "secret-value")
+		require.NotNil(t, cloudClient.creationRequest)
+		assert.Equal(t, "miniHA", cloudClient.creationRequest.Size)
+		assert.Equal(t, "9.4.0", cloudClient.creationRequest.Version)
+		assert.Equal(t, cloud.EnvVar{Value: "secret-value"}, cloudClient.creationRequest.PriorityEnv["MM_SECRET"])
+	})
+
+	t.Run("reports the sensitive config overrides not copied from a shared installation", func(t *testing.T) {
+		shared := serviceTestInstall("shared-id", "Shared", "other")
+		shared.Shared = true
+		shared.ConfigOverrides = map[string]string{"SqlSettings.DataSource": "postgres://secret-dsn"}
+		plugin, _, _ := newServiceTestPlugin(t, []*Installation{shared})
+
+		resp, isUserError, err := plugin.runCloneCommand([]string{"shared", "copy"}, &model.CommandArgs{UserId: "userid"})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "The config overrides of SqlSettings.DataSource were not copied as the installation belongs to another user.")
+		assert.NotContains(t, resp.Text, "secret-dsn")
+	})
+
+	t.Run("missing names", func(t *testing.T) {
+		plugin, _, _ := newServiceTestPlugin(t, []*Installation{source})
+
+		for _, args := range [][]string{{}, {"source"}, {"source", "--size", "miniHA"}} {
+			resp, isUserError, err := plugin.runCloneCommand(args, &model.CommandArgs{UserId: "userid"})
+			require.EqualError(t, err, "must provide the name of the installation to clone and a name for the new installation")
+			assert.True(t, isUserError)
+			assert.Nil(t, resp)
+		}
+	})
+
+	t.Run("unknown source", func(t *testing.T) {
+		plugin, _, _ := newServiceTestPlugin(t, []*Installation{source})
+
+		resp, isUserError, err := plugin.runCloneCommand([]string{"missing", "copy"}, &model.CommandArgs{UserId: "userid"})
+		require.EqualError(t, err, "no installation with the name missing found")
+		assert.True(t, isUserError)
+		assert.Nil(t, resp)
+	})
+
+	t.Run("presets are not accepted", func(t *testing.T) {
+		plugin, _, _ := newServiceTestPlugin(t, []*Installation{source})
+
+		_, isUserError, err := plugin.runCloneCommand([]string{"source", "copy", "--preset", "loadtest"}, &model.CommandArgs{UserId: "userid"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unknown flag: --preset")
+		assert.True(t, isUserError)
+	})
+}
@@ -1,15 +1,10 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"regexp"
 	"strings"
-	"time"
 
-	"github.com/blang/semver/v4"
 	cloud "github.com/mattermost/mattermost-cloud/model"
 	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/pkg/errors"
@@ -23,14 +18,23 @@ const (
 
 var installationNameMatcher = regexp.MustCompile(`^[a-zA-Z0-9-]*$`)
 
-var validInstallationSizes = []string{"miniSingleton", "miniHA"}
+func (p *Plugin) getCreateFlagSet() *flag.FlagSet {
+	createFlagSet := flag.NewFlagSet("create", flag.ContinueOnError)
+	p.addCreateOptionFlags(createFlagSet)
+	createFlagSet.String("preset", "", "Name of a saved preset to apply. Flags set explicitly take precedence over the preset")
+	return createFlagSet
+}
 
-type latestMattermostVersionCache struct {
-	version   string
-	timestamp time.Time
+// getCreateCommandFlagSet returns the flags of the create command, which can
+// also preview the create without making it.
+func (p *Plugin) getCreateCommandFlagSet() *flag.FlagSet {
+	createFlagSet := p.getCreateFlagSet()
+	createFlagSet.Bool("dry-run", false, "Show the request that would be sent to the provisioner without creating the installation")
+	return createFlagSet
 }
 
-func (p *Plugin) getCreateFlagSet() *flag.FlagSet {
+// addCreateOptionFlags adds the flags configuring a new installation.
+func (p *Plugin) addCreateOptionFlags(createFlagSet *flag.FlagSet) {
 	config := p.getConfiguration()
 	defaultFileStore := config.DefaultFilestore
 	if defaultFileStore == "" {
@@ -41,17 +45,22 @@ func (p *Plugin) getCreateFlagSet() *flag.FlagSet {
 		defaultDatabase = cloud.InstallationDatabaseMultiTenantRDSPostgresPGBouncer
 	}
 
-	createFlagSet := flag.NewFlagSet("create", flag.ContinueOnError)
-	createFlagSet.String("size", "miniSingleton", "Size of the Mattermost installation e.g. 'miniSingleton' or 'miniHA'")
-	createFlagSet.String("version", "latest", "Mattermost version to run, e.g. '9.1.0'")
+	sizes := config.installationSizes()
+	createFlagSet.String("size", sizes[0], fmt.Sprintf("Size of the Mattermost installation. Can be %s", quotedList(sizes)))
+	createFlagSet.String("version", "latest", "Mattermost version to run, e.g. '9.1.0', '9.11.x', 'latest', 'latest-esr', 'latest-rc', 'master' or 'pr-12345'")
 	createFlagSet.String("affinity", cloud.InstallationAffinityMultiTenant, "Whether the installation is isolated in it's own cluster or shares ones. Can be 'isolated' or 'multitenant'")
 	createFlagSet.String("license", licenseOptionEnterprise, "The Mattermost license to use. Can be 'enterprise', 'enterprise-advanced', 'professional', 'e20', 'e10', or 'te'")
 	createFlagSet.String("filestore", defaultFileStore, "Specify the backing file store. Can be 'bifrost' (S3 Shared Bucket), 'aws-multitenant-s3' (S3 Shared Bucket), 'aws-s3' (S3 Bucket).")
 	createFlagSet.String("database", defaultDatabase, "Specify the backing database. Can be 'aws-multitenant-rds-postgres-pgbouncer' (RDS Postgres with pgbouncer proxy connections), 'aws-rds' (RDS MySQL).")
 	createFlagSet.Bool("test-data", false, "Set to pre-load the server with test data")
-	createFlagSet.String("image", defaultImage, fmt.Sprintf("Docker image repository. Can be %s", strings.Join(dockerRepoWhitelist, ", ")))
+	createFlagSet.String("test-data-profile", "", fmt.Sprintf("Test data profile to pre-load the server with. Can be %s. Implies --test-data", quotedList(config.testDataProfileNames())))
+	createFlagSet.StringSlice("test-data-counts", []string{}, fmt.Sprintf("Test data counts replacing those of the profile in form: teams=2,users=50. Can be %s. Implies --test-data", strings.Join(validTestDataCounts, ", ")))
+	createFlagSet.StringSlice("plugins", []string{}, "Marketplace plugins to install and enable, optionally with a version, e.g. com.mattermost.plugin-jira@4.1.0,com.mattermost.calls")
+	createFlagSet.StringSlice("users", []string{}, fmt.Sprintf("Extra users to create in form username:role[:team1+team2], e.g. alice:user_manager:qa,ci:bot. Role can be %s", strings.Join(validSeedUserRoles, ", ")))
+	createFlagSet.String("image", defaultImage, fmt.Sprintf("Docker image repository. Can be %s", strings.Join(config.allowedImages(), ", ")))
 	createFlagSet.StringSlice("env", []string{}, "Environment variables in form: ENV1=test,ENV2=test")
-	return createFlagSet
+	createFlagSet.StringArray("config", []string{}, "Mattermost config setting to apply during setup in form: Section.Setting=value. Can be repeated")
+	createFlagSet.String("ttl", "", "Time until the installation is automatically deleted, e.g. '48h' or '7d'. Defaults to the plugin configuration")
 }
 
 func (p *Plugin) runCreateCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
@@ -59,10 +68,23 @@ func (p *Plugin) runCreateCommand(args []string, extra *model.CommandArgs) (*mod
 		return nil, true, errors.New("must provide an installation name")
 	}
 
-	input, err := p.createInstallationInputFromArgs(args)
+	createFlagSet := p.getCreateCommandFlagSet()
+	input, err := createInstallationInputFromArgs(createFlagSet, args)
 	if err != nil {
 		return nil, true, err
 	}
+	dryRun, err := createFlagSet.GetBool("dry-run")
+	if err != nil {
+		return nil, true, err
+	}
+
+	if dryRun {
+		result, previewErr := p.previewCreateInstallationForUser(extra.UserId, input)
+		if previewErr != nil {
+			return nil, isCreateUserError(previewErr), previewErr
+		}
+		return getCommandResponse(model.CommandResponseTypeEphemeral, dryRunResponseText(result), extra), false, nil
+	}
 
 	install, err := p.createInstallationForUser(extra.UserId, input)
 	if err != nil {
@@ -72,65 +94,117 @@ func (p *Plugin) runCreateCommand(args []string, extra *model.CommandArgs) (*mod
 		return nil, false, err
 	}
 
+	resolution := describeVersionResolution(install.versionSpec, install.Tag, install.Version)
 	install = sanitizeInstallationCopy(install)
 
-	return getCommandResponse(model.CommandResponseTypeEphemeral, "Installation being created. You will receive a notification when it is ready. Use `/cloud list` to check on the status of your installations.\n\n"+jsonCodeBlock(install.ToPrettyJSON()), extra), false, nil
+	return getCommandResponse(model.CommandResponseTypeEphemeral, "Installation being created. "+resolution+" You will receive a notification when it is ready. Use `/cloud list` to check on the status of your installations.\n\n"+jsonCodeBlock(install.ToPrettyJSON()), extra), false, nil
 }
 
-func (p *Plugin) createInstallationInputFromArgs(args []string) (CreateInstallationInput, error) {
+func createInstallationInputFromArgs(createFlagSet *flag.FlagSet, args []string) (CreateInstallationInput, error) {
 	if len(args) == 0 || args[0] == "" || strings.HasPrefix(args[0], "--") {
 		return CreateInstallationInput{}, errors.New("must provide an installation name")
 	}
 
-	createFlagSet := p.getCreateFlagSet()
 	if err := createFlagSet.Parse(args); err != nil {
 		return CreateInstallationInput{}, err
 	}
 
-	envVars, err := createFlagSet.GetStringSlice("env")
+	input, err := createInstallationInputFromFlags(createFlagSet)
 	if err != nil {
 		return CreateInstallationInput{}, err
 	}
-	envMap, err := parseEnvVarInput(envVars, nil)
-	if err != nil {
-		return CreateInstallationInput{}, err
+	input.Name = args[0]
+
+	return input, nil
+}
+
+// createInstallationInputFromFlags builds a create input from the flags that
+// were explicitly set. Unset options are left empty so they can be filled in
+// by a preset or the create defaults.
+func createInstallationInputFromFlags(createFlagSet *flag.FlagSet) (CreateInstallationInput, error) {
+	input := CreateInstallationInput{}
+
+	stringOptions := []struct {
+		flag  string
+		value *string
+	}{
+		{"size", &input.Size},
+		{"version", &input.Version},
+		{"affinity", &input.Affinity},
+		{"license", &input.License},
+		{"image", &input.Image},
+		{"database", &input.Database},
+		{"filestore", &input.Filestore},
+		{"preset", &input.Preset},
+		{"ttl", &input.TTL},
+		{"test-data-profile", &input.TestDataProfile},
+	}
+	for _, option := range stringOptions {
+		if !createFlagSet.Changed(option.flag) {
+			continue
+		}
+		value, err := createFlagSet.GetString(option.flag)
+		if err != nil {
+			return CreateInstallationInput{}, err
+		}
+		*option.value = value
 	}
 
-	input := CreateInstallationInput{Name: args[0], Env: map[string]string{}}
-	input.Size, err = createFlagSet.GetString("size")
+	if createFlagSet.Changed("test-data") {
+		testData, err := createFlagSet.GetBool("test-data")
+		if err != nil {
+			return CreateInstallationInput{}, err
+		}
+		input.TestData = NewBool(testData)
+	}
+
+	testDataCounts, err := createFlagSet.GetStringSlice("test-data-counts")
 	if err != nil {
 		return CreateInstallationInput{}, err
 	}
-	input.Version, err = createFlagSet.GetString("version")
+	input.TestDataCounts, err = parseTestDataCounts(testDataCounts)
 	if err != nil {
 		return CreateInstallationInput{}, err
 	}
-	input.Affinity, err = createFlagSet.GetString("affinity")
+
+	plugins, err := createFlagSet.GetStringSlice("plugins")
 	if err != nil {
 		return CreateInstallationInput{}, err
 	}
-	input.License, err = createFlagSet.GetString("license")
+	if len(plugins) > 0 {
+		input.Plugins = plugins
+	}
+
+	users, err := createFlagSet.GetStringSlice("users")
 	if err != nil {
 		return CreateInstallationInput{}, err
 	}
-	input.Image, err = createFlagSet.GetString("image")
+	if len(users) > 0 {
+		input.Users = users
+	}
+
+	configOverrides, err := createFlagSet.GetStringArray("config")
 	if err != nil {
 		return CreateInstallationInput{}, err
 	}
-	input.Database, err = createFlagSet.GetString("database")
+	input.Config, err = parseConfigOverrides(configOverrides)
 	if err != nil {
 		return CreateInstallationInput{}, err
 	}
-	input.Filestore, err = createFlagSet.GetString("filestore")
+
+	envVars, err := createFlagSet.GetStringSlice("env")
 	if err != nil {
 		return CreateInstallationInput{}, err
 	}
-	input.TestData, err = createFlagSet.GetBool("test-data")
+	envMap, err := parseEnvVarInput(envVars, nil)
 	if err != nil {
 		return CreateInstallationInput{}, err
 	}
-	for key, env := range envMap {
-		input.Env[key] = env.Value
+	if len(envMap) > 0 {
+		input.Env = make(map[string]string, len(envMap))
+		for key, env := range envMap {
+			input.Env[key] = env.Value
+		}
 	}
 
 	return input, nil
@@ -142,113 +216,54 @@ func isCreateUserError(err error) bool {
 		strings.Contains(errText, "is invalid: only letters, numbers, and hyphens are permitted") ||
 		strings.Contains(errText, "already exists") ||
 		strings.Contains(errText, "Invalid version number") ||
+		strings.Contains(errText, "no release matching version") ||
 		strings.Contains(errText, "is not a valid docker tag") ||
+		strings.Contains(errText, registryUnavailable) ||
+		strings.Contains(errText, noPlatformImage) ||
 		strings.Contains(errText, "Invalid size:") ||
 		strings.Contains(errText, "invalid affinity option") ||
 		strings.Contains(errText, "invalid license option") ||
 		strings.Contains(errText, "invalid image name") ||
+		strings.Contains(errText, "invalid plugin") ||
+		strings.Contains(errText, "invalid user") ||
+		strings.Contains(errText, "invalid test data") ||
+		strings.Contains(errText, "invalid config override") ||
 		strings.Contains(errText, "invalid database option") ||
 		strings.Contains(errText, "invalid filestore option") ||
 		strings.Contains(errText, "requires license option") ||
 		strings.Contains(errText, "valid env format") ||
-		strings.Contains(errText, "defined more than once")
+		strings.Contains(errText, "defined more than once") ||
+		strings.Contains(errText, "no preset with the name") ||
+		strings.Contains(errText, "invalid duration") ||
+		strings.Contains(errText, "exceeds the maximum of")
 }
 
 // installationWithNameExists returns true when there already exists an installation with name "name"
 func (p *Plugin) installationWithNameExists(name string) (bool, error) {
-	existing, _, err := p.getInstallations()
-	if err != nil {
-		return false, errors.Wrap(err, "trouble looking up existing installations")
+	installationID, appErr := p.API.KVGet(nameIndexKey(name))
+	if appErr != nil {
+		return false, errors.Wrap(appErr, "trouble looking up existing installations")
 	}
 
-	for _, i := range existing {
-		// FIXME standardizing these here really shouldn't be necessary if everything is stored in the correct format, but better safe than sorry until we can find a better approach
-		if standardizeName(name) == standardizeName(i.Name) {
-			return true, nil
-		}
-	}
-
-	return false, nil
+	return installationID != nil, nil
 }
 
-func validImageName(imageName string) bool {
-	for _, image := range dockerRepoWhitelist {
-		if image == imageName {
-			return true
-		}
-	}
-	return false
+// validImageName returns true when the image is one of the configured docker
+// repositories.
+func (p *Plugin) validImageName(imageName string) bool {
+	return Contains(p.getConfiguration().allowedImages(), imageName)
 }
 
-type githubReleaseMetadata struct {
-	TagName string `json:"tag_name"`
+// validInstallationSize returns true when the size is one of the configured
+// installation sizes.
+func (p *Plugin) validInstallationSize(size string) bool {
+	return Contains(p.getConfiguration().installationSizes(), size)
 }
 
-func (p *Plugin) githubLatestVersion() (string, error) {
-	// avoids Github rate limiting for unauthenticated requests
-	if p.latestMattermostVersion != nil &&
-		p.latestMattermostVersion.version != "" &&
-		p.latestMattermostVersion.timestamp.After(time.Now().Add(time.Minute*time.Duration(-5))) {
-		return p.latestMattermostVersion.version, nil
-	}
-
-	// else version is more than five minutes old or doesn't exist, so get it from Github
-	// use the releases endpoint and not releases/latest to avoid getting a dot release
-	resp, err := http.Get("https://api.github.com/repos/mattermost/mattermost-server/releases")
-	if err != nil {
-		return "", errors.Wrap(err, "failed to find latest release from GitHub")
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", errors.Errorf("got unexpected status code %d while determining latest release from GitHub", resp.StatusCode)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", errors.Wrap(err, "failed to read response body")
-	}
-
-	grm := []githubReleaseMetadata{}
-	err = json.Unmarshal(body, &grm)
-	if err != nil {
-		return "", errors.Wrap(err, "failed to unmarshal JSON from GitHub to determine latest release")
-	}
-
-	var (
-		latestTag        string
-		latestTagVersion semver.Version
-	)
-
-	for _, release := range grm {
-		if release.TagName == "" {
-			continue
-		}
-		currentTag := strings.TrimPrefix(release.TagName, "v")
-		currentTagVersion, err := semver.Parse(currentTag)
-		if err != nil {
-			p.API.LogError(err.Error())
-			continue
-		}
-
-		if latestTag == "" || currentTagVersion.GE(latestTagVersion) {
-			latestTag = currentTag
-			latestTagVersion = currentTagVersion
-			continue
-		}
-	}
-
-	if latestTag == "" {
-		return "", errors.New("failed to determine latest version of Mattermost")
-	}
-
-	p.latestMattermostVersion =
-		&latestMattermostVersionCache{
-			timestamp: time.Now(),
-			version:   latestTag,
-		}
-
-	return latestTag, nil
+// invalidImageNameError returns the error reported for an image which is not
+// one of the configured docker repositories.
+func (p *Plugin) invalidImageNameError(imageName string) error {
+	return errors.Errorf("invalid image name %s, valid options are %s", imageName, strings.Join(p.getConfiguration().allowedImages(), ", "))
 }
 
 func parseEnvVarInput(rawInput []string, clearEnvs []string) (cloud.EnvVarMap, error) {
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+	flag "github.com/spf13/pflag"
+)
+
+func (p *Plugin) getCreateMatrixFlagSet() *flag.FlagSet {
+	matrixFlagSet := p.getCreateFlagSet()
+	matrixFlagSet.StringSlice("versions", []string{}, fmt.Sprintf("Mattermost versions to create an installation for, e.g. '9.11.0,10.2.0,latest'. At most %d", maxMatrixInstallations))
+	return matrixFlagSet
+}
+
+func (p *Plugin) runCreateMatrixCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	if len(args) == 0 || args[0] == "" || strings.HasPrefix(args[0], "--") {
+		return nil, true, errors.New("must provide an installation name prefix")
+	}
+
+	matrixFlagSet := p.getCreateMatrixFlagSet()
+	if err := matrixFlagSet.Parse(args); err != nil {
+		return nil, true, err
+	}
+	if matrixFlagSet.Changed("version") {
+		return nil, true, errors.New("use --versions to choose the versions of the matrix")
+	}
+
+	versions, err := matrixFlagSet.GetStringSlice("versions")
+	if err != nil {
+		return nil, true, err
+	}
+	options, err := createInstallationInputFromFlags(matrixFlagSet)
+	if err != nil {
+		return nil, true, err
+	}
+
+	results, err := p.createInstallationMatrixForUser(extra.UserId, CreateInstallationMatrixInput{
+		Prefix:   args[0],
+		Versions: versions,
+		Options:  options,
+	})
+	if err != nil {
+		if isCreateUserError(err) || isCreateMatrixUserError(err) {
+			return nil, true, err
+		}
+		return nil, false, err
+	}
+
+	resp := "Installations being created. You will receive a notification when each one is ready. Use `/cloud list` to check on the status of your installations.\n\n"
+	resp += "| Version | Installation | Result |\n| -- | -- | -- |\n"
+	for _, result := range results {
+		resp += fmt.Sprintf("| %s | %s | creation requested |\n", result.Version, result.Name)
+	}
+
+	return getCommandResponse(model.CommandResponseTypeEphemeral, resp, extra), false, nil
+}
+
+func isCreateMatrixUserError(err error) bool {
+	errText := err.Error()
+	return strings.Contains(errText, "no installations were created") ||
+		strings.Contains(errText, "must provide an installation name prefix") ||
+		strings.Contains(errText, "must be set with versions") ||
+		strings.Contains(errText, "must provide at least one version") ||
+		strings.Contains(errText, "a matrix can create at most") ||
+		strings.Contains(errText, "versions must not be empty") ||
+		strings.Contains(errText, "was requested more than once")
+}
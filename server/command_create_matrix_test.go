@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateMatrixCommand(t *testing.T) {
+	t.Run("reports each installation in one response", func(t *testing.T) {
+		plugin, cloudClient, _ := newServiceTestPlugin(t, nil)
+
+		resp, isUserError, err := plugin.runCreateMatrixCommand([]string{"upgrade", "--versions", "9.11.0,10.2.0", "--license", "e20"}, &model.CommandArgs{UserId: "userid"})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "| 9.11.0 | upgrade-9-11-0 | creation requested |")
+		assert.Contains(t, resp.Text, "| 10.2.0 | upgrade-10-2-0 | creation requested |")
+		require.Len(t, cloudClient.creationRequests, 2)
+		assert.Equal(t, "e20-license", cloudClient.creationRequests[1].License)
+	})
+
+	t.Run("invalid versions are user errors", func(t *testing.T) {
+		plugin, cloudClient, _ := newServiceTestPlugin(t, nil)
+		plugin.dockerClient = &MockedDockerClient{tagExists: true, invalidTags: []string{"10.99.0"}}
+
+		resp, isUserError, err := plugin.runCreateMatrixCommand([]string{"upgrade", "--versions", "9.11.0,10.99.0"}, &model.CommandArgs{UserId: "userid"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no installations were created")
+		assert.True(t, isUserError)
+		assert.Nil(t, resp)
+		assert.Empty(t, cloudClient.creationRequests)
+	})
+
+	t.Run("version flag is rejected", func(t *testing.T) {
+		plugin, _, _ := newServiceTestPlugin(t, nil)
+
+		_, isUserError, err := plugin.runCreateMatrixCommand([]string{"upgrade", "--version", "9.11.0"}, &model.CommandArgs{UserId: "userid"})
+		require.EqualError(t, err, "use --versions to choose the versions of the matrix")
+		assert.True(t, isUserError)
+	})
+
+	t.Run("missing prefix", func(t *testing.T) {
+		plugin, _, _ := newServiceTestPlugin(t, nil)
+
+		_, isUserError, err := plugin.runCreateMatrixCommand([]string{"--versions", "9.11.0"}, &model.CommandArgs{UserId: "userid"})
+		require.EqualError(t, err, "must provide an installation name prefix")
+		assert.True(t, isUserError)
+	})
+}
@@ -30,7 +30,7 @@ func TestCreateCommand(t *testing.T) {
 	plugin.SetAPI(api)
 
 	t.Run("ensure latest version lookup routine still works", func(t *testing.T) {
-		latest, err := plugin.githubLatestVersion()
+		latest, err := plugin.latestRelease()
 		require.NoError(t, err)
 		assert.NotEmpty(t, latest)
 		_, err = semver.Parse(latest)
@@ -303,6 +303,21 @@ func TestCreateCommand(t *testing.T) {
 		})
 	})
 
+	t.Run("config overrides", func(t *testing.T) {
+		t.Run("valid config overrides", func(t *testing.T) {
+			resp, isUserError, err := plugin.runCreateCommand([]string{"test", "--version", "5.30.0", "--config", "ServiceSettings.TrustedProxyIPHeader=X-Forwarded-For,X-Real-IP", "--config", "TeamSettings.MaxUsersPerTeam=100"}, &model.CommandArgs{})
+			require.NoError(t, err)
+			assert.False(t, isUserError)
+			assert.Contains(t, resp.Text, "\"ServiceSettings.TrustedProxyIPHeader\": \"X-Forwarded-For,X-Real-IP\"")
+			assert.Contains(t, resp.Text, "\"TeamSettings.MaxUsersPerTeam\": \"100\"")
+		})
+		t.Run("invalid config overrides", func(t *testing.T) {
+			_, isUserError, err := plugin.runCreateCommand([]string{"test", "--version", "5.30.0", "--config", "TeamSettings.MaxUsersPerTeam=many"}, &model.CommandArgs{})
+			require.EqualError(t, err, "invalid config override TeamSettings.MaxUsersPerTeam=many: TeamSettings.MaxUsersPerTeam must be a whole number")
+			assert.True(t, isUserError)
+		})
+	})
+
 	t.Run("installation lookup failures are internal errors", func(t *testing.T) {
 		lookupFailurePlugin := Plugin{
 			cloudClient:             &MockClient{},
@@ -377,3 +392,28 @@ func TestCreateCommand(t *testing.T) {
 		require.Zero(t, mockCloudClient.creationRequest.ScheduledDeletionTime)
 	})
 }
+
+func TestCreateCommandDryRun(t *testing.T) {
+	plugin, cloudClient, _ := newServiceTestPlugin(t, nil)
+	plugin.configuration.E20License = "raw-license-value"
+
+	t.Run("shows the request without creating", func(t *testing.T) {
+		resp, isUserError, err := plugin.runCreateCommand([]string{"preview", "--license", "e20", "--env", "MM_SECRET=env-secret-value", "--dry-run"}, &model.CommandArgs{UserId: "owner"})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "Dry run: installation preview was not created.")
+		assert.Contains(t, resp.Text, "This request would be sent to the provisioner")
+		assert.Contains(t, resp.Text, `"Name": "preview"`)
+		assert.NotContains(t, resp.Text, "raw-license-value")
+		assert.NotContains(t, resp.Text, "env-secret-value")
+		assert.Nil(t, cloudClient.creationRequest)
+	})
+
+	t.Run("invalid options are user errors", func(t *testing.T) {
+		resp, isUserError, err := plugin.runCreateCommand([]string{"preview", "--size", "huge", "--dry-run"}, &model.CommandArgs{UserId: "owner"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "Invalid size: huge")
+		assert.True(t, isUserError)
+		assert.Nil(t, resp)
+	})
+}
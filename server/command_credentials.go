@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+func (p *Plugin) runCredentialsCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	if len(args) == 0 || len(args[0]) == 0 {
+		return nil, true, errors.New("must provide an installation name")
+	}
+
+	action := p.sendInstallationCredentialsForUser
+	if args[0] == "rotate" {
+		action = p.rotateInstallationCredentialsForUser
+		args = args[1:]
+		if len(args) == 0 || len(args[0]) == 0 {
+			return nil, true, errors.New("must provide an installation name")
+		}
+	}
+
+	result, err := action(extra.UserId, InstallationRef{Name: standardizeName(args[0])})
+	if err != nil {
+		if isCredentialsUserError(err) {
+			return nil, true, err
+		}
+		return nil, false, err
+	}
+
+	return getCommandResponse(model.CommandResponseTypeEphemeral, result.Message, extra), false, nil
+}
+
+func isCredentialsUserError(err error) bool {
+	message := err.Error()
+	return strings.Contains(message, "no installation with the name") ||
+		strings.Contains(message, "no credentials are stored") ||
+		strings.Contains(message, "encryption key") ||
+		strings.Contains(message, "to rotate its credentials") ||
+		strings.Contains(message, "once the setup completes")
+}
@@ -18,7 +18,7 @@ func TestGetDebugPacketCommand(t *testing.T) {
 	plugin := Plugin{cloudClient: mockedCloudClient}
 
 	api := &plugintest.API{}
-	api.On("KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(true, nil)
+	kv := newFakeKVStore(api)
 	api.On("GetDirectChannel", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(&model.Channel{}, nil)
 	api.On("UploadFile", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(&model.FileInfo{}, nil)
 	api.On("CreatePost", mock.Anything).Return(&model.Post{}, nil)
@@ -31,7 +31,7 @@ func TestGetDebugPacketCommand(t *testing.T) {
 	mockedCloudClient.mockedCloudClusterInstallations = []*cloud.ClusterInstallation{ci1}
 
 	t.Run("run command successfully", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 
 		resp, isUserError, err := plugin.runGetDebugPacketCommand([]string{"gabesinstall"}, &model.CommandArgs{UserId: "gabeid"})
 		require.NoError(t, err)
@@ -40,7 +40,7 @@ func TestGetDebugPacketCommand(t *testing.T) {
 	})
 
 	t.Run("run command successfully with caps in name to show name is case insensitive", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 
 		resp, isUserError, err := plugin.runGetDebugPacketCommand([]string{"GabesInstall"}, &model.CommandArgs{UserId: "gabeid"})
 		require.NoError(t, err)
@@ -57,7 +57,7 @@ func TestGetDebugPacketCommand(t *testing.T) {
 	})
 
 	t.Run("no installations", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
+		kv.reset()
 
 		resp, isUserError, err := plugin.runGetDebugPacketCommand([]string{"gabesinstall2"}, &model.CommandArgs{UserId: "gabeid2"})
 		require.Error(t, err)
@@ -67,7 +67,7 @@ func TestGetDebugPacketCommand(t *testing.T) {
 	})
 
 	t.Run("no cluster installations", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 		mockedCloudClient.mockedCloudClusterInstallations = []*cloud.ClusterInstallation{}
 
 		resp, isUserError, err := plugin.runGetDebugPacketCommand([]string{"gabesinstall", "version"}, &model.CommandArgs{UserId: "gabeid"})
@@ -8,7 +8,6 @@ import (
 	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
 
 	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
 
@@ -17,11 +16,11 @@ func TestDeleteCommand(t *testing.T) {
 	plugin.cloudClient = &MockClient{}
 
 	api := &plugintest.API{}
-	api.On("KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(true, nil)
+	kv := newFakeKVStore(api)
 	plugin.SetAPI(api)
 
 	t.Run("delete installation successfully", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"))
 
 		resp, isUserError, err := plugin.runDeleteCommand([]string{"joramsinstall"}, &model.CommandArgs{UserId: "joramid"})
 		require.Nil(t, err)
@@ -30,7 +29,7 @@ func TestDeleteCommand(t *testing.T) {
 	})
 
 	t.Run("delete installation successfully with caps in name to demonstrate name case insensitivity", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"JoramsInstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"JoramsInstall\"}]"))
 
 		resp, isUserError, err := plugin.runDeleteCommand([]string{"joramsinstall"}, &model.CommandArgs{UserId: "joramid"})
 		require.Nil(t, err)
@@ -39,7 +38,7 @@ func TestDeleteCommand(t *testing.T) {
 	})
 
 	t.Run("don't delete with wrong owner", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"))
 
 		resp, isUserError, err := plugin.runDeleteCommand([]string{"joramsinstall"}, &model.CommandArgs{UserId: "joramid2"})
 		require.NotNil(t, err)
@@ -49,7 +48,7 @@ func TestDeleteCommand(t *testing.T) {
 	})
 
 	t.Run("no installations", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
+		kv.reset()
 
 		resp, isUserError, err := plugin.runDeleteCommand([]string{"joramsinstall"}, &model.CommandArgs{UserId: "joramid2"})
 		require.NotNil(t, err)
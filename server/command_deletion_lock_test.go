@@ -17,7 +17,7 @@ func TestRunDeletionLockCommand(t *testing.T) {
 	plugin.cloudClient = mockedCloudClient
 
 	api := &plugintest.API{}
-	api.On("KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(true, nil)
+	kv := newFakeKVStore(api)
 	api.On("LogWarn", mock.AnythingOfType("string")).Return(nil)
 	plugin.SetAPI(api)
 	t.Run("no installation name provided", func(t *testing.T) {
@@ -28,7 +28,7 @@ func TestRunDeletionLockCommand(t *testing.T) {
 	})
 
 	t.Run("Invalid config value", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"))
 
 		response, _, err := plugin.runDeletionLockCommand([]string{"joramsinstall"}, &model.CommandArgs{UserId: "joramid"})
 
@@ -40,7 +40,7 @@ func TestRunDeletionLockCommand(t *testing.T) {
 		plugin.configuration = &configuration{
 			DeletionLockInstallationsAllowedPerPerson: "0",
 		}
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"))
 
 		commandResponse, _, err := plugin.runDeletionLockCommand([]string{"joramsinstall"}, &model.CommandArgs{UserId: "joramid"})
 
@@ -53,7 +53,7 @@ func TestRunDeletionLockCommand(t *testing.T) {
 			DeletionLockInstallationsAllowedPerPerson: "1",
 		}
 		mockedCloudClient.lockedInstallationID = ""
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"))
 
 		commandResponse, _, err := plugin.runDeletionLockCommand([]string{"joramsinstall"}, &model.CommandArgs{UserId: "joramid"})
 
@@ -63,7 +63,7 @@ func TestRunDeletionLockCommand(t *testing.T) {
 	})
 
 	t.Run("no installation found with the given name", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
+		kv.reset()
 
 		response, _, err := plugin.runDeletionLockCommand([]string{"test_installation_name"}, &model.CommandArgs{UserId: "test_user_id"})
 
@@ -79,7 +79,7 @@ func TestLockForDeletion(t *testing.T) {
 	plugin.cloudClient = mockedCloudClient
 
 	api := &plugintest.API{}
-	api.On("KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(true, nil)
+	kv := newFakeKVStore(api)
 	api.On("LogWarn", mock.AnythingOfType("string")).Return(nil)
 	plugin.SetAPI(api)
 
@@ -90,7 +90,7 @@ func TestLockForDeletion(t *testing.T) {
 	})
 
 	t.Run("Invalid config value", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"))
 
 		err := plugin.lockForDeletion("someid", "joramid")
 
@@ -102,7 +102,7 @@ func TestLockForDeletion(t *testing.T) {
 		plugin.configuration = &configuration{
 			DeletionLockInstallationsAllowedPerPerson: "0",
 		}
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"))
 
 		err := plugin.lockForDeletion("someid", "joramid")
 
@@ -114,7 +114,7 @@ func TestLockForDeletion(t *testing.T) {
 	})
 
 	t.Run("No error", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"))
 
 		err := plugin.lockForDeletion("someid", "joramid")
 
@@ -122,7 +122,7 @@ func TestLockForDeletion(t *testing.T) {
 	})
 
 	t.Run("No installations to be locked", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"))
 
 		err := plugin.lockForDeletion("missingid", "joramid")
 
@@ -130,7 +130,7 @@ func TestLockForDeletion(t *testing.T) {
 	})
 
 	t.Run("No installations for provided User ID", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
+		kv.reset()
 
 		err := plugin.lockForDeletion("test_installation_id", "test_user_id")
 
@@ -145,7 +145,7 @@ func TestRunDeletionUnlockCommand(t *testing.T) {
 	plugin.cloudClient = mockedCloudClient
 
 	api := &plugintest.API{}
-	api.On("KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(true, nil)
+	kv := newFakeKVStore(api)
 	api.On("LogWarn", mock.AnythingOfType("string")).Return(nil)
 	plugin.SetAPI(api)
 	t.Run("no installation name provided", func(t *testing.T) {
@@ -160,7 +160,7 @@ func TestRunDeletionUnlockCommand(t *testing.T) {
 			DeletionLockInstallationsAllowedPerPerson: "1",
 		}
 		mockedCloudClient.unlockedInstallationID = ""
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"))
 
 		commandResponse, _, err := plugin.runDeletionUnlockCommand([]string{"joramsinstall"}, &model.CommandArgs{UserId: "joramid"})
 
@@ -170,7 +170,7 @@ func TestRunDeletionUnlockCommand(t *testing.T) {
 	})
 
 	t.Run("no installation found with the given name", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
+		kv.reset()
 
 		response, _, err := plugin.runDeletionUnlockCommand([]string{"test_installation_name"}, &model.CommandArgs{UserId: "test_user_id"})
 
@@ -186,7 +186,7 @@ func TestUnlockForDeletion(t *testing.T) {
 	plugin.cloudClient = mockedCloudClient
 
 	api := &plugintest.API{}
-	api.On("KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(true, nil)
+	kv := newFakeKVStore(api)
 	api.On("LogWarn", mock.AnythingOfType("string")).Return(nil)
 	plugin.SetAPI(api)
 
@@ -197,7 +197,7 @@ func TestUnlockForDeletion(t *testing.T) {
 	})
 
 	t.Run("No error", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"))
 
 		err := plugin.unlockForDeletion("someid", "joramid")
 
@@ -205,7 +205,7 @@ func TestUnlockForDeletion(t *testing.T) {
 	})
 
 	t.Run("No installations to be unlocked", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"))
 
 		err := plugin.unlockForDeletion("missingid", "joramid")
 
@@ -213,7 +213,7 @@ func TestUnlockForDeletion(t *testing.T) {
 	})
 
 	t.Run("No installations for provided User ID", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
+		kv.reset()
 
 		err := plugin.unlockForDeletion("test_installation_id", "test_user_id")
 
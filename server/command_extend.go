@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+	flag "github.com/spf13/pflag"
+)
+
+func getExtendFlagSet() *flag.FlagSet {
+	extendFlagSet := flag.NewFlagSet("extend", flag.ContinueOnError)
+	extendFlagSet.String("by", "", "How long to push back the scheduled deletion, e.g. '48h' or '7d'")
+	return extendFlagSet
+}
+
+// runExtendCommand pushes back the scheduled deletion of the provided installation.
+func (p *Plugin) runExtendCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	if len(args) == 0 || args[0] == "" || strings.HasPrefix(args[0], "--") {
+		return nil, true, errors.New("must provide an installation name")
+	}
+
+	extendFlagSet := getExtendFlagSet()
+	if err := extendFlagSet.Parse(args); err != nil {
+		return nil, true, err
+	}
+	by, err := extendFlagSet.GetString("by")
+	if err != nil {
+		return nil, true, err
+	}
+	if by == "" {
+		return nil, true, errors.New("must provide how long to extend the installation by with --by")
+	}
+
+	name := standardizeName(args[0])
+
+	result, err := p.extendInstallationForUser(extra.UserId, InstallationRef{Name: name}, by)
+	if err != nil {
+		if strings.Contains(err.Error(), "no installation with the name") ||
+			strings.Contains(err.Error(), "invalid duration") ||
+			strings.Contains(err.Error(), "is not scheduled for deletion") ||
+			strings.Contains(err.Error(), "exceeds the maximum of") {
+			return nil, true, err
+		}
+		return nil, false, err
+	}
+
+	return getCommandResponse(model.CommandResponseTypeEphemeral, fmt.Sprintf("Installation %s extended. %s Time remaining: %s.", name, result.Message, result.Installation.TimeRemaining), extra), false, nil
+}
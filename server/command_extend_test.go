@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtendCommand(t *testing.T) {
+	install := serviceTestInstall("someid", "joramsinstall", "joramid")
+	install.ScheduledDeletionTime = time.Now().Add(time.Hour).UnixMilli()
+
+	plugin, cloudClient, _ := newServiceTestPlugin(t, []*Installation{install})
+	cloudClient.mockedCloudInstallationsDTO = serviceDTOs(install)
+
+	t.Run("extend installation successfully", func(t *testing.T) {
+		resp, isUserError, err := plugin.runExtendCommand([]string{"JoramsInstall", "--by", "48h"}, &model.CommandArgs{UserId: "joramid"})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "Installation joramsinstall extended. Deletion scheduled for")
+		assert.Contains(t, resp.Text, "Time remaining: 2d")
+		assert.Equal(t, "someid", cloudClient.scheduledDeletionID)
+	})
+
+	t.Run("invalid duration", func(t *testing.T) {
+		resp, isUserError, err := plugin.runExtendCommand([]string{"joramsinstall", "--by", "soon"}, &model.CommandArgs{UserId: "joramid"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid duration soon")
+		assert.True(t, isUserError)
+		assert.Nil(t, resp)
+	})
+
+	t.Run("missing duration", func(t *testing.T) {
+		resp, isUserError, err := plugin.runExtendCommand([]string{"joramsinstall"}, &model.CommandArgs{UserId: "joramid"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "must provide how long to extend the installation by")
+		assert.True(t, isUserError)
+		assert.Nil(t, resp)
+	})
+
+	t.Run("don't extend with wrong owner", func(t *testing.T) {
+		resp, isUserError, err := plugin.runExtendCommand([]string{"joramsinstall", "--by", "1d"}, &model.CommandArgs{UserId: "joramid2"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no installation with the name joramsinstall found")
+		assert.True(t, isUserError)
+		assert.Nil(t, resp)
+	})
+
+	t.Run("no name provided", func(t *testing.T) {
+		resp, isUserError, err := plugin.runExtendCommand([]string{}, &model.CommandArgs{UserId: "joramid"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "must provide an installation name")
+		assert.True(t, isUserError)
+		assert.Nil(t, resp)
+	})
+}
@@ -18,12 +18,12 @@ func TestHibernateCommand(t *testing.T) {
 	plugin.cloudClient = mockedCloudClient
 
 	api := &plugintest.API{}
-	api.On("KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(true, nil)
+	kv := newFakeKVStore(api)
 	api.On("LogWarn", mock.AnythingOfType("string")).Return(nil)
 	plugin.SetAPI(api)
 
 	t.Run("hibernate installation successfully", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"))
 
 		resp, isUserError, err := plugin.runHibernateCommand([]string{"joramsinstall"}, &model.CommandArgs{UserId: "joramid"})
 		require.Nil(t, err)
@@ -32,7 +32,7 @@ func TestHibernateCommand(t *testing.T) {
 	})
 
 	t.Run("hibernate installation successfully with caps in name to demonstrate name case insensitivity", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"JoramsInstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"JoramsInstall\"}]"))
 
 		resp, isUserError, err := plugin.runHibernateCommand([]string{"joramsinstall"}, &model.CommandArgs{UserId: "joramid"})
 		require.Nil(t, err)
@@ -41,7 +41,7 @@ func TestHibernateCommand(t *testing.T) {
 	})
 
 	t.Run("no installations", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
+		kv.reset()
 
 		resp, isUserError, err := plugin.runHibernateCommand([]string{"joramsinstall"}, &model.CommandArgs{UserId: "joramid2"})
 		require.NotNil(t, err)
@@ -59,7 +59,7 @@ func TestHibernateCommand(t *testing.T) {
 	})
 
 	t.Run("installation is not stable", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"))
 		mockedCloudClient.overrideGetInstallationDTO = &cloud.InstallationDTO{Installation: &cloud.Installation{ID: "someid", OwnerID: "joramid", State: cloud.InstallationStateUpdateInProgress}}
 
 		resp, isUserError, err := plugin.runHibernateCommand([]string{"joramsinstall"}, &model.CommandArgs{UserId: "joramid"})
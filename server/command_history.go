@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	cloud "github.com/mattermost/mattermost-cloud/model"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+func (p *Plugin) runHistoryCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	if len(args) == 0 || len(args[0]) == 0 {
+		return nil, true, errors.New("must provide an installation name")
+	}
+
+	name := standardizeName(args[0])
+
+	install, events, err := p.getInstallationHistoryForUser(extra.UserId, InstallationRef{Name: name})
+	if err != nil {
+		if strings.Contains(err.Error(), "no installation with the name") {
+			return nil, true, err
+		}
+		return nil, false, err
+	}
+
+	if len(events) == 0 {
+		return getCommandResponse(model.CommandResponseTypeEphemeral, fmt.Sprintf("No history recorded for installation %s.", install.Name), extra), false, nil
+	}
+
+	actorNames := map[string]string{}
+	resp := fmt.Sprintf("History for installation %s:\n\n", install.Name)
+	resp += "| Time | Event | Actor | Details |\n| -- | -- | -- | -- |\n"
+	for _, event := range events {
+		actorName, ok := actorNames[event.ActorID]
+		if !ok {
+			actorName = p.historyActorName(event.ActorID)
+			actorNames[event.ActorID] = actorName
+		}
+
+		resp += fmt.Sprintf("| %s | %s | %s | %s |\n",
+			cloud.DateTimeStringFromMillis(event.Timestamp),
+			describeHistoryEvent(event),
+			actorName,
+			event.Details,
+		)
+	}
+
+	return getCommandResponse(model.CommandResponseTypeEphemeral, resp, extra), false, nil
+}
+
+func describeHistoryEvent(event InstallationHistoryEvent) string {
+	if event.Type == historyEventTypeStateChange {
+		return fmt.Sprintf("%s → %s", inlineCode(event.OldState), inlineCode(event.NewState))
+	}
+	return event.Action
+}
+
+// historyActorName returns a readable name for the actor of a history event.
+func (p *Plugin) historyActorName(actorID string) string {
+	if actorID == "" {
+		return ""
+	}
+	if actorID == p.getConfiguration().ProvisioningServerClientID {
+		return "provisioner"
+	}
+
+	user, appErr := p.API.GetUser(actorID)
+	if appErr != nil || user == nil {
+		return actorID
+	}
+	return "@" + user.Username
+}
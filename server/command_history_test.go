@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	cloud "github.com/mattermost/mattermost-cloud/model"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryCommand(t *testing.T) {
+	owned := serviceTestInstall("owned-id", "Owned", "owner")
+	shared := serviceTestInstall("shared-id", "Shared", "other")
+	shared.Shared = true
+	private := serviceTestInstall("private-id", "Private", "other")
+
+	plugin, _, api := newServiceTestPlugin(t, []*Installation{owned, shared, private})
+	plugin.configuration.ProvisioningServerClientID = "provisioner-client"
+	api.On("GetUser", "owner").Return(&model.User{Id: "owner", Username: "joram"}, nil)
+
+	require.NoError(t, plugin.appendInstallationHistory("owned-id", InstallationHistoryEvent{Type: historyEventTypeAction, Action: historyActionCreate, ActorID: "owner", Details: "version 9.4.0"}))
+	require.NoError(t, plugin.appendInstallationHistory("owned-id", InstallationHistoryEvent{Type: historyEventTypeStateChange, ActorID: "provisioner-client", OldState: cloud.InstallationStateUpdateInProgress, NewState: cloud.InstallationStateUpdateFailed}))
+
+	t.Run("owned installation", func(t *testing.T) {
+		resp, isUserError, err := plugin.runHistoryCommand([]string{"OWNED"}, &model.CommandArgs{UserId: "owner"})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "History for installation Owned")
+		assert.Contains(t, resp.Text, "| create | @joram | version 9.4.0 |")
+		assert.Contains(t, resp.Text, "`update-in-progress` → `update-failed` | provisioner |")
+	})
+
+	t.Run("shared installation without history", func(t *testing.T) {
+		resp, isUserError, err := plugin.runHistoryCommand([]string{"shared"}, &model.CommandArgs{UserId: "owner"})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "No history recorded for installation Shared.")
+	})
+
+	t.Run("installation of another user", func(t *testing.T) {
+		resp, isUserError, err := plugin.runHistoryCommand([]string{"private"}, &model.CommandArgs{UserId: "owner"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no installation with the name private found")
+		assert.True(t, isUserError)
+		assert.Nil(t, resp)
+	})
+
+	t.Run("no name provided", func(t *testing.T) {
+		resp, isUserError, err := plugin.runHistoryCommand([]string{}, &model.CommandArgs{UserId: "owner"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "must provide an installation name")
+		assert.True(t, isUserError)
+		assert.Nil(t, resp)
+	})
+}
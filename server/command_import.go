@@ -42,15 +42,12 @@ func (p *Plugin) runImportCommand(args []string, extra *model.CommandArgs) (*mod
 		return nil, true, errors.New("no installation for the DNS provided")
 	}
 
-	installs, _, err := p.getInstallations()
+	existing, _, err := p.getInstallationRecord(cloudInstall.ID)
 	if err != nil {
 		return nil, false, err
 	}
-
-	for _, install := range installs {
-		if install.ID == cloudInstall.ID {
-			return nil, true, errors.New("installation has already been imported to cloud plugin")
-		}
+	if existing != nil {
+		return nil, true, errors.New("installation has already been imported to cloud plugin")
 	}
 
 	if cloudInstall.OwnerID != extra.UserId {
@@ -72,6 +69,7 @@ func (p *Plugin) runImportCommand(args []string, extra *model.CommandArgs) (*mod
 	if err != nil {
 		return nil, false, errors.Wrap(err, "failed to store updated installation")
 	}
+	p.recordInstallationAction(pluginInstall.ID, extra.UserId, historyActionImport)
 	pluginInstall.HideSensitiveFields()
 
 	dataInstall, err := json.Marshal(pluginInstall)
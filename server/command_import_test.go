@@ -128,13 +128,13 @@ func TestInstallExist(t *testing.T) {
 	plugin.cloudClient = &MockClient{
 		overrideGetInstallationDTO: &cloud.InstallationDTO{Installation: &cloud.Installation{ID: "id1"}, DNSRecords: []*cloud.InstallationDNS{{DomainName: "installation-one.dev.cloud.mattermost.com"}}}}
 	api := &plugintest.API{}
+	kv := newFakeKVStore(api)
 	plugin.SetAPI(api)
 
 	t.Run("installation already imported", func(t *testing.T) {
 		_, installationBytes, err := getFakePluginInstallationsWithDNS()
 		require.NoError(t, err)
-		api.On("KVGet", mock.AnythingOfType("string")).Return(installationBytes, nil)
-		api.On("KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(true, nil)
+		kv.setInstallationsJSON(t, installationBytes)
 		api.On("LogWarn", mock.AnythingOfType("string")).Return(nil)
 
 		resp, isUserError, err := plugin.runImportCommand([]string{"installation-one.dev.cloud.mattermost.com"}, &model.CommandArgs{})
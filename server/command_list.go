@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 
 	cloud "github.com/mattermost/mattermost-cloud/model"
 	"github.com/mattermost/mattermost/server/public/model"
@@ -87,10 +88,16 @@ func marshalInstallationsList(installs []*Installation) ([]byte, error) {
 	if err = json.Unmarshal(data, &rawInstalls); err != nil {
 		return nil, err
 	}
-	for _, install := range rawInstalls {
+	now := time.Now()
+	for i, install := range rawInstalls {
 		delete(install, "License")
 		delete(install, "MattermostEnv")
 		delete(install, "PriorityEnv")
+		if installs[i] != nil && installs[i].Installation != nil {
+			if timeRemaining := installationTimeRemaining(installs[i].ScheduledDeletionTime, now); timeRemaining != "" {
+				install["TimeRemaining"] = timeRemaining
+			}
+		}
 	}
 
 	return json.Marshal(rawInstalls)
@@ -221,6 +228,7 @@ func (p *Plugin) processInstallationUpdate(pluginInstall *Installation, cloudIns
 	if err = p.deleteInstallation(pluginInstall.ID); err != nil {
 		return true, errors.Wrapf(err, "unable to delete installation %s in the KV store", pluginInstall.ID)
 	}
+	p.deleteInstallationRecords(pluginInstall.ID)
 
 	return true, nil
 }
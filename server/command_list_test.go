@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"strings"
 	"testing"
+	"time"
 
 	cloud "github.com/mattermost/mattermost-cloud/model"
 	"github.com/mattermost/mattermost/server/public/model"
@@ -54,14 +55,14 @@ func TestGetUpdatedInstallsForUser(t *testing.T) {
 	}
 
 	api := &plugintest.API{}
+	kv := newFakeKVStore(api)
 
 	plugin.SetAPI(api)
 
 	t.Run("test sensitivity", func(t *testing.T) {
 		pluginInstalls, installationBytes, err := getFakePluginInstallations()
 		require.NoError(t, err)
-		api.On("KVGet", mock.AnythingOfType("string")).Return(installationBytes, nil)
-		api.On("KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(true, nil)
+		kv.setInstallationsJSON(t, installationBytes)
 		api.On("GetDirectChannel", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(&model.Channel{}, nil)
 		api.On("CreatePost", mock.Anything).Return(nil, nil)
 		api.On("LogWarn", mock.AnythingOfType("string")).Return(nil)
@@ -78,6 +79,7 @@ func TestGetUpdatedInstallsForUser(t *testing.T) {
 		})
 
 		t.Run("without sensitive", func(t *testing.T) {
+			kv.setInstallationsJSON(t, installationBytes)
 			installations, err := plugin.getUpdatedInstallsForUserWithoutSensitive("owner 1")
 			require.NoError(t, err)
 			require.Equal(t, len(pluginInstalls), len(installations))
@@ -91,8 +93,7 @@ func TestGetUpdatedInstallsForUser(t *testing.T) {
 	t.Run("test deleted installations", func(t *testing.T) {
 		pluginInstalls, installationBytes, err := getFakePluginInstallations()
 		require.NoError(t, err)
-		api.On("KVGet", mock.AnythingOfType("string")).Return(installationBytes, nil)
-		api.On("KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(true, nil)
+		kv.setInstallationsJSON(t, installationBytes)
 		api.On("GetDirectChannel", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(&model.Channel{}, nil)
 		api.On("CreatePost", mock.Anything).Return(nil, nil)
 		api.On("LogWarn", mock.AnythingOfType("string")).Return(nil)
@@ -123,10 +124,10 @@ func TestGetUpdatedInstallsForUserWithoutSensitiveDoesNotMutateRefreshSource(t *
 		dockerClient: &MockedDockerClient{tagExists: true},
 	}
 	api := &plugintest.API{}
+	kv := newFakeKVStore(api)
 	_, installationBytes, err := getFakePluginInstallations()
 	require.NoError(t, err)
-	api.On("KVGet", mock.AnythingOfType("string")).Return(installationBytes, nil)
-	api.On("KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(true, nil)
+	kv.setInstallationsJSON(t, installationBytes)
 	api.On("LogWarn", mock.AnythingOfType("string")).Return(nil)
 	plugin.SetAPI(api)
 
@@ -158,7 +159,8 @@ func TestGetUpdatedSharedInstallationsWithoutSensitiveDoesNotMutateRefreshSource
 		dockerClient: &MockedDockerClient{tagExists: true},
 	}
 	api := &plugintest.API{}
-	api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"sharedid\", \"OwnerID\": \"owner 1\", \"Name\": \"shared\", \"Shared\": true}]"), nil)
+	kv := newFakeKVStore(api)
+	kv.setInstallationsJSON(t, []byte("[{\"ID\": \"sharedid\", \"OwnerID\": \"owner 1\", \"Name\": \"shared\", \"Shared\": true}]"))
 	api.On("LogWarn", mock.AnythingOfType("string")).Return(nil)
 	plugin.SetAPI(api)
 
@@ -195,11 +197,12 @@ func TestListCommand(t *testing.T) {
 	plugin.cloudClient = &MockClient{}
 
 	api := &plugintest.API{}
+	kv := newFakeKVStore(api)
 	api.On("LogWarn", mock.AnythingOfType("string")).Return(nil)
 	plugin.SetAPI(api)
 
 	t.Run("list installations successfully", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\"}]"))
 
 		resp, isUserError, err := plugin.runListCommand([]string{}, &model.CommandArgs{UserId: "joramid"})
 		require.Nil(t, err)
@@ -208,7 +211,7 @@ func TestListCommand(t *testing.T) {
 	})
 
 	t.Run("no installations", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
+		kv.reset()
 
 		resp, isUserError, err := plugin.runListCommand([]string{}, &model.CommandArgs{})
 		require.Nil(t, err)
@@ -217,7 +220,7 @@ func TestListCommand(t *testing.T) {
 	})
 
 	t.Run("no installations for current user", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\"}]"))
 
 		resp, isUserError, err := plugin.runListCommand([]string{}, &model.CommandArgs{UserId: "joramid2"})
 		require.Nil(t, err)
@@ -226,8 +229,7 @@ func TestListCommand(t *testing.T) {
 	})
 
 	t.Run("no shared installations", func(t *testing.T) {
-		api.On("KVGet").Unset()
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\"}]"))
 
 		resp, isUserError, err := plugin.runListCommand([]string{"--shared-installations"}, &model.CommandArgs{UserId: "gabeid"})
 		require.Nil(t, err)
@@ -236,8 +238,7 @@ func TestListCommand(t *testing.T) {
 	})
 
 	t.Run("shared installations", func(t *testing.T) {
-		api.On("KVGet").Unset()
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Shared\": true}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Shared\": true}]"))
 
 		resp, isUserError, err := plugin.runListCommand([]string{"--shared-installations"}, &model.CommandArgs{UserId: "gabeid"})
 		require.Nil(t, err)
@@ -246,8 +247,7 @@ func TestListCommand(t *testing.T) {
 	})
 
 	t.Run("shared installations, hidden env", func(t *testing.T) {
-		api.On("KVGet").Unset()
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"sharedid\", \"Shared\": true}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"sharedid\", \"Shared\": true}]"))
 		plugin.cloudClient = &MockClient{overrideGetInstallationDTO: &cloud.InstallationDTO{
 			Installation: &cloud.Installation{
 				ID:      "someid",
@@ -275,6 +275,22 @@ func TestListCommand(t *testing.T) {
 		assert.False(t, strings.Contains(resp.Text, "prioritykey"))
 		assert.False(t, strings.Contains(resp.Text, "priorityval"))
 	})
+
+	t.Run("time remaining until scheduled deletion", func(t *testing.T) {
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\"}]"))
+		plugin.cloudClient = &MockClient{overrideGetInstallationDTO: &cloud.InstallationDTO{
+			Installation: &cloud.Installation{
+				ID:                    "someid",
+				OwnerID:               "joramid",
+				ScheduledDeletionTime: time.Now().Add(50*time.Hour + 30*time.Minute).UnixMilli(),
+			},
+		}}
+
+		resp, isUserError, err := plugin.runListCommand([]string{}, &model.CommandArgs{UserId: "joramid"})
+		require.Nil(t, err)
+		assert.False(t, isUserError)
+		assert.True(t, strings.Contains(resp.Text, "\"TimeRemaining\": \"2d 2h\""))
+	})
 }
 
 func TestListCommandCleansUpDeletedInstallations(t *testing.T) {
@@ -289,8 +305,8 @@ func TestListCommandCleansUpDeletedInstallations(t *testing.T) {
 		dockerClient: &MockedDockerClient{tagExists: true},
 	}
 	api := &plugintest.API{}
-	api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"deletedid\", \"OwnerID\": \"ownerid\", \"Name\": \"deletedinstall\"}]"), nil)
-	api.On("KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(true, nil).Once()
+	kv := newFakeKVStore(api)
+	kv.setInstallationsJSON(t, []byte("[{\"ID\": \"deletedid\", \"OwnerID\": \"ownerid\", \"Name\": \"deletedinstall\"}]"))
 	api.On("LogWarn", mock.AnythingOfType("string")).Return(nil)
 	plugin.SetAPI(api)
 
@@ -298,5 +314,7 @@ func TestListCommandCleansUpDeletedInstallations(t *testing.T) {
 	require.NoError(t, err)
 	assert.False(t, isUserError)
 	assert.Contains(t, resp.Text, "deletedinstall [ DELETED ]")
+	assert.Nil(t, kv.getInstallation(t, "deletedid"))
+	assert.Empty(t, kv.getOwnerIndex(t, "ownerid"))
 	api.AssertExpectations(t)
 }
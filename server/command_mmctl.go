@@ -61,7 +61,51 @@ func (p *Plugin) runMmctlCommand(args []string, extra *model.CommandArgs) (*mode
 	return getCommandResponse(model.CommandResponseTypeEphemeral, resp, extra), false, nil
 }
 
+// errMmctlTimeout is returned when the connection to the provisioner was
+// closed before a mmctl command completed. The command keeps running on the
+// installation, so whether it succeeds is unknown.
+var errMmctlTimeout = errors.New("the mmctl command didn't complete before the connection was closed")
+
+// mmctlSecretFlags are the mmctl flags whose values are redacted from logs.
+var mmctlSecretFlags = []string{"--password"}
+
+// redactMmctlSubcommand returns the subcommand as a string with the values of
+// secret flags replaced.
+func redactMmctlSubcommand(subcommand []string) string {
+	redacted := make([]string, len(subcommand))
+	copy(redacted, subcommand)
+	for i := 0; i < len(redacted); i++ {
+		if Contains(mmctlSecretFlags, redacted[i]) && i+1 < len(redacted) {
+			redacted[i+1] = "********"
+			i++
+			continue
+		}
+		for _, flag := range mmctlSecretFlags {
+			if strings.HasPrefix(redacted[i], flag+"=") {
+				redacted[i] = flag + "=********"
+			}
+		}
+	}
+	return strings.Join(redacted, " ")
+}
+
+// execMmctl runs the mmctl subcommand on the installation. A command which
+// didn't complete before the connection was closed is reported in the output
+// rather than as an error, as it keeps running.
 func (p *Plugin) execMmctl(installationID string, subcommand []string) ([]byte, error) {
+	output, err := p.execMmctlStrict(installationID, subcommand)
+	if errors.Is(err, errMmctlTimeout) {
+		command := redactMmctlSubcommand(subcommand)
+		p.API.LogWarn(errors.Wrapf(err, "Command /mmctl %s", command).Error())
+		return []byte(fmt.Sprintf("Command /mmctl %s didn't complete before the connection was closed. It will continue running until it is completed.", command)), nil
+	}
+
+	return output, err
+}
+
+// execMmctlStrict runs the mmctl subcommand on the installation, returning
+// errMmctlTimeout when it didn't complete before the connection was closed.
+func (p *Plugin) execMmctlStrict(installationID string, subcommand []string) ([]byte, error) {
 	clusterInstallations, err := p.cloudClient.GetClusterInstallations(&cloud.GetClusterInstallationsRequest{
 		InstallationID: installationID,
 		Paging:         cloud.AllPagesNotDeleted(),
@@ -76,15 +120,19 @@ func (p *Plugin) execMmctl(installationID string, subcommand []string) ([]byte,
 
 	subcommand = append(subcommand, "--local")
 	output, err := p.cloudClient.ExecClusterInstallationCLI(clusterInstallations[0].ID, "mmctl", subcommand)
-	if err != nil && err.Error() == "failed with status code 504" {
-		// TODO: make this not gross.
-		// Return an error type that can be checked or allow us to pass in
-		// something with a timeout that we can control.
-		p.API.LogWarn(errors.Wrapf(err, "Command /mmctl %s didn't complete before the connection was closed", strings.Join(subcommand, " ")).Error())
-		return []byte(fmt.Sprintf("Command /mmctl %s didn't complete before the connection was closed. It will continue running until it is completed.", strings.Join(subcommand, " "))), nil
+	if isMmctlTimeout(err) {
+		return nil, errMmctlTimeout
 	} else if err != nil {
 		return nil, err
 	}
 
 	return output, nil
 }
+
+// isMmctlTimeout returns true when the connection to the provisioner was
+// closed before a mmctl command completed.
+func isMmctlTimeout(err error) bool {
+	// TODO: make this not gross.
+	// Allow us to pass in something with a timeout that we can control.
+	return err != nil && err.Error() == "failed with status code 504"
+}
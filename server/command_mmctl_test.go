@@ -7,6 +7,7 @@ import (
 	cloud "github.com/mattermost/mattermost-cloud/model"
 	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/pkg/errors"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -18,7 +19,7 @@ func TestMmctlCommand(t *testing.T) {
 	plugin := Plugin{cloudClient: mockedCloudClient}
 
 	api := &plugintest.API{}
-	api.On("KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(true, nil)
+	kv := newFakeKVStore(api)
 	api.On("SendEphemeralPost", mock.AnythingOfType("string"), mock.Anything).Return(nil)
 	plugin.SetAPI(api)
 
@@ -28,7 +29,7 @@ func TestMmctlCommand(t *testing.T) {
 	mockedCloudClient.mockedCloudClusterInstallations = []*cloud.ClusterInstallation{ci1}
 
 	t.Run("run command successfully", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 
 		resp, isUserError, err := plugin.runMmctlCommand([]string{"gabesinstall", "version"}, &model.CommandArgs{UserId: "gabeid"})
 		require.NoError(t, err)
@@ -37,7 +38,7 @@ func TestMmctlCommand(t *testing.T) {
 	})
 
 	t.Run("run command successfully with caps in name to show name is case insensitive", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 
 		resp, isUserError, err := plugin.runMmctlCommand([]string{"GabesInstall", "version"}, &model.CommandArgs{UserId: "gabeid"})
 		require.NoError(t, err)
@@ -60,7 +61,7 @@ func TestMmctlCommand(t *testing.T) {
 	})
 
 	t.Run("no mmctl subcommand", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 
 		resp, isUserError, err := plugin.runMmctlCommand([]string{"gabesinstall"}, &model.CommandArgs{UserId: "gabeid"})
 		require.Error(t, err)
@@ -70,7 +71,7 @@ func TestMmctlCommand(t *testing.T) {
 	})
 
 	t.Run("no installations", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
+		kv.reset()
 
 		resp, isUserError, err := plugin.runMmctlCommand([]string{"gabesinstall2", "version"}, &model.CommandArgs{UserId: "gabeid2"})
 		require.Error(t, err)
@@ -79,8 +80,20 @@ func TestMmctlCommand(t *testing.T) {
 		assert.Nil(t, resp)
 	})
 
+	t.Run("command which didn't complete", func(t *testing.T) {
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
+		mockedCloudClient.execCLIErr = errors.New("failed with status code 504")
+		defer func() { mockedCloudClient.execCLIErr = nil }()
+		api.On("LogWarn", "Command /mmctl user change-password bob --password ********: the mmctl command didn't complete before the connection was closed").Return().Once()
+
+		resp, isUserError, err := plugin.runMmctlCommand([]string{"gabesinstall", "user", "change-password", "bob", "--password", "secret"}, &model.CommandArgs{UserId: "gabeid"})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "Command /mmctl user change-password bob --password ******** didn't complete before the connection was closed.")
+	})
+
 	t.Run("no cluster installations", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 		mockedCloudClient.mockedCloudClusterInstallations = []*cloud.ClusterInstallation{}
 
 		resp, isUserError, err := plugin.runMmctlCommand([]string{"gabesinstall", "version"}, &model.CommandArgs{UserId: "gabeid"})
@@ -90,3 +103,10 @@ func TestMmctlCommand(t *testing.T) {
 		assert.Nil(t, resp)
 	})
 }
+
+func TestRedactMmctlSubcommand(t *testing.T) {
+	assert.Equal(t, "user change-password bob --password ******** --local", redactMmctlSubcommand([]string{"user", "change-password", "bob", "--password", "secret", "--local"}))
+	assert.Equal(t, "user change-password bob --password=********", redactMmctlSubcommand([]string{"user", "change-password", "bob", "--password=secret"}))
+	assert.Equal(t, "user create --password", redactMmctlSubcommand([]string{"user", "create", "--password"}))
+	assert.Equal(t, "version", redactMmctlSubcommand([]string{"version"}))
+}
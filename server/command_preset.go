@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+	flag "github.com/spf13/pflag"
+)
+
+func getPresetDeleteFlagSet() *flag.FlagSet {
+	presetFlagSet := flag.NewFlagSet("preset delete", flag.ContinueOnError)
+	presetFlagSet.Bool("global", false, "Delete the global preset instead of your own. System administrators only")
+	return presetFlagSet
+}
+
+func (p *Plugin) getPresetSaveFlagSet() *flag.FlagSet {
+	presetFlagSet := p.getCreateFlagSet()
+	presetFlagSet.Bool("global", false, "Save the preset for every user. System administrators only")
+	return presetFlagSet
+}
+
+func (p *Plugin) runPresetCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	if len(args) == 0 || len(args[0]) == 0 {
+		return nil, true, errors.New("must provide a preset subcommand: save, list, or delete")
+	}
+
+	switch args[0] {
+	case "save":
+		return p.runPresetSaveCommand(args[1:], extra)
+	case "list":
+		return p.runPresetListCommand(args[1:], extra)
+	case "delete":
+		return p.runPresetDeleteCommand(args[1:], extra)
+	}
+
+	return nil, true, errors.Errorf("unknown preset subcommand %s", args[0])
+}
+
+func (p *Plugin) runPresetSaveCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	if len(args) == 0 || args[0] == "" || strings.HasPrefix(args[0], "--") {
+		return nil, true, errors.New("must provide a preset name")
+	}
+
+	presetFlagSet := p.getPresetSaveFlagSet()
+	if err := presetFlagSet.Parse(args); err != nil {
+		return nil, true, err
+	}
+	global, err := presetFlagSet.GetBool("global")
+	if err != nil {
+		return nil, true, err
+	}
+	input, err := createInstallationInputFromFlags(presetFlagSet)
+	if err != nil {
+		return nil, true, err
+	}
+
+	preset, err := p.saveInstallationPresetForUser(extra.UserId, args[0], input, global)
+	if err != nil {
+		if isPresetUserError(err) {
+			return nil, true, err
+		}
+		return nil, false, err
+	}
+
+	resp := fmt.Sprintf("Preset %s saved with %s.", preset.Name, describeCreateInstallationInput(preset.Input))
+	if global {
+		resp = fmt.Sprintf("Global preset %s saved with %s.", preset.Name, describeCreateInstallationInput(preset.Input))
+	}
+	resp += fmt.Sprintf(" Use it with `/cloud create [name] --preset %s`.", preset.Name)
+
+	return getCommandResponse(model.CommandResponseTypeEphemeral, resp, extra), false, nil
+}
+
+func (p *Plugin) runPresetListCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	userPresets, err := p.getInstallationPresets(extra.UserId, false)
+	if err != nil {
+		return nil, false, err
+	}
+	globalPresets, err := p.getInstallationPresets(extra.UserId, true)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(userPresets) == 0 && len(globalPresets) == 0 {
+		return getCommandResponse(model.CommandResponseTypeEphemeral, "No presets found. Save one with `/cloud preset save [name] [flags]`.", extra), false, nil
+	}
+
+	resp := "| Preset | Scope | Options |\n| -- | -- | -- |\n"
+	for _, name := range sortedPresetNames(userPresets) {
+		resp += fmt.Sprintf("| %s | personal | %s |\n", name, describeCreateInstallationInput(userPresets[name].Input))
+	}
+	for _, name := range sortedPresetNames(globalPresets) {
+		scope := "global"
+		if _, ok := userPresets[name]; ok {
+			scope = "global (overridden by personal)"
+		}
+		resp += fmt.Sprintf("| %s | %s | %s |\n", name, scope, describeCreateInstallationInput(globalPresets[name].Input))
+	}
+
+	return getCommandResponse(model.CommandResponseTypeEphemeral, resp, extra), false, nil
+}
+
+func (p *Plugin) runPresetDeleteCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	if len(args) == 0 || args[0] == "" || strings.HasPrefix(args[0], "--") {
+		return nil, true, errors.New("must provide a preset name")
+	}
+
+	presetFlagSet := getPresetDeleteFlagSet()
+	if err := presetFlagSet.Parse(args); err != nil {
+		return nil, true, err
+	}
+	global, err := presetFlagSet.GetBool("global")
+	if err != nil {
+		return nil, true, err
+	}
+
+	name := standardizeName(args[0])
+	if err = p.deleteInstallationPresetForUser(extra.UserId, name, global); err != nil {
+		if isPresetUserError(err) {
+			return nil, true, err
+		}
+		return nil, false, err
+	}
+
+	return getCommandResponse(model.CommandResponseTypeEphemeral, fmt.Sprintf("Preset %s deleted.", name), extra), false, nil
+}
+
+func isPresetUserError(err error) bool {
+	errText := err.Error()
+	return strings.Contains(errText, "must provide a preset name") ||
+		strings.Contains(errText, "is invalid: only letters, numbers, and hyphens are permitted") ||
+		strings.Contains(errText, "a preset cannot reference another preset") ||
+		strings.Contains(errText, "can only be managed by system administrators") ||
+		strings.Contains(errText, "no preset with the name")
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPresetCommand(t *testing.T) {
+	plugin, cloudClient, api, _ := newServiceTestPluginWithKV(t, nil)
+	api.On("HasPermissionTo", "adminid", model.PermissionManageSystem).Return(true)
+	api.On("HasPermissionTo", "userid", model.PermissionManageSystem).Return(false)
+
+	t.Run("save only stores the flags that were set", func(t *testing.T) {
+		resp, isUserError, err := plugin.runPresetCommand([]string{"save", "loadtest", "--size", "miniHA", "--test-data", "--env", "MM_FEATUREFLAGS_X=true"}, &model.CommandArgs{UserId: "userid"})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "Preset loadtest saved with size: miniHA; test data; env: MM_FEATUREFLAGS_X.")
+
+		preset, err := plugin.findInstallationPreset("userid", "loadtest")
+		require.NoError(t, err)
+		assert.Equal(t, CreateInstallationInput{
+			Size:     "miniHA",
+			TestData: NewBool(true),
+			Env:      map[string]string{"MM_FEATUREFLAGS_X": "true"},
+		}, preset.Input)
+	})
+
+	t.Run("global save requires a system administrator", func(t *testing.T) {
+		resp, isUserError, err := plugin.runPresetCommand([]string{"save", "shared", "--license", "e20", "--global"}, &model.CommandArgs{UserId: "userid"})
+		require.EqualError(t, err, "global presets can only be managed by system administrators")
+		assert.True(t, isUserError)
+		assert.Nil(t, resp)
+
+		resp, isUserError, err = plugin.runPresetCommand([]string{"save", "shared", "--license", "e20", "--global"}, &model.CommandArgs{UserId: "adminid"})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "Global preset shared saved with license: e20.")
+	})
+
+	t.Run("list shows personal and global presets without env values", func(t *testing.T) {
+		resp, isUserError, err := plugin.runPresetCommand([]string{"list"}, &model.CommandArgs{UserId: "userid"})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "| loadtest | personal | size: miniHA; test data; env: MM_FEATUREFLAGS_X |")
+		assert.Contains(t, resp.Text, "| shared | global | license: e20 |")
+		assert.NotContains(t, resp.Text, "=true")
+	})
+
+	t.Run("create applies the preset", func(t *testing.T) {
+		resp, isUserError, err := plugin.runCreateCommand([]string{"example", "--preset", "loadtest", "--size", "miniSingleton"}, &model.CommandArgs{UserId: "userid"})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "Installation being created.")
+		require.NotNil(t, cloudClient.creationRequest)
+		assert.Equal(t, "miniSingleton", cloudClient.creationRequest.Size)
+		assert.Contains(t, cloudClient.creationRequest.PriorityEnv, "MM_FEATUREFLAGS_X")
+	})
+
+	t.Run("create with an unknown preset", func(t *testing.T) {
+		resp, isUserError, err := plugin.runCreateCommand([]string{"other", "--preset", "missing"}, &model.CommandArgs{UserId: "userid"})
+		require.EqualError(t, err, "no preset with the name missing found")
+		assert.True(t, isUserError)
+		assert.Nil(t, resp)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		resp, isUserError, err := plugin.runPresetCommand([]string{"delete", "loadtest"}, &model.CommandArgs{UserId: "userid"})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "Preset loadtest deleted.")
+
+		_, isUserError, err = plugin.runPresetCommand([]string{"delete", "loadtest"}, &model.CommandArgs{UserId: "userid"})
+		require.EqualError(t, err, "no preset with the name loadtest found")
+		assert.True(t, isUserError)
+	})
+
+	t.Run("unknown subcommand", func(t *testing.T) {
+		_, isUserError, err := plugin.runPresetCommand([]string{"rename"}, &model.CommandArgs{UserId: "userid"})
+		require.EqualError(t, err, "unknown preset subcommand rename")
+		assert.True(t, isUserError)
+	})
+}
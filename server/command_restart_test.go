@@ -10,7 +10,6 @@ import (
 	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
 
 	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
 
@@ -19,11 +18,11 @@ func TestRestartCommand(t *testing.T) {
 	plugin.cloudClient = &MockClient{}
 
 	api := &plugintest.API{}
-	api.On("KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(true, nil)
+	kv := newFakeKVStore(api)
 	plugin.SetAPI(api)
 
 	t.Run("restart installation successfully", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 
 		resp, isUserError, err := plugin.runRestartCommand([]string{"gabesinstall"}, &model.CommandArgs{UserId: "gabeid"})
 		require.Nil(t, err)
@@ -32,7 +31,7 @@ func TestRestartCommand(t *testing.T) {
 	})
 
 	t.Run("restart installation successfully with caps in name to demonstrate name case insensitivity", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"GabesInstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"GabesInstall\"}]"))
 
 		resp, isUserError, err := plugin.runRestartCommand([]string{"gabesinstall"}, &model.CommandArgs{UserId: "gabeid"})
 		require.Nil(t, err)
@@ -41,7 +40,7 @@ func TestRestartCommand(t *testing.T) {
 	})
 
 	t.Run("don't restart with wrong owner", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 
 		resp, isUserError, err := plugin.runRestartCommand([]string{"gabesinstall"}, &model.CommandArgs{UserId: "gabeid2"})
 		require.NotNil(t, err)
@@ -51,7 +50,7 @@ func TestRestartCommand(t *testing.T) {
 	})
 
 	t.Run("no installations", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
+		kv.reset()
 
 		resp, isUserError, err := plugin.runRestartCommand([]string{"gabesinstall"}, &model.CommandArgs{UserId: "gabeid2"})
 		require.NotNil(t, err)
@@ -83,8 +82,7 @@ func TestRestartCommand(t *testing.T) {
 				InstallationDTO:    cloud.InstallationDTO{Installation: &cloud.Installation{ID: cloud.NewID()}},
 			}})
 			require.NoError(t, err)
-			api.On("KVGet").Unset()
-			api.On("KVGet", mock.AnythingOfType("string")).Return(installBytes, nil)
+			kv.setInstallationsJSON(t, installBytes)
 
 			resp, isUserError, err := plugin.runRestartCommand([]string{"gabesinstall", "--shared-installation"}, &model.CommandArgs{UserId: "gabeid"})
 			require.Error(t, err)
@@ -101,8 +99,7 @@ func TestRestartCommand(t *testing.T) {
 				InstallationDTO:    cloud.InstallationDTO{Installation: &cloud.Installation{ID: cloud.NewID()}},
 			}})
 			require.NoError(t, err)
-			api.On("KVGet").Unset()
-			api.On("KVGet", mock.AnythingOfType("string")).Return(installBytes, nil)
+			kv.setInstallationsJSON(t, installBytes)
 
 			resp, isUserError, err := plugin.runRestartCommand([]string{"gabesinstall", "--shared-installation"}, &model.CommandArgs{UserId: "gabeid"})
 			require.Error(t, err)
@@ -119,8 +116,7 @@ func TestRestartCommand(t *testing.T) {
 				InstallationDTO:    cloud.InstallationDTO{Installation: &cloud.Installation{ID: cloud.NewID()}},
 			}})
 			require.NoError(t, err)
-			api.On("KVGet").Unset()
-			api.On("KVGet", mock.AnythingOfType("string")).Return(installBytes, nil)
+			kv.setInstallationsJSON(t, installBytes)
 
 			resp, isUserError, err := plugin.runRestartCommand([]string{"gabesinstall", "--shared-installation"}, &model.CommandArgs{UserId: "gabeid"})
 			require.NoError(t, err)
@@ -136,8 +132,7 @@ func TestRestartCommand(t *testing.T) {
 				InstallationDTO:    cloud.InstallationDTO{Installation: &cloud.Installation{ID: cloud.NewID()}},
 			}})
 			require.NoError(t, err)
-			api.On("KVGet").Unset()
-			api.On("KVGet", mock.AnythingOfType("string")).Return(installBytes, nil)
+			kv.setInstallationsJSON(t, installBytes)
 
 			resp, isUserError, err := plugin.runRestartCommand([]string{"gabesinstall"}, &model.CommandArgs{UserId: "gabeid"})
 			assert.Contains(t, err.Error(), "no installation with the name gabesinstall found")
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+// runRestoreCommand cancels the pending deletion of the provided installation.
+func (p *Plugin) runRestoreCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	if len(args) == 0 || len(args[0]) == 0 {
+		return nil, true, errors.New("must provide an installation name")
+	}
+
+	name := standardizeName(args[0])
+
+	_, err := p.restoreInstallationForUser(extra.UserId, InstallationRef{Name: name})
+	if err != nil {
+		if strings.Contains(err.Error(), "no installation with the name") ||
+			strings.Contains(err.Error(), "to restore") ||
+			strings.Contains(err.Error(), "is now used by another installation") {
+			return nil, true, err
+		}
+		return nil, false, err
+	}
+
+	return getCommandResponse(model.CommandResponseTypeEphemeral, fmt.Sprintf("Installation %s is being restored. You will receive a notification when it is available again. Use /cloud list to check on the status of your installations.", name), extra), false, nil
+}
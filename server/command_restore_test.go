@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	cloud "github.com/mattermost/mattermost-cloud/model"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestoreCommand(t *testing.T) {
+	pending := serviceTestInstall("someid", "joramsinstall", "joramid")
+	pending.State = cloud.InstallationStateDeletionPending
+	stable := serviceTestInstall("stableid", "stableinstall", "joramid")
+
+	plugin, cloudClient, _ := newServiceTestPlugin(t, nil)
+	cloudClient.mockedCloudInstallationsDTO = serviceDTOs(pending, stable)
+
+	t.Run("restore installation successfully", func(t *testing.T) {
+		resp, isUserError, err := plugin.runRestoreCommand([]string{"JoramsInstall"}, &model.CommandArgs{UserId: "joramid"})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.True(t, strings.Contains(resp.Text, "Installation joramsinstall is being restored."))
+		assert.Equal(t, "someid", cloudClient.canceledInstallationID)
+	})
+
+	t.Run("installation not pending deletion", func(t *testing.T) {
+		resp, isUserError, err := plugin.runRestoreCommand([]string{"stableinstall"}, &model.CommandArgs{UserId: "joramid"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "must be deletion-pending to restore")
+		assert.True(t, isUserError)
+		assert.Nil(t, resp)
+	})
+
+	t.Run("don't restore with wrong owner", func(t *testing.T) {
+		resp, isUserError, err := plugin.runRestoreCommand([]string{"joramsinstall"}, &model.CommandArgs{UserId: "joramid2"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no installation with the name joramsinstall found")
+		assert.True(t, isUserError)
+		assert.Nil(t, resp)
+	})
+
+	t.Run("no name provided", func(t *testing.T) {
+		resp, isUserError, err := plugin.runRestoreCommand([]string{}, &model.CommandArgs{UserId: "joramid"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "must provide an installation name")
+		assert.True(t, isUserError)
+		assert.Nil(t, resp)
+	})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+func (p *Plugin) runSetupCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	if len(args) == 0 || len(args[0]) == 0 {
+		return nil, true, errors.New("must provide a setup subcommand")
+	}
+
+	switch args[0] {
+	case "retry":
+		return p.runSetupRetryCommand(args[1:], extra)
+	}
+
+	return nil, true, errors.Errorf("unknown setup subcommand %s", args[0])
+}
+
+func (p *Plugin) runSetupRetryCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	if len(args) == 0 || len(args[0]) == 0 {
+		return nil, true, errors.New("must provide an installation name")
+	}
+
+	result, err := p.retryInstallationSetupForUser(extra.UserId, InstallationRef{Name: standardizeName(args[0])})
+	if err != nil {
+		if isSetupRetryUserError(err) {
+			return nil, true, err
+		}
+		return nil, false, err
+	}
+
+	return getCommandResponse(model.CommandResponseTypeEphemeral, result.Message+" You will be sent the installation details once it is ready.", extra), false, nil
+}
+
+func isSetupRetryUserError(err error) bool {
+	message := err.Error()
+	return strings.Contains(message, "no installation with the name") ||
+		strings.Contains(message, "has not failed") ||
+		strings.Contains(message, "to set it up")
+}
@@ -18,6 +18,11 @@ const (
 	installationTableHeader = `
 | Installation | DNS | Size | Version | Database | Filestore | State | Created |
 | -- | -- | -- | -- | -- | -- |
+`
+
+	registryRateLimitTableHeader = `
+| Registry | Remaining | Limit | Window | Updated |
+| -- | -- | -- | -- | -- |
 `
 )
 
@@ -71,6 +76,20 @@ func (p *Plugin) runStatusCommand(args []string, extra *model.CommandArgs) (*mod
 		)
 	}
 
+	if rateLimits := p.registryRateLimits(); len(rateLimits) > 0 {
+		status += "\n"
+		status += registryRateLimitTableHeader
+		for _, rateLimit := range rateLimits {
+			status += fmt.Sprintf("| %s | %d | %d | %s | %s |\n",
+				rateLimit.Registry,
+				rateLimit.Remaining,
+				rateLimit.Limit,
+				time.Duration(rateLimit.WindowSeconds)*time.Second,
+				getTimeFromMillis(rateLimit.UpdateAt).UTC().Format(time.RFC1123),
+			)
+		}
+	}
+
 	if !includeClusters {
 		return getCommandResponse(model.CommandResponseTypeEphemeral, status, extra), false, nil
 	}
@@ -95,6 +114,15 @@ func (p *Plugin) runStatusCommand(args []string, extra *model.CommandArgs) (*mod
 	return getCommandResponse(model.CommandResponseTypeEphemeral, status, extra), false, nil
 }
 
+// registryRateLimits returns the pull rate limits last reported by the docker
+// registries.
+func (p *Plugin) registryRateLimits() []RegistryRateLimit {
+	if p.dockerClient == nil {
+		return nil
+	}
+	return p.dockerClient.RateLimits()
+}
+
 func getTimeFromMillis(millis int64) time.Time {
 	return time.Unix(millis/1000, 0)
 }
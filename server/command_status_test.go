@@ -88,4 +88,19 @@ func TestStatusCommand(t *testing.T) {
 		assert.False(t, isUserError)
 		assert.Nil(t, resp)
 	})
+
+	t.Run("registry rate limits", func(t *testing.T) {
+		plugin := Plugin{
+			cloudClient: &MockClient{},
+			dockerClient: &MockedDockerClient{rateLimits: []RegistryRateLimit{
+				{Registry: dockerHubURL, Limit: 100, Remaining: 42, WindowSeconds: 21600, UpdateAt: 1700000000000},
+			}},
+		}
+
+		resp, isUserError, err := plugin.runStatusCommand([]string{""}, &model.CommandArgs{UserId: "gabeid"})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, registryRateLimitTableHeader)
+		assert.Contains(t, resp.Text, "| https://registry.hub.docker.com | 42 | 100 | 6h0m0s | Tue, 14 Nov 2023 22:13:20 UTC |")
+	})
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"testing"
 
 	cloud "github.com/mattermost/mattermost-cloud/model"
@@ -24,28 +25,50 @@ type MockClient struct {
 
 	// Stores latest CreateInstallationRequest passed to mock
 	creationRequest *cloud.CreateInstallationRequest
+	// Stores every CreateInstallationRequest passed to mock
+	creationRequests []*cloud.CreateInstallationRequest
+	// Stores every command passed to ExecClusterInstallationCLI
+	execCLICalls [][]string
+	// Stores every GetInstallationsRequest passed to mock
+	getInstallationsRequests []*cloud.GetInstallationsRequest
 	// Stores latest PatchInstallationRequest passed to mock
 	patchRequest             *cloud.PatchInstallationRequest
 	patchInstallationID      string
 	deletedInstallationID    string
+	deletedInstallationIDs   []string
+	canceledInstallationID   string
+	scheduledDeletionID      string
+	scheduledDeletionTime    int64
 	lockedInstallationID     string
 	unlockedInstallationID   string
 	hibernatedInstallationID string
 	wokenInstallationID      string
-
-	createErr    error
-	updateErr    error
-	deleteErr    error
-	lockErr      error
-	unlockErr    error
-	hibernateErr error
-	wakeErr      error
-	listErr      error
-	clusterErr   error
-	err          error
+	retriedInstallationID    string
+
+	createErr error
+	// createErrAfter is the number of creations succeeding before createErr
+	// is returned.
+	createErrAfter int
+	updateErr      error
+	deleteErr      error
+	cancelErr      error
+	scheduleErr    error
+	lockErr        error
+	unlockErr      error
+	hibernateErr   error
+	wakeErr        error
+	retryErr       error
+	execCLIErr     error
+	listErr        error
+	clusterErr     error
+	err            error
 }
 
 func (mc *MockClient) ExecClusterInstallationCLI(clusterInstallationID, command string, subcommand []string) ([]byte, error) {
+	mc.execCLICalls = append(mc.execCLICalls, append([]string{command}, subcommand...))
+	if mc.execCLIErr != nil {
+		return nil, mc.execCLIErr
+	}
 	return []byte{}, nil
 }
 
@@ -58,10 +81,14 @@ func (mc *MockClient) GetClusters(request *cloud.GetClustersRequest) ([]*cloud.C
 
 func (mc *MockClient) CreateInstallation(request *cloud.CreateInstallationRequest) (*cloud.InstallationDTO, error) {
 	mc.creationRequest = request
-	if mc.createErr != nil {
+	mc.creationRequests = append(mc.creationRequests, request)
+	if mc.createErr != nil && len(mc.creationRequests) > mc.createErrAfter {
 		return nil, mc.createErr
 	}
-	return &cloud.InstallationDTO{Installation: &cloud.Installation{ID: "someid"}}, nil
+	if len(mc.creationRequests) > 1 {
+		return &cloud.InstallationDTO{Installation: &cloud.Installation{ID: fmt.Sprintf("someid%d", len(mc.creationRequests)), Version: request.Version}}, nil
+	}
+	return &cloud.InstallationDTO{Installation: &cloud.Installation{ID: "someid", Version: request.Version}}, nil
 }
 
 func (mc *MockClient) GetInstallation(installataionID string, request *cloud.GetInstallationRequest) (*cloud.InstallationDTO, error) {
@@ -87,6 +114,7 @@ func (mc *MockClient) GetInstallationByDNS(DNS string, request *cloud.GetInstall
 }
 
 func (mc *MockClient) GetInstallations(request *cloud.GetInstallationsRequest) ([]*cloud.InstallationDTO, error) {
+	mc.getInstallationsRequests = append(mc.getInstallationsRequests, request)
 	if mc.listErr != nil {
 		return nil, mc.listErr
 	}
@@ -102,6 +130,11 @@ func (mc *MockClient) UpdateInstallation(installationID string, request *cloud.P
 	return &cloud.InstallationDTO{Installation: &cloud.Installation{ID: "someid", OwnerID: "joramid"}}, nil
 }
 
+func (mc *MockClient) RetryCreateInstallation(installationID string) error {
+	mc.retriedInstallationID = installationID
+	return mc.retryErr
+}
+
 func (mc *MockClient) HibernateInstallation(installationID string) (*cloud.InstallationDTO, error) {
 	mc.hibernatedInstallationID = installationID
 	if mc.hibernateErr != nil {
@@ -136,12 +169,32 @@ func (mc *MockClient) UnlockDeletionLockForInstallation(installationID string) e
 
 func (mc *MockClient) DeleteInstallation(installationID string) error {
 	mc.deletedInstallationID = installationID
+	mc.deletedInstallationIDs = append(mc.deletedInstallationIDs, installationID)
 	if mc.deleteErr != nil {
 		return mc.deleteErr
 	}
 	return nil
 }
 
+func (mc *MockClient) CancelInstallationDeletion(installationID string) error {
+	mc.canceledInstallationID = installationID
+	if mc.cancelErr != nil {
+		return mc.cancelErr
+	}
+	return nil
+}
+
+func (mc *MockClient) UpdateInstallationScheduledDeletion(installationID string, request *cloud.PatchInstallationScheduledDeletionRequest) (*cloud.InstallationDTO, error) {
+	mc.scheduledDeletionID = installationID
+	if request.ScheduledDeletionTime != nil {
+		mc.scheduledDeletionTime = *request.ScheduledDeletionTime
+	}
+	if mc.scheduleErr != nil {
+		return nil, mc.scheduleErr
+	}
+	return &cloud.InstallationDTO{Installation: &cloud.Installation{ID: installationID, ScheduledDeletionTime: mc.scheduledDeletionTime}}, nil
+}
+
 func (mc *MockClient) GetClusterInstallations(request *cloud.GetClusterInstallationsRequest) ([]*cloud.ClusterInstallation, error) {
 	return mc.mockedCloudClusterInstallations, nil
 }
@@ -249,3 +302,38 @@ func TestAuthorizedPluginUser(t *testing.T) {
 		})
 	}
 }
+
+func TestGetCommandConfiguredOptions(t *testing.T) {
+	plugin, _, _ := newServiceTestPlugin(t, nil)
+	plugin.configuration.AllowedImages = "mattermost/mattermost-enterprise-edition,mattermostdevelopment/mm-ee-new"
+	plugin.configuration.InstallationSizes = "miniHA,provisionerXL"
+
+	command := plugin.getCommand()
+	for _, trigger := range []string{"create", "update"} {
+		var subCommand *model.AutocompleteData
+		for _, candidate := range command.AutocompleteData.SubCommands {
+			if candidate.Trigger == trigger {
+				subCommand = candidate
+			}
+		}
+		require.NotNil(t, subCommand, trigger)
+
+		options := map[string][]string{}
+		for _, arg := range subCommand.Arguments {
+			list, ok := arg.Data.(*model.AutocompleteStaticListArg)
+			if !ok || (arg.Name != "size" && arg.Name != "image") {
+				continue
+			}
+			for _, item := range list.PossibleArguments {
+				options[arg.Name] = append(options[arg.Name], item.Item)
+			}
+		}
+		assert.Equal(t, []string{"miniHA", "provisionerXL"}, options["size"], trigger)
+		assert.Equal(t, []string{imageEE, "mattermostdevelopment/mm-ee-new"}, options["image"], trigger)
+	}
+
+	createFlags := plugin.getCreateFlagSet()
+	assert.Equal(t, "miniHA", createFlags.Lookup("size").DefValue)
+	assert.Contains(t, createFlags.Lookup("size").Usage, "'miniHA' or 'provisionerXL'")
+	assert.Contains(t, createFlags.Lookup("image").Usage, "mattermostdevelopment/mm-ee-new")
+}
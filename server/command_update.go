@@ -9,15 +9,17 @@ import (
 	flag "github.com/spf13/pflag"
 )
 
-func getUpdateFlagSet() *flag.FlagSet {
+func (p *Plugin) getUpdateFlagSet() *flag.FlagSet {
+	config := p.getConfiguration()
 	updateFlagSet := flag.NewFlagSet("update", flag.ContinueOnError)
-	updateFlagSet.String("version", "", "Mattermost version to run, e.g. '9.1.0'")
+	updateFlagSet.String("version", "", "Mattermost version to run, e.g. '9.1.0', '9.11.x', 'latest', 'latest-esr', 'latest-rc', 'master' or 'pr-12345'")
 	updateFlagSet.String("license", "", "The Enterprise license to use. Can be 'enterprise-advanced', 'enterprise', 'professional', 'e20', 'e10', or 'te'")
-	updateFlagSet.String("size", "", "Size of the Mattermost installation e.g. 'miniSingleton' or 'miniHA'")
-	updateFlagSet.String("image", "", fmt.Sprintf("Docker image repository, can be %s", strings.Join(dockerRepoWhitelist, ", ")))
+	updateFlagSet.String("size", "", fmt.Sprintf("Size of the Mattermost installation. Can be %s", quotedList(config.installationSizes())))
+	updateFlagSet.String("image", "", fmt.Sprintf("Docker image repository, can be %s", strings.Join(config.allowedImages(), ", ")))
 	updateFlagSet.StringSlice("env", []string{}, "Environment variables in form: ENV1=test,ENV2=test")
 	updateFlagSet.StringSlice("clear-env", []string{}, "List of custom environment variables to erase, for example: ENV1,ENV2")
 	updateFlagSet.Bool("shared-installation", false, "Set this to true when attempting to update a shared installation")
+	updateFlagSet.Bool("dry-run", false, "Show the request that would be sent to the provisioner without updating the installation")
 
 	return updateFlagSet
 }
@@ -32,7 +34,7 @@ func (p *Plugin) runUpdateCommand(args []string, extra *model.CommandArgs) (*mod
 
 	name := standardizeName(args[0])
 
-	input, shared, err := updateInstallationInputFromArgs(args)
+	input, shared, dryRun, err := p.updateInstallationInputFromArgs(args)
 	if err != nil {
 		return nil, true, err
 	}
@@ -41,6 +43,14 @@ func (p *Plugin) runUpdateCommand(args []string, extra *model.CommandArgs) (*mod
 	if shared {
 		scope = InstallationScopeUpdatable
 	}
+
+	if dryRun {
+		result, previewErr := p.previewUpdateInstallationForUser(extra.UserId, InstallationRef{Name: name}, input, scope)
+		if previewErr != nil {
+			return nil, isUpdateUserError(previewErr), previewErr
+		}
+		return getCommandResponse(model.CommandResponseTypeEphemeral, dryRunResponseText(result), extra), false, nil
+	}
 	result, err := p.updateInstallationForUser(extra.UserId, InstallationRef{Name: name}, input, scope)
 	if err != nil {
 		if isUpdateUserError(err) {
@@ -63,45 +73,51 @@ func (p *Plugin) runUpdateCommand(args []string, extra *model.CommandArgs) (*mod
 		p.PostBotDM(result.Installation.OwnerID, fmt.Sprintf("%s has updated an installation you have shared. The following command was run: `%s`", username, extra.Command))
 	}
 
-	return getCommandResponse(model.CommandResponseTypeEphemeral, fmt.Sprintf("Update of installation %s has begun. You will receive a notification when it is ready. Use /cloud list to check on the status of your installations.", name), extra), false, nil
+	text := fmt.Sprintf("Update of installation %s has begun.", name)
+	if result.Message != "" {
+		text += " " + result.Message
+	}
+	text += " You will receive a notification when it is ready. Use /cloud list to check on the status of your installations."
+
+	return getCommandResponse(model.CommandResponseTypeEphemeral, text, extra), false, nil
 }
 
-func updateInstallationInputFromArgs(args []string) (UpdateInstallationInput, bool, error) {
-	updateFlagSet := getUpdateFlagSet()
+func (p *Plugin) updateInstallationInputFromArgs(args []string) (UpdateInstallationInput, bool, bool, error) {
+	updateFlagSet := p.getUpdateFlagSet()
 	if err := updateFlagSet.Parse(args); err != nil {
-		return UpdateInstallationInput{}, false, err
+		return UpdateInstallationInput{}, false, false, err
 	}
 
 	input := UpdateInstallationInput{}
 	var err error
 	input.Version, err = updateFlagSet.GetString("version")
 	if err != nil {
-		return UpdateInstallationInput{}, false, err
+		return UpdateInstallationInput{}, false, false, err
 	}
 	input.License, err = updateFlagSet.GetString("license")
 	if err != nil {
-		return UpdateInstallationInput{}, false, err
+		return UpdateInstallationInput{}, false, false, err
 	}
 	input.Size, err = updateFlagSet.GetString("size")
 	if err != nil {
-		return UpdateInstallationInput{}, false, err
+		return UpdateInstallationInput{}, false, false, err
 	}
 	input.Image, err = updateFlagSet.GetString("image")
 	if err != nil {
-		return UpdateInstallationInput{}, false, err
+		return UpdateInstallationInput{}, false, false, err
 	}
 
 	envVars, err := updateFlagSet.GetStringSlice("env")
 	if err != nil {
-		return UpdateInstallationInput{}, false, err
+		return UpdateInstallationInput{}, false, false, err
 	}
 	input.ClearEnv, err = updateFlagSet.GetStringSlice("clear-env")
 	if err != nil {
-		return UpdateInstallationInput{}, false, err
+		return UpdateInstallationInput{}, false, false, err
 	}
 	envVarMap, err := parseEnvVarInput(envVars, input.ClearEnv)
 	if err != nil {
-		return UpdateInstallationInput{}, false, err
+		return UpdateInstallationInput{}, false, false, err
 	}
 	input.SetEnv = map[string]string{}
 	for key, env := range envVarMap {
@@ -112,10 +128,15 @@ func updateInstallationInputFromArgs(args []string) (UpdateInstallationInput, bo
 
 	shared, err := updateFlagSet.GetBool("shared-installation")
 	if err != nil {
-		return UpdateInstallationInput{}, false, err
+		return UpdateInstallationInput{}, false, false, err
+	}
+
+	dryRun, err := updateFlagSet.GetBool("dry-run")
+	if err != nil {
+		return UpdateInstallationInput{}, false, false, err
 	}
 
-	return input, shared, nil
+	return input, shared, dryRun, nil
 }
 
 func isUpdateUserError(err error) bool {
@@ -127,5 +148,8 @@ func isUpdateUserError(err error) bool {
 		strings.Contains(errText, "valid env format") ||
 		strings.Contains(errText, "defined more than once") ||
 		strings.Contains(errText, "no installation with the name") ||
-		strings.Contains(errText, "is not a valid docker tag")
+		strings.Contains(errText, "is not a valid docker tag") ||
+		strings.Contains(errText, registryUnavailable) ||
+		strings.Contains(errText, noPlatformImage) ||
+		strings.Contains(errText, "no release matching version")
 }
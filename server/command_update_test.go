@@ -22,11 +22,11 @@ func TestUpdateCommand(t *testing.T) {
 	}
 
 	api := &plugintest.API{}
-	api.On("KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(true, nil)
+	kv := newFakeKVStore(api)
 	plugin.SetAPI(api)
 
 	t.Run("update installation successfully", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 
 		resp, isUserError, err := plugin.runUpdateCommand([]string{"gabesinstall", "--version", "5.13.1"}, &model.CommandArgs{UserId: "gabeid"})
 		require.NoError(t, err)
@@ -35,7 +35,7 @@ func TestUpdateCommand(t *testing.T) {
 	})
 
 	t.Run("update installation successfully with name with caps to demonstrate case insensitivity of name", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 
 		resp, isUserError, err := plugin.runUpdateCommand([]string{"GabesInstall", "--version", "5.13.1"}, &model.CommandArgs{UserId: "gabeid"})
 		require.NoError(t, err)
@@ -44,7 +44,7 @@ func TestUpdateCommand(t *testing.T) {
 	})
 
 	t.Run("no version, license, or size", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 
 		resp, isUserError, err := plugin.runUpdateCommand([]string{"gabesinstall"}, &model.CommandArgs{UserId: "gabeid"})
 		require.Error(t, err)
@@ -55,7 +55,7 @@ func TestUpdateCommand(t *testing.T) {
 
 	t.Run("size", func(t *testing.T) {
 		t.Run("incorrect size", func(t *testing.T) {
-			api.On("KVGet", mock.AnythingOfType("string")).Return([]byte(`[{"ID": "someid", "OwnerID": "gabeid", "Name": "gabesinstall", "Size": "1000users"}]`), nil)
+			kv.setInstallationsJSON(t, []byte(`[{"ID": "someid", "OwnerID": "gabeid", "Name": "gabesinstall", "Size": "1000users"}]`))
 
 			resp, isUserError, err := plugin.runUpdateCommand([]string{"gabesinstall", "--size", "1000users"}, &model.CommandArgs{UserId: "gabeid"})
 			require.Error(t, err)
@@ -65,7 +65,7 @@ func TestUpdateCommand(t *testing.T) {
 		})
 
 		t.Run("valid size", func(t *testing.T) {
-			api.On("KVGet", mock.AnythingOfType("string")).Return([]byte(`[{"ID": "someid", "OwnerID": "gabeid", "Name": "gabesinstall", "Size": "miniSingleton"}]`), nil)
+			kv.setInstallationsJSON(t, []byte(`[{"ID": "someid", "OwnerID": "gabeid", "Name": "gabesinstall", "Size": "miniSingleton"}]`))
 
 			_, _, err := plugin.runUpdateCommand([]string{"gabesinstall", "--size", "miniSingleton"}, &model.CommandArgs{UserId: "gabeid"})
 			require.NoError(t, err)
@@ -73,7 +73,7 @@ func TestUpdateCommand(t *testing.T) {
 	})
 
 	t.Run("version only", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 
 		resp, isUserError, err := plugin.runUpdateCommand([]string{"gabesinstall", "--version", "5.13.1"}, &model.CommandArgs{UserId: "gabeid"})
 		require.NoError(t, err)
@@ -82,7 +82,7 @@ func TestUpdateCommand(t *testing.T) {
 	})
 
 	t.Run("size only", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 
 		resp, isUserError, err := plugin.runUpdateCommand([]string{"gabesinstall", "--size", "miniHA"}, &model.CommandArgs{UserId: "gabeid"})
 		require.NoError(t, err)
@@ -92,7 +92,7 @@ func TestUpdateCommand(t *testing.T) {
 
 	t.Run("licenses", func(t *testing.T) {
 		t.Run("invalid", func(t *testing.T) {
-			api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+			kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 
 			resp, isUserError, err := plugin.runUpdateCommand([]string{"gabesinstall", "--version", "5.13.1", "--license", "e30"}, &model.CommandArgs{UserId: "gabeid"})
 			require.Error(t, err)
@@ -102,7 +102,7 @@ func TestUpdateCommand(t *testing.T) {
 		})
 
 		t.Run("enterprise", func(t *testing.T) {
-			api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+			kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 
 			resp, isUserError, err := plugin.runUpdateCommand([]string{"gabesinstall", "--license", licenseOptionE20}, &model.CommandArgs{UserId: "gabeid"})
 			require.NoError(t, err)
@@ -111,7 +111,7 @@ func TestUpdateCommand(t *testing.T) {
 		})
 
 		t.Run("professional", func(t *testing.T) {
-			api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+			kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 
 			resp, isUserError, err := plugin.runUpdateCommand([]string{"gabesinstall", "--license", licenseOptionProfessional}, &model.CommandArgs{UserId: "gabeid"})
 			require.NoError(t, err)
@@ -120,7 +120,7 @@ func TestUpdateCommand(t *testing.T) {
 		})
 
 		t.Run("e20", func(t *testing.T) {
-			api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+			kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 
 			resp, isUserError, err := plugin.runUpdateCommand([]string{"gabesinstall", "--license", licenseOptionE20}, &model.CommandArgs{UserId: "gabeid"})
 			require.NoError(t, err)
@@ -129,7 +129,7 @@ func TestUpdateCommand(t *testing.T) {
 		})
 
 		t.Run("e10", func(t *testing.T) {
-			api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+			kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 
 			resp, isUserError, err := plugin.runUpdateCommand([]string{"gabesinstall", "--license", licenseOptionE10}, &model.CommandArgs{UserId: "gabeid"})
 			require.NoError(t, err)
@@ -138,7 +138,7 @@ func TestUpdateCommand(t *testing.T) {
 		})
 
 		t.Run("te", func(t *testing.T) {
-			api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+			kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 
 			resp, isUserError, err := plugin.runUpdateCommand([]string{"gabesinstall", "--license", licenseOptionTE}, &model.CommandArgs{UserId: "gabeid"})
 			require.NoError(t, err)
@@ -148,7 +148,7 @@ func TestUpdateCommand(t *testing.T) {
 	})
 
 	t.Run("version is equal to current version", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\", \"Version\": \"5.31.1\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\", \"Version\": \"5.31.1\"}]"))
 
 		resp, isUserError, err := plugin.runUpdateCommand([]string{"gabesinstall", "--version", "5.31.1"}, &model.CommandArgs{UserId: "gabeid"})
 		require.NoError(t, err)
@@ -158,7 +158,7 @@ func TestUpdateCommand(t *testing.T) {
 
 	t.Run("docker tag", func(t *testing.T) {
 		t.Run("valid", func(t *testing.T) {
-			api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+			kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 
 			resp, isUserError, err := plugin.runUpdateCommand([]string{"gabesinstall", "--version", "5.13.1"}, &model.CommandArgs{UserId: "gabeid"})
 			require.NoError(t, err)
@@ -167,7 +167,7 @@ func TestUpdateCommand(t *testing.T) {
 		})
 
 		t.Run("invalid", func(t *testing.T) {
-			api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+			kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 			dockerClient.tagExists = false
 			defer func() { dockerClient.tagExists = true }()
 
@@ -179,7 +179,7 @@ func TestUpdateCommand(t *testing.T) {
 	})
 
 	t.Run("no installations", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
+		kv.reset()
 
 		resp, isUserError, err := plugin.runUpdateCommand([]string{"gabesinstall2", "--version", "5.13.1"}, &model.CommandArgs{UserId: "gabeid2"})
 		require.Error(t, err)
@@ -204,7 +204,7 @@ func TestUpdateCommand(t *testing.T) {
 
 	t.Run("image", func(t *testing.T) {
 		t.Run("invalid image", func(t *testing.T) {
-			api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+			kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 			resp, isUserError, err := plugin.runUpdateCommand([]string{"gabesinstall", "--image", "mattermost/randomimage"}, &model.CommandArgs{UserId: "gabeid"})
 			require.Error(t, err)
 			assert.Contains(t, err.Error(), "invalid image name")
@@ -212,7 +212,7 @@ func TestUpdateCommand(t *testing.T) {
 			assert.Nil(t, resp)
 		})
 		t.Run("valid te-test image", func(t *testing.T) {
-			api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+			kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 			resp, isUserError, err := plugin.runUpdateCommand([]string{"gabesinstall", "--image", "mattermostdevelopment/mm-te-test"}, &model.CommandArgs{UserId: "gabeid"})
 			require.NoError(t, err)
 			assert.False(t, isUserError)
@@ -220,7 +220,7 @@ func TestUpdateCommand(t *testing.T) {
 		})
 
 		t.Run("valid ee-test image", func(t *testing.T) {
-			api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+			kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 			resp, isUserError, err := plugin.runUpdateCommand([]string{"gabesinstall", "--image", "mattermostdevelopment/mm-ee-test"}, &model.CommandArgs{UserId: "gabeid"})
 			require.NoError(t, err)
 			assert.False(t, isUserError)
@@ -232,7 +232,7 @@ func TestUpdateCommand(t *testing.T) {
 		t.Run("valid env vars", func(t *testing.T) {
 			expectedEnv := cloud.EnvVarMap{"ENV1": cloud.EnvVar{Value: "test"}, "ENV2": cloud.EnvVar{Value: "test2"}}
 
-			api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+			kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 			resp, isUserError, err := plugin.runUpdateCommand([]string{"gabesinstall", "--env", "ENV1=test,ENV2=test2"}, &model.CommandArgs{UserId: "gabeid"})
 			require.NoError(t, err)
 			assert.False(t, isUserError)
@@ -242,7 +242,7 @@ func TestUpdateCommand(t *testing.T) {
 		t.Run("clean env takes precedence", func(t *testing.T) {
 			expectedEnv := cloud.EnvVarMap{"ENV1": cloud.EnvVar{}, "ENV2": cloud.EnvVar{Value: "test2"}}
 
-			api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+			kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 			resp, isUserError, err := plugin.runUpdateCommand([]string{"gabesinstall", "--env", "ENV1=test,ENV2=test2", "--clear-env", "ENV1"}, &model.CommandArgs{UserId: "gabeid"})
 			require.NoError(t, err)
 			assert.False(t, isUserError)
@@ -250,7 +250,7 @@ func TestUpdateCommand(t *testing.T) {
 			assert.Equal(t, expectedEnv, mockCloudClient.patchRequest.PriorityEnv)
 		})
 		t.Run("invalid env vars", func(t *testing.T) {
-			api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"), nil)
+			kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"gabeid\", \"Name\": \"gabesinstall\"}]"))
 			_, isUserError, err := plugin.runUpdateCommand([]string{"gabesinstall", "--version", "5.30.0", "--env", "ENV1:test,ENV2=test2"}, &model.CommandArgs{UserId: "gabeid"})
 			require.Error(t, err)
 			assert.True(t, isUserError)
@@ -271,8 +271,7 @@ func TestUpdateCommand(t *testing.T) {
 				InstallationDTO:    cloud.InstallationDTO{Installation: &cloud.Installation{ID: cloud.NewID()}},
 			}})
 			require.NoError(t, err)
-			api.On("KVGet").Unset()
-			api.On("KVGet", mock.AnythingOfType("string")).Return(installBytes, nil)
+			kv.setInstallationsJSON(t, installBytes)
 
 			resp, isUserError, err := plugin.runUpdateCommand([]string{"gabesinstall", "--env", "ENV1=test", "--shared-installation"}, &model.CommandArgs{UserId: "gabeid"})
 			require.Error(t, err)
@@ -289,8 +288,7 @@ func TestUpdateCommand(t *testing.T) {
 				InstallationDTO:    cloud.InstallationDTO{Installation: &cloud.Installation{ID: cloud.NewID()}},
 			}})
 			require.NoError(t, err)
-			api.On("KVGet").Unset()
-			api.On("KVGet", mock.AnythingOfType("string")).Return(installBytes, nil)
+			kv.setInstallationsJSON(t, installBytes)
 
 			resp, isUserError, err := plugin.runUpdateCommand([]string{"gabesinstall", "--env", "ENV1=test", "--shared-installation"}, &model.CommandArgs{UserId: "gabeid"})
 			require.Error(t, err)
@@ -307,8 +305,7 @@ func TestUpdateCommand(t *testing.T) {
 				InstallationDTO:    cloud.InstallationDTO{Installation: &cloud.Installation{ID: cloud.NewID()}},
 			}})
 			require.NoError(t, err)
-			api.On("KVGet").Unset()
-			api.On("KVGet", mock.AnythingOfType("string")).Return(installBytes, nil)
+			kv.setInstallationsJSON(t, installBytes)
 
 			resp, isUserError, err := plugin.runUpdateCommand([]string{"gabesinstall", "--env", "ENV1=test", "--shared-installation"}, &model.CommandArgs{UserId: "gabeid"})
 			require.NoError(t, err)
@@ -324,8 +321,7 @@ func TestUpdateCommand(t *testing.T) {
 				InstallationDTO:    cloud.InstallationDTO{Installation: &cloud.Installation{ID: cloud.NewID()}},
 			}})
 			require.NoError(t, err)
-			api.On("KVGet").Unset()
-			api.On("KVGet", mock.AnythingOfType("string")).Return(installBytes, nil)
+			kv.setInstallationsJSON(t, installBytes)
 
 			resp, isUserError, err := plugin.runUpdateCommand([]string{"gabesinstall", "--env", "ENV1=test"}, &model.CommandArgs{UserId: "gabeid"})
 			assert.Contains(t, err.Error(), "no installation with the name gabesinstall found")
@@ -334,3 +330,17 @@ func TestUpdateCommand(t *testing.T) {
 		})
 	})
 }
+
+func TestUpdateCommandDryRun(t *testing.T) {
+	install := serviceTestInstall("someid", "gabesinstall", "gabeid")
+	plugin, cloudClient, _ := newServiceTestPlugin(t, []*Installation{install})
+	plugin.configuration.E20License = "raw-license-value"
+
+	resp, isUserError, err := plugin.runUpdateCommand([]string{"gabesinstall", "--license", "e20", "--size", "miniHA", "--dry-run"}, &model.CommandArgs{UserId: "gabeid"})
+	require.NoError(t, err)
+	assert.False(t, isUserError)
+	assert.Contains(t, resp.Text, "Dry run: installation gabesinstall was not updated. Changed fields: license, size.")
+	assert.Contains(t, resp.Text, `"Size": "miniHA"`)
+	assert.NotContains(t, resp.Text, "raw-license-value")
+	assert.Empty(t, cloudClient.patchInstallationID)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	// versionsAutocompleteURL is the plugin route suggesting versions for the
+	// --version flags of the slash command.
+	versionsAutocompleteURL = "/api/v1/autocomplete/versions"
+
+	versionsAutocompleteLimit = 25
+)
+
+// versionSpecSuggestions are suggested ahead of the registry tags when
+// autocompleting a version.
+var versionSpecSuggestions = []model.AutocompleteListItem{
+	{Item: versionSpecLatest, HelpText: "Newest release"},
+	{Item: versionSpecLatestESR, HelpText: "Newest extended support release"},
+	{Item: versionSpecLatestRC, HelpText: "Newest release candidate"},
+	{Item: versionSpecMaster, HelpText: "Latest development build"},
+}
+
+func (p *Plugin) getVersionsFlagSet() *flag.FlagSet {
+	versionsFlagSet := flag.NewFlagSet("versions", flag.ContinueOnError)
+	versionsFlagSet.String("image", defaultImage, fmt.Sprintf("Docker image repository to list the tags of. Can be %s", strings.Join(p.getConfiguration().allowedImages(), ", ")))
+	versionsFlagSet.String("filter", "", "Only list tags starting with the filter, e.g. '10.'")
+	versionsFlagSet.Int("limit", defaultVersionListLimit, fmt.Sprintf("Maximum number of tags to list, up to %d", maxVersionListLimit))
+
+	return versionsFlagSet
+}
+
+func (p *Plugin) runVersionsCommand(args []string, extra *model.CommandArgs) (*model.CommandResponse, bool, error) {
+	versionsFlagSet := p.getVersionsFlagSet()
+	if err := versionsFlagSet.Parse(args); err != nil {
+		return nil, true, err
+	}
+
+	image, err := versionsFlagSet.GetString("image")
+	if err != nil {
+		return nil, true, err
+	}
+	filter, err := versionsFlagSet.GetString("filter")
+	if err != nil {
+		return nil, true, err
+	}
+	limit, err := versionsFlagSet.GetInt("limit")
+	if err != nil {
+		return nil, true, err
+	}
+
+	list, err := p.listVersions(ListVersionsInput{Image: image, Filter: filter, Limit: limit})
+	if err != nil {
+		if strings.Contains(err.Error(), "invalid image name") {
+			return nil, true, err
+		}
+		return nil, false, errors.Wrap(err, "failed to list versions")
+	}
+
+	if len(list.Tags) == 0 {
+		if filter != "" {
+			return getCommandResponse(model.CommandResponseTypeEphemeral, fmt.Sprintf("No tags of %s start with %s.", list.Image, inlineCode(filter)), extra), false, nil
+		}
+		return getCommandResponse(model.CommandResponseTypeEphemeral, fmt.Sprintf("No tags found for %s.", list.Image), extra), false, nil
+	}
+
+	tags := make([]string, 0, len(list.Tags))
+	for _, tag := range list.Tags {
+		tags = append(tags, inlineCode(tag))
+	}
+
+	resp := fmt.Sprintf("Showing %d of %d tags of %s, newest first:\n\n%s\n\n", len(list.Tags), list.Total, list.Image, strings.Join(tags, ", "))
+	resp += fmt.Sprintf("Create and update also accept %s, %s, %s, release lines such as %s, and development builds such as %s and %s.",
+		inlineCode(versionSpecLatest), inlineCode(versionSpecLatestESR), inlineCode(versionSpecLatestRC), inlineCode("10.5.x"), inlineCode(versionSpecMaster), inlineCode("pr-12345"))
+
+	return getCommandResponse(model.CommandResponseTypeEphemeral, resp, extra), false, nil
+}
+
+// handleVersionsAutocomplete returns the version specs and registry tags
+// starting with the user input, for the image given earlier in the command.
+func (p *Plugin) handleVersionsAutocomplete(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" || !p.authorizedPluginUser(userID) {
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	userInput := query.Get("user_input")
+
+	suggestions := []model.AutocompleteListItem{}
+	for _, suggestion := range versionSpecSuggestions {
+		if strings.HasPrefix(suggestion.Item, userInput) {
+			suggestions = append(suggestions, suggestion)
+		}
+	}
+
+	list, err := p.listVersions(ListVersionsInput{
+		Image:  autocompleteFlagValue(query.Get("parsed"), "image"),
+		Filter: userInput,
+		Limit:  versionsAutocompleteLimit,
+	})
+	if err != nil {
+		p.API.LogWarn("Failed to list versions for autocomplete", "error", err.Error())
+	}
+	for _, tag := range list.Tags {
+		suggestions = append(suggestions, model.AutocompleteListItem{Item: tag})
+	}
+
+	data, err := json.Marshal(suggestions)
+	if err != nil {
+		p.API.LogError(errors.Wrap(err, "Unable to marshal version suggestions").Error())
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(data)
+}
+
+// autocompleteFlagValue returns the value given to a flag in the command
+// parsed so far, or an empty string when the flag is not set.
+func autocompleteFlagValue(parsed, name string) string {
+	fields := strings.Fields(parsed)
+	for i, field := range fields {
+		if field == "--"+name && i+1 < len(fields) {
+			return fields[i+1]
+		}
+		if value, ok := strings.CutPrefix(field, "--"+name+"="); ok {
+			return value
+		}
+	}
+	return ""
+}
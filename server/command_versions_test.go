@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionsCommand(t *testing.T) {
+	plugin, _, _ := newServiceTestPlugin(t, nil)
+	plugin.dockerClient = &MockedDockerClient{tags: testRegistryTags}
+
+	t.Run("lists the newest tags", func(t *testing.T) {
+		resp, isUserError, err := plugin.runVersionsCommand([]string{"--filter", "10.", "--limit", "2"}, &model.CommandArgs{})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "Showing 2 of 4 tags of mattermost/mattermost-enterprise-edition, newest first:\n\n`10.1.0-rc10`, `10.1.0-rc2`\n\n")
+	})
+
+	t.Run("no matching tags", func(t *testing.T) {
+		resp, isUserError, err := plugin.runVersionsCommand([]string{"--filter", "7."}, &model.CommandArgs{})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "No tags of mattermost/mattermost-enterprise-edition start with `7.`.")
+	})
+
+	t.Run("invalid image", func(t *testing.T) {
+		resp, isUserError, err := plugin.runVersionsCommand([]string{"--image", "someone/else"}, &model.CommandArgs{})
+		require.Error(t, err)
+		assert.True(t, isUserError)
+		assert.Nil(t, resp)
+	})
+}
+
+func TestVersionsAutocomplete(t *testing.T) {
+	plugin, _, _ := newServiceTestPlugin(t, nil)
+	plugin.dockerClient = &MockedDockerClient{tags: testRegistryTags}
+
+	doRequest := func(userID, query string) (*httptest.ResponseRecorder, []model.AutocompleteListItem) {
+		req := httptest.NewRequest(http.MethodGet, versionsAutocompleteURL+"?"+query, nil)
+		req.Header.Set("Mattermost-User-ID", userID)
+		rec := httptest.NewRecorder()
+
+		plugin.handleVersionsAutocomplete(rec, req)
+
+		items := []model.AutocompleteListItem{}
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &items))
+		}
+		return rec, items
+	}
+
+	t.Run("suggests version specs and matching tags", func(t *testing.T) {
+		rec, items := doRequest("owner", "user_input=latest-")
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Len(t, items, 2)
+		assert.Equal(t, versionSpecLatestESR, items[0].Item)
+		assert.Equal(t, versionSpecLatestRC, items[1].Item)
+
+		rec, items = doRequest("owner", "user_input=9.5&parsed=%2Fcloud+create+test+--image+mattermostdevelopment%2Fmattermost-enterprise-edition+--version")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, []model.AutocompleteListItem{{Item: "9.5.3"}, {Item: "9.5.0"}}, items)
+	})
+
+	t.Run("unauthenticated requests are rejected", func(t *testing.T) {
+		rec, _ := doRequest("", "user_input=9")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
+
+func TestAutocompleteFlagValue(t *testing.T) {
+	assert.Equal(t, imageEEDev, autocompleteFlagValue("/cloud create test --image "+imageEEDev+" --version", "image"))
+	assert.Equal(t, imageEEDev, autocompleteFlagValue("/cloud create test --image="+imageEEDev, "image"))
+	assert.Empty(t, autocompleteFlagValue("/cloud create test --image", "image"))
+	assert.Empty(t, autocompleteFlagValue("/cloud create test --version", "image"))
+}
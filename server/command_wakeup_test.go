@@ -19,12 +19,12 @@ func TestWakeUpCommand(t *testing.T) {
 	plugin.cloudClient = mockedCloudClient
 
 	api := &plugintest.API{}
-	api.On("KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(true, nil)
+	kv := newFakeKVStore(api)
 	api.On("LogWarn", mock.AnythingOfType("string")).Return(nil)
 	plugin.SetAPI(api)
 
 	t.Run("wake up installation successfully", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"))
 
 		resp, isUserError, err := plugin.runWakeUpCommand([]string{"joramsinstall"}, &model.CommandArgs{UserId: "joramid"})
 		require.Nil(t, err)
@@ -33,7 +33,7 @@ func TestWakeUpCommand(t *testing.T) {
 	})
 
 	t.Run("hibernate installation successfully with caps in name to demonstrate name case insensitivity", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"JoramsInstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"JoramsInstall\"}]"))
 
 		resp, isUserError, err := plugin.runWakeUpCommand([]string{"joramsinstall"}, &model.CommandArgs{UserId: "joramid"})
 		require.Nil(t, err)
@@ -42,7 +42,7 @@ func TestWakeUpCommand(t *testing.T) {
 	})
 
 	t.Run("no installations", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return(nil, nil)
+		kv.reset()
 
 		resp, isUserError, err := plugin.runWakeUpCommand([]string{"joramsinstall"}, &model.CommandArgs{UserId: "joramid2"})
 		require.NotNil(t, err)
@@ -60,7 +60,7 @@ func TestWakeUpCommand(t *testing.T) {
 	})
 
 	t.Run("installation is not hibernating", func(t *testing.T) {
-		api.On("KVGet", mock.AnythingOfType("string")).Return([]byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"), nil)
+		kv.setInstallationsJSON(t, []byte("[{\"ID\": \"someid\", \"OwnerID\": \"joramid\", \"Name\": \"joramsinstall\"}]"))
 		mockedCloudClient.overrideGetInstallationDTO = &cloud.InstallationDTO{Installation: &cloud.Installation{ID: "someid", OwnerID: "joramid", State: cloud.InstallationStateStable}}
 
 		resp, isUserError, err := plugin.runWakeUpCommand([]string{"joramsinstall"}, &model.CommandArgs{UserId: "joramid"})
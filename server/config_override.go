@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+// configOverrideResult is the outcome of applying a config override.
+type configOverrideResult struct {
+	Key   string
+	Value string
+	Err   error
+}
+
+// parseConfigOverrides parses config overrides given in the form
+// Section.Setting=value and checks them against the Mattermost config.
+func parseConfigOverrides(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	overrides := make(map[string]string, len(values))
+	for _, value := range values {
+		key, setting, found := strings.Cut(value, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, errors.Errorf("invalid config override %s: must be in the form Section.Setting=value", value)
+		}
+		if _, ok := overrides[key]; ok {
+			return nil, errors.Errorf("invalid config override %s: %s is defined more than once", value, key)
+		}
+		overrides[key] = setting
+	}
+
+	if err := validateConfigOverrides(overrides); err != nil {
+		return nil, err
+	}
+
+	return overrides, nil
+}
+
+// validateConfigOverrides checks that every override names a Mattermost
+// config setting and that its value has the type of the setting.
+func validateConfigOverrides(overrides map[string]string) error {
+	config := &model.Config{}
+	for _, key := range sortedStringMapKeys(overrides) {
+		if err := setConfigValue(config, key, overrides[key]); err != nil {
+			return errors.Wrapf(err, "invalid config override %s=%s", key, maskConfigOverrides(overrides)[key])
+		}
+	}
+	return nil
+}
+
+// setConfigValue sets the config setting named by a dotted path such as
+// ServiceSettings.EnableDeveloper, parsing the value for the type of the
+// setting. Lists are given as comma-separated values.
+func setConfigValue(config *model.Config, key, value string) error {
+	field, err := configField(config, key)
+	if err != nil {
+		return err
+	}
+
+	fieldType := field.Type()
+	if fieldType.Kind() == reflect.Pointer {
+		fieldType = fieldType.Elem()
+	}
+
+	parsed := reflect.New(fieldType).Elem()
+	switch fieldType.Kind() {
+	case reflect.String:
+		parsed.SetString(value)
+	case reflect.Bool:
+		b, parseErr := strconv.ParseBool(value)
+		if parseErr != nil {
+			return errors.Errorf("%s must be true or false", key)
+		}
+		parsed.SetBool(b)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		i, parseErr := strconv.ParseInt(value, 10, fieldType.Bits())
+		if parseErr != nil {
+			return errors.Errorf("%s must be a whole number", key)
+		}
+		parsed.SetInt(i)
+	case reflect.Float64:
+		f, parseErr := strconv.ParseFloat(value, 64)
+		if parseErr != nil {
+			return errors.Errorf("%s must be a number", key)
+		}
+		parsed.SetFloat(f)
+	case reflect.Slice:
+		if fieldType.Elem().Kind() != reflect.String {
+			return errors.Errorf("%s is a %s setting which cannot be overridden", key, fieldType)
+		}
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		parsed.Set(reflect.ValueOf(items).Convert(fieldType))
+	default:
+		return errors.Errorf("%s is a %s setting which cannot be overridden", key, fieldType)
+	}
+
+	if field.Kind() == reflect.Pointer {
+		pointer := reflect.New(fieldType)
+		pointer.Elem().Set(parsed)
+		field.Set(pointer)
+		return nil
+	}
+	field.Set(parsed)
+
+	return nil
+}
+
+// configField returns the settable field of the config named by a dotted
+// path, allocating the sections along the way.
+func configField(config *model.Config, key string) (reflect.Value, error) {
+	names := strings.Split(key, ".")
+	if len(names) < 2 {
+		return reflect.Value{}, errors.Errorf("%s must name a setting in the form Section.Setting", key)
+	}
+
+	value := reflect.ValueOf(config).Elem()
+	for i, name := range names {
+		if value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				value.Set(reflect.New(value.Type().Elem()))
+			}
+			value = value.Elem()
+		}
+		if value.Kind() != reflect.Struct {
+			return reflect.Value{}, errors.Errorf("%s is not a config section", strings.Join(names[:i], "."))
+		}
+
+		field, ok := value.Type().FieldByName(name)
+		if !ok || !field.IsExported() {
+			return reflect.Value{}, errors.Errorf("%s is not a Mattermost config setting", key)
+		}
+		value = value.FieldByIndex(field.Index)
+	}
+
+	if value.Kind() == reflect.Struct || (value.Kind() == reflect.Pointer && value.Type().Elem().Kind() == reflect.Struct) {
+		return reflect.Value{}, errors.Errorf("%s is a config section, not a setting", key)
+	}
+
+	return value, nil
+}
+
+// sensitiveConfigSettingWords are the words naming config settings whose
+// values are secrets.
+var sensitiveConfigSettingWords = []string{"Password", "Secret", "Key", "DataSource"}
+
+// isSensitiveConfigSetting returns whether the value of the setting named by
+// a dotted path is a secret.
+func isSensitiveConfigSetting(key string) bool {
+	setting := key[strings.LastIndex(key, ".")+1:]
+	for _, word := range sensitiveConfigSettingWords {
+		if strings.Contains(setting, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// maskConfigOverrides returns a copy of the config overrides with the values
+// of sensitive settings hidden.
+func maskConfigOverrides(overrides map[string]string) map[string]string {
+	if overrides == nil {
+		return nil
+	}
+
+	masked := make(map[string]string, len(overrides))
+	for key, value := range overrides {
+		if isSensitiveConfigSetting(key) {
+			value = "hidden"
+		}
+		masked[key] = value
+	}
+	return masked
+}
+
+// applyConfigOverrides applies the config overrides of the installation one
+// at a time, so that a setting rejected by the server doesn't prevent the
+// others from being applied.
+func (p *Plugin) applyConfigOverrides(client *model.Client4, config *model.Config, install *Installation) []configOverrideResult {
+	results := make([]configOverrideResult, 0, len(install.ConfigOverrides))
+	for _, key := range sortedStringMapKeys(install.ConfigOverrides) {
+		result := configOverrideResult{Key: key, Value: install.ConfigOverrides[key]}
+
+		field, err := configField(config, key)
+		if err != nil {
+			result.Err = err
+		} else {
+			previous := reflect.ValueOf(field.Interface())
+			if err = setConfigValue(config, key, result.Value); err != nil {
+				result.Err = err
+			} else if updated, _, updateErr := client.UpdateConfig(context.Background(), config); updateErr != nil {
+				field.Set(previous)
+				result.Err = errors.Wrap(updateErr, "failed to update config")
+			} else {
+				config = updated
+			}
+		}
+
+		if result.Err != nil {
+			p.API.LogWarn("Failed to apply installation config override", "installation", install.Name, "setting", key, "error", result.Err.Error())
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// configOverrideMessage describes the outcome of applying the config
+// overrides of an installation, or returns an empty string when it has none.
+// The values of sensitive settings are hidden.
+func configOverrideMessage(results []configOverrideResult) string {
+	if len(results) == 0 {
+		return ""
+	}
+
+	message := "Config overrides:\n\n| Setting | Value | Result |\n| -- | -- | -- |\n"
+	for _, result := range results {
+		outcome := "Applied"
+		if result.Err != nil {
+			outcome = "Failed: " + result.Err.Error()
+		}
+		value := inlineCode(result.Value)
+		if isSensitiveConfigSetting(result.Key) {
+			value = "hidden"
+		}
+		message += fmt.Sprintf("| %s | %s | %s |\n", inlineCode(result.Key), value, outcome)
+	}
+
+	return message
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfigOverrides(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		overrides, err := parseConfigOverrides([]string{
+			"ServiceSettings.EnableDeveloper=false",
+			"TeamSettings.MaxUsersPerTeam=100",
+			"ServiceSettings.SiteURL=https://example.com/?a=b",
+			"ServiceSettings.TrustedProxyIPHeader=X-Forwarded-For, X-Real-IP",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"ServiceSettings.EnableDeveloper":      "false",
+			"TeamSettings.MaxUsersPerTeam":         "100",
+			"ServiceSettings.SiteURL":              "https://example.com/?a=b",
+			"ServiceSettings.TrustedProxyIPHeader": "X-Forwarded-For, X-Real-IP",
+		}, overrides)
+
+		overrides, err = parseConfigOverrides(nil)
+		require.NoError(t, err)
+		assert.Nil(t, overrides)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for value, expected := range map[string]string{
+			"ServiceSettings.EnableDeveloper":      "invalid config override ServiceSettings.EnableDeveloper: must be in the form Section.Setting=value",
+			"ServiceSettings.EnableDeveloper=yes":  "invalid config override ServiceSettings.EnableDeveloper=yes: ServiceSettings.EnableDeveloper must be true or false",
+			"TeamSettings.MaxUsersPerTeam=many":    "invalid config override TeamSettings.MaxUsersPerTeam=many: TeamSettings.MaxUsersPerTeam must be a whole number",
+			"ServiceSettings.NoSuchSetting=1":      "invalid config override ServiceSettings.NoSuchSetting=1: ServiceSettings.NoSuchSetting is not a Mattermost config setting",
+			"ServiceSettings=1":                    "invalid config override ServiceSettings=1: ServiceSettings must name a setting in the form Section.Setting",
+			"ServiceSettings.SiteURL.Path=/":       "invalid config override ServiceSettings.SiteURL.Path=/: ServiceSettings.SiteURL is not a config section",
+			"PluginSettings.Plugins=x":             "invalid config override PluginSettings.Plugins=x: PluginSettings.Plugins is a map[string]map[string]interface {} setting which cannot be overridden",
+			"ServiceSettings.EnableGifPicker=true": "",
+		} {
+			_, err := parseConfigOverrides([]string{value})
+			if expected == "" {
+				require.NoError(t, err, value)
+				continue
+			}
+			require.EqualError(t, err, expected)
+		}
+
+		_, err := parseConfigOverrides([]string{"TeamSettings.SiteName=a", "TeamSettings.SiteName=b"})
+		require.EqualError(t, err, "invalid config override TeamSettings.SiteName=b: TeamSettings.SiteName is defined more than once")
+	})
+}
+
+func TestSetConfigValue(t *testing.T) {
+	config := &model.Config{}
+
+	require.NoError(t, setConfigValue(config, "ServiceSettings.EnableDeveloper", "true"))
+	require.NoError(t, setConfigValue(config, "TeamSettings.MaxUsersPerTeam", "100"))
+	require.NoError(t, setConfigValue(config, "ExperimentalSettings.LinkMetadataTimeoutMilliseconds", "5000"))
+	require.NoError(t, setConfigValue(config, "ServiceSettings.TrustedProxyIPHeader", "X-Forwarded-For, X-Real-IP"))
+
+	require.NotNil(t, config.ServiceSettings.EnableDeveloper)
+	assert.True(t, *config.ServiceSettings.EnableDeveloper)
+	require.NotNil(t, config.TeamSettings.MaxUsersPerTeam)
+	assert.Equal(t, 100, *config.TeamSettings.MaxUsersPerTeam)
+	require.NotNil(t, config.ExperimentalSettings.LinkMetadataTimeoutMilliseconds)
+	assert.Equal(t, int64(5000), *config.ExperimentalSettings.LinkMetadataTimeoutMilliseconds)
+	assert.Equal(t, []string{"X-Forwarded-For", "X-Real-IP"}, config.ServiceSettings.TrustedProxyIPHeader)
+}
+
+func TestConfigOverrideMessage(t *testing.T) {
+	assert.Empty(t, configOverrideMessage(nil))
+
+	message := configOverrideMessage([]configOverrideResult{
+		{Key: "ServiceSettings.EnableGifPicker", Value: "false"},
+		{Key: "TeamSettings.MaxUsersPerTeam", Value: "0", Err: errors.New("failed to update config: invalid max users per team")},
+		{Key: "EmailSettings.SMTPPassword", Value: "smtp-secret"},
+		{Key: "SqlSettings.DataSource", Value: "postgres://secret-dsn"},
+	})
+	assert.Equal(t, "Config overrides:\n\n| Setting | Value | Result |\n| -- | -- | -- |\n"+
+		"| `ServiceSettings.EnableGifPicker` | `false` | Applied |\n"+
+		"| `TeamSettings.MaxUsersPerTeam` | `0` | Failed: failed to update config: invalid max users per team |\n"+
+		"| `EmailSettings.SMTPPassword` | hidden | Applied |\n"+
+		"| `SqlSettings.DataSource` | hidden | Applied |\n", message)
+}
+
+func TestIsSensitiveConfigSetting(t *testing.T) {
+	for _, key := range []string{"EmailSettings.SMTPPassword", "GitLabSettings.Secret", "FileSettings.AmazonS3SecretAccessKey", "SqlSettings.DataSource", "ServiceSettings.GoogleDeveloperKey"} {
+		assert.True(t, isSensitiveConfigSetting(key), key)
+	}
+	for _, key := range []string{"ServiceSettings.EnableGifPicker", "TeamSettings.SiteName", "PasswordSettings.MinimumLength"} {
+		assert.False(t, isSensitiveConfigSetting(key), key)
+	}
+}
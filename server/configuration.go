@@ -3,7 +3,13 @@ package main
 import (
 	"net/url"
 	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/blang/semver/v4"
 	cloud "github.com/mattermost/mattermost-cloud/model"
 	"github.com/pkg/errors"
 )
@@ -38,9 +44,9 @@ var validLicenseOptions = []string{
 	licenseOptionTE,
 }
 
-// dockerRepoWhitelist is the full list of valid docker repositories which
-// Mattermost servers can be created from.
-var dockerRepoWhitelist = []string{
+// defaultAllowedImages is the list of docker repositories which Mattermost
+// servers can be created from when AllowedImages is not configured.
+var defaultAllowedImages = []string{
 	imageEE,
 	imageEECloud,
 	imageEEFips,
@@ -52,6 +58,15 @@ var dockerRepoWhitelist = []string{
 	imageTEDev,
 }
 
+// defaultInstallationSizes is the list of installation sizes which can be
+// requested when InstallationSizes is not configured.
+var defaultInstallationSizes = []string{"miniSingleton", "miniHA"}
+
+// imageRepositoryMatcher matches docker image repository names such as
+// mattermost/mattermost-enterprise-edition, optionally starting with a
+// registry host such as registry.example.com:5000/.
+var imageRepositoryMatcher = regexp.MustCompile(`^(?:[a-z0-9.-]+(?::[0-9]+)?/)?[a-z0-9]+(?:[._-][a-z0-9]+)*(?:/[a-z0-9]+(?:[._-][a-z0-9]+)*)*$`)
+
 // configuration captures the plugin's external configuration as exposed in the Mattermost server
 // configuration, as well as values computed from the configuration. Any public fields will be
 // deserialized from the Mattermost server configuration in OnConfigurationChange.
@@ -73,7 +88,18 @@ type configuration struct {
 	AllowedEmailDomain                        string
 	DeletionLockInstallationsAllowedPerPerson string
 	ProvisioningServerWebhookSecret           string
+	CredentialsEncryptionKey                  string
 	ScheduledDeletionHours                    string
+	MaxInstallationTTLHours                   string
+	ExpiryReminderHours                       string
+	ESRVersions                               string
+	AllowedImages                             string
+	InstallationSizes                         string
+	DockerRegistries                          string
+	ReleaseSource                             string
+	GithubToken                               string
+	PinnedReleaseVersion                      string
+	TestDataProfiles                          string
 
 	// License
 	E10License                string
@@ -154,9 +180,213 @@ func (c *configuration) IsValid() error {
 		}
 	}
 
+	if len(c.MaxInstallationTTLHours) != 0 {
+		hours, err := strconv.Atoi(c.MaxInstallationTTLHours)
+		if err != nil || hours < 0 {
+			return errors.Errorf("MaxInstallationTTLHours must be a non-negative number of hours, got %s", c.MaxInstallationTTLHours)
+		}
+	}
+
+	if _, err := parseExpiryReminderHours(c.ExpiryReminderHours); err != nil {
+		return err
+	}
+
+	if _, err := parseESRVersions(c.ESRVersions); err != nil {
+		return err
+	}
+
+	allowedImages, err := parseAllowedImages(c.AllowedImages)
+	if err != nil {
+		return err
+	}
+	// The default image is used when no image is requested, and its tags are
+	// the registry release source.
+	if len(allowedImages) > 0 && !Contains(allowedImages, defaultImage) {
+		return errors.Errorf("AllowedImages must include the default image %s, got %s", defaultImage, strings.Join(allowedImages, ","))
+	}
+
+	if _, err := parseInstallationSizes(c.InstallationSizes); err != nil {
+		return err
+	}
+
+	if _, err := parseDockerRegistries(c.DockerRegistries); err != nil {
+		return err
+	}
+
+	if _, err := parseTestDataProfiles(c.TestDataProfiles); err != nil {
+		return err
+	}
+
+	if len(c.ReleaseSource) != 0 && !Contains(validReleaseSources, c.ReleaseSource) {
+		return errors.Errorf("ReleaseSource must be one of %s, got %s", strings.Join(validReleaseSources, ", "), c.ReleaseSource)
+	}
+
+	if c.releaseSource() == releaseSourcePinned {
+		if _, err := semver.Parse(c.PinnedReleaseVersion); err != nil {
+			return errors.Errorf("PinnedReleaseVersion must be a release version such as 10.5.1 when ReleaseSource is pinned, got %s", c.PinnedReleaseVersion)
+		}
+	}
+
 	return nil
 }
 
+// maxInstallationTTL returns the longest time an installation may be
+// scheduled to live for. It returns 0 when there is no maximum.
+func (c *configuration) maxInstallationTTL() time.Duration {
+	hours, err := strconv.Atoi(c.MaxInstallationTTLHours)
+	if err != nil || hours <= 0 {
+		return 0
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// expiryReminderLeadTimes returns how long before the scheduled deletion of
+// an installation its owner is reminded, longest first.
+func (c *configuration) expiryReminderLeadTimes() []time.Duration {
+	leadTimes, err := parseExpiryReminderHours(c.ExpiryReminderHours)
+	if err != nil {
+		return nil
+	}
+	return leadTimes
+}
+
+func parseExpiryReminderHours(value string) ([]time.Duration, error) {
+	leadTimes := []time.Duration{}
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		hours, err := strconv.Atoi(field)
+		if err != nil || hours <= 0 {
+			return nil, errors.Errorf("ExpiryReminderHours must be a comma-separated list of positive numbers of hours, got %s", value)
+		}
+		leadTimes = append(leadTimes, time.Duration(hours)*time.Hour)
+	}
+	sort.Slice(leadTimes, func(i, j int) bool { return leadTimes[i] > leadTimes[j] })
+
+	return leadTimes, nil
+}
+
+// esrVersions returns the major and minor versions of the release lines with
+// extended support.
+func (c *configuration) esrVersions() []semver.Version {
+	versions, err := parseESRVersions(c.ESRVersions)
+	if err != nil {
+		return nil
+	}
+	return versions
+}
+
+func parseESRVersions(value string) ([]semver.Version, error) {
+	versions := []semver.Version{}
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		version, err := semver.ParseTolerant(field)
+		if err != nil || version.Patch != 0 || len(version.Pre) > 0 || strings.Count(field, ".") != 1 {
+			return nil, errors.Errorf("ESRVersions must be a comma-separated list of release lines such as 9.11, got %s", value)
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, nil
+}
+
+// allowedImages returns the docker repositories which Mattermost servers can
+// be created from.
+func (c *configuration) allowedImages() []string {
+	images, err := parseAllowedImages(c.AllowedImages)
+	if err != nil || len(images) == 0 {
+		return defaultAllowedImages
+	}
+	return images
+}
+
+func parseAllowedImages(value string) ([]string, error) {
+	images := []string{}
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !imageRepositoryMatcher.MatchString(field) {
+			return nil, errors.Errorf("AllowedImages must be a comma-separated list of docker image repositories such as mattermost/mattermost-enterprise-edition, got %s", field)
+		}
+		if !Contains(images, field) {
+			images = append(images, field)
+		}
+	}
+
+	return images, nil
+}
+
+// installationSizes returns the installation sizes which can be requested,
+// the first being the default.
+func (c *configuration) installationSizes() []string {
+	sizes, err := parseInstallationSizes(c.InstallationSizes)
+	if err != nil || len(sizes) == 0 {
+		return defaultInstallationSizes
+	}
+	return sizes
+}
+
+func parseInstallationSizes(value string) ([]string, error) {
+	sizes := []string{}
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if _, err := cloud.GetInstallationSize(field); err != nil {
+			return nil, errors.Wrapf(err, "InstallationSizes must be a comma-separated list of sizes supported by the provisioner, got %s", field)
+		}
+		if !Contains(sizes, field) {
+			sizes = append(sizes, field)
+		}
+	}
+
+	return sizes, nil
+}
+
+// dockerRegistries returns the private registries images are looked up in
+// instead of Docker Hub.
+func (c *configuration) dockerRegistries() []DockerRegistry {
+	registries, err := parseDockerRegistries(c.DockerRegistries)
+	if err != nil {
+		return nil
+	}
+	return registries
+}
+
+// testDataProfiles returns the profiles test data can be generated with, the
+// first being the default.
+func (c *configuration) testDataProfiles() []TestDataProfile {
+	profiles, err := parseTestDataProfiles(c.TestDataProfiles)
+	if err != nil || len(profiles) == 0 {
+		return defaultTestDataProfiles
+	}
+	return profiles
+}
+
+func (c *configuration) testDataProfileNames() []string {
+	names := []string{}
+	for _, profile := range c.testDataProfiles() {
+		names = append(names, profile.Name)
+	}
+	return names
+}
+
+// releaseSource returns where the latest Mattermost releases are looked up.
+func (c *configuration) releaseSource() string {
+	if c.ReleaseSource == "" {
+		return releaseSourceGithub
+	}
+	return c.ReleaseSource
+}
+
 // getConfiguration retrieves the active configuration under lock, making it safe to use
 // concurrently. The active configuration may change underneath the client of this method, but
 // the struct returned by this API call is considered immutable.
@@ -208,14 +438,30 @@ func (p *Plugin) OnConfigurationChange() error {
 	}
 
 	// Always reinitialize dockerClient to ensure it's properly set even if called before OnActivate
-	p.dockerClient = NewDockerClient()
+	p.dockerClient = NewDockerClient(configuration.dockerRegistries()...)
 
 	if p.configuration != nil {
 		p.setCloudClient()
+
+		// Look the releases up again once the release source changes.
+		if p.configuration.releaseSource() != configuration.releaseSource() || p.configuration.PinnedReleaseVersion != configuration.PinnedReleaseVersion {
+			p.setReleaseCache(nil)
+		}
 	}
 
 	p.setConfiguration(configuration)
 
+	// Refresh the image and size options offered by the slash command and
+	// the MCP tools once the plugin is active.
+	if p.BotUserID != "" {
+		if err := p.API.RegisterCommand(p.getCommand()); err != nil {
+			return errors.Wrap(err, "failed to register command")
+		}
+	}
+	if server := p.currentMCPServer(); server != nil {
+		p.registerMCPTools(server)
+	}
+
 	return nil
 }
 
@@ -254,3 +500,19 @@ func (p *Plugin) getLicenseValue(licenseOption string) string {
 
 	return ""
 }
+
+// getLicenseOption returns the license option configured with the given
+// license value. It returns false when no option matches.
+func (p *Plugin) getLicenseOption(licenseValue string) (string, bool) {
+	if licenseValue == "" {
+		return licenseOptionTE, true
+	}
+
+	for _, licenseOption := range validLicenseOptions {
+		if p.getLicenseValue(licenseOption) == licenseValue {
+			return licenseOption, true
+		}
+	}
+
+	return "", false
+}
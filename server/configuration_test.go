@@ -2,7 +2,9 @@ package main
 
 import (
 	"testing"
+	"time"
 
+	"github.com/blang/semver/v4"
 	"github.com/mattermost/mattermost-cloud/model"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -70,6 +72,140 @@ func TestConfigurationIsValid(t *testing.T) {
 			require.NoError(t, config.IsValid())
 		})
 	})
+
+	t.Run("expiry reminder hours", func(t *testing.T) {
+		config := baseConfiguration
+		t.Run("valid", func(t *testing.T) {
+			config.ExpiryReminderHours = "2, 24"
+			require.NoError(t, config.IsValid())
+			assert.Equal(t, []time.Duration{24 * time.Hour, 2 * time.Hour}, config.expiryReminderLeadTimes())
+		})
+		t.Run("invalid", func(t *testing.T) {
+			config.ExpiryReminderHours = "24,soon"
+			require.Error(t, config.IsValid())
+			config.ExpiryReminderHours = "0"
+			require.Error(t, config.IsValid())
+		})
+	})
+
+	t.Run("esr versions", func(t *testing.T) {
+		config := baseConfiguration
+		t.Run("valid", func(t *testing.T) {
+			config.ESRVersions = "9.11, 10.5"
+			require.NoError(t, config.IsValid())
+			assert.Equal(t, []semver.Version{semver.MustParse("9.11.0"), semver.MustParse("10.5.0")}, config.esrVersions())
+		})
+		t.Run("invalid", func(t *testing.T) {
+			config.ESRVersions = "9.11.2"
+			require.Error(t, config.IsValid())
+			config.ESRVersions = "esr"
+			require.Error(t, config.IsValid())
+		})
+	})
+
+	t.Run("allowed images", func(t *testing.T) {
+		config := baseConfiguration
+		t.Run("defaults", func(t *testing.T) {
+			assert.Equal(t, defaultAllowedImages, config.allowedImages())
+		})
+		t.Run("valid", func(t *testing.T) {
+			config.AllowedImages = "mattermost/mattermost-enterprise-edition, mattermostdevelopment/mm-ee-new,mattermost/mattermost-enterprise-edition,registry.example.com:5000/team/mattermost"
+			require.NoError(t, config.IsValid())
+			assert.Equal(t, []string{imageEE, "mattermostdevelopment/mm-ee-new", "registry.example.com:5000/team/mattermost"}, config.allowedImages())
+		})
+		t.Run("invalid", func(t *testing.T) {
+			config.AllowedImages = "mattermost/mattermost-enterprise-edition:9.11.0"
+			require.Error(t, config.IsValid())
+			config.AllowedImages = "Mattermost/EE"
+			require.Error(t, config.IsValid())
+		})
+		t.Run("without the default image", func(t *testing.T) {
+			config.AllowedImages = "mattermostdevelopment/mm-ee-new"
+			require.EqualError(t, config.IsValid(), "AllowedImages must include the default image mattermost/mattermost-enterprise-edition, got mattermostdevelopment/mm-ee-new")
+		})
+	})
+
+	t.Run("installation sizes", func(t *testing.T) {
+		config := baseConfiguration
+		t.Run("defaults", func(t *testing.T) {
+			assert.Equal(t, defaultInstallationSizes, config.installationSizes())
+		})
+		t.Run("valid", func(t *testing.T) {
+			config.InstallationSizes = "miniHA, provisionerXL, miniSingleton"
+			require.NoError(t, config.IsValid())
+			assert.Equal(t, []string{"miniHA", "provisionerXL", "miniSingleton"}, config.installationSizes())
+		})
+		t.Run("invalid", func(t *testing.T) {
+			config.InstallationSizes = "miniSingleton,huge"
+			require.Error(t, config.IsValid())
+		})
+	})
+
+	t.Run("docker registries", func(t *testing.T) {
+		config := baseConfiguration
+		t.Run("valid", func(t *testing.T) {
+			config.DockerRegistries = `[{"image_prefix": "registry.example.com/", "url": "https://registry.example.com", "token_url": "https://registry.example.com/token", "username": "user", "password": "secret"}]`
+			require.NoError(t, config.IsValid())
+			assert.Equal(t, []DockerRegistry{{
+				ImagePrefix: "registry.example.com/",
+				URL:         "https://registry.example.com",
+				TokenURL:    "https://registry.example.com/token",
+				Username:    "user",
+				Password:    "secret",
+			}}, config.dockerRegistries())
+		})
+		t.Run("invalid", func(t *testing.T) {
+			for _, registries := range []string{
+				`{"image_prefix": "registry.example.com/"}`,
+				`[{"url": "https://registry.example.com"}]`,
+				`[{"image_prefix": "registry.example.com/", "url": "registry.example.com"}]`,
+				`[{"image_prefix": "registry.example.com/", "url": "https://registry.example.com", "username": "user"}]`,
+				`[{"image_prefix": "registry.example.com/", "url": "https://registry.example.com", "username": "user", "password": "secret", "bearer_token": "token"}]`,
+			} {
+				config.DockerRegistries = registries
+				require.Error(t, config.IsValid(), registries)
+			}
+		})
+	})
+
+	t.Run("release source", func(t *testing.T) {
+		config := baseConfiguration
+		t.Run("defaults to github", func(t *testing.T) {
+			assert.Equal(t, releaseSourceGithub, config.releaseSource())
+		})
+		t.Run("valid", func(t *testing.T) {
+			config.ReleaseSource = releaseSourceRegistry
+			require.NoError(t, config.IsValid())
+			config.ReleaseSource = releaseSourcePinned
+			config.PinnedReleaseVersion = "10.5.1"
+			require.NoError(t, config.IsValid())
+		})
+		t.Run("invalid", func(t *testing.T) {
+			config.ReleaseSource = "gitlab"
+			require.Error(t, config.IsValid())
+			config.ReleaseSource = releaseSourcePinned
+			config.PinnedReleaseVersion = "10.5"
+			require.Error(t, config.IsValid())
+		})
+	})
+
+	t.Run("test data profiles", func(t *testing.T) {
+		config := baseConfiguration
+		t.Run("defaults", func(t *testing.T) {
+			assert.Equal(t, []string{"small", "medium", "large"}, config.testDataProfileNames())
+		})
+		t.Run("valid", func(t *testing.T) {
+			config.TestDataProfiles = `[{"name": "tiny", "teams": 1, "channels_per_team": 2, "users": 3, "posts_per_channel": 4, "threads": 5}]`
+			require.NoError(t, config.IsValid())
+			assert.Equal(t, []string{"tiny"}, config.testDataProfileNames())
+		})
+		t.Run("invalid", func(t *testing.T) {
+			config.TestDataProfiles = `{"name": "tiny"}`
+			require.Error(t, config.IsValid())
+			config.TestDataProfiles = `[{"name": "tiny", "users": -1}]`
+			require.Error(t, config.IsValid())
+		})
+	})
 }
 
 func TestGetLicenseValue(t *testing.T) {
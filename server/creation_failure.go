@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	cloud "github.com/mattermost/mattermost-cloud/model"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	creationFailureActionDelete = "delete"
+	creationFailureActionRetry  = "retry"
+)
+
+// isInstallationCreationFailedState returns true for the state of an
+// installation whose creation failed and can be retried. An installation
+// without compatible clusters hasn't failed, as the provisioner keeps retrying
+// its creation until a cluster has capacity for it.
+func isInstallationCreationFailedState(state string) bool {
+	return state == cloud.InstallationStateCreationFailed
+}
+
+// reportCreationFailure sends the owner a DM with what is known about the
+// failed creation of the installation, and buttons to delete the
+// installation or retry its creation.
+func (p *Plugin) reportCreationFailure(install *Installation, previousState string) error {
+	clusterInstallations, err := p.cloudClient.GetClusterInstallations(&cloud.GetClusterInstallationsRequest{
+		Paging:         cloud.AllPagesNotDeleted(),
+		InstallationID: install.ID,
+	})
+	if err != nil {
+		p.API.LogWarn("Failed to get ClusterInstallations of failed installation", "installation", install.Name, "error", err.Error())
+	}
+
+	installationLogsURL, err := getStringFromTemplate(installationLogsURLTmpl, install)
+	if err != nil {
+		return err
+	}
+	provisionerLogsURL, err := getStringFromTemplate(provisionerLogsURLTmpl, install)
+	if err != nil {
+		return err
+	}
+
+	text := fmt.Sprintf("The provisioner moved installation %s from %s to %s.\n\n%s\nGrafana logs for this installation:\n\n- [Installation logs](%s)\n- [Provisioner logs](%s)",
+		install.Name, inlineCode(previousState), inlineCode(install.State),
+		clusterInstallationsTable(clusterInstallations),
+		installationLogsURL, provisionerLogsURL,
+	)
+
+	channel, appErr := p.API.GetDirectChannel(install.OwnerID, p.BotUserID)
+	if appErr != nil {
+		return appErr
+	}
+
+	post := &model.Post{
+		UserId:    p.BotUserID,
+		ChannelId: channel.Id,
+		Message:   fmt.Sprintf("Creation of installation %s failed.", install.Name),
+	}
+	model.ParseSlackAttachment(post, []*model.SlackAttachment{{
+		Fallback: fmt.Sprintf("Creation of installation %s failed with state %s.", install.Name, install.State),
+		Text:     text,
+		Actions: []*model.PostAction{
+			creationFailureAction(install.ID, creationFailureActionRetry, "Retry", "primary"),
+			creationFailureAction(install.ID, creationFailureActionDelete, "Delete", "danger"),
+		},
+	}})
+
+	if _, appErr = p.API.CreatePost(post); appErr != nil {
+		return appErr
+	}
+
+	return nil
+}
+
+// clusterInstallationsTable describes the ClusterInstallations of a failed
+// installation, if any were created.
+func clusterInstallationsTable(clusterInstallations []*cloud.ClusterInstallation) string {
+	if len(clusterInstallations) == 0 {
+		return "No ClusterInstallations were created.\n"
+	}
+
+	table := "| ClusterInstallation | Cluster | State |\n| -- | -- | -- |\n"
+	for _, clusterInstallation := range clusterInstallations {
+		table += fmt.Sprintf("| %s | %s | %s |\n", inlineCode(clusterInstallation.ID), inlineCode(clusterInstallation.ClusterID), clusterInstallation.State)
+	}
+	return table
+}
+
+func creationFailureAction(installationID, action, name, style string) *model.PostAction {
+	return &model.PostAction{
+		Id:    action,
+		Type:  model.PostActionTypeButton,
+		Name:  name,
+		Style: style,
+		Integration: &model.PostActionIntegration{
+			URL: fmt.Sprintf("/plugins/%s/api/v1/creation-failure/%s", manifest.ID, action),
+			Context: map[string]any{
+				"installation_id": installationID,
+			},
+		},
+	}
+}
+
+// handleCreationFailureAction handles the buttons of a creation failure DM.
+func (p *Plugin) handleCreationFailureAction(w http.ResponseWriter, r *http.Request, action string) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	req := &model.PostActionIntegrationRequest{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	installationID, _ := req.Context["installation_id"].(string)
+	if err != nil || installationID == "" {
+		if err != nil {
+			p.API.LogError(errors.Wrap(err, "Unable to decode creation failure action request").Error())
+		}
+
+		http.Error(w, "Please provide a post action request with an installation_id in its context", http.StatusBadRequest)
+		return
+	}
+
+	var status string
+	ref := InstallationRef{ID: installationID}
+	switch action {
+	case creationFailureActionRetry:
+		_, err = p.retryInstallationCreationForUser(userID, ref)
+		status = "Creation retried. You will be sent the progress of the new attempt."
+	case creationFailureActionDelete:
+		var install *Installation
+		install, err = p.findInstallationForUser(userID, ref, InstallationScopeMine)
+		if err == nil {
+			_, err = p.deleteInstallationForUser(userID, ref, install.Name)
+		}
+		status = "Installation deleted."
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	response := &model.PostActionIntegrationResponse{}
+	if err != nil {
+		response.EphemeralText = fmt.Sprintf("Unable to %s the installation: %s", action, err.Error())
+	} else {
+		response.Update = p.resolvedActionPost(req.PostId, status)
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		p.API.LogError(errors.Wrap(err, "Unable to marshal creation failure action response").Error())
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Write(data)
+}
+
+// retryInstallationCreationForUser asks the provisioner to retry the failed
+// creation of an installation owned by the user.
+func (p *Plugin) retryInstallationCreationForUser(userID string, ref InstallationRef) (InstallationActionResult, error) {
+	install, err := p.findRefInRefreshedList(userID, ref, InstallationScopeMine)
+	if err != nil {
+		return InstallationActionResult{}, err
+	}
+	if !isInstallationCreationFailedState(install.State) {
+		return InstallationActionResult{}, errors.Errorf("installation state is currently %s and must be %s to retry its creation",
+			install.State, cloud.InstallationStateCreationFailed)
+	}
+
+	if err = p.cloudClient.RetryCreateInstallation(install.ID); err != nil {
+		return InstallationActionResult{}, err
+	}
+	p.recordInstallationAction(install.ID, userID, historyActionRetry)
+
+	summary, err := installationSummary(install, false)
+	if err != nil {
+		return InstallationActionResult{}, err
+	}
+	return InstallationActionResult{Installation: summary, Status: "creation_retry_requested"}, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	cloud "github.com/mattermost/mattermost-cloud/model"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreationFailureActionHandlers(t *testing.T) {
+	failurePost := &model.Post{Id: "post-id"}
+	model.ParseSlackAttachment(failurePost, []*model.SlackAttachment{{
+		Text:    "The provisioner moved installation first from `creation-in-progress` to `creation-failed`.",
+		Actions: []*model.PostAction{{Id: creationFailureActionRetry}, {Id: creationFailureActionDelete}},
+	}})
+
+	setup := func(t *testing.T, state string) (*Plugin, *MockClient) {
+		install := serviceTestInstall("id1", "first", "owner1")
+		install.State = state
+		plugin, cloudClient, api := newServiceTestPlugin(t, []*Installation{install})
+		cloudClient.mockedCloudInstallationsDTO = serviceDTOs(install)
+		api.On("GetPost", "post-id").Return(failurePost, nil)
+		return plugin, cloudClient
+	}
+
+	doAction := func(plugin *Plugin, action, userID string, body string) (*httptest.ResponseRecorder, *model.PostActionIntegrationResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/creation-failure/"+action, strings.NewReader(body))
+		req.Header.Set("Mattermost-User-ID", userID)
+		rec := httptest.NewRecorder()
+
+		plugin.handleCreationFailureAction(rec, req, action)
+
+		response := &model.PostActionIntegrationResponse{}
+		if rec.Code == http.StatusOK {
+			_ = json.Unmarshal(rec.Body.Bytes(), response)
+		}
+		return rec, response
+	}
+
+	actionBody := `{"user_id":"owner1","post_id":"post-id","context":{"installation_id":"id1"}}`
+
+	t.Run("retry", func(t *testing.T) {
+		plugin, cloudClient := setup(t, cloud.InstallationStateCreationFailed)
+
+		rec, response := doAction(plugin, creationFailureActionRetry, "owner1", actionBody)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, response.EphemeralText)
+		assert.Equal(t, "id1", cloudClient.retriedInstallationID)
+		require.NotNil(t, response.Update)
+		attachments := response.Update.Attachments()
+		require.Len(t, attachments, 1)
+		assert.Empty(t, attachments[0].Actions)
+		assert.Contains(t, attachments[0].Fields[0].Value, "Creation retried.")
+	})
+
+	t.Run("retry without compatible clusters", func(t *testing.T) {
+		plugin, cloudClient := setup(t, cloud.InstallationStateCreationNoCompatibleClusters)
+
+		rec, response := doAction(plugin, creationFailureActionRetry, "owner1", actionBody)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "Unable to retry the installation: installation state is currently creation-no-compatible-clusters and must be creation-failed to retry its creation", response.EphemeralText)
+		assert.Empty(t, cloudClient.retriedInstallationID)
+	})
+
+	t.Run("retry an installation that didn't fail", func(t *testing.T) {
+		plugin, cloudClient := setup(t, cloud.InstallationStateStable)
+
+		rec, response := doAction(plugin, creationFailureActionRetry, "owner1", actionBody)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "Unable to retry the installation: installation state is currently stable and must be creation-failed to retry its creation", response.EphemeralText)
+		assert.Nil(t, response.Update)
+		assert.Empty(t, cloudClient.retriedInstallationID)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		plugin, cloudClient := setup(t, cloud.InstallationStateCreationFailed)
+
+		rec, response := doAction(plugin, creationFailureActionDelete, "owner1", actionBody)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, response.EphemeralText)
+		assert.Equal(t, "id1", cloudClient.deletedInstallationID)
+		require.NotNil(t, response.Update)
+		assert.Contains(t, response.Update.Attachments()[0].Fields[0].Value, "Installation deleted.")
+	})
+
+	t.Run("errors are returned as ephemeral text", func(t *testing.T) {
+		plugin, cloudClient := setup(t, cloud.InstallationStateCreationFailed)
+
+		rec, response := doAction(plugin, creationFailureActionDelete, "other", actionBody)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, response.EphemeralText, "Unable to delete the installation:")
+		assert.Nil(t, response.Update)
+		assert.Empty(t, cloudClient.deletedInstallationID)
+	})
+
+	t.Run("requests without an installation are rejected", func(t *testing.T) {
+		plugin, _ := setup(t, cloud.InstallationStateCreationFailed)
+
+		rec, _ := doAction(plugin, creationFailureActionRetry, "owner1", `{"user_id":"owner1","context":{}}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("unauthenticated requests are rejected", func(t *testing.T) {
+		plugin, _ := setup(t, cloud.InstallationStateCreationFailed)
+
+		rec, _ := doAction(plugin, creationFailureActionRetry, "", actionBody)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
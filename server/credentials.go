@@ -0,0 +1,288 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	cloud "github.com/mattermost/mattermost-cloud/model"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/pkg/errors"
+)
+
+// StoreCredentialsKeyPrefix prefixes the key holding the encrypted admin and
+// user passwords of an installation.
+const StoreCredentialsKeyPrefix = "credentials_"
+
+// installationCredentials are the passwords of the users and the access
+// tokens of the bots created during the setup of an installation. They are
+// stored encrypted with a key derived from the CredentialsEncryptionKey
+// setting.
+type installationCredentials struct {
+	AdminPassword string           `json:"admin_password"`
+	UserPassword  string           `json:"user_password"`
+	SeedUsers     []seedUserResult `json:"seed_users,omitempty"`
+	UpdateAt      int64            `json:"update_at"`
+}
+
+func credentialsKey(installationID string) string {
+	return StoreCredentialsKeyPrefix + installationID
+}
+
+func credentialsCipher(encryptionKey string) (cipher.AEAD, error) {
+	if encryptionKey == "" {
+		return nil, errors.New("the credentials encryption key is not configured")
+	}
+
+	key := sha256.Sum256([]byte(encryptionKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create credentials cipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create credentials cipher")
+	}
+
+	return aead, nil
+}
+
+func encryptCredentials(encryptionKey string, credentials *installationCredentials) ([]byte, error) {
+	aead, err := credentialsCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	credentialsJSON, err := json.Marshal(credentials)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to marshal installation credentials")
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "unable to generate credentials nonce")
+	}
+
+	return aead.Seal(nonce, nonce, credentialsJSON, nil), nil
+}
+
+func decryptCredentials(encryptionKey string, encrypted []byte) (*installationCredentials, error) {
+	aead, err := credentialsCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(encrypted) < aead.NonceSize() {
+		return nil, errors.New("stored installation credentials are malformed")
+	}
+
+	nonce, ciphertext := encrypted[:aead.NonceSize()], encrypted[aead.NonceSize():]
+	credentialsJSON, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("unable to decrypt installation credentials, the encryption key may have been regenerated since they were stored")
+	}
+
+	credentials := &installationCredentials{}
+	if err = json.Unmarshal(credentialsJSON, credentials); err != nil {
+		return nil, errors.Wrap(err, "unable to unmarshal installation credentials")
+	}
+
+	return credentials, nil
+}
+
+func (p *Plugin) storeInstallationCredentials(installationID string, credentials *installationCredentials) error {
+	credentials.UpdateAt = time.Now().UnixMilli()
+	encrypted, err := encryptCredentials(p.getConfiguration().CredentialsEncryptionKey, credentials)
+	if err != nil {
+		return err
+	}
+	if appErr := p.API.KVSet(credentialsKey(installationID), encrypted); appErr != nil {
+		return errors.Wrap(appErr, "unable to store installation credentials")
+	}
+	return nil
+}
+
+// getInstallationCredentials returns the stored credentials of the
+// installation, or nil when none were stored.
+func (p *Plugin) getInstallationCredentials(installationID string) (*installationCredentials, error) {
+	encrypted, appErr := p.API.KVGet(credentialsKey(installationID))
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "unable to get installation credentials")
+	}
+	if encrypted == nil {
+		return nil, nil
+	}
+
+	return decryptCredentials(p.getConfiguration().CredentialsEncryptionKey, encrypted)
+}
+
+// sendInstallationCredentialsForUser sends the stored credentials of an
+// installation owned by the user to them in a direct message.
+func (p *Plugin) sendInstallationCredentialsForUser(userID string, ref InstallationRef) (InstallationActionResult, error) {
+	auditRec := newCredentialsAuditRecord("sendInstallationCredentials", userID, ref)
+	defer p.API.LogAuditRec(auditRec)
+
+	result, err := p.sendInstallationCredentials(userID, ref)
+	if err != nil {
+		auditRec.AddErrorDesc(err.Error())
+		return InstallationActionResult{}, err
+	}
+
+	auditRec.Success()
+	return result, nil
+}
+
+func (p *Plugin) sendInstallationCredentials(userID string, ref InstallationRef) (InstallationActionResult, error) {
+	install, err := p.findInstallationForUser(userID, ref, InstallationScopeMine)
+	if err != nil {
+		return InstallationActionResult{}, err
+	}
+
+	credentials, err := p.getInstallationCredentials(install.ID)
+	if err != nil {
+		return InstallationActionResult{}, err
+	}
+	if credentials == nil {
+		return InstallationActionResult{}, errors.Errorf("no credentials are stored for installation %s, run `/cloud credentials rotate %s` to reset them", install.Name, install.Name)
+	}
+
+	p.PostBotDM(userID, installationCredentialsMessage(install, credentials, false))
+
+	summary, err := installationSummary(install, false)
+	if err != nil {
+		return InstallationActionResult{}, err
+	}
+	return InstallationActionResult{
+		Installation: summary,
+		Status:       "credentials_sent",
+		Message:      fmt.Sprintf("The credentials of installation %s were sent to you in a direct message.", install.Name),
+	}, nil
+}
+
+// rotateInstallationCredentialsForUser resets the admin and user passwords of
+// an installation owned by the user, stores them and sends them to the user
+// in a direct message.
+func (p *Plugin) rotateInstallationCredentialsForUser(userID string, ref InstallationRef) (InstallationActionResult, error) {
+	auditRec := newCredentialsAuditRecord("rotateInstallationCredentials", userID, ref)
+	defer p.API.LogAuditRec(auditRec)
+
+	result, err := p.rotateInstallationCredentials(userID, ref)
+	if err != nil {
+		auditRec.AddErrorDesc(err.Error())
+		return InstallationActionResult{}, err
+	}
+
+	auditRec.Success()
+	return result, nil
+}
+
+func (p *Plugin) rotateInstallationCredentials(userID string, ref InstallationRef) (InstallationActionResult, error) {
+	install, err := p.findRefInRefreshedList(userID, ref, InstallationScopeMine)
+	if err != nil {
+		return InstallationActionResult{}, err
+	}
+	if install.State != cloud.InstallationStateStable {
+		return InstallationActionResult{}, errors.Errorf("installation state is currently %s and must be %s to rotate its credentials", install.State, cloud.InstallationStateStable)
+	}
+
+	state, _, err := p.getInstallationSetupState(install.ID)
+	if err != nil {
+		return InstallationActionResult{}, err
+	}
+	if state != nil && state.Status != setupStatusComplete {
+		return InstallationActionResult{}, errors.Errorf("setup of installation %s is %s, its credentials can be rotated once the setup completes", install.Name, state.Status)
+	}
+
+	// Credentials which can't be read are replaced as a whole.
+	credentials, err := p.getInstallationCredentials(install.ID)
+	if err != nil || credentials == nil {
+		credentials = &installationCredentials{}
+	}
+
+	// Each password is stored as soon as it is changed, so that a failure to
+	// change the next one doesn't lose it. A change which didn't complete in
+	// time fails the rotation, as the password may not have been changed. Bot
+	// access tokens are kept.
+	users := []struct {
+		username string
+		password *string
+	}{
+		{defaultAdminUsername, &credentials.AdminPassword},
+		{defaultUserUsername, &credentials.UserPassword},
+	}
+	for i := range credentials.SeedUsers {
+		if credentials.SeedUsers[i].Role != seedUserRoleBot {
+			users = append(users, struct {
+				username string
+				password *string
+			}{credentials.SeedUsers[i].Username, &credentials.SeedUsers[i].Secret})
+		}
+	}
+	for _, user := range users {
+		password := generateRandomPassword(user.username)
+		if _, err = p.execMmctlStrict(install.ID, []string{"user", "change-password", user.username, "--password", password}); err != nil {
+			return InstallationActionResult{}, errors.Wrapf(err, "unable to change the password of %s", user.username)
+		}
+		*user.password = password
+		if err = p.storeInstallationCredentials(install.ID, credentials); err != nil {
+			return InstallationActionResult{}, err
+		}
+	}
+	p.recordInstallationAction(install.ID, userID, historyActionRotate)
+
+	p.PostBotDM(userID, installationCredentialsMessage(install, credentials, true))
+
+	summary, err := installationSummary(install, false)
+	if err != nil {
+		return InstallationActionResult{}, err
+	}
+	return InstallationActionResult{
+		Installation: summary,
+		Status:       "credentials_rotated",
+		Message:      fmt.Sprintf("The credentials of installation %s were rotated and sent to you in a direct message.", install.Name),
+	}, nil
+}
+
+func newCredentialsAuditRecord(event, userID string, ref InstallationRef) *model.AuditRecord {
+	rec := plugin.MakeAuditRecord(event, model.AuditStatusFail)
+	rec.Actor.UserId = userID
+	if ref.ID != "" {
+		model.AddEventParameterToAuditRec(rec, "installation_id", ref.ID)
+	}
+	if ref.Name != "" {
+		model.AddEventParameterToAuditRec(rec, "installation_name", ref.Name)
+	}
+	return rec
+}
+
+func installationCredentialsMessage(install *Installation, credentials *installationCredentials, rotated bool) string {
+	header := fmt.Sprintf("Credentials for installation %s:", install.Name)
+	if rotated {
+		header = fmt.Sprintf("The credentials of installation %s were rotated. The previous passwords no longer work.", install.Name)
+	}
+
+	var dnsRecord string
+	if len(install.DNSRecords) > 0 {
+		dnsRecord = install.DNSRecords[0].DomainName
+	}
+
+	return fmt.Sprintf(`%s
+
+Access at: https://%s
+
+| Username | Password | Note |
+| -- | -- | -- |
+| %s | %s | Admin user |
+| %s | %s | Regular user |
+%s`,
+		header,
+		dnsRecord,
+		inlineCode(defaultAdminUsername), inlineCode(credentials.AdminPassword),
+		inlineCode(defaultUserUsername), inlineCode(credentials.UserPassword),
+		seedUserTableRows(credentials.SeedUsers),
+	)
+}
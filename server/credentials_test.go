@@ -0,0 +1,188 @@
+package main
+
+import (
+	"testing"
+
+	cloud "github.com/mattermost/mattermost-cloud/model"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialsEncryption(t *testing.T) {
+	credentials := &installationCredentials{AdminPassword: "sysadmin@pass", UserPassword: "user-1@pass"}
+
+	encrypted, err := encryptCredentials("key", credentials)
+	require.NoError(t, err)
+	assert.NotContains(t, string(encrypted), "sysadmin@pass")
+
+	decrypted, err := decryptCredentials("key", encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, credentials, decrypted)
+
+	_, err = decryptCredentials("regenerated-key", encrypted)
+	assert.EqualError(t, err, "unable to decrypt installation credentials, the encryption key may have been regenerated since they were stored")
+
+	_, err = decryptCredentials("key", encrypted[:4])
+	assert.EqualError(t, err, "stored installation credentials are malformed")
+
+	_, err = encryptCredentials("", credentials)
+	assert.EqualError(t, err, "the credentials encryption key is not configured")
+}
+
+func TestCredentialsCommand(t *testing.T) {
+	setup := func(t *testing.T) (*Plugin, *MockClient, *fakeKVStore, *[]*model.Post, *Installation) {
+		install := setupTestInstall("id1", "first", "owner1")
+		plugin, cloudClient, api, kv := newServiceTestPluginWithKV(t, []*Installation{install})
+		plugin.BotUserID = "bot-id"
+		cloudClient.mockedCloudInstallationsDTO = serviceDTOs(install)
+		cloudClient.mockedCloudClusterInstallations = []*cloud.ClusterInstallation{{ID: "ci1"}}
+		return plugin, cloudClient, kv, captureBotPosts(api), install
+	}
+
+	t.Run("sends the stored credentials", func(t *testing.T) {
+		plugin, _, kv, posts, install := setup(t)
+		require.NoError(t, plugin.storeInstallationCredentials(install.ID, &installationCredentials{AdminPassword: "sysadmin@pass", UserPassword: "user-1@pass"}))
+		assert.NotContains(t, string(kv.get(credentialsKey(install.ID))), "sysadmin@pass")
+
+		resp, isUserError, err := plugin.runCredentialsCommand([]string{"first"}, &model.CommandArgs{UserId: "owner1"})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "The credentials of installation first were sent to you in a direct message.")
+
+		require.Len(t, *posts, 1)
+		message := (*posts)[0].Message
+		assert.Contains(t, message, "Credentials for installation first:")
+		assert.Contains(t, message, "https://first.example.com")
+		assert.Contains(t, message, "`sysadmin@pass`")
+		assert.Contains(t, message, "`user-1@pass`")
+	})
+
+	t.Run("no stored credentials", func(t *testing.T) {
+		plugin, _, _, posts, _ := setup(t)
+
+		_, isUserError, err := plugin.runCredentialsCommand([]string{"first"}, &model.CommandArgs{UserId: "owner1"})
+		require.EqualError(t, err, "no credentials are stored for installation first, run `/cloud credentials rotate first` to reset them")
+		assert.True(t, isUserError)
+		assert.Empty(t, *posts)
+	})
+
+	t.Run("rotates the credentials", func(t *testing.T) {
+		plugin, cloudClient, _, posts, install := setup(t)
+		require.NoError(t, plugin.storeInstallationCredentials(install.ID, &installationCredentials{
+			AdminPassword: "sysadmin@old",
+			UserPassword:  "user-1@old",
+			SeedUsers: []seedUserResult{
+				{SeedUser: SeedUser{Username: "alice", Role: seedUserRoleGuest}, Secret: "alice@old"},
+				{SeedUser: SeedUser{Username: "ci", Role: seedUserRoleBot}, Secret: "bot-token"},
+			},
+		}))
+
+		resp, isUserError, err := plugin.runCredentialsCommand([]string{"rotate", "first"}, &model.CommandArgs{UserId: "owner1"})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "The credentials of installation first were rotated and sent to you in a direct message.")
+
+		credentials, err := plugin.getInstallationCredentials(install.ID)
+		require.NoError(t, err)
+		assert.NotEqual(t, "sysadmin@old", credentials.AdminPassword)
+		assert.NotEqual(t, "user-1@old", credentials.UserPassword)
+		assert.NotEqual(t, "alice@old", credentials.SeedUsers[0].Secret)
+		assert.Equal(t, "bot-token", credentials.SeedUsers[1].Secret)
+		assert.Equal(t, [][]string{
+			{"mmctl", "user", "change-password", defaultAdminUsername, "--password", credentials.AdminPassword, "--local"},
+			{"mmctl", "user", "change-password", defaultUserUsername, "--password", credentials.UserPassword, "--local"},
+			{"mmctl", "user", "change-password", "alice", "--password", credentials.SeedUsers[0].Secret, "--local"},
+		}, cloudClient.execCLICalls)
+
+		require.Len(t, *posts, 1)
+		assert.Contains(t, (*posts)[0].Message, "The credentials of installation first were rotated.")
+		assert.Contains(t, (*posts)[0].Message, credentials.AdminPassword)
+		assert.Contains(t, (*posts)[0].Message, "| `ci` | `bot-token` | Bot, the password is its access token |")
+
+		history, err := plugin.getInstallationHistory(install.ID)
+		require.NoError(t, err)
+		require.NotEmpty(t, history)
+		assert.Equal(t, historyActionRotate, history[len(history)-1].Action)
+	})
+
+	t.Run("a password change which didn't complete fails the rotation", func(t *testing.T) {
+		plugin, cloudClient, _, posts, install := setup(t)
+		require.NoError(t, plugin.storeInstallationCredentials(install.ID, &installationCredentials{
+			AdminPassword: "sysadmin@old",
+			UserPassword:  "user-1@old",
+		}))
+		cloudClient.execCLIErr = errors.New("failed with status code 504")
+
+		_, _, err := plugin.runCredentialsCommand([]string{"rotate", "first"}, &model.CommandArgs{UserId: "owner1"})
+		require.EqualError(t, err, "unable to change the password of admin: the mmctl command didn't complete before the connection was closed")
+		assert.Empty(t, *posts)
+
+		credentials, err := plugin.getInstallationCredentials(install.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "sysadmin@old", credentials.AdminPassword)
+		assert.Equal(t, "user-1@old", credentials.UserPassword)
+	})
+
+	t.Run("rotates credentials which were never stored", func(t *testing.T) {
+		plugin, cloudClient, _, _, install := setup(t)
+
+		_, _, err := plugin.runCredentialsCommand([]string{"rotate", "first"}, &model.CommandArgs{UserId: "owner1"})
+		require.NoError(t, err)
+		assert.Len(t, cloudClient.execCLICalls, 2)
+
+		credentials, err := plugin.getInstallationCredentials(install.ID)
+		require.NoError(t, err)
+		assert.NotEmpty(t, credentials.AdminPassword)
+		assert.NotEmpty(t, credentials.UserPassword)
+	})
+
+	t.Run("rotation requires a stable installation", func(t *testing.T) {
+		plugin, cloudClient, _, _, install := setup(t)
+		install.State = cloud.InstallationStateHibernationInProgress
+		cloudClient.mockedCloudInstallationsDTO = serviceDTOs(install)
+
+		_, isUserError, err := plugin.runCredentialsCommand([]string{"rotate", "first"}, &model.CommandArgs{UserId: "owner1"})
+		require.EqualError(t, err, "installation state is currently hibernation-in-progress and must be stable to rotate its credentials")
+		assert.True(t, isUserError)
+		assert.Empty(t, cloudClient.execCLICalls)
+	})
+
+	t.Run("rotation waits for the setup", func(t *testing.T) {
+		plugin, cloudClient, kv, _, install := setup(t)
+		storeSetupState(t, kv, install.ID, &installationSetupState{Status: setupStatusFailed})
+
+		_, isUserError, err := plugin.runCredentialsCommand([]string{"rotate", "first"}, &model.CommandArgs{UserId: "owner1"})
+		require.EqualError(t, err, "setup of installation first is failed, its credentials can be rotated once the setup completes")
+		assert.True(t, isUserError)
+		assert.Empty(t, cloudClient.execCLICalls)
+	})
+
+	t.Run("not owned", func(t *testing.T) {
+		plugin, cloudClient, _, posts, install := setup(t)
+		require.NoError(t, plugin.storeInstallationCredentials(install.ID, &installationCredentials{AdminPassword: "sysadmin@pass"}))
+
+		_, isUserError, err := plugin.runCredentialsCommand([]string{"first"}, &model.CommandArgs{UserId: "other"})
+		require.Error(t, err)
+		assert.True(t, isUserError)
+
+		_, isUserError, err = plugin.runCredentialsCommand([]string{"rotate", "first"}, &model.CommandArgs{UserId: "other"})
+		require.Error(t, err)
+		assert.True(t, isUserError)
+		assert.Empty(t, cloudClient.execCLICalls)
+		assert.Empty(t, *posts)
+	})
+
+	t.Run("bad usage", func(t *testing.T) {
+		plugin, _, _, _, _ := setup(t)
+
+		_, isUserError, err := plugin.runCredentialsCommand([]string{}, &model.CommandArgs{UserId: "owner1"})
+		require.EqualError(t, err, "must provide an installation name")
+		assert.True(t, isUserError)
+
+		_, isUserError, err = plugin.runCredentialsCommand([]string{"rotate"}, &model.CommandArgs{UserId: "owner1"})
+		require.EqualError(t, err, "must provide an installation name")
+		assert.True(t, isUserError)
+	})
+}
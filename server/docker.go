@@ -5,143 +5,618 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/docker/distribution/manifest/manifestlist"
 	"github.com/docker/distribution/manifest/schema2"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/pkg/errors"
 )
 
-const dockerHubURL = "https://registry.hub.docker.com"
+const (
+	dockerHubURL          = "https://registry.hub.docker.com"
+	dockerHubTokenURL     = "https://auth.docker.io/token"
+	dockerHubTokenService = "registry.docker.io"
 
-// DockerClient is a client for interacting with docker registries.
+	tagListPageSize = 1000
+	tagListMaxPages = 50
+	tagListCacheTTL = 10 * time.Minute
+
+	// digestCacheTTL is how long the digest of a tag is reused. It is kept
+	// short since tags such as master are moved to new builds.
+	digestCacheTTL = 5 * time.Minute
+
+	// defaultTokenTTL is the lifetime of registry tokens issued without an
+	// expires_in, and tokenExpiryMargin renews tokens before they expire.
+	defaultTokenTTL   = 60 * time.Second
+	tokenExpiryMargin = 10 * time.Second
+
+	// Rate limited requests are retried up to rateLimitMaxRetries times,
+	// waiting for Retry-After or an exponential backoff starting at
+	// rateLimitBackoff. Waits longer than rateLimitMaxWait fail right away.
+	rateLimitMaxRetries = 3
+	rateLimitBackoff    = time.Second
+	rateLimitMaxWait    = 30 * time.Second
+
+	registryUnavailable = "registry unavailable"
+	noPlatformImage     = "has no image for platform"
+
+	// clusterPlatformOS and clusterPlatformArchitecture select the image of
+	// multi-platform tags the clusters run.
+	clusterPlatformOS           = "linux"
+	clusterPlatformArchitecture = "amd64"
+)
+
+// manifestMediaTypes are accepted when fetching a manifest, so that
+// multi-platform tags return their manifest list or image index.
+var manifestMediaTypes = strings.Join([]string{
+	schema2.MediaTypeManifest,
+	manifestlist.MediaTypeManifestList,
+	ocispec.MediaTypeImageManifest,
+	ocispec.MediaTypeImageIndex,
+}, ", ")
+
+// platformMismatchError is returned for tags which do not provide an image
+// for the cluster platform.
+type platformMismatchError struct {
+	repository string
+	tag        string
+	platforms  []string
+}
+
+func (e *platformMismatchError) Error() string {
+	return fmt.Sprintf("%s:%s %s %s/%s, only for %s", e.repository, e.tag, noPlatformImage, clusterPlatformOS, clusterPlatformArchitecture, strings.Join(e.platforms, ", "))
+}
+
+var nextPageLinkMatcher = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// RegistryRateLimit is the pull rate limit a registry last reported in its
+// RateLimit-Limit and RateLimit-Remaining headers.
+type RegistryRateLimit struct {
+	Registry  string `json:"registry"`
+	Limit     int    `json:"limit"`
+	Remaining int    `json:"remaining"`
+	// WindowSeconds is the period the limit applies to.
+	WindowSeconds int   `json:"window_seconds,omitempty"`
+	UpdateAt      int64 `json:"update_at"`
+}
+
+// DockerClient is a client for interacting with docker registries. Images
+// are looked up in the configured registry with the longest matching image
+// prefix, or in Docker Hub when none match.
 type DockerClient struct {
-	registryURL string
-	username    string
-	password    string
+	defaultRegistry DockerRegistry
+	registries      []DockerRegistry
+
+	// sleep waits before retrying rate limited requests.
+	sleep func(time.Duration)
+
+	cacheLock   sync.Mutex
+	tagCache    map[string]tagCacheEntry
+	digestCache map[string]digestCacheEntry
+	tokenCache  map[string]tokenCacheEntry
+	rateLimits  map[string]RegistryRateLimit
+}
+
+type tagCacheEntry struct {
+	tags      []string
+	expiresAt time.Time
+}
+
+type digestCacheEntry struct {
+	digest    string
+	expiresAt time.Time
+}
+
+type tokenCacheEntry struct {
+	token     string
+	expiresAt time.Time
 }
 
-// NewDockerClient returns a new docker client.
-func NewDockerClient() *DockerClient {
+// NewDockerClient returns a new docker client using the given private
+// registries in addition to Docker Hub.
+func NewDockerClient(registries ...DockerRegistry) *DockerClient {
 	return &DockerClient{
-		registryURL: dockerHubURL,
-		username:    "",
-		password:    "",
+		defaultRegistry: DockerRegistry{
+			URL:          dockerHubURL,
+			TokenURL:     dockerHubTokenURL,
+			TokenService: dockerHubTokenService,
+		},
+		registries:  registries,
+		sleep:       time.Sleep,
+		tagCache:    map[string]tagCacheEntry{},
+		digestCache: map[string]digestCacheEntry{},
+		tokenCache:  map[string]tokenCacheEntry{},
+		rateLimits:  map[string]RegistryRateLimit{},
 	}
 }
 
+// registryUnavailableError explains that the registry could not answer
+// whether the tag exists, as opposed to the tag not existing. Tags without an
+// image for the cluster platform are reported as they are.
+func registryUnavailableError(err error, repository, tag string) error {
+	var platformErr *platformMismatchError
+	if errors.As(err, &platformErr) {
+		return err
+	}
+	return errors.Wrapf(err, "%s, unable to check if %s:%s exists", registryUnavailable, repository, tag)
+}
+
+// registryFor returns the registry serving the image repository.
+func (dc *DockerClient) registryFor(repository string) DockerRegistry {
+	registry := dc.defaultRegistry
+	matched := ""
+	for _, candidate := range dc.registries {
+		if strings.HasPrefix(repository, candidate.ImagePrefix) && len(candidate.ImagePrefix) > len(matched) {
+			registry = candidate
+			matched = candidate.ImagePrefix
+		}
+	}
+	return registry
+}
+
 // fetchManifest fetches the manifest for a given tag and returns the response and status code.
-// This is a shared helper for both ValidTag and GetDigestForTag.
 func (dc *DockerClient) fetchManifest(desiredTag, repository, method string) (*http.Response, error) {
+	return dc.doRegistryRequest(method, fmt.Sprintf("/v2/%s/manifests/%s", registryRepositoryPath(repository), desiredTag), repository, manifestMediaTypes)
+}
+
+// doRegistryRequest sends a request for the given path to the registry of
+// the repository, retrying with a token when the registry requires
+// authentication. Tokens are cached until they expire.
+func (dc *DockerClient) doRegistryRequest(method, path, repository, accept string) (*http.Response, error) {
 	if dc == nil {
 		return nil, errors.New("docker client is not initialized")
 	}
-	if dc.registryURL == "" {
+	registry := dc.registryFor(repository)
+	if registry.URL == "" {
 		return nil, errors.New("docker registry URL is not configured")
 	}
 
-	resource := fmt.Sprintf("%s/v2/%s/manifests/%s", dc.registryURL, repository, desiredTag)
-
-	req, err := http.NewRequest(method, resource, nil)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to create request")
-	}
+	resource := strings.TrimSuffix(registry.URL, "/") + path
+	repositoryPath := registryRepositoryPath(repository)
+	tokenKey := registry.URL + "|" + repositoryPath
 
-	req.Header.Set("Accept", schema2.MediaTypeManifest)
+	newRequest := func(token string) (*http.Request, error) {
+		req, err := http.NewRequest(method, resource, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create request")
+		}
+		req.Header.Set("Accept", accept)
 
-	// Add authentication if provided
-	if dc.username != "" && dc.password != "" {
-		req.SetBasicAuth(dc.username, dc.password)
+		// Add authentication if provided
+		switch {
+		case token != "":
+			req.Header.Set("Authorization", "Bearer "+token)
+		case registry.BearerToken != "":
+			req.Header.Set("Authorization", "Bearer "+registry.BearerToken)
+		case registry.Username != "" && registry.Password != "" && registry.TokenURL == "":
+			req.SetBasicAuth(registry.Username, registry.Password)
+		}
+		return req, nil
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	token, _ := dc.cachedToken(tokenKey)
+	resp, err := dc.sendRegistryRequest(registry, func() (*http.Request, error) { return newRequest(token) })
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to fetch manifest")
+		return nil, err
 	}
 
-	// If unauthorized, try with token authentication
-	if resp.StatusCode == http.StatusUnauthorized {
+	// If unauthorized, try with a new token
+	if resp.StatusCode == http.StatusUnauthorized && registry.TokenURL != "" {
 		resp.Body.Close()
 
-		token, err := dc.getAuthToken(repository)
+		var expiresAt time.Time
+		token, expiresAt, err = dc.getAuthToken(registry, repositoryPath)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to get auth token")
 		}
+		dc.cacheToken(tokenKey, token, expiresAt)
 
-		req, err = http.NewRequest(method, resource, nil)
+		resp, err = dc.sendRegistryRequest(registry, func() (*http.Request, error) { return newRequest(token) })
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to create request")
+			return nil, errors.Wrap(err, "failed to send registry request with token")
 		}
-		req.Header.Set("Accept", schema2.MediaTypeManifest)
-		req.Header.Set("Authorization", "Bearer "+token)
+	}
 
-		resp, err = client.Do(req)
+	return resp, nil
+}
+
+// sendRegistryRequest sends a request, records the rate limit reported by
+// the registry and retries while the registry answers 429 Too Many Requests.
+func (dc *DockerClient) sendRegistryRequest(registry DockerRegistry, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to fetch manifest with token")
+			return nil, err
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to send registry request")
+		}
+		dc.recordRateLimit(registry.URL, resp.Header)
+
+		if resp.StatusCode != http.StatusTooManyRequests {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		wait := retryAfter(resp.Header.Get("Retry-After"), rateLimitBackoff<<attempt)
+		if attempt == rateLimitMaxRetries || wait > rateLimitMaxWait {
+			return nil, errors.Errorf("rate limited by %s%s, retry after %s", registry.URL, dc.describeRateLimit(registry.URL), wait)
+		}
+		if dc.sleep != nil {
+			dc.sleep(wait)
 		}
 	}
+}
 
-	return resp, nil
+// retryAfter returns the wait given by a Retry-After header in seconds, or
+// the backoff when there is none.
+func retryAfter(header string, backoff time.Duration) time.Duration {
+	seconds, err := strconv.Atoi(strings.TrimSpace(header))
+	if err != nil || seconds < 0 {
+		return backoff
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// recordRateLimit stores the rate limit reported in headers such as
+// `RateLimit-Remaining: 76;w=21600`.
+func (dc *DockerClient) recordRateLimit(registryURL string, header http.Header) {
+	limit, window, okLimit := parseRateLimitHeader(header.Get("RateLimit-Limit"))
+	remaining, _, okRemaining := parseRateLimitHeader(header.Get("RateLimit-Remaining"))
+	if !okLimit || !okRemaining {
+		return
+	}
+
+	dc.cacheLock.Lock()
+	defer dc.cacheLock.Unlock()
+
+	if dc.rateLimits == nil {
+		dc.rateLimits = map[string]RegistryRateLimit{}
+	}
+	dc.rateLimits[registryURL] = RegistryRateLimit{
+		Registry:      registryURL,
+		Limit:         limit,
+		Remaining:     remaining,
+		WindowSeconds: window,
+		UpdateAt:      time.Now().UnixMilli(),
+	}
+}
+
+func parseRateLimitHeader(value string) (int, int, bool) {
+	countValue, params, _ := strings.Cut(value, ";")
+	count, err := strconv.Atoi(strings.TrimSpace(countValue))
+	if err != nil {
+		return 0, 0, false
+	}
+
+	window := 0
+	for _, param := range strings.Split(params, ";") {
+		if seconds, ok := strings.CutPrefix(strings.TrimSpace(param), "w="); ok {
+			window, _ = strconv.Atoi(seconds)
+		}
+	}
+	return count, window, true
+}
+
+// RateLimits returns the rate limits last reported by the registries.
+func (dc *DockerClient) RateLimits() []RegistryRateLimit {
+	dc.cacheLock.Lock()
+	defer dc.cacheLock.Unlock()
+
+	rateLimits := make([]RegistryRateLimit, 0, len(dc.rateLimits))
+	for _, rateLimit := range dc.rateLimits {
+		rateLimits = append(rateLimits, rateLimit)
+	}
+	sort.Slice(rateLimits, func(i, j int) bool { return rateLimits[i].Registry < rateLimits[j].Registry })
+	return rateLimits
+}
+
+func (dc *DockerClient) describeRateLimit(registryURL string) string {
+	dc.cacheLock.Lock()
+	defer dc.cacheLock.Unlock()
+
+	rateLimit, ok := dc.rateLimits[registryURL]
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf(" (%d of %d requests remaining)", rateLimit.Remaining, rateLimit.Limit)
+}
+
+func (dc *DockerClient) cachedToken(key string) (string, bool) {
+	dc.cacheLock.Lock()
+	defer dc.cacheLock.Unlock()
+
+	entry, ok := dc.tokenCache[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return "", false
+	}
+	return entry.token, true
+}
+
+func (dc *DockerClient) cacheToken(key, token string, expiresAt time.Time) {
+	dc.cacheLock.Lock()
+	defer dc.cacheLock.Unlock()
+
+	if dc.tokenCache == nil {
+		dc.tokenCache = map[string]tokenCacheEntry{}
+	}
+	dc.tokenCache[key] = tokenCacheEntry{token: token, expiresAt: expiresAt}
+}
+
+// manifestDigest returns the status code of the manifest of the tag and its
+// digest. For manifest lists and image indexes the digest of the image for the
+// cluster platform is returned, and tags without one are refused. Digests are
+// cached for digestCacheTTL so that validating a tag and resolving its digest
+// only queries the registry once.
+func (dc *DockerClient) manifestDigest(desiredTag, repository string) (int, string, error) {
+	key := repository + ":" + desiredTag
+	if digest, ok := dc.cachedDigest(key); ok {
+		return http.StatusOK, digest, nil
+	}
+
+	resp, err := dc.fetchManifest(desiredTag, repository, http.MethodHead)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return 0, "", errors.Errorf("unexpected status code %d from registry", resp.StatusCode)
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if resp.StatusCode == http.StatusOK && isManifestIndex(resp.Header.Get("Content-Type")) {
+		digest, err = dc.platformDigest(desiredTag, repository)
+		if err != nil {
+			return 0, "", err
+		}
+	}
+	if resp.StatusCode == http.StatusOK && digest != "" {
+		dc.cacheLock.Lock()
+		if dc.digestCache == nil {
+			dc.digestCache = map[string]digestCacheEntry{}
+		}
+		dc.digestCache[key] = digestCacheEntry{digest: digest, expiresAt: time.Now().Add(digestCacheTTL)}
+		dc.cacheLock.Unlock()
+	}
+
+	return resp.StatusCode, digest, nil
+}
+
+func isManifestIndex(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(mediaType)
+	return mediaType == manifestlist.MediaTypeManifestList || mediaType == ocispec.MediaTypeImageIndex
+}
+
+// platformDigest fetches the manifest list or image index of the tag and
+// returns the digest of the image for the cluster platform.
+func (dc *DockerClient) platformDigest(desiredTag, repository string) (string, error) {
+	resp, err := dc.fetchManifest(desiredTag, repository, http.MethodGet)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("unexpected status code %d from registry", resp.StatusCode)
+	}
+
+	var index ocispec.Index
+	if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+		return "", errors.Wrap(err, "failed to decode manifest list")
+	}
+
+	platforms := []string{}
+	for _, manifest := range index.Manifests {
+		if manifest.Platform == nil {
+			continue
+		}
+		if manifest.Platform.OS == clusterPlatformOS && manifest.Platform.Architecture == clusterPlatformArchitecture {
+			return manifest.Digest.String(), nil
+		}
+		// Attestation manifests are listed with an unknown platform.
+		if manifest.Platform.OS != "unknown" {
+			platforms = append(platforms, manifest.Platform.OS+"/"+manifest.Platform.Architecture)
+		}
+	}
+
+	return "", &platformMismatchError{repository: repository, tag: desiredTag, platforms: platforms}
+}
+
+func (dc *DockerClient) cachedDigest(key string) (string, bool) {
+	if dc == nil {
+		return "", false
+	}
+
+	dc.cacheLock.Lock()
+	defer dc.cacheLock.Unlock()
+
+	entry, ok := dc.digestCache[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return "", false
+	}
+	return entry.digest, true
 }
 
 // ValidTag checks if a given tag exists for the given repository by querying the manifest endpoint.
 func (dc *DockerClient) ValidTag(desiredTag, repository string) (bool, error) {
-	resp, err := dc.fetchManifest(desiredTag, repository, "HEAD")
+	status, _, err := dc.manifestDigest(desiredTag, repository)
 	if err != nil {
 		return false, err
 	}
-	defer resp.Body.Close()
 
 	// Tag exists if we get a 200 OK
-	return resp.StatusCode == http.StatusOK, nil
+	return status == http.StatusOK, nil
 }
 
-// getAuthToken retrieves an authentication token for accessing Docker Hub
-func (dc *DockerClient) getAuthToken(repository string) (string, error) {
-	authURL := fmt.Sprintf("https://auth.docker.io/token?service=registry.docker.io&scope=repository:%s:pull", repository)
+// getAuthToken retrieves a token for pulling the repository from the token
+// endpoint of the registry, authenticating with the registry credentials when
+// they are configured. It also returns when the token expires.
+func (dc *DockerClient) getAuthToken(registry DockerRegistry, repository string) (string, time.Time, error) {
+	authURL, err := url.Parse(registry.TokenURL)
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "failed to parse token URL")
+	}
+	query := authURL.Query()
+	if registry.TokenService != "" {
+		query.Set("service", registry.TokenService)
+	}
+	query.Set("scope", fmt.Sprintf("repository:%s:pull", repository))
+	authURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, authURL.String(), nil)
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "failed to create auth request")
+	}
+	if registry.Username != "" && registry.Password != "" {
+		req.SetBasicAuth(registry.Username, registry.Password)
+	}
 
-	resp, err := http.Get(authURL)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to get auth token")
+		return "", time.Time{}, errors.Wrap(err, "failed to get auth token")
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", errors.Errorf("unexpected status code %d from auth endpoint", resp.StatusCode)
+		return "", time.Time{}, errors.Errorf("unexpected status code %d from auth endpoint", resp.StatusCode)
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to read auth response")
+		return "", time.Time{}, errors.Wrap(err, "failed to read auth response")
 	}
 
 	var authResp struct {
-		Token string `json:"token"`
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
 	}
 	if err := json.Unmarshal(body, &authResp); err != nil {
-		return "", errors.Wrap(err, "failed to unmarshal auth response")
+		return "", time.Time{}, errors.Wrap(err, "failed to unmarshal auth response")
+	}
+
+	ttl := defaultTokenTTL
+	if authResp.ExpiresIn > 0 {
+		ttl = time.Duration(authResp.ExpiresIn) * time.Second
 	}
 
-	return authResp.Token, nil
+	return defaultString(authResp.Token, authResp.AccessToken), time.Now().Add(ttl - tokenExpiryMargin), nil
 }
 
 // GetDigestForTag fetches the digest for the image.
 func (dc *DockerClient) GetDigestForTag(desiredTag, repository string) (string, error) {
-	resp, err := dc.fetchManifest(desiredTag, repository, "HEAD")
+	status, digest, err := dc.manifestDigest(desiredTag, repository)
 	if err != nil {
 		return "", err
 	}
+
+	if status != http.StatusOK {
+		return "", errors.Errorf("unexpected status code %d from registry", status)
+	}
+	if digest == "" {
+		return "", errors.New("image digest header was missing")
+	}
+
+	return digest, nil
+}
+
+// ListTags returns every tag of the given repository, following the pages of
+// the registry tag list. Results are cached for tagListCacheTTL.
+func (dc *DockerClient) ListTags(repository string) ([]string, error) {
+	if tags, ok := dc.cachedTags(repository); ok {
+		return tags, nil
+	}
+
+	tags := []string{}
+	path := fmt.Sprintf("/v2/%s/tags/list?n=%d", registryRepositoryPath(repository), tagListPageSize)
+	for page := 0; path != ""; page++ {
+		if page == tagListMaxPages {
+			return nil, errors.Errorf("tag list of repository %s has more than %d pages", repository, tagListMaxPages)
+		}
+
+		pageTags, next, err := dc.fetchTagListPage(path, repository)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, pageTags...)
+		path = next
+	}
+
+	dc.cacheLock.Lock()
+	if dc.tagCache == nil {
+		dc.tagCache = map[string]tagCacheEntry{}
+	}
+	dc.tagCache[repository] = tagCacheEntry{tags: tags, expiresAt: time.Now().Add(tagListCacheTTL)}
+	dc.cacheLock.Unlock()
+
+	return tags, nil
+}
+
+func (dc *DockerClient) cachedTags(repository string) ([]string, bool) {
+	if dc == nil {
+		return nil, false
+	}
+
+	dc.cacheLock.Lock()
+	defer dc.cacheLock.Unlock()
+
+	entry, ok := dc.tagCache[repository]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.tags, true
+}
+
+// fetchTagListPage returns the tags of one page of a tag list and the path of
+// the next page, if any.
+func (dc *DockerClient) fetchTagListPage(path, repository string) ([]string, string, error) {
+	resp, err := dc.doRegistryRequest(http.MethodGet, path, repository, "application/json")
+	if err != nil {
+		return nil, "", err
+	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", errors.Errorf("unexpected status code %d from registry", resp.StatusCode)
+		return nil, "", errors.Errorf("unexpected status code %d from registry", resp.StatusCode)
 	}
 
-	digestHeader, ok := resp.Header["Docker-Content-Digest"]
-	if !ok {
-		return "", errors.New("image digest header was missing")
-	} else if len(digestHeader) < 1 {
-		return "", errors.New("image digest header was empty")
+	var tagList struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tagList); err != nil {
+		return nil, "", errors.Wrap(err, "failed to decode tag list")
+	}
+
+	next, err := nextPagePath(resp.Header.Get("Link"))
+	if err != nil {
+		return nil, "", err
 	}
 
-	return digestHeader[0], nil
+	return tagList.Tags, next, nil
+}
+
+// nextPagePath returns the path and query of the next page from a registry
+// Link header, such as `</v2/repo/tags/list?last=1.0&n=100>; rel="next"`.
+func nextPagePath(link string) (string, error) {
+	match := nextPageLinkMatcher.FindStringSubmatch(link)
+	if match == nil {
+		return "", nil
+	}
+
+	next, err := url.Parse(match[1])
+	if err != nil {
+		return "", errors.Wrap(err, "failed to parse next page link")
+	}
+	return next.RequestURI(), nil
 }
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DockerRegistry is a private docker registry or registry mirror serving the
+// images starting with ImagePrefix.
+type DockerRegistry struct {
+	// ImagePrefix selects the images served by the registry, such as
+	// registry.example.com/ or mattermostdevelopment/.
+	ImagePrefix string `json:"image_prefix"`
+	// URL is the base URL of the registry API, such as
+	// https://registry.example.com.
+	URL string `json:"url"`
+
+	// TokenURL is the endpoint issuing pull tokens when the registry answers
+	// with 401 Unauthorized. TokenService is sent as its service parameter.
+	TokenURL     string `json:"token_url,omitempty"`
+	TokenService string `json:"token_service,omitempty"`
+
+	// Username and Password are sent with basic auth to the token endpoint,
+	// or to the registry itself when there is no token endpoint.
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// BearerToken is sent with every request to the registry instead.
+	BearerToken string `json:"bearer_token,omitempty"`
+}
+
+func parseDockerRegistries(value string) ([]DockerRegistry, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	var registries []DockerRegistry
+	if err := json.Unmarshal([]byte(value), &registries); err != nil {
+		return nil, errors.Wrap(err, "DockerRegistries must be a JSON list of registries")
+	}
+
+	for i, registry := range registries {
+		if registry.ImagePrefix == "" {
+			return nil, errors.Errorf("DockerRegistries entry %d must specify an image_prefix", i)
+		}
+		if err := validateRegistryURL(registry.URL); err != nil {
+			return nil, errors.Wrapf(err, "DockerRegistries entry %s has an invalid url", registry.ImagePrefix)
+		}
+		if registry.TokenURL != "" {
+			if err := validateRegistryURL(registry.TokenURL); err != nil {
+				return nil, errors.Wrapf(err, "DockerRegistries entry %s has an invalid token_url", registry.ImagePrefix)
+			}
+		}
+		if (registry.Username == "") != (registry.Password == "") {
+			return nil, errors.Errorf("DockerRegistries entry %s must specify both a username and a password", registry.ImagePrefix)
+		}
+		if registry.BearerToken != "" && registry.Username != "" {
+			return nil, errors.Errorf("DockerRegistries entry %s must use either basic auth or a bearer token", registry.ImagePrefix)
+		}
+	}
+
+	return registries, nil
+}
+
+func validateRegistryURL(value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.Errorf("%q is not an absolute http or https URL", value)
+	}
+	return nil
+}
+
+// registryRepositoryPath returns the repository name of an image within its
+// registry, removing the registry host such as registry.example.com:5000/
+// from the image.
+func registryRepositoryPath(image string) string {
+	host, path, found := strings.Cut(image, "/")
+	if found && (strings.ContainsAny(host, ".:") || host == "localhost") {
+		return path
+	}
+	return image
+}
@@ -1,8 +1,25 @@
 package main
 
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/manifest/manifestlist"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
 type MockedDockerClient struct {
 	tagExists      bool
+	validTagErr    error
+	invalidTags    []string
 	digest         string
+	tags           []string
+	listTagsErr    error
+	rateLimits     []RegistryRateLimit
 	validTagCalls  []dockerClientCall
 	getDigestCalls []dockerClientCall
 }
@@ -14,6 +31,12 @@ type dockerClientCall struct {
 
 func (mc *MockedDockerClient) ValidTag(desiredTag, repository string) (bool, error) {
 	mc.validTagCalls = append(mc.validTagCalls, dockerClientCall{tag: desiredTag, repository: repository})
+	if mc.validTagErr != nil {
+		return false, mc.validTagErr
+	}
+	if Contains(mc.invalidTags, desiredTag) {
+		return false, nil
+	}
 	return mc.tagExists, nil
 }
 
@@ -24,3 +47,325 @@ func (mc *MockedDockerClient) GetDigestForTag(desiredTag, repository string) (st
 	}
 	return desiredTag, nil
 }
+
+func (mc *MockedDockerClient) ListTags(repository string) ([]string, error) {
+	return mc.tags, mc.listTagsErr
+}
+
+func (mc *MockedDockerClient) RateLimits() []RegistryRateLimit {
+	return mc.rateLimits
+}
+
+func TestDockerClientListTags(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/v2/mattermost/mattermost-enterprise-edition/tags/list", r.URL.Path)
+		switch r.URL.Query().Get("last") {
+		case "":
+			assert.Equal(t, "1000", r.URL.Query().Get("n"))
+			w.Header().Set("Link", `</v2/mattermost/mattermost-enterprise-edition/tags/list?last=9.11.0&n=1000>; rel="next"`)
+			w.Write([]byte(`{"name":"mattermost/mattermost-enterprise-edition","tags":["9.5.0","9.11.0"]}`))
+		case "9.11.0":
+			w.Write([]byte(`{"name":"mattermost/mattermost-enterprise-edition","tags":["10.0.0","master"]}`))
+		default:
+			t.Errorf("unexpected page %s", r.URL.RawQuery)
+		}
+	}))
+	defer server.Close()
+
+	dc := &DockerClient{defaultRegistry: DockerRegistry{URL: server.URL}}
+
+	tags, err := dc.ListTags("mattermost/mattermost-enterprise-edition")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"9.5.0", "9.11.0", "10.0.0", "master"}, tags)
+	assert.Equal(t, 2, requests)
+
+	tags, err = dc.ListTags("mattermost/mattermost-enterprise-edition")
+	require.NoError(t, err)
+	assert.Len(t, tags, 4)
+	assert.Equal(t, 2, requests, "the tag list should be cached")
+}
+
+func TestDockerClientListTagsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	dc := &DockerClient{defaultRegistry: DockerRegistry{URL: server.URL}}
+
+	_, err := dc.ListTags("mattermost/unknown")
+	require.EqualError(t, err, "unexpected status code 404 from registry")
+}
+
+// newTestRegistry starts a registry stand-in serving the manifest of
+// team/mattermost:9.11.0. Requests must carry the bearer token issued by its
+// token endpoint for the given basic auth credentials.
+func newTestRegistry(t *testing.T, username, password string) *httptest.Server {
+	const token = "pull-token"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != username || pass != password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "registry.example.com", r.URL.Query().Get("service"))
+		assert.Equal(t, "repository:team/mattermost:pull", r.URL.Query().Get("scope"))
+		w.Write([]byte(`{"access_token":"` + token + `"}`))
+	})
+	mux.HandleFunc("/v2/team/mattermost/manifests/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/v2/team/mattermost/manifests/9.11.0" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", "sha256:private")
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDockerClientPrivateRegistry(t *testing.T) {
+	t.Run("token endpoint with basic auth", func(t *testing.T) {
+		server := newTestRegistry(t, "user", "secret")
+		dc := NewDockerClient(DockerRegistry{
+			ImagePrefix:  "registry.example.com/",
+			URL:          server.URL,
+			TokenURL:     server.URL + "/token",
+			TokenService: "registry.example.com",
+			Username:     "user",
+			Password:     "secret",
+		})
+
+		valid, err := dc.ValidTag("9.11.0", "registry.example.com/team/mattermost")
+		require.NoError(t, err)
+		assert.True(t, valid)
+
+		valid, err = dc.ValidTag("0.0.1", "registry.example.com/team/mattermost")
+		require.NoError(t, err)
+		assert.False(t, valid)
+
+		digest, err := dc.GetDigestForTag("9.11.0", "registry.example.com/team/mattermost")
+		require.NoError(t, err)
+		assert.Equal(t, "sha256:private", digest)
+	})
+
+	t.Run("wrong credentials", func(t *testing.T) {
+		server := newTestRegistry(t, "user", "secret")
+		dc := NewDockerClient(DockerRegistry{
+			ImagePrefix: "registry.example.com/",
+			URL:         server.URL,
+			TokenURL:    server.URL + "/token",
+			Username:    "user",
+			Password:    "wrong",
+		})
+
+		_, err := dc.GetDigestForTag("9.11.0", "registry.example.com/team/mattermost")
+		require.EqualError(t, err, "failed to get auth token: unexpected status code 401 from auth endpoint")
+	})
+
+	t.Run("static bearer token", func(t *testing.T) {
+		server := newTestRegistry(t, "", "")
+		dc := NewDockerClient(DockerRegistry{
+			ImagePrefix: "registry.example.com/",
+			URL:         server.URL,
+			BearerToken: "pull-token",
+		})
+
+		digest, err := dc.GetDigestForTag("9.11.0", "registry.example.com/team/mattermost")
+		require.NoError(t, err)
+		assert.Equal(t, "sha256:private", digest)
+	})
+
+	t.Run("registries are chosen by the longest image prefix", func(t *testing.T) {
+		dc := NewDockerClient(
+			DockerRegistry{ImagePrefix: "registry.example.com/", URL: "https://registry.example.com"},
+			DockerRegistry{ImagePrefix: "registry.example.com/team/", URL: "https://team.example.com"},
+		)
+
+		assert.Equal(t, "https://team.example.com", dc.registryFor("registry.example.com/team/mattermost").URL)
+		assert.Equal(t, "https://registry.example.com", dc.registryFor("registry.example.com/other/mattermost").URL)
+		assert.Equal(t, dockerHubURL, dc.registryFor(imageEE).URL)
+	})
+}
+
+func TestRegistryRepositoryPath(t *testing.T) {
+	assert.Equal(t, imageEE, registryRepositoryPath(imageEE))
+	assert.Equal(t, "team/mattermost", registryRepositoryPath("registry.example.com/team/mattermost"))
+	assert.Equal(t, "mattermost", registryRepositoryPath("localhost:5000/mattermost"))
+}
+
+func TestDockerClientCaching(t *testing.T) {
+	tokenRequests, manifestRequests := 0, 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests++
+		w.Write([]byte(`{"token":"pull-token","expires_in":300}`))
+	})
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, r *http.Request) {
+		manifestRequests++
+		if r.Header.Get("Authorization") != "Bearer pull-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", "sha256:"+r.URL.Path)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	dc := NewDockerClient()
+	dc.defaultRegistry = DockerRegistry{URL: server.URL, TokenURL: server.URL + "/token"}
+
+	valid, err := dc.ValidTag("9.11.0", imageEE)
+	require.NoError(t, err)
+	assert.True(t, valid)
+	digest, err := dc.GetDigestForTag("9.11.0", imageEE)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:/v2/mattermost/mattermost-enterprise-edition/manifests/9.11.0", digest)
+	assert.Equal(t, 1, tokenRequests)
+	assert.Equal(t, 2, manifestRequests, "the digest should be reused")
+
+	_, err = dc.GetDigestForTag("10.5.0", imageEE)
+	require.NoError(t, err)
+	assert.Equal(t, 1, tokenRequests, "the token should be reused")
+	assert.Equal(t, 3, manifestRequests)
+}
+
+func TestDockerClientRateLimit(t *testing.T) {
+	newRateLimitedRegistry := func(t *testing.T, retryAfter string, rateLimitedRequests int) *httptest.Server {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Header().Set("RateLimit-Limit", "100;w=21600")
+			if requests <= rateLimitedRequests {
+				w.Header().Set("RateLimit-Remaining", "0;w=21600")
+				w.Header().Set("Retry-After", retryAfter)
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.Header().Set("RateLimit-Remaining", "42;w=21600")
+			w.Header().Set("Docker-Content-Digest", "sha256:abc")
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+
+	t.Run("retries after backing off", func(t *testing.T) {
+		server := newRateLimitedRegistry(t, "", 2)
+		dc := NewDockerClient()
+		dc.defaultRegistry = DockerRegistry{URL: server.URL}
+		waits := []time.Duration{}
+		dc.sleep = func(wait time.Duration) { waits = append(waits, wait) }
+
+		digest, err := dc.GetDigestForTag("9.11.0", imageEE)
+		require.NoError(t, err)
+		assert.Equal(t, "sha256:abc", digest)
+		assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, waits)
+
+		rateLimits := dc.RateLimits()
+		require.Len(t, rateLimits, 1)
+		assert.Equal(t, server.URL, rateLimits[0].Registry)
+		assert.Equal(t, 100, rateLimits[0].Limit)
+		assert.Equal(t, 42, rateLimits[0].Remaining)
+		assert.Equal(t, 21600, rateLimits[0].WindowSeconds)
+	})
+
+	t.Run("gives up on long waits", func(t *testing.T) {
+		server := newRateLimitedRegistry(t, "3600", 1)
+		dc := NewDockerClient()
+		dc.defaultRegistry = DockerRegistry{URL: server.URL}
+		dc.sleep = func(time.Duration) { t.Error("should not wait for an hour") }
+
+		_, err := dc.ValidTag("9.11.0", imageEE)
+		require.EqualError(t, err, "rate limited by "+server.URL+" (0 of 100 requests remaining), retry after 1h0m0s")
+	})
+
+	t.Run("gives up after the retries", func(t *testing.T) {
+		server := newRateLimitedRegistry(t, "1", rateLimitMaxRetries+1)
+		dc := NewDockerClient()
+		dc.defaultRegistry = DockerRegistry{URL: server.URL}
+		waits := 0
+		dc.sleep = func(time.Duration) { waits++ }
+
+		_, err := dc.ValidTag("9.11.0", imageEE)
+		require.Error(t, err)
+		assert.Equal(t, rateLimitMaxRetries, waits)
+	})
+}
+
+func TestDockerClientServerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	dc := &DockerClient{defaultRegistry: DockerRegistry{URL: server.URL}}
+
+	valid, err := dc.ValidTag("9.11.0", imageEE)
+	require.EqualError(t, err, "unexpected status code 502 from registry")
+	assert.False(t, valid)
+}
+
+func TestDockerClientPlatformDigest(t *testing.T) {
+	newIndexRegistry := func(t *testing.T, mediaType, index string) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Contains(t, r.Header.Get("Accept"), mediaType)
+			w.Header().Set("Content-Type", mediaType)
+			w.Header().Set("Docker-Content-Digest", "sha256:index")
+			if r.Method == http.MethodGet {
+				w.Write([]byte(index))
+			}
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+
+	multiPlatformIndex := `{"schemaVersion":2,"manifests":[
+		{"digest":"sha256:arm64","platform":{"os":"linux","architecture":"arm64"}},
+		{"digest":"sha256:amd64","platform":{"os":"linux","architecture":"amd64"}},
+		{"digest":"sha256:attestation","platform":{"os":"unknown","architecture":"unknown"}}
+	]}`
+
+	for name, mediaType := range map[string]string{
+		"manifest list": manifestlist.MediaTypeManifestList,
+		"OCI index":     ocispec.MediaTypeImageIndex,
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := newIndexRegistry(t, mediaType, multiPlatformIndex)
+			dc := NewDockerClient()
+			dc.defaultRegistry = DockerRegistry{URL: server.URL}
+
+			valid, err := dc.ValidTag("9.11.0", imageEE)
+			require.NoError(t, err)
+			assert.True(t, valid)
+
+			digest, err := dc.GetDigestForTag("9.11.0", imageEE)
+			require.NoError(t, err)
+			assert.Equal(t, "sha256:amd64", digest)
+		})
+	}
+
+	t.Run("tags without a linux/amd64 image are refused", func(t *testing.T) {
+		server := newIndexRegistry(t, ocispec.MediaTypeImageIndex, `{"schemaVersion":2,"manifests":[
+			{"digest":"sha256:arm64","platform":{"os":"linux","architecture":"arm64"}},
+			{"digest":"sha256:attestation","platform":{"os":"unknown","architecture":"unknown"}}
+		]}`)
+		dc := &DockerClient{defaultRegistry: DockerRegistry{URL: server.URL}}
+
+		valid, err := dc.ValidTag("9.11.0", imageEE)
+		require.EqualError(t, err, "mattermost/mattermost-enterprise-edition:9.11.0 has no image for platform linux/amd64, only for linux/arm64")
+		assert.False(t, valid)
+		assert.Equal(t, err, registryUnavailableError(err, imageEE, "9.11.0"))
+
+		_, err = dc.GetDigestForTag("9.11.0", imageEE)
+		require.Error(t, err)
+	})
+}
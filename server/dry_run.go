@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	cloud "github.com/mattermost/mattermost-cloud/model"
+)
+
+const (
+	dryRunStatus = "dry_run"
+
+	// maskedValue replaces license and env values in dry-run requests.
+	maskedValue = "hidden"
+)
+
+// previewCreateInstallationForUser validates the create exactly as
+// createInstallationForUser does and returns the request that would be sent
+// to the provisioner, without sending it.
+func (p *Plugin) previewCreateInstallationForUser(userID string, input CreateInstallationInput) (InstallationActionResult, error) {
+	install, req, err := p.buildCreateInstallationRequest(userID, input)
+	if err != nil {
+		return InstallationActionResult{}, err
+	}
+
+	install.Version = req.Version
+	install.ScheduledDeletionTime = req.ScheduledDeletionTime
+	summary, err := installationSummary(install, false)
+	if err != nil {
+		return InstallationActionResult{}, err
+	}
+
+	return InstallationActionResult{
+		Installation:  summary,
+		Status:        dryRunStatus,
+		Message:       fmt.Sprintf("Dry run: installation %s was not created. %s", install.Name, describeVersionResolution(install.versionSpec, install.Tag, req.Version)),
+		DryRunRequest: maskCreateInstallationRequest(req),
+	}, nil
+}
+
+// previewUpdateInstallationForUser validates the update exactly as
+// updateInstallationForUser does and returns the request that would be sent
+// to the provisioner, without sending it.
+func (p *Plugin) previewUpdateInstallationForUser(userID string, ref InstallationRef, input UpdateInstallationInput, scope InstallationScope) (InstallationActionResult, error) {
+	installToUpdate, err := p.findInstallationToUpdate(userID, ref, scope)
+	if err != nil {
+		return InstallationActionResult{}, err
+	}
+
+	request, changedFields, setEnvKeys, clearEnvKeys, requestedTag, err := p.buildUpdateInstallationRequest(installToUpdate, input)
+	if err != nil {
+		return InstallationActionResult{}, err
+	}
+
+	summary, err := installationSummary(installToUpdate, false)
+	if err != nil {
+		return InstallationActionResult{}, err
+	}
+
+	message := fmt.Sprintf("Dry run: installation %s was not updated.", installToUpdate.Name)
+	if requestedTag != "" && request.Version != nil {
+		message += " " + describeVersionResolution(input.Version, requestedTag, *request.Version)
+	}
+
+	return InstallationActionResult{
+		Installation:   summary,
+		Status:         dryRunStatus,
+		ChangedFields:  changedFields,
+		ChangedEnvKeys: setEnvKeys,
+		ClearedEnvKeys: clearEnvKeys,
+		Message:        message,
+		DryRunRequest:  maskPatchInstallationRequest(request),
+	}, nil
+}
+
+// maskCreateInstallationRequest returns a copy of the request with the
+// license and env values masked.
+func maskCreateInstallationRequest(req *cloud.CreateInstallationRequest) *cloud.CreateInstallationRequest {
+	masked := *req
+	if masked.License != "" {
+		masked.License = maskedValue
+	}
+	masked.MattermostEnv = maskEnvVarMap(req.MattermostEnv)
+	masked.PriorityEnv = maskEnvVarMap(req.PriorityEnv)
+	return &masked
+}
+
+// maskPatchInstallationRequest returns a copy of the request with the
+// license and env values masked. Cleared env vars keep their empty value so
+// they remain recognizable.
+func maskPatchInstallationRequest(req *cloud.PatchInstallationRequest) *cloud.PatchInstallationRequest {
+	masked := *req
+	if req.License != nil && *req.License != "" {
+		masked.License = NewString(maskedValue)
+	}
+	masked.MattermostEnv = maskEnvVarMap(req.MattermostEnv)
+	masked.PriorityEnv = maskEnvVarMap(req.PriorityEnv)
+	return &masked
+}
+
+func maskEnvVarMap(envVars cloud.EnvVarMap) cloud.EnvVarMap {
+	if envVars == nil {
+		return nil
+	}
+
+	masked := make(cloud.EnvVarMap, len(envVars))
+	for key, envVar := range envVars {
+		if envVar.Value != "" {
+			envVar.Value = maskedValue
+		}
+		masked[key] = envVar
+	}
+	return masked
+}
+
+// dryRunResponseText renders a dry-run result for a slash command response.
+func dryRunResponseText(result InstallationActionResult) string {
+	var text strings.Builder
+	text.WriteString(result.Message)
+	if len(result.ChangedFields) > 0 {
+		text.WriteString(" Changed fields: " + strings.Join(result.ChangedFields, ", ") + ".")
+	}
+	text.WriteString(" This request would be sent to the provisioner:\n\n")
+	requestJSON, err := json.MarshalIndent(result.DryRunRequest, "", "\t")
+	if err == nil {
+		text.WriteString(jsonCodeBlock(string(requestJSON)))
+	}
+	return text.String()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+
+	cloud "github.com/mattermost/mattermost-cloud/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreviewCreateInstallationForUser(t *testing.T) {
+	t.Run("returns the masked request without creating", func(t *testing.T) {
+		plugin, cloudClient, _, kv := newServiceTestPluginWithKV(t, nil)
+		plugin.dockerClient = &MockedDockerClient{tagExists: true, digest: "sha256:abc"}
+
+		result, err := plugin.previewCreateInstallationForUser("owner", CreateInstallationInput{
+			Name:    "Preview",
+			License: licenseOptionE20,
+			Env:     map[string]string{"MM_SECRET": "value"},
+			TTL:     "48h",
+		})
+		require.NoError(t, err)
+		assert.Nil(t, cloudClient.creationRequest)
+		assert.Nil(t, kv.get(nameIndexKey("preview")))
+
+		assert.Equal(t, dryRunStatus, result.Status)
+		assert.Equal(t, "Dry run: installation preview was not created. Version latest resolved to tag 9.5.0 (digest sha256:abc).", result.Message)
+		assert.Equal(t, "9.5.0", result.Installation.VersionTag)
+		assert.Equal(t, "sha256:abc", result.Installation.Version)
+		assert.NotEmpty(t, result.Installation.TimeRemaining)
+
+		req, ok := result.DryRunRequest.(*cloud.CreateInstallationRequest)
+		require.True(t, ok)
+		assert.Equal(t, "preview", req.Name)
+		assert.Equal(t, "owner", req.OwnerID)
+		assert.Equal(t, "sha256:abc", req.Version)
+		assert.Equal(t, maskedValue, req.License)
+		assert.Equal(t, maskedValue, req.PriorityEnv["MM_SECRET"].Value)
+		assert.NotZero(t, req.ScheduledDeletionTime)
+	})
+
+	t.Run("te installations have no license to mask", func(t *testing.T) {
+		plugin, _, _ := newServiceTestPlugin(t, nil)
+
+		result, err := plugin.previewCreateInstallationForUser("owner", CreateInstallationInput{Name: "preview", License: licenseOptionTE})
+		require.NoError(t, err)
+		assert.Empty(t, result.DryRunRequest.(*cloud.CreateInstallationRequest).License)
+	})
+
+	t.Run("validation errors match create", func(t *testing.T) {
+		plugin, _, _ := newServiceTestPlugin(t, nil)
+		plugin.dockerClient = &MockedDockerClient{tagExists: false}
+
+		_, err := plugin.previewCreateInstallationForUser("owner", CreateInstallationInput{Name: "preview", Version: "9.1.0"})
+		require.EqualError(t, err, "9.1.0 is not a valid docker tag for repository "+defaultImage)
+	})
+}
+
+func TestPreviewUpdateInstallationForUser(t *testing.T) {
+	t.Run("returns the masked request without updating", func(t *testing.T) {
+		install := serviceTestInstall("id1", "first", "owner1")
+		plugin, cloudClient, _, kv := newServiceTestPluginWithKV(t, []*Installation{install})
+		plugin.dockerClient = &MockedDockerClient{tagExists: true, digest: "sha256:def"}
+
+		result, err := plugin.previewUpdateInstallationForUser("owner1", InstallationRef{Name: "first"}, UpdateInstallationInput{
+			Version:  "9.5.0",
+			License:  licenseOptionE20,
+			SetEnv:   map[string]string{"MM_SECRET": "value"},
+			ClearEnv: []string{"MM_OLD"},
+		}, InstallationScopeMine)
+		require.NoError(t, err)
+		assert.Empty(t, cloudClient.patchInstallationID)
+		assert.Equal(t, "9.4.0", kv.getInstallation(t, "id1").Tag)
+
+		assert.Equal(t, dryRunStatus, result.Status)
+		assert.Equal(t, "Dry run: installation first was not updated. Version 9.5.0 resolved to digest sha256:def.", result.Message)
+		assert.Equal(t, []string{"env", "license", "version"}, result.ChangedFields)
+		assert.Equal(t, []string{"MM_SECRET"}, result.ChangedEnvKeys)
+		assert.Equal(t, []string{"MM_OLD"}, result.ClearedEnvKeys)
+
+		req, ok := result.DryRunRequest.(*cloud.PatchInstallationRequest)
+		require.True(t, ok)
+		require.NotNil(t, req.Version)
+		assert.Equal(t, "sha256:def", *req.Version)
+		require.NotNil(t, req.License)
+		assert.Equal(t, maskedValue, *req.License)
+		assert.Equal(t, maskedValue, req.PriorityEnv["MM_SECRET"].Value)
+		assert.Empty(t, req.PriorityEnv["MM_OLD"].Value)
+	})
+
+	t.Run("shared scope is rejected", func(t *testing.T) {
+		plugin, _, _ := newServiceTestPlugin(t, nil)
+
+		_, err := plugin.previewUpdateInstallationForUser("owner1", InstallationRef{Name: "first"}, UpdateInstallationInput{Size: "miniHA"}, InstallationScopeShared)
+		require.EqualError(t, err, "shared scope is read-only for updates")
+	})
+}
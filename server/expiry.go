@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	cloud "github.com/mattermost/mattermost-cloud/model"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/pluginapi/cluster"
+	"github.com/pkg/errors"
+)
+
+const (
+	// StoreExpiryReminderKeyPrefix prefixes the key recording the last expiry
+	// reminder sent for an installation.
+	StoreExpiryReminderKeyPrefix = "expiry_reminder_"
+
+	expiryReminderJobKey   = "expiry_reminders"
+	expiryReminderInterval = 5 * time.Minute
+
+	// expiryReminderExtension is how long the Extend button of a reminder
+	// pushes back the scheduled deletion.
+	expiryReminderExtension = "24h"
+
+	expiryActionExtend  = "extend"
+	expiryActionLock    = "lock"
+	expiryActionDismiss = "dismiss"
+)
+
+// expiryReminder records the reminder last sent for a scheduled deletion so
+// that each lead time is only reminded once. A lead time of 0 means the owner
+// chose to let the installation go and no further reminders are sent.
+type expiryReminder struct {
+	ScheduledDeletionTime int64         `json:"scheduled_deletion_time"`
+	LeadTime              time.Duration `json:"lead_time"`
+}
+
+func expiryReminderKey(installationID string) string {
+	return StoreExpiryReminderKeyPrefix + installationID
+}
+
+// scheduleExpiryReminderJob starts the job reminding owners of upcoming
+// scheduled deletions. The job runs on a single plugin instance at a time.
+func (p *Plugin) scheduleExpiryReminderJob() error {
+	job, err := cluster.Schedule(p.API, expiryReminderJobKey, cluster.MakeWaitForRoundedInterval(expiryReminderInterval), p.sendExpiryReminders)
+	if err != nil {
+		return errors.Wrap(err, "unable to schedule expiry reminder job")
+	}
+	p.expiryReminderJob = job
+
+	return nil
+}
+
+func (p *Plugin) sendExpiryReminders() {
+	if err := p.sendExpiryRemindersAt(time.Now()); err != nil {
+		p.API.LogError(errors.Wrap(err, "failed to send expiry reminders").Error())
+	}
+}
+
+// sendExpiryRemindersAt DMs the owner of every installation whose scheduled
+// deletion has come within one of the configured lead times. The
+// installations of every owner are fetched from the provisioner at once.
+func (p *Plugin) sendExpiryRemindersAt(now time.Time) error {
+	leadTimes := p.getConfiguration().expiryReminderLeadTimes()
+	if len(leadTimes) == 0 {
+		return nil
+	}
+
+	installs, err := p.getInstallations()
+	if err != nil {
+		return errors.Wrap(err, "unable to get installations")
+	}
+
+	cloudInstalls, err := p.cloudClient.GetInstallations(&cloud.GetInstallationsRequest{
+		Paging: cloud.AllPagesNotDeleted(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to get installations from cloud server")
+	}
+	cloudInstallsByID := make(map[string]*cloud.InstallationDTO, len(cloudInstalls))
+	for _, cloudInstall := range cloudInstalls {
+		if cloudInstall != nil && cloudInstall.Installation != nil {
+			cloudInstallsByID[cloudInstall.ID] = cloudInstall
+		}
+	}
+
+	for _, install := range installs {
+		// Installations the provisioner didn't return were deleted.
+		cloudInstall, ok := cloudInstallsByID[install.ID]
+		if !ok {
+			continue
+		}
+		install.InstallationDTO = *cloudInstall
+
+		if err = p.remindInstallationExpiry(install, leadTimes, now); err != nil {
+			p.API.LogWarn("Failed to send expiry reminder", "installation", install.ID, "error", err.Error())
+		}
+	}
+
+	return nil
+}
+
+func (p *Plugin) remindInstallationExpiry(install *Installation, leadTimes []time.Duration, now time.Time) error {
+	if install == nil || install.Installation == nil ||
+		install.ScheduledDeletionTime <= 0 ||
+		install.DeletionLocked ||
+		!installationAwaitingDeletion(install.State) {
+		return nil
+	}
+
+	remaining := time.UnixMilli(install.ScheduledDeletionTime).Sub(now)
+	if remaining <= 0 {
+		return nil
+	}
+
+	// Lead times are sorted longest first, so the last one the remaining
+	// time falls within is the most urgent reminder due.
+	var leadTime time.Duration
+	for _, candidate := range leadTimes {
+		if remaining <= candidate {
+			leadTime = candidate
+		}
+	}
+	if leadTime == 0 {
+		return nil
+	}
+
+	last, err := p.getExpiryReminder(install.ID)
+	if err != nil {
+		return err
+	}
+	if last != nil && last.ScheduledDeletionTime == install.ScheduledDeletionTime && last.LeadTime <= leadTime {
+		return nil
+	}
+
+	if err = p.postExpiryReminder(install, remaining); err != nil {
+		return err
+	}
+
+	return p.storeExpiryReminder(install.ID, expiryReminder{
+		ScheduledDeletionTime: install.ScheduledDeletionTime,
+		LeadTime:              leadTime,
+	}, now)
+}
+
+// installationAwaitingDeletion returns false for installations that are
+// already on their way to deletion.
+func installationAwaitingDeletion(state string) bool {
+	switch state {
+	case cloud.InstallationStateDeletionPendingRequested,
+		cloud.InstallationStateDeletionPendingInProgress,
+		cloud.InstallationStateDeletionPending,
+		cloud.InstallationStateDeletionRequested,
+		cloud.InstallationStateDeletionInProgress,
+		cloud.InstallationStateDeletionFinalCleanup,
+		cloud.InstallationStateDeletionFailed,
+		cloud.InstallationStateDeleted:
+		return false
+	}
+	return true
+}
+
+func (p *Plugin) getExpiryReminder(installationID string) (*expiryReminder, error) {
+	reminderJSON, appErr := p.API.KVGet(expiryReminderKey(installationID))
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "unable to get expiry reminder")
+	}
+	if reminderJSON == nil {
+		return nil, nil
+	}
+
+	var reminder expiryReminder
+	if err := json.Unmarshal(reminderJSON, &reminder); err != nil {
+		return nil, errors.Wrap(err, "unable to unmarshal expiry reminder")
+	}
+
+	return &reminder, nil
+}
+
+// storeExpiryReminder saves the reminder until a day after the scheduled
+// deletion, after which it is no longer needed.
+func (p *Plugin) storeExpiryReminder(installationID string, reminder expiryReminder, now time.Time) error {
+	reminderJSON, err := json.Marshal(reminder)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal expiry reminder")
+	}
+
+	expiry := time.UnixMilli(reminder.ScheduledDeletionTime).Add(24 * time.Hour).Sub(now)
+	if expiry < time.Hour {
+		expiry = time.Hour
+	}
+	_, appErr := p.API.KVSetWithOptions(expiryReminderKey(installationID), reminderJSON, model.PluginKVSetOptions{
+		ExpireInSeconds: int64(expiry.Seconds()),
+	})
+	if appErr != nil {
+		return errors.Wrap(appErr, "unable to store expiry reminder")
+	}
+
+	return nil
+}
+
+func (p *Plugin) postExpiryReminder(install *Installation, remaining time.Duration) error {
+	channel, appErr := p.API.GetDirectChannel(install.OwnerID, p.BotUserID)
+	if appErr != nil {
+		return appErr
+	}
+	if channel == nil {
+		return fmt.Errorf("could not get direct channel for bot and user_id=%s", install.OwnerID)
+	}
+
+	post := &model.Post{
+		UserId:    p.BotUserID,
+		ChannelId: channel.Id,
+	}
+	model.ParseSlackAttachment(post, []*model.SlackAttachment{{
+		Fallback: fmt.Sprintf("Installation %s will be deleted in %s.", install.Name, formatDuration(remaining)),
+		Text: fmt.Sprintf("Installation %s will be deleted in %s, on %s. Extend it, lock it for deletion, or let it go.",
+			install.Name, formatDuration(remaining), cloud.DateTimeStringFromMillis(install.ScheduledDeletionTime)),
+		Actions: []*model.PostAction{
+			expiryReminderAction(install.ID, expiryActionExtend, "Extend "+expiryReminderExtension, "primary"),
+			expiryReminderAction(install.ID, expiryActionLock, "Lock", "default"),
+			expiryReminderAction(install.ID, expiryActionDismiss, "Let it go", "danger"),
+		},
+	}})
+
+	_, appErr = p.API.CreatePost(post)
+	if appErr != nil {
+		return appErr
+	}
+
+	return nil
+}
+
+func expiryReminderAction(installationID, action, name, style string) *model.PostAction {
+	return &model.PostAction{
+		Id:    action,
+		Type:  model.PostActionTypeButton,
+		Name:  name,
+		Style: style,
+		Integration: &model.PostActionIntegration{
+			URL: fmt.Sprintf("/plugins/%s/api/v1/expiry/%s", manifest.ID, action),
+			Context: map[string]any{
+				"installation_id": installationID,
+			},
+		},
+	}
+}
+
+// handleExpiryReminderAction handles the buttons of an expiry reminder DM.
+func (p *Plugin) handleExpiryReminderAction(w http.ResponseWriter, r *http.Request, action string) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	req := &model.PostActionIntegrationRequest{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	installationID, _ := req.Context["installation_id"].(string)
+	if err != nil || installationID == "" {
+		if err != nil {
+			p.API.LogError(errors.Wrap(err, "Unable to decode expiry reminder action request").Error())
+		}
+
+		http.Error(w, "Please provide a post action request with an installation_id in its context", http.StatusBadRequest)
+		return
+	}
+
+	var status string
+	ref := InstallationRef{ID: installationID}
+	switch action {
+	case expiryActionExtend:
+		var result InstallationActionResult
+		result, err = p.extendInstallationForUser(userID, ref, expiryReminderExtension)
+		if err == nil {
+			status = fmt.Sprintf("Extended by %s. %s", expiryReminderExtension, result.Message)
+		}
+	case expiryActionLock:
+		_, err = p.setDeletionLockForUser(userID, ref, true)
+		status = "Locked for deletion. Run `/cloud deletion-unlock` when you no longer need it."
+	case expiryActionDismiss:
+		err = p.dismissExpiryReminders(userID, installationID)
+		status = "No further reminders will be sent. The installation will be deleted as scheduled."
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	response := &model.PostActionIntegrationResponse{}
+	if err != nil {
+		response.EphemeralText = fmt.Sprintf("Unable to %s the installation: %s", action, err.Error())
+	} else {
+		response.Update = p.resolvedActionPost(req.PostId, status)
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		p.API.LogError(errors.Wrap(err, "Unable to marshal expiry reminder action response").Error())
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Write(data)
+}
+
+// dismissExpiryReminders stops further reminders for the current scheduled
+// deletion of an installation owned by the user.
+func (p *Plugin) dismissExpiryReminders(userID, installationID string) error {
+	install, err := p.getInstallation(installationID)
+	if err != nil {
+		return err
+	}
+	if install == nil || install.OwnerID != userID {
+		return errors.New("installation not found")
+	}
+
+	return p.storeExpiryReminder(installationID, expiryReminder{
+		ScheduledDeletionTime: install.ScheduledDeletionTime,
+	}, time.Now())
+}
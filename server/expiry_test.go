@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// captureBotPosts records the posts created by the bot. Posts edited by the
+// bot are updated in place.
+func captureBotPosts(api *plugintest.API) *[]*model.Post {
+	posts := []*model.Post{}
+	api.On("GetDirectChannel", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(&model.Channel{Id: "dm-channel-id"}, nil)
+	api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(func(post *model.Post) (*model.Post, *model.AppError) {
+		if post.Id == "" {
+			post.Id = model.NewId()
+		}
+		posts = append(posts, post)
+		return post, nil
+	})
+	api.On("GetPost", mock.AnythingOfType("string")).Return(func(postID string) (*model.Post, *model.AppError) {
+		for _, post := range posts {
+			if post.Id == postID {
+				return post.Clone(), nil
+			}
+		}
+		return nil, model.NewAppError("GetPost", "app.post.get.app_error", nil, "", http.StatusNotFound)
+	}).Maybe()
+	api.On("UpdatePost", mock.AnythingOfType("*model.Post")).Return(func(post *model.Post) (*model.Post, *model.AppError) {
+		for i := range posts {
+			if posts[i].Id == post.Id {
+				posts[i] = post
+				return post, nil
+			}
+		}
+		return nil, model.NewAppError("UpdatePost", "app.post.get.app_error", nil, "", http.StatusNotFound)
+	}).Maybe()
+	return &posts
+}
+
+func TestSendExpiryReminders(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	setup := func(t *testing.T, install *Installation) (*Plugin, *MockClient, *[]*model.Post, *fakeKVStore) {
+		plugin, cloudClient, api, kv := newServiceTestPluginWithKV(t, []*Installation{install})
+		plugin.configuration.ExpiryReminderHours = "24,2"
+		plugin.BotUserID = "bot-id"
+		cloudClient.mockedCloudInstallationsDTO = serviceDTOs(install)
+		return plugin, cloudClient, captureBotPosts(api), kv
+	}
+
+	t.Run("reminds once per lead time", func(t *testing.T) {
+		install := serviceTestInstall("id1", "first", "owner1")
+		install.ScheduledDeletionTime = now.Add(20 * time.Hour).UnixMilli()
+		plugin, _, posts, _ := setup(t, install)
+
+		require.NoError(t, plugin.sendExpiryRemindersAt(now))
+		require.Len(t, *posts, 1)
+		post := (*posts)[0]
+		assert.Equal(t, "bot-id", post.UserId)
+		assert.Equal(t, "dm-channel-id", post.ChannelId)
+		attachments := post.Attachments()
+		require.Len(t, attachments, 1)
+		assert.Contains(t, attachments[0].Text, "Installation first will be deleted in 20h")
+		require.Len(t, attachments[0].Actions, 3)
+		assert.Equal(t, "/plugins/com.mattermost.cloud/api/v1/expiry/extend", attachments[0].Actions[0].Integration.URL)
+		assert.Equal(t, "id1", attachments[0].Actions[0].Integration.Context["installation_id"])
+		assert.Equal(t, "Lock", attachments[0].Actions[1].Name)
+		assert.Equal(t, "Let it go", attachments[0].Actions[2].Name)
+
+		require.NoError(t, plugin.sendExpiryRemindersAt(now.Add(time.Hour)))
+		assert.Len(t, *posts, 1)
+
+		require.NoError(t, plugin.sendExpiryRemindersAt(now.Add(19*time.Hour)))
+		require.Len(t, *posts, 2)
+		assert.Contains(t, (*posts)[1].Attachments()[0].Text, "will be deleted in 1h")
+
+		require.NoError(t, plugin.sendExpiryRemindersAt(now.Add(19*time.Hour+30*time.Minute)))
+		assert.Len(t, *posts, 2)
+	})
+
+	t.Run("an extended deletion is reminded again", func(t *testing.T) {
+		install := serviceTestInstall("id1", "first", "owner1")
+		install.ScheduledDeletionTime = now.Add(time.Hour).UnixMilli()
+		plugin, cloudClient, posts, _ := setup(t, install)
+
+		require.NoError(t, plugin.sendExpiryRemindersAt(now))
+		require.Len(t, *posts, 1)
+
+		install.ScheduledDeletionTime = now.Add(90 * time.Minute).UnixMilli()
+		cloudClient.mockedCloudInstallationsDTO = serviceDTOs(install)
+		require.NoError(t, plugin.sendExpiryRemindersAt(now))
+		assert.Len(t, *posts, 2)
+	})
+
+	t.Run("skips installations that are not due, locked, or already being deleted", func(t *testing.T) {
+		install := serviceTestInstall("id1", "first", "owner1")
+		install.ScheduledDeletionTime = now.Add(30 * time.Hour).UnixMilli()
+		plugin, cloudClient, posts, _ := setup(t, install)
+
+		require.NoError(t, plugin.sendExpiryRemindersAt(now))
+
+		install.ScheduledDeletionTime = now.Add(time.Hour).UnixMilli()
+		install.DeletionLocked = true
+		cloudClient.mockedCloudInstallationsDTO = serviceDTOs(install)
+		require.NoError(t, plugin.sendExpiryRemindersAt(now))
+
+		install.DeletionLocked = false
+		install.State = "deletion-pending"
+		cloudClient.mockedCloudInstallationsDTO = serviceDTOs(install)
+		require.NoError(t, plugin.sendExpiryRemindersAt(now))
+
+		assert.Empty(t, *posts)
+	})
+
+	t.Run("fetches the installations of every owner at once", func(t *testing.T) {
+		first := serviceTestInstall("id1", "first", "owner1")
+		first.ScheduledDeletionTime = now.Add(time.Hour).UnixMilli()
+		second := serviceTestInstall("id2", "second", "owner2")
+		second.ScheduledDeletionTime = now.Add(time.Hour).UnixMilli()
+		deleted := serviceTestInstall("id3", "third", "owner2")
+		deleted.ScheduledDeletionTime = now.Add(time.Hour).UnixMilli()
+		plugin, cloudClient, api, _ := newServiceTestPluginWithKV(t, []*Installation{first, second, deleted})
+		plugin.configuration.ExpiryReminderHours = "24,2"
+		plugin.BotUserID = "bot-id"
+		cloudClient.mockedCloudInstallationsDTO = serviceDTOs(first, second)
+		posts := captureBotPosts(api)
+
+		require.NoError(t, plugin.sendExpiryRemindersAt(now))
+
+		require.Len(t, cloudClient.getInstallationsRequests, 1)
+		assert.Empty(t, cloudClient.getInstallationsRequests[0].OwnerID)
+		require.Len(t, *posts, 2)
+		texts := []string{(*posts)[0].Attachments()[0].Text, (*posts)[1].Attachments()[0].Text}
+		assert.Contains(t, strings.Join(texts, "\n"), "Installation first will be deleted")
+		assert.Contains(t, strings.Join(texts, "\n"), "Installation second will be deleted")
+	})
+
+	t.Run("no reminders without lead times", func(t *testing.T) {
+		install := serviceTestInstall("id1", "first", "owner1")
+		install.ScheduledDeletionTime = now.Add(time.Hour).UnixMilli()
+		plugin, _, posts, _ := setup(t, install)
+		plugin.configuration.ExpiryReminderHours = ""
+
+		require.NoError(t, plugin.sendExpiryRemindersAt(now))
+		assert.Empty(t, *posts)
+	})
+
+	t.Run("letting it go stops further reminders", func(t *testing.T) {
+		install := serviceTestInstall("id1", "first", "owner1")
+		install.ScheduledDeletionTime = now.Add(20 * time.Hour).UnixMilli()
+		plugin, _, posts, _ := setup(t, install)
+
+		require.NoError(t, plugin.sendExpiryRemindersAt(now))
+		require.Len(t, *posts, 1)
+		require.NoError(t, plugin.dismissExpiryReminders("owner1", "id1"))
+
+		require.NoError(t, plugin.sendExpiryRemindersAt(now.Add(19*time.Hour)))
+		assert.Len(t, *posts, 1)
+	})
+}
+
+func TestExpiryReminderActionHandlers(t *testing.T) {
+	reminderPost := &model.Post{Id: "post-id"}
+	model.ParseSlackAttachment(reminderPost, []*model.SlackAttachment{{
+		Text:    "Installation first will be deleted in 2h.",
+		Actions: []*model.PostAction{{Id: expiryActionExtend}},
+	}})
+
+	setup := func(t *testing.T) (*Plugin, *MockClient) {
+		install := serviceTestInstall("id1", "first", "owner1")
+		install.ScheduledDeletionTime = time.Now().Add(2 * time.Hour).UnixMilli()
+		plugin, cloudClient, api := newServiceTestPlugin(t, []*Installation{install})
+		cloudClient.mockedCloudInstallationsDTO = serviceDTOs(install)
+		api.On("GetPost", "post-id").Return(reminderPost, nil)
+		return plugin, cloudClient
+	}
+
+	doAction := func(plugin *Plugin, action, userID string, body string) (*httptest.ResponseRecorder, *model.PostActionIntegrationResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/expiry/"+action, strings.NewReader(body))
+		req.Header.Set("Mattermost-User-ID", userID)
+		rec := httptest.NewRecorder()
+
+		plugin.handleExpiryReminderAction(rec, req, action)
+
+		response := &model.PostActionIntegrationResponse{}
+		if rec.Code == http.StatusOK {
+			_ = json.Unmarshal(rec.Body.Bytes(), response)
+		}
+		return rec, response
+	}
+
+	actionBody := `{"user_id":"owner1","post_id":"post-id","context":{"installation_id":"id1"}}`
+
+	t.Run("extend", func(t *testing.T) {
+		plugin, cloudClient := setup(t)
+
+		rec, response := doAction(plugin, expiryActionExtend, "owner1", actionBody)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, response.EphemeralText)
+		assert.Equal(t, "id1", cloudClient.scheduledDeletionID)
+		require.NotNil(t, response.Update)
+		attachments := response.Update.Attachments()
+		require.Len(t, attachments, 1)
+		assert.Empty(t, attachments[0].Actions)
+		assert.Equal(t, "Installation first will be deleted in 2h.", attachments[0].Text)
+		require.Len(t, attachments[0].Fields, 1)
+		assert.Contains(t, attachments[0].Fields[0].Value, "Extended by 24h.")
+	})
+
+	t.Run("lock", func(t *testing.T) {
+		plugin, cloudClient := setup(t)
+
+		rec, response := doAction(plugin, expiryActionLock, "owner1", actionBody)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, response.EphemeralText)
+		assert.Equal(t, "id1", cloudClient.lockedInstallationID)
+		require.NotNil(t, response.Update)
+		assert.Contains(t, response.Update.Attachments()[0].Fields[0].Value, "Locked for deletion.")
+	})
+
+	t.Run("let it go", func(t *testing.T) {
+		plugin, cloudClient := setup(t)
+
+		rec, response := doAction(plugin, expiryActionDismiss, "owner1", actionBody)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, response.EphemeralText)
+		assert.Empty(t, cloudClient.scheduledDeletionID)
+		assert.Empty(t, cloudClient.lockedInstallationID)
+		require.NotNil(t, response.Update)
+		assert.Contains(t, response.Update.Attachments()[0].Fields[0].Value, "deleted as scheduled")
+	})
+
+	t.Run("errors are returned as ephemeral text", func(t *testing.T) {
+		plugin, cloudClient := setup(t)
+
+		rec, response := doAction(plugin, expiryActionLock, "other", actionBody)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "Unable to lock the installation: no installations found for the given User ID", response.EphemeralText)
+		assert.Nil(t, response.Update)
+		assert.Empty(t, cloudClient.lockedInstallationID)
+	})
+
+	t.Run("requests without an installation are rejected", func(t *testing.T) {
+		plugin, _ := setup(t)
+
+		rec, _ := doAction(plugin, expiryActionExtend, "owner1", `{"user_id":"owner1","context":{}}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("unauthenticated requests are rejected", func(t *testing.T) {
+		plugin, _ := setup(t)
+
+		rec, _ := doAction(plugin, expiryActionExtend, "", actionBody)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	cloud "github.com/mattermost/mattermost-cloud/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	// StoreHistoryKeyPrefix prefixes the key holding the history of an installation
+	StoreHistoryKeyPrefix = "history_"
+
+	// maxHistoryEvents is the number of most recent events kept per installation.
+	maxHistoryEvents = 200
+
+	historyEventTypeAction      = "action"
+	historyEventTypeStateChange = "state_change"
+
+	historyActionCreate    = "create"
+	historyActionImport    = "import"
+	historyActionClone     = "clone"
+	historyActionUpdate    = "update"
+	historyActionRestart   = "restart"
+	historyActionHibernate = "hibernate"
+	historyActionWake      = "wake"
+	historyActionDelete    = "delete"
+	historyActionRestore   = "restore"
+	historyActionExtend    = "extend"
+	historyActionLock      = "lock"
+	historyActionUnlock    = "unlock"
+	historyActionRetry     = "retry"
+	historyActionRotate    = "rotate_credentials"
+)
+
+// InstallationHistoryEvent is a single plugin action or provisioner state
+// transition recorded for an installation.
+type InstallationHistoryEvent struct {
+	Timestamp int64  `json:"timestamp"`
+	Type      string `json:"type"`
+	Action    string `json:"action,omitempty"`
+	ActorID   string `json:"actor_id,omitempty"`
+	OldState  string `json:"old_state,omitempty"`
+	NewState  string `json:"new_state,omitempty"`
+	Details   string `json:"details,omitempty"`
+}
+
+func historyKey(installationID string) string {
+	return StoreHistoryKeyPrefix + installationID
+}
+
+// appendInstallationHistory adds an event to the history of an installation,
+// dropping the oldest events once maxHistoryEvents is reached.
+func (p *Plugin) appendInstallationHistory(installationID string, event InstallationHistoryEvent) error {
+	if installationID == "" {
+		return errors.New("installation ID must not be empty")
+	}
+	if event.Timestamp == 0 {
+		event.Timestamp = cloud.GetMillis()
+	}
+
+	key := historyKey(installationID)
+	for i := 0; i < StoreInstallRetries; i++ {
+		originalJSON, appErr := p.API.KVGet(key)
+		if appErr != nil {
+			return errors.Wrap(appErr, "unable to get installation history")
+		}
+
+		var events []InstallationHistoryEvent
+		if originalJSON != nil {
+			if err := json.Unmarshal(originalJSON, &events); err != nil {
+				return errors.Wrap(err, "unable to unmarshal installation history")
+			}
+		}
+
+		events = append(events, event)
+		if len(events) > maxHistoryEvents {
+			events = events[len(events)-maxHistoryEvents:]
+		}
+
+		eventsJSON, err := json.Marshal(events)
+		if err != nil {
+			return errors.Wrap(err, "unable to marshal installation history")
+		}
+
+		ok, appErr := p.API.KVCompareAndSet(key, originalJSON, eventsJSON)
+		if appErr != nil {
+			return errors.Wrap(appErr, "unable to store installation history")
+		}
+		if ok {
+			return nil
+		}
+
+		time.Sleep(time.Duration(i) * time.Second)
+	}
+
+	return errors.Errorf("failed %d times to store history for installation %s", StoreInstallRetries, installationID)
+}
+
+// getInstallationHistory returns the recorded events of an installation,
+// oldest first.
+func (p *Plugin) getInstallationHistory(installationID string) ([]InstallationHistoryEvent, error) {
+	eventsJSON, appErr := p.API.KVGet(historyKey(installationID))
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "unable to get installation history")
+	}
+
+	events := []InstallationHistoryEvent{}
+	if eventsJSON == nil {
+		return events, nil
+	}
+	if err := json.Unmarshal(eventsJSON, &events); err != nil {
+		return nil, errors.Wrap(err, "unable to unmarshal installation history")
+	}
+
+	return events, nil
+}
+
+// recordInstallationAction records a plugin action run by a user. History is
+// informational, so failures are logged rather than returned.
+func (p *Plugin) recordInstallationAction(installationID, actorID, action string, details ...string) {
+	err := p.appendInstallationHistory(installationID, InstallationHistoryEvent{
+		Type:    historyEventTypeAction,
+		Action:  action,
+		ActorID: actorID,
+		Details: strings.Join(details, ", "),
+	})
+	if err != nil {
+		p.API.LogWarn("Failed to record installation action", "installation", installationID, "action", action, "error", err.Error())
+	}
+}
+
+// recordInstallationStateChange records a provisioner state transition for
+// installations managed by the plugin. Installations deleted through the
+// plugin no longer have a record, so an existing history is also accepted.
+func (p *Plugin) recordInstallationStateChange(payload *cloud.WebhookPayload) error {
+	install, _, err := p.getInstallationRecord(payload.ID)
+	if err != nil {
+		return err
+	}
+	if install == nil {
+		existing, appErr := p.API.KVGet(historyKey(payload.ID))
+		if appErr != nil {
+			return errors.Wrap(appErr, "unable to get installation history")
+		}
+		if existing == nil {
+			return nil
+		}
+	}
+
+	return p.appendInstallationHistory(payload.ID, InstallationHistoryEvent{
+		Type:     historyEventTypeStateChange,
+		ActorID:  payload.ExtraData["actor_id"],
+		OldState: payload.OldState,
+		NewState: payload.NewState,
+	})
+}
+
+// getInstallationHistoryForUser returns an installation owned by or shared
+// with the user along with its history.
+func (p *Plugin) getInstallationHistoryForUser(userID string, ref InstallationRef) (*Installation, []InstallationHistoryEvent, error) {
+	install, err := p.findVisibleInstallationForUser(userID, ref)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	events, err := p.getInstallationHistory(install.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return install, events, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	cloud "github.com/mattermost/mattermost-cloud/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstallationHistory(t *testing.T) {
+	t.Run("appends in order and keeps the most recent events", func(t *testing.T) {
+		plugin, _, _ := newInstallationStoreTestPlugin()
+
+		for i := 0; i < maxHistoryEvents+5; i++ {
+			require.NoError(t, plugin.appendInstallationHistory("id1", InstallationHistoryEvent{
+				Type:    historyEventTypeAction,
+				Action:  historyActionRestart,
+				Details: fmt.Sprintf("%d", i),
+			}))
+		}
+
+		events, err := plugin.getInstallationHistory("id1")
+		require.NoError(t, err)
+		require.Len(t, events, maxHistoryEvents)
+		assert.Equal(t, "5", events[0].Details)
+		assert.Equal(t, fmt.Sprintf("%d", maxHistoryEvents+4), events[len(events)-1].Details)
+		assert.NotZero(t, events[0].Timestamp)
+	})
+
+	t.Run("no history", func(t *testing.T) {
+		plugin, _, _ := newInstallationStoreTestPlugin()
+
+		events, err := plugin.getInstallationHistory("id1")
+		require.NoError(t, err)
+		assert.Empty(t, events)
+	})
+
+	t.Run("state changes are only recorded for plugin installations", func(t *testing.T) {
+		plugin, _, kv := newInstallationStoreTestPlugin()
+		kv.seedInstallations(t, serviceTestInstall("id1", "First", "owner1"))
+
+		for _, id := range []string{"id1", "unknown"} {
+			require.NoError(t, plugin.recordInstallationStateChange(&cloud.WebhookPayload{
+				Type:      cloud.TypeInstallation,
+				ID:        id,
+				OldState:  cloud.InstallationStateCreationInProgress,
+				NewState:  cloud.InstallationStateStable,
+				ExtraData: map[string]string{"actor_id": "provisioner-client"},
+			}))
+		}
+
+		events, err := plugin.getInstallationHistory("id1")
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, historyEventTypeStateChange, events[0].Type)
+		assert.Equal(t, cloud.InstallationStateCreationInProgress, events[0].OldState)
+		assert.Equal(t, cloud.InstallationStateStable, events[0].NewState)
+		assert.Equal(t, "provisioner-client", events[0].ActorID)
+		assert.Nil(t, kv.get(historyKey("unknown")))
+	})
+
+	t.Run("state changes are recorded after the plugin deleted the installation", func(t *testing.T) {
+		plugin, _, _ := newInstallationStoreTestPlugin()
+		plugin.recordInstallationAction("id1", "owner1", historyActionDelete)
+
+		require.NoError(t, plugin.recordInstallationStateChange(&cloud.WebhookPayload{
+			Type:     cloud.TypeInstallation,
+			ID:       "id1",
+			OldState: cloud.InstallationStateDeletionRequested,
+			NewState: cloud.InstallationStateDeletionPending,
+		}))
+
+		events, err := plugin.getInstallationHistory("id1")
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		assert.Equal(t, historyActionDelete, events[0].Action)
+		assert.Equal(t, cloud.InstallationStateDeletionPending, events[1].NewState)
+	})
+
+	t.Run("service actions are recorded with their actor", func(t *testing.T) {
+		install := serviceTestInstall("id1", "First", "owner1")
+		install.Shared = true
+		install.AllowSharedUpdates = true
+		plugin, _, _ := newServiceTestPlugin(t, []*Installation{install})
+
+		_, err := plugin.restartInstallationForUser("other", InstallationRef{Name: "first"}, InstallationScopeUpdatable)
+		require.NoError(t, err)
+		_, err = plugin.updateInstallationForUser("owner1", InstallationRef{ID: "id1"}, UpdateInstallationInput{Size: "miniHA"}, InstallationScopeMine)
+		require.NoError(t, err)
+
+		events, err := plugin.getInstallationHistory("id1")
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		assert.Equal(t, historyActionRestart, events[0].Action)
+		assert.Equal(t, "other", events[0].ActorID)
+		assert.Equal(t, historyActionUpdate, events[1].Action)
+		assert.Equal(t, "owner1", events[1].ActorID)
+		assert.Equal(t, "size", events[1].Details)
+	})
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	cloud "github.com/mattermost/mattermost-cloud/model"
@@ -12,8 +14,17 @@ import (
 const (
 	// StoreInstallRetries is the number of retries to use when storing installs fails on a race
 	StoreInstallRetries = 3
-	// StoreInstallsKey is the key used to store installs in the plugin KV store
+	// StoreInstallsKey is the legacy key that stored every installation in a
+	// single JSON blob. It is only read when migrating to per-installation records.
 	StoreInstallsKey = "installs"
+	// StoreInstallationKeyPrefix prefixes the key of each installation record
+	StoreInstallationKeyPrefix = "install_"
+	// StoreOwnerIndexKeyPrefix prefixes the key listing the installation IDs of an owner
+	StoreOwnerIndexKeyPrefix = "owner_installs_"
+	// StoreNameIndexKeyPrefix prefixes the key reserving an installation name
+	StoreNameIndexKeyPrefix = "name_install_"
+
+	listInstallationsPerPage = 200
 )
 
 // Installation extends the cloud struct of the same name to add additional configuration options
@@ -22,8 +33,17 @@ type Installation struct {
 	cloud.InstallationDTO
 	Tag                string
 	TestData           bool
+	TestDataProfile    *TestDataProfile
+	Plugins            []string
+	ConfigOverrides    map[string]string
+	SeedUsers          []SeedUser
 	Shared             bool
 	AllowSharedUpdates bool
+
+	// versionSpec is the version requested when creating the installation,
+	// such as latest or 9.11.x, before it was resolved to a tag. It is not
+	// stored.
+	versionSpec string
 }
 
 // ToPrettyJSON will return a JSON string installation with indentation and new lines
@@ -41,43 +61,133 @@ func (i *Installation) HideSensitiveFields() {
 	i.License = "hidden"
 	i.MattermostEnv = nil
 	i.PriorityEnv = nil
+	i.ConfigOverrides = maskConfigOverrides(i.ConfigOverrides)
+}
+
+func installationKey(installationID string) string {
+	return StoreInstallationKeyPrefix + installationID
+}
+
+func ownerIndexKey(ownerID string) string {
+	return StoreOwnerIndexKeyPrefix + ownerID
 }
 
+func nameIndexKey(name string) string {
+	return StoreNameIndexKeyPrefix + standardizeName(name)
+}
+
+// storeInstallation saves a new installation record and adds it to the owner
+// and name indexes.
 func (p *Plugin) storeInstallation(install *Installation) error {
+	if install == nil || install.Installation == nil || install.ID == "" {
+		return errors.New("installation must have an ID to be stored")
+	}
+
+	installJSON, err := json.Marshal(install)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal installation")
+	}
+
+	ok, appErr := p.API.KVCompareAndSet(installationKey(install.ID), nil, installJSON)
+	if appErr != nil {
+		return errors.Wrapf(appErr, "unable to store installation %s", install.ID)
+	}
+	if !ok {
+		return errors.Errorf("installation %s is already stored", install.ID)
+	}
+
+	return p.indexInstallation(install)
+}
+
+// indexInstallation adds the installation to the owner index and reserves its
+// name. Both operations are idempotent.
+func (p *Plugin) indexInstallation(install *Installation) error {
+	err := p.updateOwnerIndex(install.OwnerID, func(ids []string) ([]string, bool) {
+		if Contains(ids, install.ID) {
+			return ids, false
+		}
+		return append(ids, install.ID), true
+	})
+	if err != nil {
+		return err
+	}
+
+	if install.Name == "" {
+		return nil
+	}
+
+	key := nameIndexKey(install.Name)
+	ok, appErr := p.API.KVCompareAndSet(key, nil, []byte(install.ID))
+	if appErr != nil {
+		return errors.Wrapf(appErr, "unable to reserve installation name %s", install.Name)
+	}
+	if ok {
+		return nil
+	}
+
+	existingID, appErr := p.API.KVGet(key)
+	if appErr != nil {
+		return errors.Wrapf(appErr, "unable to get installation name %s", install.Name)
+	}
+	if string(existingID) != install.ID {
+		p.API.LogWarn(fmt.Sprintf("Installation name %s is already reserved by installation %s; not indexing installation %s", install.Name, string(existingID), install.ID))
+	}
+
+	return nil
+}
+
+// updateOwnerIndex applies mutate to the list of installation IDs belonging
+// to the owner and stores the result. mutate returns false when no change is
+// required.
+func (p *Plugin) updateOwnerIndex(ownerID string, mutate func(ids []string) ([]string, bool)) error {
+	key := ownerIndexKey(ownerID)
 	for i := 0; i < StoreInstallRetries; i++ {
 		// Use the retry count value to build an increasing backoff that has no
 		// delay on the first attempt.
 		time.Sleep(time.Duration(i) * time.Second)
 
-		installs, originalJSONInstalls, err := p.getInstallations()
-		if err != nil {
-			p.API.LogWarn(errors.Wrap(err, "unable to get installations").Error())
+		originalJSONIDs, appErr := p.API.KVGet(key)
+		if appErr != nil {
+			p.API.LogWarn(errors.Wrap(appErr, "unable to get owner installation index").Error())
 			continue
 		}
 
-		installs = append(installs, install)
+		var ids []string
+		if originalJSONIDs != nil {
+			if err := json.Unmarshal(originalJSONIDs, &ids); err != nil {
+				return errors.Wrapf(err, "unable to unmarshal installation index for owner %s", ownerID)
+			}
+		}
 
-		newJSONInstalls, err := json.Marshal(installs)
-		if err != nil {
-			p.API.LogWarn(errors.Wrap(err, "unable to marshal installations").Error())
-			continue
+		ids, changed := mutate(ids)
+		if !changed {
+			return nil
 		}
 
-		ok, appErr := p.API.KVCompareAndSet(StoreInstallsKey, originalJSONInstalls, newJSONInstalls)
+		var ok bool
+		if len(ids) == 0 {
+			ok, appErr = p.API.KVCompareAndDelete(key, originalJSONIDs)
+		} else {
+			newJSONIDs, err := json.Marshal(ids)
+			if err != nil {
+				return errors.Wrap(err, "unable to marshal owner installation index")
+			}
+			ok, appErr = p.API.KVCompareAndSet(key, originalJSONIDs, newJSONIDs)
+		}
 		if appErr != nil {
-			p.API.LogWarn(errors.Wrap(appErr, "unable to store install").Error())
+			p.API.LogWarn(errors.Wrap(appErr, "unable to store owner installation index").Error())
 			continue
 		}
 
-		// If err is nil but ok is false, then something else updated the installs between the get and set above
-		// so we need to try again, otherwise we can return
+		// If err is nil but ok is false, then something else updated the index
+		// between the get and set above so we need to try again.
 		if ok {
 			return nil
 		}
-		p.API.LogWarn("unable to store installs due to another process making an update first")
+		p.API.LogWarn("unable to store owner installation index due to another process making an update first")
 	}
 
-	return errors.Errorf("failed %d times to store installation %s", StoreInstallRetries, install.ID)
+	return errors.Errorf("failed %d times to update installation index for owner %s", StoreInstallRetries, ownerID)
 }
 
 func (p *Plugin) updateInstallation(install *Installation) error {
@@ -86,43 +196,44 @@ func (p *Plugin) updateInstallation(install *Installation) error {
 		// delay on the first attempt.
 		time.Sleep(time.Duration(i) * time.Second)
 
-		installs, originalJSONInstalls, err := p.getInstallations()
+		existing, originalJSONInstall, err := p.getInstallationRecord(install.ID)
 		if err != nil {
-			p.API.LogWarn(errors.Wrap(err, "unable to get installations").Error())
+			p.API.LogWarn(errors.Wrap(err, "unable to get installation").Error())
 			continue
 		}
-
-		found := false
-		for index, existingInstall := range installs {
-			if existingInstall.ID == install.ID {
-				found = true
-				installs[index] = install
-				break
-			}
-		}
-
-		if !found {
+		if existing == nil {
 			return errors.New("installation does not exist")
 		}
 
-		newJSONInstalls, err := json.Marshal(installs)
+		newJSONInstall, err := json.Marshal(install)
 		if err != nil {
-			p.API.LogWarn(errors.Wrap(err, "unable to marshal installations").Error())
+			p.API.LogWarn(errors.Wrap(err, "unable to marshal installation").Error())
 			continue
 		}
 
-		ok, appErr := p.API.KVCompareAndSet(StoreInstallsKey, originalJSONInstalls, newJSONInstalls)
+		ok, appErr := p.API.KVCompareAndSet(installationKey(install.ID), originalJSONInstall, newJSONInstall)
 		if appErr != nil {
 			p.API.LogWarn(errors.Wrap(appErr, "unable to store install").Error())
 			continue
 		}
 
-		// If err is nil but ok is false, then something else updated the installs between the get and set above
+		// If err is nil but ok is false, then something else updated the installation between the get and set above
 		// so we need to try again, otherwise we can return
-		if ok {
-			return nil
+		if !ok {
+			p.API.LogWarn("unable to store installation due to another process making an update first")
+			continue
+		}
+
+		if existing.OwnerID != install.OwnerID {
+			if err = p.removeFromOwnerIndex(existing.OwnerID, install.ID); err != nil {
+				return err
+			}
+			if err = p.indexInstallation(install); err != nil {
+				return err
+			}
 		}
-		p.API.LogWarn("unable to store installs due to another process making an update first")
+
+		return nil
 	}
 
 	return fmt.Errorf("failed %d times to store updated installation %s", StoreInstallRetries, install.ID)
@@ -134,104 +245,187 @@ func (p *Plugin) deleteInstallation(installationID string) error {
 		// delay on the first attempt.
 		time.Sleep(time.Duration(i) * time.Second)
 
-		installs, originalJSONInstalls, err := p.getInstallations()
+		existing, originalJSONInstall, err := p.getInstallationRecord(installationID)
 		if err != nil {
-			p.API.LogWarn(errors.Wrap(err, "unable to get installations").Error())
+			p.API.LogWarn(errors.Wrap(err, "unable to get installation").Error())
 			continue
 		}
-
-		indexToDelete := -1
-		for index, install := range installs {
-			if install.ID == installationID {
-				indexToDelete = index
-				break
-			}
-		}
-		if indexToDelete == -1 {
+		if existing == nil {
 			return errors.New("installation does not exist")
 		}
 
-		installs = append(installs[:indexToDelete], installs[indexToDelete+1:]...)
-
-		newJSONInstalls, err := json.Marshal(installs)
-		if err != nil {
-			p.API.LogWarn(errors.Wrap(err, "unable to marshal installations").Error())
+		ok, appErr := p.API.KVCompareAndDelete(installationKey(installationID), originalJSONInstall)
+		if appErr != nil {
+			p.API.LogWarn(errors.Wrap(appErr, "unable to delete install").Error())
 			continue
 		}
 
-		ok, appErr := p.API.KVCompareAndSet(StoreInstallsKey, originalJSONInstalls, newJSONInstalls)
-		if appErr != nil {
-			p.API.LogWarn(errors.Wrap(appErr, "unable to store install").Error())
+		// If err is nil but ok is false, then something else updated the installation between the get and delete above
+		// so we need to try again, otherwise we can clean up the indexes
+		if !ok {
+			p.API.LogWarn("unable to delete installation due to another process making an update first")
 			continue
 		}
 
-		// If err is nil but ok is false, then something else updated the installs between the get and set above
-		// so we need to try again, otherwise we can break
-		if ok {
-			return nil
+		if err = p.removeFromOwnerIndex(existing.OwnerID, installationID); err != nil {
+			return err
 		}
-		p.API.LogWarn("unable to store installs due to another process making an update first")
+
+		return p.releaseInstallationName(existing.Name, installationID)
 	}
 
 	return fmt.Errorf("failed %d times to delete installation %s", StoreInstallRetries, installationID)
 }
 
-// getInstallations fetches existing installs from the KV store and returns a slice of pointers to the Installations (unmarshalled from JSON), the original JSON as a byte slice, and any errors
-func (p *Plugin) getInstallations() ([]*Installation, []byte, error) {
-	originalJSONInstalls, err := p.API.KVGet(StoreInstallsKey)
-	if err != nil {
-		return nil, nil, err
+// deleteInstallationRecords removes the records kept alongside an
+// installation once the provisioner has deleted it. They are kept when the
+// installation is only removed from the plugin, so that it can be restored.
+func (p *Plugin) deleteInstallationRecords(installationID string) {
+	for _, key := range []string{
+		setupStateKey(installationID),
+		credentialsKey(installationID),
+		creationProgressKey(installationID),
+		testDataProgressKey(installationID),
+	} {
+		if appErr := p.API.KVDelete(key); appErr != nil {
+			p.API.LogWarn("Failed to remove installation record", "installation", installationID, "key", key, "error", appErr.Error())
+		}
+	}
+}
+
+func (p *Plugin) removeFromOwnerIndex(ownerID, installationID string) error {
+	return p.updateOwnerIndex(ownerID, func(ids []string) ([]string, bool) {
+		for index, id := range ids {
+			if id == installationID {
+				return append(ids[:index], ids[index+1:]...), true
+			}
+		}
+		return ids, false
+	})
+}
+
+// releaseInstallationName removes the name reservation if it still belongs to
+// the given installation.
+func (p *Plugin) releaseInstallationName(name, installationID string) error {
+	if name == "" {
+		return nil
 	}
 
-	if originalJSONInstalls == nil {
-		return []*Installation{}, originalJSONInstalls, nil
+	_, appErr := p.API.KVCompareAndDelete(nameIndexKey(name), []byte(installationID))
+	if appErr != nil {
+		return errors.Wrapf(appErr, "unable to release installation name %s", name)
 	}
 
-	var installs []*Installation
-	jsonErr := json.Unmarshal(originalJSONInstalls, &installs)
-	if jsonErr != nil {
-		return nil, nil, jsonErr
+	return nil
+}
+
+// getInstallationRecord fetches a single installation from the KV store and
+// returns it along with the original JSON. A nil installation is returned when
+// no record exists.
+func (p *Plugin) getInstallationRecord(installationID string) (*Installation, []byte, error) {
+	originalJSONInstall, appErr := p.API.KVGet(installationKey(installationID))
+	if appErr != nil {
+		return nil, nil, appErr
+	}
+	if originalJSONInstall == nil {
+		return nil, nil, nil
+	}
+
+	var install *Installation
+	if err := json.Unmarshal(originalJSONInstall, &install); err != nil {
+		return nil, nil, errors.Wrapf(err, "unable to unmarshal installation %s", installationID)
+	}
+
+	return install, originalJSONInstall, nil
+}
+
+// getInstallations fetches every installation record from the KV store,
+// ordered by creation time.
+func (p *Plugin) getInstallations() ([]*Installation, error) {
+	installs := []*Installation{}
+	for page := 0; ; page++ {
+		keys, appErr := p.API.KVList(page, listInstallationsPerPage)
+		if appErr != nil {
+			return nil, appErr
+		}
+
+		for _, key := range keys {
+			if !strings.HasPrefix(key, StoreInstallationKeyPrefix) {
+				continue
+			}
+
+			install, _, err := p.getInstallationRecord(strings.TrimPrefix(key, StoreInstallationKeyPrefix))
+			if err != nil {
+				return nil, err
+			}
+			if install != nil {
+				installs = append(installs, install)
+			}
+		}
+
+		if len(keys) < listInstallationsPerPage {
+			break
+		}
 	}
 
-	return installs, originalJSONInstalls, nil
+	sort.SliceStable(installs, func(i, j int) bool {
+		if installs[i].CreateAt != installs[j].CreateAt {
+			return installs[i].CreateAt < installs[j].CreateAt
+		}
+		return installs[i].ID < installs[j].ID
+	})
+
+	return installs, nil
 }
 
 func (p *Plugin) getInstallation(installationID string) (*Installation, error) {
-	installs, _, err := p.getInstallations()
+	install, _, err := p.getInstallationRecord(installationID)
 	if err != nil {
 		return nil, err
 	}
+	if install == nil {
+		return nil, nil
+	}
 
-	for _, install := range installs {
-		if install.ID == installationID {
-			// Retrieve the information we need from the installation directly from the provisioner
-			if len(install.DNSRecords) == 0 {
-				cloudInstall, err := p.cloudClient.GetInstallation(install.ID, &cloud.GetInstallationRequest{})
-				if err != nil {
-					return nil, err
-				}
-
-				install.DNSRecords = cloudInstall.DNSRecords
-			}
-
-			return install, nil
+	// Retrieve the information we need from the installation directly from the provisioner
+	if len(install.DNSRecords) == 0 {
+		cloudInstall, err := p.cloudClient.GetInstallation(install.ID, &cloud.GetInstallationRequest{})
+		if err != nil {
+			return nil, err
 		}
+
+		install.DNSRecords = cloudInstall.DNSRecords
 	}
 
-	return nil, nil
+	return install, nil
 }
 
 func (p *Plugin) getInstallationsForUser(userID string) ([]*Installation, error) {
-	installs, _, err := p.getInstallations()
-	if err != nil {
-		return nil, err
+	jsonIDs, appErr := p.API.KVGet(ownerIndexKey(userID))
+	if appErr != nil {
+		return nil, appErr
 	}
 
 	installsForUser := []*Installation{}
-	for _, install := range installs {
-		if install.OwnerID == userID {
-			installsForUser = append(installsForUser, install)
+	if jsonIDs == nil {
+		return installsForUser, nil
+	}
+
+	var ids []string
+	if err := json.Unmarshal(jsonIDs, &ids); err != nil {
+		return nil, errors.Wrapf(err, "unable to unmarshal installation index for owner %s", userID)
+	}
+
+	for _, id := range ids {
+		install, _, err := p.getInstallationRecord(id)
+		if err != nil {
+			return nil, err
 		}
+		// The index may briefly reference a record that is being deleted.
+		if install == nil || install.OwnerID != userID {
+			continue
+		}
+		installsForUser = append(installsForUser, install)
 	}
 
 	return installsForUser, nil
@@ -265,7 +459,7 @@ func (p *Plugin) getUpdatedSharedInstallations(hideSensitive bool) ([]*Installat
 }
 
 func (p *Plugin) getSharedInstallations() ([]*Installation, error) {
-	installs, _, err := p.getInstallations()
+	installs, err := p.getInstallations()
 	if err != nil {
 		return nil, err
 	}
@@ -279,3 +473,57 @@ func (p *Plugin) getSharedInstallations() ([]*Installation, error) {
 
 	return sharedInstalls, nil
 }
+
+// migrateLegacyInstallations copies installations from the legacy single blob
+// into per-installation records and indexes, then removes the blob. It is
+// safe to run more than once.
+func (p *Plugin) migrateLegacyInstallations() error {
+	legacyJSONInstalls, appErr := p.API.KVGet(StoreInstallsKey)
+	if appErr != nil {
+		return errors.Wrap(appErr, "unable to get legacy installations")
+	}
+	if legacyJSONInstalls == nil {
+		return nil
+	}
+
+	var installs []*Installation
+	if err := json.Unmarshal(legacyJSONInstalls, &installs); err != nil {
+		return errors.Wrap(err, "unable to unmarshal legacy installations")
+	}
+
+	migrated := 0
+	for _, install := range installs {
+		if install == nil || install.Installation == nil || install.ID == "" {
+			p.API.LogWarn("Skipping legacy installation without an ID")
+			continue
+		}
+
+		existing, _, err := p.getInstallationRecord(install.ID)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			installJSON, err := json.Marshal(install)
+			if err != nil {
+				return errors.Wrap(err, "unable to marshal installation")
+			}
+			if _, appErr = p.API.KVCompareAndSet(installationKey(install.ID), nil, installJSON); appErr != nil {
+				return errors.Wrapf(appErr, "unable to store installation %s", install.ID)
+			}
+			migrated++
+		}
+
+		if err = p.indexInstallation(install); err != nil {
+			return err
+		}
+	}
+
+	// Only remove the legacy blob if nothing changed it while migrating.
+	if _, appErr = p.API.KVCompareAndDelete(StoreInstallsKey, legacyJSONInstalls); appErr != nil {
+		return errors.Wrap(appErr, "unable to delete legacy installations")
+	}
+
+	p.API.LogInfo("Migrated legacy installations to per-installation records", "migrated", migrated, "total", len(installs))
+
+	return nil
+}
@@ -39,8 +39,21 @@ type CreateInstallationInput struct {
 	Database  string
 	Filestore string
 	Image     string
-	TestData  bool
-	Env       map[string]string
+	// TestData is nil when test data was not explicitly requested or
+	// declined, so that a preset can request it.
+	TestData *bool
+	// TestDataProfile and TestDataCounts select the amount of test data
+	// and imply TestData.
+	TestDataProfile string
+	TestDataCounts  map[string]int
+	Plugins         []string
+	// Users are the specs of the seed users to create in addition to the
+	// default users, in form username:role[:team1+team2].
+	Users  []string
+	Config map[string]string
+	Env    map[string]string
+	Preset string
+	TTL    string
 }
 
 type UpdateInstallationInput struct {
@@ -53,26 +66,32 @@ type UpdateInstallationInput struct {
 }
 
 type InstallationSummary struct {
-	ID                  string `json:"id"`
-	Name                string `json:"name"`
-	DNS                 string `json:"dns,omitempty"`
-	State               string `json:"state"`
-	OwnerID             string `json:"owner_id"`
-	Version             string `json:"version"`
-	VersionTag          string `json:"version_tag,omitempty"`
-	Image               string `json:"image,omitempty"`
-	Size                string `json:"size,omitempty"`
-	Database            string `json:"database,omitempty"`
-	Filestore           string `json:"filestore,omitempty"`
-	Affinity            string `json:"affinity,omitempty"`
-	TestData            bool   `json:"test_data"`
-	Shared              bool   `json:"shared"`
-	AllowSharedUpdates  bool   `json:"allow_shared_updates"`
-	DeletionLocked      bool   `json:"deletion_locked"`
-	CreateAt            int64  `json:"create_at,omitempty"`
-	ServiceEnvironment  string `json:"service_environment,omitempty"`
-	InstallationLogsURL string `json:"installation_logs_url,omitempty"`
-	ProvisionerLogsURL  string `json:"provisioner_logs_url,omitempty"`
+	ID                    string   `json:"id"`
+	Name                  string   `json:"name"`
+	DNS                   string   `json:"dns,omitempty"`
+	State                 string   `json:"state"`
+	OwnerID               string   `json:"owner_id"`
+	Version               string   `json:"version"`
+	VersionTag            string   `json:"version_tag,omitempty"`
+	Image                 string   `json:"image,omitempty"`
+	Size                  string   `json:"size,omitempty"`
+	Database              string   `json:"database,omitempty"`
+	Filestore             string   `json:"filestore,omitempty"`
+	Affinity              string   `json:"affinity,omitempty"`
+	TestData              bool     `json:"test_data"`
+	TestDataProfile       string   `json:"test_data_profile,omitempty"`
+	Plugins               []string `json:"plugins,omitempty"`
+	Users                 []string `json:"users,omitempty"`
+	ConfigKeys            []string `json:"config_keys,omitempty"`
+	Shared                bool     `json:"shared"`
+	AllowSharedUpdates    bool     `json:"allow_shared_updates"`
+	DeletionLocked        bool     `json:"deletion_locked"`
+	CreateAt              int64    `json:"create_at,omitempty"`
+	ScheduledDeletionTime int64    `json:"scheduled_deletion_time,omitempty"`
+	TimeRemaining         string   `json:"time_remaining,omitempty"`
+	ServiceEnvironment    string   `json:"service_environment,omitempty"`
+	InstallationLogsURL   string   `json:"installation_logs_url,omitempty"`
+	ProvisionerLogsURL    string   `json:"provisioner_logs_url,omitempty"`
 }
 
 type InstallationActionResult struct {
@@ -82,6 +101,7 @@ type InstallationActionResult struct {
 	ChangedEnvKeys []string            `json:"changed_env_keys,omitempty"`
 	ClearedEnvKeys []string            `json:"cleared_env_keys,omitempty"`
 	Message        string              `json:"message,omitempty"`
+	DryRunRequest  any                 `json:"dry_run_request,omitempty"`
 }
 
 // sanitizeInstallationCopy returns a copy of install with sensitive fields
@@ -120,6 +140,10 @@ func installationSummary(install *Installation, includeLogURLs bool) (Installati
 	summary := InstallationSummary{
 		Name:               install.Name,
 		TestData:           install.TestData,
+		Plugins:            install.Plugins,
+		TestDataProfile:    testDataProfileName(install.TestDataProfile),
+		Users:              seedUserSpecs(install.SeedUsers),
+		ConfigKeys:         sortedStringMapKeys(install.ConfigOverrides),
 		Shared:             install.Shared,
 		AllowSharedUpdates: install.AllowSharedUpdates,
 		ServiceEnvironment: getInstallationServiceEnvironment(install),
@@ -138,6 +162,8 @@ func installationSummary(install *Installation, includeLogURLs bool) (Installati
 		summary.Affinity = install.Affinity
 		summary.DeletionLocked = install.DeletionLocked
 		summary.CreateAt = install.CreateAt
+		summary.ScheduledDeletionTime = install.ScheduledDeletionTime
+		summary.TimeRemaining = installationTimeRemaining(install.ScheduledDeletionTime, time.Now())
 	}
 
 	if len(install.DNSRecords) > 0 && install.DNSRecords[0] != nil {
@@ -169,7 +195,7 @@ func (p *Plugin) findInstallationForUser(userID string, ref InstallationRef, sco
 		return nil, err
 	}
 
-	installs, _, err := p.getInstallations()
+	installs, err := p.getInstallations()
 	if err != nil {
 		return nil, err
 	}
@@ -177,6 +203,21 @@ func (p *Plugin) findInstallationForUser(userID string, ref InstallationRef, sco
 	return findInstallationInSlice(userID, ref, defaultInstallationScope(scope), installs)
 }
 
+// findVisibleInstallationForUser returns an installation the user owns or,
+// failing that, one that is shared with every user.
+func (p *Plugin) findVisibleInstallationForUser(userID string, ref InstallationRef) (*Installation, error) {
+	install, err := p.findInstallationForUser(userID, ref, InstallationScopeMine)
+	if err != nil {
+		var sharedErr error
+		install, sharedErr = p.findInstallationForUser(userID, ref, InstallationScopeShared)
+		if sharedErr != nil {
+			return nil, err
+		}
+	}
+
+	return install, nil
+}
+
 func (p *Plugin) listInstallationsForUser(userID string, input ListInstallationsInput) ([]*Installation, error) {
 	scope := defaultInstallationScope(input.Scope)
 	if err := validateInstallationScope(scope); err != nil {
@@ -184,7 +225,7 @@ func (p *Plugin) listInstallationsForUser(userID string, input ListInstallations
 	}
 
 	if !input.Refresh {
-		installs, _, err := p.getInstallations()
+		installs, err := p.getInstallations()
 		if err != nil {
 			return nil, err
 		}
@@ -212,22 +253,47 @@ func (p *Plugin) listInstallationsForUser(userID string, input ListInstallations
 }
 
 func (p *Plugin) createInstallationForUser(userID string, input CreateInstallationInput) (*Installation, error) {
-	install, err := p.buildCreateInstallation(userID, input)
+	install, req, err := p.buildCreateInstallationRequest(userID, input)
+	if err != nil {
+		return nil, err
+	}
+
+	cloudInstallation, err := p.cloudClient.CreateInstallation(req)
 	if err != nil {
+		if strings.Contains(err.Error(), "409") {
+			return nil, errors.Errorf("Installation name %s already exists. **NOTE**: installation names are reserved for 24 hours after deletion in order to support restoration. Please try a new name, wait 24 hours, or contact the Cloud Platform team for support.", install.Name)
+		}
+		return nil, errors.Wrap(err, "failed to create installation")
+	}
+
+	install.Installation = cloudInstallation.Installation
+	if err = p.storeInstallation(install); err != nil {
 		return nil, err
 	}
+	p.recordInstallationAction(install.ID, userID, historyActionCreate, "version "+install.Tag)
+
+	return install, nil
+}
+
+// buildCreateInstallationRequest builds the installation and resolves its
+// docker digest, returning the request to send to the provisioner.
+func (p *Plugin) buildCreateInstallationRequest(userID string, input CreateInstallationInput) (*Installation, *cloud.CreateInstallationRequest, error) {
+	install, err := p.buildCreateInstallation(userID, input)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	validTag, err := p.dockerClient.ValidTag(install.Version, install.Image)
 	if err != nil {
-		p.API.LogError(errors.Wrapf(err, "unable to check if %s:%s exists", install.Image, install.Version).Error())
+		return nil, nil, registryUnavailableError(err, install.Image, install.Version)
 	}
 	if !validTag {
-		return nil, errors.Errorf("%s is not a valid docker tag for repository %s", install.Version, install.Image)
+		return nil, nil, errors.Errorf("%s is not a valid docker tag for repository %s", install.Version, install.Image)
 	}
 
 	digest, err := p.dockerClient.GetDigestForTag(install.Version, install.Image)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to find a manifest digest for version %s", install.Version)
+		return nil, nil, errors.Wrapf(err, "failed to find a manifest digest for version %s", install.Version)
 	}
 
 	install.Version = digest
@@ -248,36 +314,20 @@ func (p *Plugin) createInstallationForUser(userID string, input CreateInstallati
 		Annotations: []string{defaultMultiTenantAnnotation},
 	}
 
-	if config.ScheduledDeletionHours != "" && config.ScheduledDeletionHours != "0" {
+	if install.ScheduledDeletionTime != 0 {
+		req.ScheduledDeletionTime = install.ScheduledDeletionTime
+	} else if config.ScheduledDeletionHours != "" && config.ScheduledDeletionHours != "0" {
 		hours, hoursErr := strconv.Atoi(config.ScheduledDeletionHours)
 		if hoursErr == nil && hours > 0 {
 			req.ScheduledDeletionTime = time.Now().Add(time.Duration(hours) * time.Hour).UnixMilli()
 		}
 	}
 
-	cloudInstallation, err := p.cloudClient.CreateInstallation(req)
-	if err != nil {
-		if strings.Contains(err.Error(), "409") {
-			return nil, errors.Errorf("Installation name %s already exists. **NOTE**: installation names are reserved for 24 hours after deletion in order to support restoration. Please try a new name, wait 24 hours, or contact the Cloud Platform team for support.", install.Name)
-		}
-		return nil, errors.Wrap(err, "failed to create installation")
-	}
-
-	install.Installation = cloudInstallation.Installation
-	if err = p.storeInstallation(install); err != nil {
-		return nil, err
-	}
-
-	return install, nil
+	return install, req, nil
 }
 
 func (p *Plugin) updateInstallationForUser(userID string, ref InstallationRef, input UpdateInstallationInput, scope InstallationScope) (InstallationActionResult, error) {
-	scope = defaultInstallationScope(scope)
-	if scope == InstallationScopeShared {
-		return InstallationActionResult{}, errors.New("shared scope is read-only for updates")
-	}
-
-	installToUpdate, err := p.findInstallationForUser(userID, ref, scope)
+	installToUpdate, err := p.findInstallationToUpdate(userID, ref, scope)
 	if err != nil {
 		return InstallationActionResult{}, err
 	}
@@ -294,8 +344,8 @@ func (p *Plugin) updateInstallationForUser(userID string, ref InstallationRef, i
 	if requestedTag != "" {
 		installToUpdate.Tag = requestedTag
 	}
-	if input.Image != "" {
-		installToUpdate.Image = input.Image
+	if request.Image != nil {
+		installToUpdate.Image = *request.Image
 	}
 	if input.Size != "" {
 		installToUpdate.Size = input.Size
@@ -304,19 +354,34 @@ func (p *Plugin) updateInstallationForUser(userID string, ref InstallationRef, i
 	if err = p.updateInstallation(installToUpdate); err != nil {
 		return InstallationActionResult{}, errors.Wrap(err, "failed to store updated installation metadata")
 	}
+	p.recordInstallationAction(installToUpdate.ID, userID, historyActionUpdate, changedFields...)
 
 	summary, err := installationSummary(installToUpdate, false)
 	if err != nil {
 		return InstallationActionResult{}, err
 	}
 
-	return InstallationActionResult{
+	result := InstallationActionResult{
 		Installation:   summary,
 		Status:         "update_requested",
 		ChangedFields:  changedFields,
 		ChangedEnvKeys: setEnvKeys,
 		ClearedEnvKeys: clearEnvKeys,
-	}, nil
+	}
+	if requestedTag != "" {
+		result.Message = describeVersionResolution(input.Version, requestedTag, *request.Version)
+	}
+
+	return result, nil
+}
+
+func (p *Plugin) findInstallationToUpdate(userID string, ref InstallationRef, scope InstallationScope) (*Installation, error) {
+	scope = defaultInstallationScope(scope)
+	if scope == InstallationScopeShared {
+		return nil, errors.New("shared scope is read-only for updates")
+	}
+
+	return p.findInstallationForUser(userID, ref, scope)
 }
 
 func (p *Plugin) restartInstallationForUser(userID string, ref InstallationRef, scope InstallationScope) (InstallationActionResult, error) {
@@ -336,6 +401,7 @@ func (p *Plugin) restartInstallationForUser(userID string, ref InstallationRef,
 	if _, err = p.cloudClient.UpdateInstallation(installToRestart.ID, patch); err != nil {
 		return InstallationActionResult{}, err
 	}
+	p.recordInstallationAction(installToRestart.ID, userID, historyActionRestart)
 
 	summary, err := installationSummary(installToRestart, false)
 	if err != nil {
@@ -360,6 +426,7 @@ func (p *Plugin) hibernateInstallationForUser(userID string, ref InstallationRef
 	if _, err = p.cloudClient.HibernateInstallation(installToHibernate.ID); err != nil {
 		return InstallationActionResult{}, err
 	}
+	p.recordInstallationAction(installToHibernate.ID, userID, historyActionHibernate)
 
 	summary, err := installationSummary(installToHibernate, false)
 	if err != nil {
@@ -380,6 +447,7 @@ func (p *Plugin) wakeInstallationForUser(userID string, ref InstallationRef) (In
 	if _, err = p.cloudClient.WakeupInstallation(installToWake.ID, &cloud.PatchInstallationRequest{}); err != nil {
 		return InstallationActionResult{}, err
 	}
+	p.recordInstallationAction(installToWake.ID, userID, historyActionWake)
 
 	summary, err := installationSummary(installToWake, false)
 	if err != nil {
@@ -472,6 +540,11 @@ func (p *Plugin) setDeletionLockForUser(userID string, ref InstallationRef, lock
 	if err = p.updateInstallation(target); err != nil {
 		return InstallationActionResult{}, errors.Wrap(err, "failed to persist deletion lock state")
 	}
+	if locked {
+		p.recordInstallationAction(target.ID, userID, historyActionLock)
+	} else {
+		p.recordInstallationAction(target.ID, userID, historyActionUnlock)
+	}
 
 	summary, err := installationSummary(target, false)
 	if err != nil {
@@ -502,6 +575,10 @@ func (p *Plugin) deleteInstallationForUser(userID string, ref InstallationRef, c
 	if err = p.cloudClient.DeleteInstallation(installToDelete.ID); err != nil {
 		return InstallationActionResult{}, err
 	}
+	p.recordInstallationAction(installToDelete.ID, userID, historyActionDelete)
+	if err = p.storeDeletedInstallation(installToDelete); err != nil {
+		p.API.LogWarn("Failed to keep deleted installation for restoration", "installation", installToDelete.ID, "error", err.Error())
+	}
 	if err = p.deleteInstallation(installToDelete.ID); err != nil {
 		return InstallationActionResult{}, err
 	}
@@ -511,6 +588,11 @@ func (p *Plugin) deleteInstallationForUser(userID string, ref InstallationRef, c
 
 func (p *Plugin) buildCreateInstallation(userID string, input CreateInstallationInput) (*Installation, error) {
 	config := p.getConfiguration()
+	input, err := p.applyInstallationPreset(userID, input)
+	if err != nil {
+		return nil, err
+	}
+
 	install := &Installation{
 		Name: standardizeName(input.Name),
 		InstallationDTO: cloud.InstallationDTO{
@@ -533,20 +615,20 @@ func (p *Plugin) buildCreateInstallation(userID string, input CreateInstallation
 		return nil, errors.Errorf("Installation name %s already exists. **NOTE**: installation names are reserved for 24 hours after deletion in order to support restoration. Please try a new name, wait 24 hours, or contact the Cloud Platform team for support.", install.Name)
 	}
 
-	install.Size = defaultString(input.Size, "miniSingleton")
-	if install.Size != "" && !Contains(validInstallationSizes, install.Size) {
+	install.Size = defaultString(input.Size, p.getConfiguration().installationSizes()[0])
+	if install.Size != "" && !p.validInstallationSize(install.Size) {
 		return nil, fmt.Errorf("Invalid size: %s", install.Size)
 	}
 
-	install.Version = defaultString(input.Version, "latest")
-	if install.Version == "latest" {
-		install.Version, err = p.githubLatestVersion()
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to determine latest tag for requested version 'latest'")
-		}
-		if install.Version == "" {
-			return nil, errors.New("failed to determine latest tag for requested version 'latest': got empty version")
-		}
+	install.versionSpec = defaultString(input.Version, versionSpecLatest)
+	install.Image = createImageForVersion(input.Image, install.versionSpec)
+	if !p.validImageName(install.Image) {
+		return nil, p.invalidImageNameError(install.Image)
+	}
+
+	install.Version, err = p.resolveVersionSpec(install.versionSpec, install.Image)
+	if err != nil {
+		return nil, err
 	}
 	install.Tag = install.Version
 	if err = validVersionOption(install.Version); err != nil {
@@ -563,11 +645,6 @@ func (p *Plugin) buildCreateInstallation(userID string, input CreateInstallation
 		return nil, errors.Errorf("invalid license option %s, valid options are %s", install.License, strings.Join(validLicenseOptions, ", "))
 	}
 
-	install.Image = defaultString(input.Image, defaultImage)
-	if !validImageName(install.Image) {
-		return nil, errors.Errorf("invalid image name %s, valid options are %s", install.Image, strings.Join(dockerRepoWhitelist, ", "))
-	}
-
 	install.Database = input.Database
 	if install.Database == "" {
 		install.Database = config.DefaultDatabase
@@ -604,7 +681,38 @@ func (p *Plugin) buildCreateInstallation(userID string, input CreateInstallation
 		return nil, errors.Errorf("filestore option %s requires license option %s or %s or %s", cloud.InstallationFilestoreMultiTenantAwsS3, licenseOptionEnterprise, licenseOptionE20, licenseOptionEnterpriseAdvanced)
 	}
 
-	install.TestData = input.TestData
+	if input.TTL != "" {
+		ttl, ttlErr := p.validateInstallationTTL(input.TTL)
+		if ttlErr != nil {
+			return nil, ttlErr
+		}
+		install.ScheduledDeletionTime = time.Now().Add(ttl).UnixMilli()
+	}
+
+	install.TestData = (input.TestData != nil && *input.TestData) || input.TestDataProfile != "" || len(input.TestDataCounts) > 0
+	if install.TestData {
+		install.TestDataProfile, err = p.resolveTestDataProfile(input.TestDataProfile, input.TestDataCounts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	install.Plugins, err = parseMarketplacePlugins(input.Plugins)
+	if err != nil {
+		return nil, err
+	}
+	install.SeedUsers, err = parseSeedUsers(input.Users)
+	if err != nil {
+		return nil, err
+	}
+	if err = validateSeedUsersLicense(install.SeedUsers, install.License); err != nil {
+		return nil, err
+	}
+	if err = validateConfigOverrides(input.Config); err != nil {
+		return nil, err
+	}
+	if len(input.Config) > 0 {
+		install.ConfigOverrides = input.Config
+	}
 	install.PriorityEnv = envMapFromInput(input.Env)
 	install.OwnerID = userID
 
@@ -616,14 +724,14 @@ func (p *Plugin) buildUpdateInstallationRequest(install *Installation, input Upd
 		return nil, nil, nil, nil, "", errors.New("must specify at least one option: version, license, image, size, env, clear-env")
 	}
 
-	if input.Size != "" && !Contains(validInstallationSizes, input.Size) {
+	if input.Size != "" && !p.validInstallationSize(input.Size) {
 		return nil, nil, nil, nil, "", fmt.Errorf("Invalid size: %s", input.Size)
 	}
 	if input.License != "" && !validLicenseOption(input.License) {
 		return nil, nil, nil, nil, "", errors.Errorf("invalid license option %s, valid options are %s", input.License, strings.Join(validLicenseOptions, ", "))
 	}
-	if input.Image != "" && !validImageName(input.Image) {
-		return nil, nil, nil, nil, "", errors.Errorf("invalid image name %s, valid options are %s", input.Image, strings.Join(dockerRepoWhitelist, ", "))
+	if input.Image != "" && !p.validImageName(input.Image) {
+		return nil, nil, nil, nil, "", p.invalidImageNameError(input.Image)
 	}
 
 	request := &cloud.PatchInstallationRequest{}
@@ -638,6 +746,10 @@ func (p *Plugin) buildUpdateInstallationRequest(install *Installation, input Upd
 		request.License = &licenseValue
 		changedFields = append(changedFields, "license")
 	}
+	if input.Image == "" && isDevBuildVersionSpec(input.Version) && !isDevImage(install.Image) {
+		// Development builds are only published to the development images.
+		input.Image = devImageFor(install.Image)
+	}
 	if input.Image != "" {
 		request.Image = &input.Image
 		changedFields = append(changedFields, "image")
@@ -647,16 +759,20 @@ func (p *Plugin) buildUpdateInstallationRequest(install *Installation, input Upd
 	if input.Version != "" || input.Image != "" {
 		dockerTag := defaultString(install.Tag, install.Version)
 		dockerRepository := install.Image
-		if input.Version != "" {
-			dockerTag = input.Version
-			changedFields = append(changedFields, "version")
-		}
 		if input.Image != "" {
 			dockerRepository = input.Image
 		}
+		if input.Version != "" {
+			var err error
+			dockerTag, err = p.resolveVersionSpec(input.Version, dockerRepository)
+			if err != nil {
+				return nil, nil, nil, nil, "", err
+			}
+			changedFields = append(changedFields, "version")
+		}
 		exists, err := p.dockerClient.ValidTag(dockerTag, dockerRepository)
 		if err != nil {
-			p.API.LogError(errors.Wrapf(err, "unable to check if %s:%s exists", dockerRepository, dockerTag).Error())
+			return nil, nil, nil, nil, "", registryUnavailableError(err, dockerRepository, dockerTag)
 		}
 		if !exists {
 			return nil, nil, nil, nil, "", errors.Errorf("%s is not a valid docker tag for repository %s", dockerTag, dockerRepository)
@@ -812,7 +928,7 @@ func envMapFromInput(input map[string]string) cloud.EnvVarMap {
 	return env
 }
 
-func sortedStringMapKeys(input map[string]string) []string {
+func sortedStringMapKeys[V any](input map[string]V) []string {
 	keys := make([]string, 0, len(input))
 	for key := range input {
 		keys = append(keys, key)
@@ -7,6 +7,7 @@ import (
 
 	cloud "github.com/mattermost/mattermost-cloud/model"
 	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -24,12 +25,18 @@ func TestInstallationServiceSanitizeAndSummary(t *testing.T) {
 		"SAFE":                      cloud.EnvVar{Value: "safe-value"},
 	}
 	install.DNSRecords = []*cloud.InstallationDNS{{DomainName: "first.example.com"}, {DomainName: "second.example.com"}}
+	install.ConfigOverrides = map[string]string{
+		"ServiceSettings.EnableGifPicker": "false",
+		"SqlSettings.DataSource":          "postgres://secret-dsn",
+	}
 
 	sanitized := sanitizeInstallationCopy(install)
 	require.NotNil(t, sanitized)
 	assert.Equal(t, "hidden", sanitized.License)
 	assert.Nil(t, sanitized.MattermostEnv)
 	assert.Nil(t, sanitized.PriorityEnv)
+	assert.Equal(t, map[string]string{"ServiceSettings.EnableGifPicker": "false", "SqlSettings.DataSource": "hidden"}, sanitized.ConfigOverrides)
+	assert.Equal(t, "postgres://secret-dsn", install.ConfigOverrides["SqlSettings.DataSource"])
 	assert.Equal(t, "super-secret-license", install.License)
 	assert.Equal(t, "secret-value", install.MattermostEnv["SECRET"].Value)
 	assert.Equal(t, "safe-value", install.PriorityEnv["SAFE"].Value)
@@ -140,6 +147,7 @@ func TestInstallationServiceRefreshWithoutCleanup(t *testing.T) {
 	assert.Equal(t, cloud.InstallationStateDeleted, installs[0].State)
 	assert.Contains(t, installs[0].Name, "DELETED")
 	api.AssertNotCalled(t, "KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything)
+	api.AssertNotCalled(t, "KVCompareAndDelete", mock.AnythingOfType("string"), mock.Anything)
 }
 
 func TestInstallationServiceCreate(t *testing.T) {
@@ -189,6 +197,96 @@ func TestInstallationServiceCreate(t *testing.T) {
 		assert.Equal(t, "9.5.0", install.Tag)
 		assert.Equal(t, cloud.EnvVarMap{"ENV1": cloud.EnvVar{Value: "value1"}}, cloudClient.creationRequest.PriorityEnv)
 	})
+
+	t.Run("reports an unavailable registry", func(t *testing.T) {
+		plugin, cloudClient, _ := newServiceTestPlugin(t, nil)
+		plugin.dockerClient = &MockedDockerClient{validTagErr: errors.New("rate limited by https://registry.hub.docker.com, retry after 1h0m0s")}
+
+		_, err := plugin.createInstallationForUser("owner", CreateInstallationInput{Name: "new", Version: "9.5.0"})
+		require.EqualError(t, err, "registry unavailable, unable to check if mattermost/mattermost-enterprise-edition:9.5.0 exists: rate limited by https://registry.hub.docker.com, retry after 1h0m0s")
+		assert.True(t, isCreateUserError(err))
+		assert.Nil(t, cloudClient.creationRequest)
+	})
+
+	t.Run("refuses tags without an image for the cluster platform", func(t *testing.T) {
+		plugin, cloudClient, _ := newServiceTestPlugin(t, nil)
+		plugin.dockerClient = &MockedDockerClient{validTagErr: &platformMismatchError{repository: imageEE, tag: "9.5.0", platforms: []string{"linux/arm64"}}}
+
+		_, err := plugin.createInstallationForUser("owner", CreateInstallationInput{Name: "new", Version: "9.5.0"})
+		require.EqualError(t, err, "mattermost/mattermost-enterprise-edition:9.5.0 has no image for platform linux/amd64, only for linux/arm64")
+		assert.True(t, isCreateUserError(err))
+		assert.Nil(t, cloudClient.creationRequest)
+	})
+
+	t.Run("stores the plugins to install", func(t *testing.T) {
+		plugin, _, _, kv := newServiceTestPluginWithKV(t, nil)
+
+		install, err := plugin.createInstallationForUser("owner", CreateInstallationInput{Name: "new", Plugins: []string{" com.mattermost.plugin-jira@4.1.0", "com.mattermost.calls", ""}})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"com.mattermost.plugin-jira@4.1.0", "com.mattermost.calls"}, kv.getInstallation(t, install.ID).Plugins)
+
+		_, err = plugin.createInstallationForUser("owner", CreateInstallationInput{Name: "other", Plugins: []string{"com.mattermost.calls@latest"}})
+		require.EqualError(t, err, "invalid plugin com.mattermost.calls@latest: latest is not a valid version")
+		assert.True(t, isCreateUserError(err))
+	})
+
+	t.Run("stores the config overrides", func(t *testing.T) {
+		plugin, _, _, kv := newServiceTestPluginWithKV(t, nil)
+
+		install, err := plugin.createInstallationForUser("owner", CreateInstallationInput{Name: "new", Config: map[string]string{"ServiceSettings.EnableGifPicker": "false"}})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"ServiceSettings.EnableGifPicker": "false"}, kv.getInstallation(t, install.ID).ConfigOverrides)
+
+		_, err = plugin.createInstallationForUser("owner", CreateInstallationInput{Name: "other", Config: map[string]string{"ServiceSettings.EnableGifPicker": "nope"}})
+		require.EqualError(t, err, "invalid config override ServiceSettings.EnableGifPicker=nope: ServiceSettings.EnableGifPicker must be true or false")
+		assert.True(t, isCreateUserError(err))
+	})
+
+	t.Run("stores the test data profile", func(t *testing.T) {
+		plugin, _, _, kv := newServiceTestPluginWithKV(t, nil)
+
+		install, err := plugin.createInstallationForUser("owner", CreateInstallationInput{Name: "new", TestDataProfile: "medium", TestDataCounts: map[string]int{"threads": 5}})
+		require.NoError(t, err)
+		stored := kv.getInstallation(t, install.ID)
+		assert.True(t, stored.TestData)
+		require.NotNil(t, stored.TestDataProfile)
+		assert.Equal(t, "medium", stored.TestDataProfile.Name)
+		assert.Equal(t, 5, stored.TestDataProfile.Threads)
+
+		_, err = plugin.createInstallationForUser("owner", CreateInstallationInput{Name: "other", TestDataProfile: "huge"})
+		require.EqualError(t, err, "invalid test data profile huge, valid profiles are small, medium, large")
+		assert.True(t, isCreateUserError(err))
+	})
+
+	t.Run("stores the seed users", func(t *testing.T) {
+		plugin, _, _, kv := newServiceTestPluginWithKV(t, nil)
+
+		install, err := plugin.createInstallationForUser("owner", CreateInstallationInput{Name: "new", Users: []string{"alice:system_admin", "ci:bot:qa"}})
+		require.NoError(t, err)
+		stored := kv.getInstallation(t, install.ID)
+		assert.Equal(t, []SeedUser{{Username: "alice", Role: seedUserRoleSystemAdmin}, {Username: "ci", Role: seedUserRoleBot, Teams: []string{"qa"}}}, stored.SeedUsers)
+
+		_, err = plugin.createInstallationForUser("owner", CreateInstallationInput{Name: "other", Users: []string{"alice:owner"}})
+		require.EqualError(t, err, "invalid user alice:owner: role must be one of system_admin, user_manager, user, guest, bot")
+		assert.True(t, isCreateUserError(err))
+	})
+
+	t.Run("uses the configured images and sizes", func(t *testing.T) {
+		plugin, cloudClient, _ := newServiceTestPlugin(t, nil)
+		plugin.configuration.AllowedImages = "mattermostdevelopment/mm-ee-new"
+		plugin.configuration.InstallationSizes = "provisionerXL,miniHA"
+
+		_, err := plugin.createInstallationForUser("owner", CreateInstallationInput{Name: "new", Image: "mattermostdevelopment/mm-ee-new"})
+		require.NoError(t, err)
+		assert.Equal(t, "provisionerXL", cloudClient.creationRequest.Size)
+		assert.Equal(t, "mattermostdevelopment/mm-ee-new", cloudClient.creationRequest.Image)
+
+		_, err = plugin.createInstallationForUser("owner", CreateInstallationInput{Name: "other", Size: "miniSingleton", Image: "mattermostdevelopment/mm-ee-new"})
+		require.EqualError(t, err, "Invalid size: miniSingleton")
+
+		_, err = plugin.createInstallationForUser("owner", CreateInstallationInput{Name: "other"})
+		require.EqualError(t, err, "invalid image name mattermost/mattermost-enterprise-edition, valid options are mattermostdevelopment/mm-ee-new")
+	})
 }
 
 func TestInstallationServiceUpdate(t *testing.T) {
@@ -275,6 +373,17 @@ func TestInstallationServiceUpdate(t *testing.T) {
 		assert.Equal(t, []dockerClientCall{{tag: "9.5.0", repository: imageTE}}, dockerClient.getDigestCalls)
 	})
 
+	t.Run("update reports an unavailable registry", func(t *testing.T) {
+		install := serviceTestInstall("install-id", "Install", "owner")
+		plugin, cloudClient, _ := newServiceTestPlugin(t, []*Installation{install})
+		plugin.dockerClient = &MockedDockerClient{validTagErr: errors.New("failed to send registry request")}
+
+		_, err := plugin.updateInstallationForUser("owner", InstallationRef{Name: "install"}, UpdateInstallationInput{Version: "9.5.0"}, InstallationScopeMine)
+		require.EqualError(t, err, "registry unavailable, unable to check if mattermost/mattermost-enterprise-edition:9.5.0 exists: failed to send registry request")
+		assert.True(t, isUpdateUserError(err))
+		assert.Nil(t, cloudClient.patchRequest)
+	})
+
 	t.Run("shared update after redacted read preserves sensitive persisted fields", func(t *testing.T) {
 		shared := serviceTestInstall("shared-id", "Shared", "owner")
 		shared.Shared = true
@@ -282,7 +391,7 @@ func TestInstallationServiceUpdate(t *testing.T) {
 		shared.License = "secret-license"
 		shared.MattermostEnv = cloud.EnvVarMap{"SECRET": cloud.EnvVar{Value: "secret-value"}}
 		shared.PriorityEnv = cloud.EnvVarMap{"PRIORITY": cloud.EnvVar{Value: "priority-value"}}
-		plugin, cloudClient, api := newServiceTestPlugin(t, []*Installation{shared})
+		plugin, cloudClient, _, kv := newServiceTestPluginWithKV(t, []*Installation{shared})
 		cloudClient.overrideGetInstallationDTO = &cloud.InstallationDTO{
 			Installation: shared.Clone(),
 		}
@@ -295,20 +404,14 @@ func TestInstallationServiceUpdate(t *testing.T) {
 		assert.Nil(t, redacted[0].MattermostEnv)
 		assert.Nil(t, redacted[0].PriorityEnv)
 
-		var persisted []*Installation
-		unsetKVCompareAndSet(api)
-		api.On("KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything).
-			Run(func(args mock.Arguments) {
-				require.NoError(t, json.Unmarshal(args.Get(2).([]byte), &persisted))
-			}).
-			Return(true, nil)
-
 		_, err = plugin.updateInstallationForUser("other", InstallationRef{Name: "shared"}, UpdateInstallationInput{Size: "miniHA"}, InstallationScopeUpdatable)
 		require.NoError(t, err)
-		require.Len(t, persisted, 1)
-		assert.Equal(t, "secret-license", persisted[0].License)
-		assert.Equal(t, "secret-value", persisted[0].MattermostEnv["SECRET"].Value)
-		assert.Equal(t, "priority-value", persisted[0].PriorityEnv["PRIORITY"].Value)
+		persisted := kv.getInstallation(t, shared.ID)
+		require.NotNil(t, persisted)
+		assert.Equal(t, "miniHA", persisted.Size)
+		assert.Equal(t, "secret-license", persisted.License)
+		assert.Equal(t, "secret-value", persisted.MattermostEnv["SECRET"].Value)
+		assert.Equal(t, "priority-value", persisted.PriorityEnv["PRIORITY"].Value)
 	})
 }
 
@@ -440,13 +543,10 @@ func TestInstallationServiceSharingDeletionLockAndDelete(t *testing.T) {
 
 	t.Run("delete requires confirmation and calls provisioner before KV delete", func(t *testing.T) {
 		target := serviceTestInstall("delete-id", "DeleteMe", "owner")
-		plugin, cloudClient, api := newServiceTestPlugin(t, []*Installation{target})
-		unsetKVCompareAndSet(api)
-		api.On("KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything).
-			Run(func(args mock.Arguments) {
-				assert.Equal(t, "delete-id", cloudClient.deletedInstallationID)
-			}).
-			Return(true, nil)
+		plugin, cloudClient, _, kv := newServiceTestPluginWithKV(t, []*Installation{target})
+		kv.onWrite = func(key string) {
+			assert.Equal(t, "delete-id", cloudClient.deletedInstallationID)
+		}
 
 		_, err := plugin.deleteInstallationForUser("owner", InstallationRef{Name: "deleteme"}, "wrong")
 		require.EqualError(t, err, "confirmation name wrong does not match installation name DeleteMe")
@@ -456,6 +556,7 @@ func TestInstallationServiceSharingDeletionLockAndDelete(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, "delete_requested", result.Status)
 		assert.Equal(t, "delete-id", cloudClient.deletedInstallationID)
+		assert.Nil(t, kv.getInstallation(t, "delete-id"))
 
 		_, err = plugin.deleteInstallationForUser("owner", InstallationRef{ID: "missing-id"}, "deleteme")
 		require.EqualError(t, err, "no installation with the id missing-id found")
@@ -475,18 +576,24 @@ func unsetKVCompareAndSet(api *plugintest.API) {
 func newServiceTestPlugin(t *testing.T, installs []*Installation) (*Plugin, *MockClient, *plugintest.API) {
 	t.Helper()
 
-	installBytes, err := json.Marshal(installs)
-	require.NoError(t, err)
-	if installs == nil {
-		installBytes = nil
-	}
+	plugin, cloudClient, api, _ := newServiceTestPluginWithKV(t, installs)
+	return plugin, cloudClient, api
+}
+
+// testCredentialsEncryptionKey is the credentials encryption key of the
+// service test plugin.
+const testCredentialsEncryptionKey = "credentials-key"
+
+func newServiceTestPluginWithKV(t *testing.T, installs []*Installation) (*Plugin, *MockClient, *plugintest.API, *fakeKVStore) {
+	t.Helper()
 
 	cloudClient := &MockClient{}
 	plugin := &Plugin{
 		cloudClient:  cloudClient,
 		dockerClient: &MockedDockerClient{tagExists: true},
 		configuration: &configuration{
-			InstallationDNS: "example.com",
+			InstallationDNS:                           "example.com",
+			CredentialsEncryptionKey:                  testCredentialsEncryptionKey,
 			DeletionLockInstallationsAllowedPerPerson: "2",
 			EnterpriseLicense:                         "enterprise-license",
 			EnterpriseAdvancedLicense:                 "enterprise-advanced-license",
@@ -498,14 +605,14 @@ func newServiceTestPlugin(t *testing.T, installs []*Installation) (*Plugin, *Moc
 	}
 
 	api := &plugintest.API{}
-	api.On("KVGet", mock.AnythingOfType("string")).Return(installBytes, nil)
-	api.On("KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(true, nil)
+	kv := newFakeKVStore(api)
+	kv.seedInstallations(t, installs...)
 	api.On("LogAuditRec", mock.AnythingOfType("*model.AuditRecord")).Return()
 	api.On("LogWarn", mock.AnythingOfType("string")).Return(nil)
 	api.On("LogError", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(nil)
 	plugin.SetAPI(api)
 
-	return plugin, cloudClient, api
+	return plugin, cloudClient, api, kv
 }
 
 func serviceTestInstall(id, name, ownerID string) *Installation {
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"sync"
+	"testing"
+
+	cloud "github.com/mattermost/mattermost-cloud/model"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeKVStore is an in-memory plugin KV store wired into a plugintest.API.
+type fakeKVStore struct {
+	lock sync.Mutex
+	data map[string][]byte
+
+	// onWrite is called with the key of every compare-and-set or
+	// compare-and-delete before it is applied.
+	onWrite func(key string)
+}
+
+func newFakeKVStore(api *plugintest.API) *fakeKVStore {
+	s := &fakeKVStore{data: map[string][]byte{}}
+
+	api.On("KVGet", mock.AnythingOfType("string")).Return(
+		func(key string) []byte { return s.get(key) },
+		func(key string) *model.AppError { return nil },
+	).Maybe()
+	api.On("KVList", mock.AnythingOfType("int"), mock.AnythingOfType("int")).Return(
+		func(page, perPage int) []string { return s.list(page, perPage) },
+		func(page, perPage int) *model.AppError { return nil },
+	).Maybe()
+	api.On("KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(
+		func(key string, oldValue, newValue []byte) bool { return s.compareAndSet(key, oldValue, newValue) },
+		func(key string, oldValue, newValue []byte) *model.AppError { return nil },
+	).Maybe()
+	api.On("KVCompareAndDelete", mock.AnythingOfType("string"), mock.Anything).Return(
+		func(key string, oldValue []byte) bool { return s.compareAndDelete(key, oldValue) },
+		func(key string, oldValue []byte) *model.AppError { return nil },
+	).Maybe()
+	api.On("KVSet", mock.AnythingOfType("string"), mock.Anything).Return(
+		func(key string, value []byte) *model.AppError {
+			s.set(key, value)
+			return nil
+		},
+	).Maybe()
+	api.On("KVDelete", mock.AnythingOfType("string")).Return(
+		func(key string) *model.AppError {
+			s.set(key, nil)
+			return nil
+		},
+	).Maybe()
+	api.On("KVSetWithOptions", mock.AnythingOfType("string"), mock.Anything, mock.AnythingOfType("model.PluginKVSetOptions")).Return(
+		func(key string, value []byte, options model.PluginKVSetOptions) bool {
+			return s.setWithOptions(key, value, options)
+		},
+		func(key string, value []byte, options model.PluginKVSetOptions) *model.AppError { return nil },
+	).Maybe()
+
+	return s
+}
+
+func (s *fakeKVStore) get(key string) []byte {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.data[key]
+}
+
+func (s *fakeKVStore) set(key string, value []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if value == nil {
+		delete(s.data, key)
+		return
+	}
+	s.data[key] = value
+}
+
+func (s *fakeKVStore) list(page, perPage int) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	keys := make([]string, 0, len(s.data))
+	for key := range s.data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	start := page * perPage
+	if start >= len(keys) {
+		return []string{}
+	}
+	end := start + perPage
+	if end > len(keys) {
+		end = len(keys)
+	}
+	return keys[start:end]
+}
+
+func (s *fakeKVStore) compareAndSet(key string, oldValue, newValue []byte) bool {
+	if s.onWrite != nil {
+		s.onWrite(key)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	current, exists := s.data[key]
+	if oldValue == nil && exists {
+		return false
+	}
+	if oldValue != nil && !bytes.Equal(current, oldValue) {
+		return false
+	}
+	s.data[key] = newValue
+	return true
+}
+
+func (s *fakeKVStore) compareAndDelete(key string, oldValue []byte) bool {
+	if s.onWrite != nil {
+		s.onWrite(key)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	current, exists := s.data[key]
+	if !exists || !bytes.Equal(current, oldValue) {
+		return false
+	}
+	delete(s.data, key)
+	return true
+}
+
+// setWithOptions applies the atomic and delete semantics of KVSetWithOptions.
+// Expiry is ignored.
+func (s *fakeKVStore) setWithOptions(key string, value []byte, options model.PluginKVSetOptions) bool {
+	if !options.Atomic {
+		s.set(key, value)
+		return true
+	}
+	if value == nil {
+		if options.OldValue == nil {
+			return false
+		}
+		return s.compareAndDelete(key, options.OldValue)
+	}
+	return s.compareAndSet(key, options.OldValue, value)
+}
+
+func (s *fakeKVStore) reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.data = map[string][]byte{}
+}
+
+// seedInstallations stores the installations and their indexes directly,
+// bypassing the plugin.
+func (s *fakeKVStore) seedInstallations(t *testing.T, installs ...*Installation) {
+	t.Helper()
+
+	for _, install := range installs {
+		installJSON, err := json.Marshal(install)
+		require.NoError(t, err)
+		s.set(installationKey(install.ID), installJSON)
+
+		var ids []string
+		if existing := s.get(ownerIndexKey(install.OwnerID)); existing != nil {
+			require.NoError(t, json.Unmarshal(existing, &ids))
+		}
+		ids = append(ids, install.ID)
+		idsJSON, err := json.Marshal(ids)
+		require.NoError(t, err)
+		s.set(ownerIndexKey(install.OwnerID), idsJSON)
+
+		if install.Name != "" {
+			s.set(nameIndexKey(install.Name), []byte(install.ID))
+		}
+	}
+}
+
+// setInstallationsJSON replaces the store contents with the installations
+// from a JSON array.
+func (s *fakeKVStore) setInstallationsJSON(t *testing.T, installsJSON []byte) {
+	t.Helper()
+
+	s.reset()
+	if installsJSON == nil {
+		return
+	}
+
+	var installs []*Installation
+	require.NoError(t, json.Unmarshal(installsJSON, &installs))
+	s.seedInstallations(t, installs...)
+}
+
+func (s *fakeKVStore) getInstallation(t *testing.T, installationID string) *Installation {
+	t.Helper()
+
+	installJSON := s.get(installationKey(installationID))
+	if installJSON == nil {
+		return nil
+	}
+
+	var install *Installation
+	require.NoError(t, json.Unmarshal(installJSON, &install))
+	return install
+}
+
+func (s *fakeKVStore) getOwnerIndex(t *testing.T, ownerID string) []string {
+	t.Helper()
+
+	idsJSON := s.get(ownerIndexKey(ownerID))
+	if idsJSON == nil {
+		return nil
+	}
+
+	var ids []string
+	require.NoError(t, json.Unmarshal(idsJSON, &ids))
+	return ids
+}
+
+func newInstallationStoreTestPlugin() (*Plugin, *plugintest.API, *fakeKVStore) {
+	plugin := &Plugin{cloudClient: &MockClient{}}
+	api := &plugintest.API{}
+	kv := newFakeKVStore(api)
+	api.On("LogWarn", mock.AnythingOfType("string")).Return(nil)
+	api.On("LogInfo", mock.AnythingOfType("string"), mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	plugin.SetAPI(api)
+
+	return plugin, api, kv
+}
+
+func TestInstallationStore(t *testing.T) {
+	t.Run("store indexes by owner and name", func(t *testing.T) {
+		plugin, _, kv := newInstallationStoreTestPlugin()
+
+		require.NoError(t, plugin.storeInstallation(serviceTestInstall("id1", "First", "owner1")))
+		require.NoError(t, plugin.storeInstallation(serviceTestInstall("id2", "second", "owner1")))
+		require.NoError(t, plugin.storeInstallation(serviceTestInstall("id3", "third", "owner2")))
+
+		assert.Equal(t, []string{"id1", "id2"}, kv.getOwnerIndex(t, "owner1"))
+		assert.Equal(t, []string{"id3"}, kv.getOwnerIndex(t, "owner2"))
+		assert.Equal(t, "id1", string(kv.get(nameIndexKey("first"))))
+
+		exists, err := plugin.installationWithNameExists("FIRST")
+		require.NoError(t, err)
+		assert.True(t, exists)
+		exists, err = plugin.installationWithNameExists("fourth")
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		installs, err := plugin.getInstallationsForUser("owner1")
+		require.NoError(t, err)
+		require.Len(t, installs, 2)
+		assert.Equal(t, "id1", installs[0].ID)
+		assert.Equal(t, "id2", installs[1].ID)
+
+		installs, err = plugin.getInstallations()
+		require.NoError(t, err)
+		assert.Len(t, installs, 3)
+
+		err = plugin.storeInstallation(serviceTestInstall("id1", "First", "owner1"))
+		require.EqualError(t, err, "installation id1 is already stored")
+	})
+
+	t.Run("shared installations are filtered from all records", func(t *testing.T) {
+		plugin, _, kv := newInstallationStoreTestPlugin()
+		shared := serviceTestInstall("shared-id", "shared", "owner1")
+		shared.Shared = true
+		kv.seedInstallations(t, serviceTestInstall("private-id", "private", "owner1"), shared)
+
+		installs, err := plugin.getSharedInstallations()
+		require.NoError(t, err)
+		require.Len(t, installs, 1)
+		assert.Equal(t, "shared-id", installs[0].ID)
+	})
+
+	t.Run("update replaces the record and moves the owner index", func(t *testing.T) {
+		plugin, _, kv := newInstallationStoreTestPlugin()
+		kv.seedInstallations(t, serviceTestInstall("id1", "first", "owner1"))
+
+		install := serviceTestInstall("id1", "first", "owner2")
+		install.Shared = true
+		require.NoError(t, plugin.updateInstallation(install))
+
+		assert.True(t, kv.getInstallation(t, "id1").Shared)
+		assert.Empty(t, kv.getOwnerIndex(t, "owner1"))
+		assert.Equal(t, []string{"id1"}, kv.getOwnerIndex(t, "owner2"))
+
+		err := plugin.updateInstallation(serviceTestInstall("missing", "missing", "owner1"))
+		require.EqualError(t, err, "installation does not exist")
+	})
+
+	t.Run("delete removes the record and releases the name", func(t *testing.T) {
+		plugin, _, kv := newInstallationStoreTestPlugin()
+		kv.seedInstallations(t, serviceTestInstall("id1", "first", "owner1"), serviceTestInstall("id2", "second", "owner1"))
+
+		require.NoError(t, plugin.deleteInstallation("id1"))
+
+		assert.Nil(t, kv.getInstallation(t, "id1"))
+		assert.Equal(t, []string{"id2"}, kv.getOwnerIndex(t, "owner1"))
+		assert.Nil(t, kv.get(nameIndexKey("first")))
+		assert.Equal(t, "id2", string(kv.get(nameIndexKey("second"))))
+
+		err := plugin.deleteInstallation("id1")
+		require.EqualError(t, err, "installation does not exist")
+	})
+
+	t.Run("owner index skips missing records", func(t *testing.T) {
+		plugin, _, kv := newInstallationStoreTestPlugin()
+		kv.seedInstallations(t, serviceTestInstall("id1", "first", "owner1"))
+		kv.set(ownerIndexKey("owner1"), []byte(`["gone","id1"]`))
+
+		installs, err := plugin.getInstallationsForUser("owner1")
+		require.NoError(t, err)
+		require.Len(t, installs, 1)
+		assert.Equal(t, "id1", installs[0].ID)
+	})
+}
+
+func TestMigrateLegacyInstallations(t *testing.T) {
+	legacyInstalls := []*Installation{
+		{Name: "first", Shared: true, InstallationDTO: cloud.InstallationDTO{Installation: &cloud.Installation{ID: "id1", OwnerID: "owner1", CreateAt: 1}}},
+		{Name: "second", InstallationDTO: cloud.InstallationDTO{Installation: &cloud.Installation{ID: "id2", OwnerID: "owner1", CreateAt: 2}}},
+		{Name: "third", InstallationDTO: cloud.InstallationDTO{Installation: &cloud.Installation{ID: "id3", OwnerID: "owner2", CreateAt: 3}}},
+	}
+	legacyJSON, err := json.Marshal(legacyInstalls)
+	require.NoError(t, err)
+
+	t.Run("no legacy installations", func(t *testing.T) {
+		plugin, api, _ := newInstallationStoreTestPlugin()
+
+		require.NoError(t, plugin.migrateLegacyInstallations())
+		api.AssertNotCalled(t, "KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything)
+	})
+
+	t.Run("migrates records and indexes then removes the legacy key", func(t *testing.T) {
+		plugin, _, kv := newInstallationStoreTestPlugin()
+		kv.set(StoreInstallsKey, legacyJSON)
+
+		require.NoError(t, plugin.migrateLegacyInstallations())
+
+		assert.Nil(t, kv.get(StoreInstallsKey))
+		installs, err := plugin.getInstallations()
+		require.NoError(t, err)
+		require.Len(t, installs, 3)
+		assert.Equal(t, []string{"id1", "id2", "id3"}, []string{installs[0].ID, installs[1].ID, installs[2].ID})
+		assert.True(t, installs[0].Shared)
+		assert.Equal(t, []string{"id1", "id2"}, kv.getOwnerIndex(t, "owner1"))
+		assert.Equal(t, []string{"id3"}, kv.getOwnerIndex(t, "owner2"))
+		assert.Equal(t, "id3", string(kv.get(nameIndexKey("third"))))
+	})
+
+	t.Run("resumes a partial migration without duplicating", func(t *testing.T) {
+		plugin, _, kv := newInstallationStoreTestPlugin()
+		kv.seedInstallations(t, legacyInstalls[0])
+		kv.set(StoreInstallsKey, legacyJSON)
+
+		require.NoError(t, plugin.migrateLegacyInstallations())
+		require.NoError(t, plugin.migrateLegacyInstallations())
+
+		assert.Nil(t, kv.get(StoreInstallsKey))
+		assert.Equal(t, []string{"id1", "id2"}, kv.getOwnerIndex(t, "owner1"))
+		installs, err := plugin.getInstallations()
+		require.NoError(t, err)
+		assert.Len(t, installs, 3)
+	})
+
+	t.Run("duplicate legacy names keep the first reservation", func(t *testing.T) {
+		plugin, _, kv := newInstallationStoreTestPlugin()
+		duplicateJSON, err := json.Marshal([]*Installation{
+			{Name: "dupe", InstallationDTO: cloud.InstallationDTO{Installation: &cloud.Installation{ID: "id1", OwnerID: "owner1"}}},
+			{Name: "DUPE", InstallationDTO: cloud.InstallationDTO{Installation: &cloud.Installation{ID: "id2", OwnerID: "owner1"}}},
+		})
+		require.NoError(t, err)
+		kv.set(StoreInstallsKey, duplicateJSON)
+
+		require.NoError(t, plugin.migrateLegacyInstallations())
+
+		assert.Equal(t, "id1", string(kv.get(nameIndexKey("dupe"))))
+		assert.NotNil(t, kv.getInstallation(t, "id2"))
+	})
+}
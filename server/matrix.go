@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// maxMatrixInstallations caps the number of installations a single matrix
+// request can create.
+const maxMatrixInstallations = 10
+
+var matrixNameReplacer = regexp.MustCompile(`[^a-zA-Z0-9-]+`)
+
+// CreateInstallationMatrixInput describes a set of installations sharing the
+// same options and differing only in version.
+type CreateInstallationMatrixInput struct {
+	Prefix   string
+	Versions []string
+	Options  CreateInstallationInput
+}
+
+// InstallationMatrixResult is the outcome of creating one installation of a
+// version matrix.
+type InstallationMatrixResult struct {
+	Version      string               `json:"version"`
+	Name         string               `json:"name"`
+	Status       string               `json:"status"`
+	Installation *InstallationSummary `json:"installation,omitempty"`
+}
+
+// matrixInstallationName returns the name of the matrix installation running
+// the given version, e.g. prefix-9-11-0 for version 9.11.0.
+func matrixInstallationName(prefix, version string) string {
+	return standardizeName(prefix + "-" + strings.Trim(matrixNameReplacer.ReplaceAllString(version, "-"), "-"))
+}
+
+// createInstallationMatrixForUser creates one installation per requested
+// version. Every installation is validated, including its docker tag, before
+// any is created so invalid input never results in a partial matrix. When an
+// installation fails to be created, the ones created before it are deleted.
+func (p *Plugin) createInstallationMatrixForUser(userID string, input CreateInstallationMatrixInput) ([]InstallationMatrixResult, error) {
+	inputs, err := p.prepareInstallationMatrix(userID, input)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]InstallationMatrixResult, 0, len(inputs))
+	created := []*Installation{}
+	for _, createInput := range inputs {
+		install, err := p.createInstallationForUser(userID, createInput)
+		if err != nil {
+			return nil, p.rollBackInstallationMatrix(created, errors.Wrapf(err, "installation %s", standardizeName(createInput.Name)))
+		}
+		created = append(created, install)
+
+		summary, err := installationSummary(install, false)
+		if err != nil {
+			return nil, p.rollBackInstallationMatrix(created, err)
+		}
+		results = append(results, InstallationMatrixResult{
+			Version:      createInput.Version,
+			Name:         install.Name,
+			Status:       "creation_requested",
+			Installation: &summary,
+		})
+	}
+
+	return results, nil
+}
+
+// rollBackInstallationMatrix deletes the installations of a matrix which
+// failed to be created, and returns the creation error along with the
+// installations which couldn't be deleted.
+func (p *Plugin) rollBackInstallationMatrix(created []*Installation, createErr error) error {
+	remaining := []string{}
+	for _, install := range created {
+		if err := p.cloudClient.DeleteInstallation(install.ID); err != nil {
+			p.API.LogWarn(errors.Wrapf(err, "Unable to delete matrix installation %s", install.Name).Error())
+			remaining = append(remaining, install.Name)
+			continue
+		}
+		if err := p.deleteInstallation(install.ID); err != nil {
+			p.API.LogWarn(errors.Wrapf(err, "Unable to remove matrix installation %s from the KV store", install.Name).Error())
+		}
+	}
+
+	if len(remaining) > 0 {
+		return errors.Errorf("%s; the matrix is partial, delete installations %s with `/cloud delete`", createErr.Error(), strings.Join(remaining, ", "))
+	}
+	return errors.Errorf("%s; the installations created before it were deleted", createErr.Error())
+}
+
+// prepareInstallationMatrix resolves and validates the create input of every
+// installation in the matrix.
+func (p *Plugin) prepareInstallationMatrix(userID string, input CreateInstallationMatrixInput) ([]CreateInstallationInput, error) {
+	prefix := standardizeName(input.Prefix)
+	if prefix == "" || strings.HasPrefix(prefix, "--") {
+		return nil, errors.New("must provide an installation name prefix")
+	}
+	if input.Options.Version != "" {
+		return nil, errors.New("the version of matrix installations must be set with versions")
+	}
+	if len(input.Versions) == 0 {
+		return nil, errors.New("must provide at least one version")
+	}
+	if len(input.Versions) > maxMatrixInstallations {
+		return nil, errors.Errorf("a matrix can create at most %d installations", maxMatrixInstallations)
+	}
+
+	inputs := make([]CreateInstallationInput, 0, len(input.Versions))
+	names := map[string]bool{}
+	failures := []string{}
+	for _, version := range input.Versions {
+		version = strings.TrimSpace(version)
+		if version == "" {
+			return nil, errors.New("versions must not be empty")
+		}
+
+		version, err := p.resolveVersionSpec(version, createImageForVersion(input.Options.Image, version))
+		if err != nil {
+			return nil, err
+		}
+
+		createInput := input.Options
+		createInput.Version = version
+		createInput.Name = matrixInstallationName(prefix, version)
+		if names[createInput.Name] {
+			return nil, errors.Errorf("version %s was requested more than once", version)
+		}
+		names[createInput.Name] = true
+
+		install, err := p.buildCreateInstallation(userID, createInput)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", version, err.Error()))
+			continue
+		}
+
+		validTag, err := p.dockerClient.ValidTag(install.Version, install.Image)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", version, registryUnavailableError(err, install.Image, install.Version).Error()))
+			continue
+		}
+		if !validTag {
+			failures = append(failures, fmt.Sprintf("%s: %s is not a valid docker tag for repository %s", version, install.Version, install.Image))
+			continue
+		}
+
+		inputs = append(inputs, createInput)
+	}
+
+	if len(failures) > 0 {
+		return nil, errors.Errorf("no installations were created: %s", strings.Join(failures, "; "))
+	}
+
+	return inputs, nil
+}
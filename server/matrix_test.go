@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatrixInstallationName(t *testing.T) {
+	assert.Equal(t, "upgrade-9-11-0", matrixInstallationName("Upgrade", "9.11.0"))
+	assert.Equal(t, "upgrade-10-2-0-rc1", matrixInstallationName("upgrade", "10.2.0-rc1"))
+	assert.Equal(t, "upgrade-master", matrixInstallationName("upgrade", "master"))
+}
+
+func TestCreateInstallationMatrixForUser(t *testing.T) {
+	t.Run("creates one installation per version with shared options", func(t *testing.T) {
+		plugin, cloudClient, _, kv := newServiceTestPluginWithKV(t, nil)
+
+		results, err := plugin.createInstallationMatrixForUser("owner", CreateInstallationMatrixInput{
+			Prefix:   "Upgrade",
+			Versions: []string{"9.11.0", "10.2.0", "latest"},
+			Options:  CreateInstallationInput{Size: "miniHA", Env: map[string]string{"MM_SECRET": "value"}},
+		})
+		require.NoError(t, err)
+		require.Len(t, results, 3)
+		require.Len(t, cloudClient.creationRequests, 3)
+
+		expected := []struct{ version, name string }{
+			{"9.11.0", "upgrade-9-11-0"},
+			{"10.2.0", "upgrade-10-2-0"},
+			{"9.5.0", "upgrade-9-5-0"},
+		}
+		for i, want := range expected {
+			assert.Equal(t, want.version, results[i].Version)
+			assert.Equal(t, want.name, results[i].Name)
+			assert.Equal(t, "creation_requested", results[i].Status)
+			require.NotNil(t, results[i].Installation)
+			assert.Equal(t, want.name, cloudClient.creationRequests[i].Name)
+			assert.Equal(t, "miniHA", cloudClient.creationRequests[i].Size)
+			assert.Equal(t, "value", cloudClient.creationRequests[i].PriorityEnv["MM_SECRET"].Value)
+			assert.Equal(t, results[i].Installation.ID, string(kv.get(nameIndexKey(want.name))))
+		}
+	})
+
+	t.Run("an invalid tag prevents every creation", func(t *testing.T) {
+		plugin, cloudClient, _ := newServiceTestPlugin(t, nil)
+		plugin.dockerClient = &MockedDockerClient{tagExists: true, invalidTags: []string{"10.99.0"}}
+
+		_, err := plugin.createInstallationMatrixForUser("owner", CreateInstallationMatrixInput{
+			Prefix:   "upgrade",
+			Versions: []string{"9.11.0", "10.99.0"},
+		})
+		require.EqualError(t, err, "no installations were created: 10.99.0: 10.99.0 is not a valid docker tag for repository "+defaultImage)
+		assert.Empty(t, cloudClient.creationRequests)
+	})
+
+	t.Run("invalid options and taken names are reported together", func(t *testing.T) {
+		plugin, cloudClient, _ := newServiceTestPlugin(t, []*Installation{serviceTestInstall("taken-id", "upgrade-9-11-0", "other")})
+
+		_, err := plugin.createInstallationMatrixForUser("owner", CreateInstallationMatrixInput{
+			Prefix:   "upgrade",
+			Versions: []string{"9.11.0", "5.0.0"},
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no installations were created: 9.11.0: Installation name upgrade-9-11-0 already exists")
+		assert.Contains(t, err.Error(), "5.0.0: Invalid version number")
+		assert.Empty(t, cloudClient.creationRequests)
+	})
+
+	t.Run("rejects invalid requests", func(t *testing.T) {
+		plugin, _, _ := newServiceTestPlugin(t, nil)
+
+		tests := []struct {
+			input       CreateInstallationMatrixInput
+			errContains string
+		}{
+			{CreateInstallationMatrixInput{Versions: []string{"9.11.0"}}, "must provide an installation name prefix"},
+			{CreateInstallationMatrixInput{Prefix: "upgrade"}, "must provide at least one version"},
+			{CreateInstallationMatrixInput{Prefix: "upgrade", Versions: []string{"9.11.0"}, Options: CreateInstallationInput{Version: "9.11.0"}}, "must be set with versions"},
+			{CreateInstallationMatrixInput{Prefix: "upgrade", Versions: []string{"9.5.0", "latest"}}, "version 9.5.0 was requested more than once"},
+			{CreateInstallationMatrixInput{Prefix: "upgrade", Versions: make([]string, maxMatrixInstallations+1)}, "a matrix can create at most 10 installations"},
+		}
+		for _, test := range tests {
+			_, err := plugin.createInstallationMatrixForUser("owner", test.input)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.errContains)
+		}
+	})
+
+	t.Run("a provisioner failure deletes the installations already created", func(t *testing.T) {
+		plugin, cloudClient, _, kv := newServiceTestPluginWithKV(t, nil)
+		cloudClient.createErr = errors.New("provisioner unavailable")
+		cloudClient.createErrAfter = 1
+
+		results, err := plugin.createInstallationMatrixForUser("owner", CreateInstallationMatrixInput{
+			Prefix:   "upgrade",
+			Versions: []string{"9.11.0", "10.2.0", "10.5.0"},
+		})
+		require.EqualError(t, err, "installation upgrade-10-2-0: failed to create installation: provisioner unavailable; the installations created before it were deleted")
+		assert.Nil(t, results)
+		assert.Len(t, cloudClient.creationRequests, 2)
+		assert.Equal(t, []string{"someid"}, cloudClient.deletedInstallationIDs)
+		assert.Nil(t, kv.getInstallation(t, "someid"))
+		assert.Nil(t, kv.get(nameIndexKey("upgrade-9-11-0")))
+	})
+
+	t.Run("installations which can't be deleted are reported", func(t *testing.T) {
+		plugin, cloudClient, _ := newServiceTestPlugin(t, nil)
+		cloudClient.createErr = errors.New("provisioner unavailable")
+		cloudClient.createErrAfter = 1
+		cloudClient.deleteErr = errors.New("delete failed")
+
+		_, err := plugin.createInstallationMatrixForUser("owner", CreateInstallationMatrixInput{
+			Prefix:   "upgrade",
+			Versions: []string{"9.11.0", "10.2.0"},
+		})
+		require.EqualError(t, err, "installation upgrade-10-2-0: failed to create installation: provisioner unavailable; the matrix is partial, delete installations upgrade-9-11-0 with `/cloud delete`")
+	})
+}
@@ -21,7 +21,7 @@ func TestMCPAdminToolsRegistration(t *testing.T) {
 
 	result, err := session.ListTools(context.Background(), &mcp.ListToolsParams{})
 	require.NoError(t, err)
-	require.Len(t, result.Tools, 11)
+	require.Len(t, result.Tools, 15)
 
 	tools := map[string]*mcp.Tool{}
 	for _, tool := range result.Tools {
@@ -31,6 +31,7 @@ func TestMCPAdminToolsRegistration(t *testing.T) {
 	for _, toolName := range []string{
 		mcpListInstallationsToolName,
 		mcpGetInstallationToolName,
+		mcpGetInstallationHistoryToolName,
 		mcpCreateInstallationToolName,
 		mcpUpdateInstallationToolName,
 		mcpRestartInstallationToolName,
@@ -39,6 +40,7 @@ func TestMCPAdminToolsRegistration(t *testing.T) {
 		mcpSetInstallationSharingToolName,
 		mcpSetDeletionLockToolName,
 		mcpDeleteInstallationToolName,
+		mcpRestoreInstallationToolName,
 		mcpCloudStatusToolName,
 	} {
 		assert.Contains(t, tools, toolName)
@@ -446,13 +446,10 @@ func TestMCPLifecycleProvisionerErrors(t *testing.T) {
 func TestDeleteInstallationMCP(t *testing.T) {
 	t.Run("requires confirmation and calls provisioner before local delete", func(t *testing.T) {
 		target := serviceTestInstall("delete-id", "DeleteMe", "owner")
-		plugin, cloudClient, api := newMCPToolsTestPlugin(t, []*Installation{target})
-		unsetKVCompareAndSet(api)
-		api.On("KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything).
-			Run(func(args mock.Arguments) {
-				assert.Equal(t, "delete-id", cloudClient.deletedInstallationID)
-			}).
-			Return(true, nil)
+		plugin, cloudClient, _, kv := newMCPToolsTestPluginWithKV(t, []*Installation{target})
+		kv.onWrite = func(key string) {
+			assert.Equal(t, "delete-id", cloudClient.deletedInstallationID)
+		}
 		session, cleanup := connectMCPToolsClient(t, plugin, "owner")
 		defer cleanup()
 
@@ -475,6 +472,8 @@ func TestDeleteInstallationMCP(t *testing.T) {
 		output := decodeMCPStructuredOutput[InstallationActionMCPOutput](t, result)
 		assert.Equal(t, "delete_requested", output.Result.Status)
 		assert.Equal(t, "delete-id", cloudClient.deletedInstallationID)
+		assert.Nil(t, kv.getInstallation(t, "delete-id"))
+		assert.NotNil(t, kv.get(deletedInstallationKey("delete-id")))
 	})
 
 	t.Run("blocks wrong owner and preserves KV on provisioner failure", func(t *testing.T) {
@@ -496,9 +495,42 @@ func TestDeleteInstallationMCP(t *testing.T) {
 		assert.True(t, result.IsError)
 		assert.Contains(t, mcpToolText(t, result), "provisioner delete failed")
 		api.AssertNotCalled(t, "KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything)
+		api.AssertNotCalled(t, "KVCompareAndDelete", mock.AnythingOfType("string"), mock.Anything)
 	})
 }
 
+func TestRestoreInstallationMCP(t *testing.T) {
+	target := serviceTestInstall("restore-id", "RestoreMe", "owner")
+	plugin, cloudClient, _, kv := newMCPToolsTestPluginWithKV(t, []*Installation{target})
+
+	session, cleanup := connectMCPToolsClient(t, plugin, "owner")
+	defer cleanup()
+	result, err := callMCPTool(t, session, mcpDeleteInstallationToolName, map[string]any{"name": "restoreme", "confirm_name": "RestoreMe"})
+	require.NoError(t, err)
+	require.False(t, result.IsError)
+
+	pending := serviceTestInstall("restore-id", "RestoreMe", "owner")
+	pending.State = cloud.InstallationStateDeletionPending
+	cloudClient.mockedCloudInstallationsDTO = serviceDTOs(pending)
+
+	otherSession, otherCleanup := connectMCPToolsClient(t, plugin, "other")
+	defer otherCleanup()
+	result, err = callMCPTool(t, otherSession, mcpRestoreInstallationToolName, map[string]any{"installation_id": "restore-id"})
+	require.NoError(t, err)
+	assert.True(t, result.IsError)
+	assert.Contains(t, mcpToolText(t, result), "no installation with the id restore-id found")
+	assert.Empty(t, cloudClient.canceledInstallationID)
+
+	result, err = callMCPTool(t, session, mcpRestoreInstallationToolName, map[string]any{"name": "restoreme"})
+	require.NoError(t, err)
+	require.False(t, result.IsError)
+	output := decodeMCPStructuredOutput[InstallationActionMCPOutput](t, result)
+	assert.Equal(t, "restore_requested", output.Result.Status)
+	assert.Equal(t, "restore-id", output.Result.Installation.ID)
+	assert.Equal(t, "restore-id", cloudClient.canceledInstallationID)
+	assert.NotNil(t, kv.getInstallation(t, "restore-id"))
+}
+
 func TestMCPLifecycleResultSensitivity(t *testing.T) {
 	install := serviceTestInstall("secret-id", "Secret", "owner")
 	install.License = "raw-license-value"
@@ -517,3 +549,96 @@ func TestMCPLifecycleResultSensitivity(t *testing.T) {
 	require.NoError(t, err)
 	assert.Contains(t, string(data), "CLOUD_PLUGIN_RESTART")
 }
+
+func TestCreateInstallationMatrixMCP(t *testing.T) {
+	t.Run("creates every version and redacts output", func(t *testing.T) {
+		plugin, cloudClient, _, _ := newMCPToolsTestPluginWithKV(t, nil)
+		plugin.configuration.E20License = "raw-license-value"
+
+		session, cleanup := connectMCPToolsClient(t, plugin, "owner")
+		defer cleanup()
+		result, err := callMCPTool(t, session, mcpCreateMatrixToolName, map[string]any{
+			"prefix":   "upgrade",
+			"versions": []string{"9.11.0", "10.2.0"},
+			"license":  licenseOptionE20,
+			"env":      map[string]any{"SECRET_ENV": "env-secret-value"},
+		})
+		require.NoError(t, err)
+		require.False(t, result.IsError)
+
+		output := decodeMCPStructuredOutput[CreateInstallationMatrixMCPOutput](t, result)
+		require.Equal(t, 2, output.Count)
+		assert.Equal(t, "upgrade-9-11-0", output.Results[0].Name)
+		assert.Equal(t, "creation_requested", output.Results[1].Status)
+		require.NotNil(t, output.Results[1].Installation)
+		assert.Equal(t, "10.2.0", output.Results[1].Installation.VersionTag)
+		require.Len(t, cloudClient.creationRequests, 2)
+		assertMCPResultRedacted(t, result, "raw-license-value", "env-secret-value", "MattermostEnv", "PriorityEnv", "License")
+	})
+
+	t.Run("invalid tags are tool errors and nothing is created", func(t *testing.T) {
+		plugin, cloudClient, _, _ := newMCPToolsTestPluginWithKV(t, nil)
+		plugin.dockerClient = &MockedDockerClient{tagExists: true, invalidTags: []string{"10.99.0"}}
+
+		session, cleanup := connectMCPToolsClient(t, plugin, "owner")
+		defer cleanup()
+		result, err := callMCPTool(t, session, mcpCreateMatrixToolName, map[string]any{
+			"prefix":   "upgrade",
+			"versions": []string{"9.11.0", "10.99.0"},
+		})
+		require.NoError(t, err)
+		assert.True(t, result.IsError)
+		assert.Contains(t, mcpToolText(t, result), "no installations were created")
+		assert.Empty(t, cloudClient.creationRequests)
+	})
+}
+
+func TestDryRunMCP(t *testing.T) {
+	t.Run("create returns the masked request", func(t *testing.T) {
+		plugin, cloudClient, _, _ := newMCPToolsTestPluginWithKV(t, nil)
+		plugin.configuration.E20License = "raw-license-value"
+
+		session, cleanup := connectMCPToolsClient(t, plugin, "owner")
+		defer cleanup()
+		result, err := callMCPTool(t, session, mcpCreateInstallationToolName, map[string]any{
+			"name":    "preview",
+			"license": licenseOptionE20,
+			"env":     map[string]any{"SECRET_ENV": "env-secret-value"},
+			"dry_run": true,
+		})
+		require.NoError(t, err)
+		require.False(t, result.IsError)
+
+		output := decodeMCPStructuredOutput[InstallationActionMCPOutput](t, result)
+		assert.Equal(t, dryRunStatus, output.Result.Status)
+		assert.Equal(t, "9.5.0", output.Result.Installation.VersionTag)
+		request, ok := output.Result.DryRunRequest.(map[string]any)
+		require.True(t, ok)
+		assert.Equal(t, "preview", request["Name"])
+		assert.Equal(t, maskedValue, request["License"])
+		assert.Nil(t, cloudClient.creationRequest)
+		assertMCPResultRedacted(t, result, "raw-license-value", "env-secret-value")
+	})
+
+	t.Run("update returns the masked request", func(t *testing.T) {
+		install := serviceTestInstall("id1", "first", "owner")
+		plugin, cloudClient, _, _ := newMCPToolsTestPluginWithKV(t, []*Installation{install})
+
+		session, cleanup := connectMCPToolsClient(t, plugin, "owner")
+		defer cleanup()
+		result, err := callMCPTool(t, session, mcpUpdateInstallationToolName, map[string]any{
+			"name":    "first",
+			"set_env": map[string]any{"SECRET_ENV": "env-secret-value"},
+			"dry_run": true,
+		})
+		require.NoError(t, err)
+		require.False(t, result.IsError)
+
+		output := decodeMCPStructuredOutput[InstallationActionMCPOutput](t, result)
+		assert.Equal(t, dryRunStatus, output.Result.Status)
+		assert.Equal(t, []string{"env"}, output.Result.ChangedFields)
+		assert.NotNil(t, output.Result.DryRunRequest)
+		assert.Empty(t, cloudClient.patchInstallationID)
+		assertMCPResultRedacted(t, result, "env-secret-value")
+	})
+}
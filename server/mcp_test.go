@@ -250,6 +250,8 @@ func TestOnActivateRegistersCommandThenMCPBestEffort(t *testing.T) {
 	api.On("CreateBot", mock.AnythingOfType("*model.Bot")).Return(&model.Bot{UserId: "bot-id"}, nil).Once()
 	api.On("GetBundlePath").Return(bundlePath, nil).Once()
 	api.On("SetProfileImage", "bot-id", mock.Anything).Return(nil).Once()
+	newFakeKVStore(api)
+	api.On("LogInfo", mock.AnythingOfType("string"), mock.Anything, mock.Anything, mock.Anything, mock.Anything).Maybe()
 	api.On("RegisterCommand", mock.AnythingOfType("*model.Command")).
 		Run(func(args mock.Arguments) {
 			events = append(events, "command")
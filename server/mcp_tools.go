@@ -2,7 +2,10 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
+	"github.com/google/jsonschema-go/jsonschema"
 	cloud "github.com/mattermost/mattermost-cloud/model"
 	"github.com/mattermost/mattermost-plugin-agents/external/pluginmcp"
 	"github.com/mattermost/mattermost/server/public/model"
@@ -35,28 +38,62 @@ type GetInstallationMCPOutput struct {
 }
 
 type CreateInstallationMCPInput struct {
-	Name      string            `json:"name" jsonschema:"Required installation name."`
-	Version   string            `json:"version,omitempty" jsonschema:"Mattermost version tag. Defaults to latest."`
-	Size      string            `json:"size,omitempty" jsonschema:"Installation size, such as miniSingleton or miniHA. Defaults to miniSingleton."`
-	License   string            `json:"license,omitempty" jsonschema:"License option: enterprise, enterprise-advanced, professional, e20, e10, or te. Defaults to enterprise."`
-	Affinity  string            `json:"affinity,omitempty" jsonschema:"Cluster affinity, isolated or multitenant. Defaults to multitenant."`
-	Database  string            `json:"database,omitempty" jsonschema:"Database backend. Defaults to plugin configuration."`
-	Filestore string            `json:"filestore,omitempty" jsonschema:"Filestore backend. Defaults to plugin configuration."`
-	Image     string            `json:"image,omitempty" jsonschema:"Docker image repository from the configured allowlist."`
-	TestData  bool              `json:"test_data,omitempty" jsonschema:"Whether to pre-load test data."`
-	Env       map[string]string `json:"env,omitempty" jsonschema:"Priority environment variables to set during creation. Values are never returned."`
+	Name            string            `json:"name" jsonschema:"Required installation name."`
+	Version         string            `json:"version,omitempty" jsonschema:"Mattermost version: a tag such as 9.11.0, a release line such as 9.11.x, latest, latest-esr, latest-rc, master, or pr-12345. Defaults to latest."`
+	Size            string            `json:"size,omitempty" jsonschema:"Installation size. Defaults to the first configured size."`
+	License         string            `json:"license,omitempty" jsonschema:"License option: enterprise, enterprise-advanced, professional, e20, e10, or te. Defaults to enterprise."`
+	Affinity        string            `json:"affinity,omitempty" jsonschema:"Cluster affinity, isolated or multitenant. Defaults to multitenant."`
+	Database        string            `json:"database,omitempty" jsonschema:"Database backend. Defaults to plugin configuration."`
+	Filestore       string            `json:"filestore,omitempty" jsonschema:"Filestore backend. Defaults to plugin configuration."`
+	Image           string            `json:"image,omitempty" jsonschema:"Docker image repository from the configured allowlist."`
+	TestData        *bool             `json:"test_data,omitempty" jsonschema:"Whether to pre-load test data. Set to false to decline the test data of a preset."`
+	TestDataProfile string            `json:"test_data_profile,omitempty" jsonschema:"Test data profile to pre-load. Implies test_data."`
+	TestDataCounts  map[string]int    `json:"test_data_counts,omitempty" jsonschema:"Test data counts replacing those of the profile, keyed by teams, channels, users, posts, or threads. Implies test_data."`
+	Plugins         []string          `json:"plugins,omitempty" jsonschema:"Marketplace plugin IDs to install and enable, optionally followed by @ and a version such as com.mattermost.plugin-jira@4.1.0."`
+	Users           []string          `json:"users,omitempty" jsonschema:"Extra users to create during setup in form username:role or username:role:team1+team2. Role is system_admin, user_manager, user, guest, or bot. Guests require a license other than te. Their passwords or bot access tokens are sent to the owner."`
+	Config          map[string]string `json:"config,omitempty" jsonschema:"Mattermost config settings to apply during setup, keyed by Section.Setting such as ServiceSettings.EnableDeveloper. Lists are comma-separated."`
+	Env             map[string]string `json:"env,omitempty" jsonschema:"Priority environment variables to set during creation. Values are never returned."`
+	Preset          string            `json:"preset,omitempty" jsonschema:"Name of a saved create preset. Options set explicitly take precedence over the preset."`
+	TTL             string            `json:"ttl,omitempty" jsonschema:"Time until the installation is automatically deleted, such as 48h or 7d. Capped by the configured maximum. Defaults to plugin configuration."`
+	DryRun          bool              `json:"dry_run,omitempty" jsonschema:"When true, validate the options and return the masked provisioner request without creating the installation."`
+}
+
+type CreateInstallationMatrixMCPInput struct {
+	Prefix          string            `json:"prefix" jsonschema:"Required installation name prefix. Each installation is named prefix-version, for example prefix-9-11-0."`
+	Versions        []string          `json:"versions" jsonschema:"Required Mattermost versions, one installation per version. Release lines such as 9.11.x and channels such as latest resolve to a tag."`
+	Size            string            `json:"size,omitempty" jsonschema:"Installation size. Defaults to the first configured size."`
+	License         string            `json:"license,omitempty" jsonschema:"License option: enterprise, enterprise-advanced, professional, e20, e10, or te. Defaults to enterprise."`
+	Affinity        string            `json:"affinity,omitempty" jsonschema:"Cluster affinity, isolated or multitenant. Defaults to multitenant."`
+	Database        string            `json:"database,omitempty" jsonschema:"Database backend. Defaults to plugin configuration."`
+	Filestore       string            `json:"filestore,omitempty" jsonschema:"Filestore backend. Defaults to plugin configuration."`
+	Image           string            `json:"image,omitempty" jsonschema:"Docker image repository from the configured allowlist."`
+	TestData        *bool             `json:"test_data,omitempty" jsonschema:"Whether to pre-load test data. Set to false to decline the test data of a preset."`
+	TestDataProfile string            `json:"test_data_profile,omitempty" jsonschema:"Test data profile to pre-load. Implies test_data."`
+	TestDataCounts  map[string]int    `json:"test_data_counts,omitempty" jsonschema:"Test data counts replacing those of the profile, keyed by teams, channels, users, posts, or threads. Implies test_data."`
+	Plugins         []string          `json:"plugins,omitempty" jsonschema:"Marketplace plugin IDs to install and enable, optionally followed by @ and a version such as com.mattermost.plugin-jira@4.1.0."`
+	Users           []string          `json:"users,omitempty" jsonschema:"Extra users to create during setup in form username:role or username:role:team1+team2. Role is system_admin, user_manager, user, guest, or bot. Guests require a license other than te. Their passwords or bot access tokens are sent to the owner."`
+	Config          map[string]string `json:"config,omitempty" jsonschema:"Mattermost config settings to apply during setup, keyed by Section.Setting such as ServiceSettings.EnableDeveloper. Lists are comma-separated."`
+	Env             map[string]string `json:"env,omitempty" jsonschema:"Priority environment variables to set during creation. Values are never returned."`
+	Preset          string            `json:"preset,omitempty" jsonschema:"Name of a saved create preset. Options set explicitly take precedence over the preset."`
+	TTL             string            `json:"ttl,omitempty" jsonschema:"Time until each installation is automatically deleted, such as 48h or 7d. Capped by the configured maximum. Defaults to plugin configuration."`
+}
+
+type CreateInstallationMatrixMCPOutput struct {
+	Results []InstallationMatrixResult `json:"results" jsonschema:"Creation result of each installation in the matrix"`
+	Count   int                        `json:"count" jsonschema:"Number of installations in the matrix"`
 }
 
 type UpdateInstallationMCPInput struct {
 	InstallationID string            `json:"installation_id,omitempty" jsonschema:"Stable installation ID. Provide exactly one of installation_id or name."`
 	Name           string            `json:"name,omitempty" jsonschema:"Human-friendly installation name. Provide exactly one of installation_id or name."`
 	Scope          string            `json:"scope,omitempty" jsonschema:"Update scope: mine or updatable. Defaults to mine."`
-	Version        string            `json:"version,omitempty" jsonschema:"Mattermost version tag."`
+	Version        string            `json:"version,omitempty" jsonschema:"Mattermost version: a tag such as 9.11.0, a release line such as 9.11.x, latest, latest-esr, latest-rc, master, or pr-12345."`
 	Image          string            `json:"image,omitempty" jsonschema:"Docker image repository from the configured allowlist."`
 	License        string            `json:"license,omitempty" jsonschema:"License option: enterprise, enterprise-advanced, professional, e20, e10, or te."`
-	Size           string            `json:"size,omitempty" jsonschema:"Installation size, such as miniSingleton or miniHA."`
+	Size           string            `json:"size,omitempty" jsonschema:"Installation size."`
 	SetEnv         map[string]string `json:"set_env,omitempty" jsonschema:"Environment variables to set. Values are never returned."`
 	ClearEnv       []string          `json:"clear_env,omitempty" jsonschema:"Environment variable keys to clear."`
+	DryRun         bool              `json:"dry_run,omitempty" jsonschema:"When true, validate the options and return the masked provisioner request without updating the installation."`
 }
 
 type RestartInstallationMCPInput struct {
@@ -89,15 +126,22 @@ type DeleteInstallationMCPInput struct {
 	ConfirmName    string `json:"confirm_name" jsonschema:"Required installation name confirmation. Must match the target installation name."`
 }
 
+type GetInstallationHistoryMCPOutput struct {
+	Installation InstallationSummary        `json:"installation" jsonschema:"Installation the history belongs to"`
+	Events       []InstallationHistoryEvent `json:"events" jsonschema:"Recorded plugin actions and provisioner state changes, oldest first"`
+	Count        int                        `json:"count" jsonschema:"Number of events returned"`
+}
+
 type CloudStatusMCPInput struct {
 	IncludeClusters bool `json:"include_clusters,omitempty" jsonschema:"When true, include cluster status summaries. Defaults to false."`
 }
 
 type CloudStatusMCPOutput struct {
-	Installations     []CloudStatusInstallationSummary `json:"installations" jsonschema:"Global Cloud installation summaries"`
-	InstallationCount int                              `json:"installation_count" jsonschema:"Number of installations returned"`
-	Clusters          []CloudStatusClusterSummary      `json:"clusters,omitempty" jsonschema:"Global Cloud cluster summaries"`
-	ClusterCount      int                              `json:"cluster_count,omitempty" jsonschema:"Number of clusters returned"`
+	Installations      []CloudStatusInstallationSummary `json:"installations" jsonschema:"Global Cloud installation summaries"`
+	InstallationCount  int                              `json:"installation_count" jsonschema:"Number of installations returned"`
+	Clusters           []CloudStatusClusterSummary      `json:"clusters,omitempty" jsonschema:"Global Cloud cluster summaries"`
+	ClusterCount       int                              `json:"cluster_count,omitempty" jsonschema:"Number of clusters returned"`
+	RegistryRateLimits []RegistryRateLimit              `json:"registry_rate_limits,omitempty" jsonschema:"Pull rate limits last reported by the docker registries"`
 }
 
 type CloudStatusInstallationSummary struct {
@@ -130,11 +174,25 @@ type CloudStatusClusterSummary struct {
 	APISecurityLock    bool   `json:"api_security_lock"`
 }
 
+type ListVersionsMCPInput struct {
+	Image  string `json:"image,omitempty" jsonschema:"Docker image repository from the configured allowlist. Defaults to mattermost/mattermost-enterprise-edition."`
+	Filter string `json:"filter,omitempty" jsonschema:"Only return tags starting with this prefix, such as 10. or pr-."`
+	Limit  int    `json:"limit,omitempty" jsonschema:"Maximum number of tags to return. Defaults to 50, up to 500."`
+}
+
+type ListVersionsMCPOutput struct {
+	Image string   `json:"image" jsonschema:"Docker image repository the tags belong to"`
+	Tags  []string `json:"tags" jsonschema:"Matching tags, release versions first from newest to oldest, then other tags alphabetically"`
+	Count int      `json:"count" jsonschema:"Number of tags returned"`
+	Total int      `json:"total" jsonschema:"Number of tags matching the filter"`
+}
+
 type InstallationActionMCPOutput struct {
 	Result InstallationActionResult `json:"result" jsonschema:"Lifecycle action result"`
 }
 
 func (p *Plugin) registerMCPTools(server *pluginmcp.Server) {
+	config := p.getConfiguration()
 	readOnly := true
 	notReadOnly := false
 	notDestructive := false
@@ -165,10 +223,23 @@ func (p *Plugin) registerMCPTools(server *pluginmcp.Server) {
 		},
 	}, p.getInstallationMCPHandler)
 
+	pluginmcp.AddTool(server, &mcp.Tool{
+		Name:        "get_installation_history",
+		Title:       "Get Cloud Installation History",
+		Description: "Get the timeline of plugin actions and provisioner state changes for an owned or shared Cloud installation by ID or name.",
+		Annotations: &mcp.ToolAnnotations{
+			ReadOnlyHint:    readOnly,
+			DestructiveHint: &notDestructive,
+			OpenWorldHint:   &closedWorld,
+			Title:           "Get Cloud Installation History",
+		},
+	}, p.getInstallationHistoryMCPHandler)
+
 	pluginmcp.AddTool(server, &mcp.Tool{
 		Name:        "create_installation",
 		Title:       "Create Cloud Installation",
-		Description: "Create a new Cloud-managed Mattermost installation owned by the calling user.",
+		Description: "Create a new Cloud-managed Mattermost installation owned by the calling user. Set dry_run to preview the provisioner request first.",
+		InputSchema: configuredOptionsInputSchema[CreateInstallationMCPInput](config),
 		Annotations: &mcp.ToolAnnotations{
 			ReadOnlyHint:    notReadOnly,
 			DestructiveHint: &notDestructive,
@@ -177,10 +248,24 @@ func (p *Plugin) registerMCPTools(server *pluginmcp.Server) {
 		},
 	}, p.createInstallationMCPHandler)
 
+	pluginmcp.AddTool(server, &mcp.Tool{
+		Name:        "create_installation_matrix",
+		Title:       "Create Cloud Installation Matrix",
+		Description: "Create one Cloud-managed Mattermost installation per version with the same options, owned by the calling user. Every version is validated before any installation is created, and the installations already created are deleted if one fails to be created.",
+		InputSchema: configuredOptionsInputSchema[CreateInstallationMatrixMCPInput](config),
+		Annotations: &mcp.ToolAnnotations{
+			ReadOnlyHint:    notReadOnly,
+			DestructiveHint: &notDestructive,
+			OpenWorldHint:   &closedWorld,
+			Title:           "Create Cloud Installation Matrix",
+		},
+	}, p.createInstallationMatrixMCPHandler)
+
 	pluginmcp.AddTool(server, &mcp.Tool{
 		Name:        "update_installation",
 		Title:       "Update Cloud Installation",
-		Description: "Update an owned Cloud installation or an explicitly updatable shared installation.",
+		Description: "Update an owned Cloud installation or an explicitly updatable shared installation. Set dry_run to preview the provisioner request first.",
+		InputSchema: configuredOptionsInputSchema[UpdateInstallationMCPInput](config),
 		Annotations: &mcp.ToolAnnotations{
 			ReadOnlyHint:    notReadOnly,
 			DestructiveHint: &notDestructive,
@@ -261,6 +346,18 @@ func (p *Plugin) registerMCPTools(server *pluginmcp.Server) {
 		},
 	}, p.deleteInstallationMCPHandler)
 
+	pluginmcp.AddTool(server, &mcp.Tool{
+		Name:        "restore_installation",
+		Title:       "Restore Cloud Installation",
+		Description: "Cancel the pending deletion of an owned Cloud installation and restore it under its original name.",
+		Annotations: &mcp.ToolAnnotations{
+			ReadOnlyHint:    notReadOnly,
+			DestructiveHint: &notDestructive,
+			OpenWorldHint:   &closedWorld,
+			Title:           "Restore Cloud Installation",
+		},
+	}, p.restoreInstallationMCPHandler)
+
 	pluginmcp.AddTool(server, &mcp.Tool{
 		Name:        "cloud_status",
 		Title:       "Get Cloud Status",
@@ -272,6 +369,41 @@ func (p *Plugin) registerMCPTools(server *pluginmcp.Server) {
 			Title:           "Get Cloud Status",
 		},
 	}, p.cloudStatusMCPHandler)
+
+	pluginmcp.AddTool(server, &mcp.Tool{
+		Name:        "list_versions",
+		Title:       "List Mattermost Versions",
+		Description: "List the tags of an allowlisted docker image repository to find valid versions for create_installation and update_installation. Those tools also accept latest, latest-esr, latest-rc, release lines such as 10.5.x, master, and pr-12345.",
+		InputSchema: configuredOptionsInputSchema[ListVersionsMCPInput](config),
+		Annotations: &mcp.ToolAnnotations{
+			ReadOnlyHint:    readOnly,
+			DestructiveHint: &notDestructive,
+			OpenWorldHint:   &closedWorld,
+			Title:           "List Mattermost Versions",
+		},
+	}, p.listVersionsMCPHandler)
+}
+
+// configuredOptionsInputSchema returns the input schema of a tool input type
+// with the size and image descriptions listing the configured options. It
+// returns nil, letting the schema be inferred, when the type has no schema.
+func configuredOptionsInputSchema[T any](config *configuration) any {
+	schema, err := jsonschema.For[T](nil)
+	if err != nil {
+		return nil
+	}
+
+	if property, ok := schema.Properties["size"]; ok {
+		property.Description += fmt.Sprintf(" One of: %s.", strings.Join(config.installationSizes(), ", "))
+	}
+	if property, ok := schema.Properties["image"]; ok {
+		property.Description += fmt.Sprintf(" One of: %s.", strings.Join(config.allowedImages(), ", "))
+	}
+	if property, ok := schema.Properties["test_data_profile"]; ok {
+		property.Description += fmt.Sprintf(" One of: %s. Defaults to %s.", strings.Join(config.testDataProfileNames(), ", "), config.testDataProfiles()[0].Name)
+	}
+
+	return schema
 }
 
 func (p *Plugin) listInstallationsMCPHandler(ctx context.Context, _ *mcp.CallToolRequest, input ListInstallationsMCPInput) (*mcp.CallToolResult, ListInstallationsMCPOutput, error) {
@@ -310,6 +442,28 @@ func (p *Plugin) listInstallationsMCPHandler(ctx context.Context, _ *mcp.CallToo
 	return nil, output, nil
 }
 
+func (p *Plugin) listVersionsMCPHandler(ctx context.Context, _ *mcp.CallToolRequest, input ListVersionsMCPInput) (*mcp.CallToolResult, ListVersionsMCPOutput, error) {
+	if _, err := p.requireMCPUser(ctx); err != nil {
+		return nil, ListVersionsMCPOutput{}, err
+	}
+
+	list, err := p.listVersions(ListVersionsInput{
+		Image:  input.Image,
+		Filter: input.Filter,
+		Limit:  input.Limit,
+	})
+	if err != nil {
+		return nil, ListVersionsMCPOutput{}, err
+	}
+
+	return nil, ListVersionsMCPOutput{
+		Image: list.Image,
+		Tags:  list.Tags,
+		Count: len(list.Tags),
+		Total: list.Total,
+	}, nil
+}
+
 func (p *Plugin) getInstallationMCPHandler(ctx context.Context, _ *mcp.CallToolRequest, input GetInstallationMCPInput) (*mcp.CallToolResult, GetInstallationMCPOutput, error) {
 	userID, err := p.requireMCPUser(ctx)
 	if err != nil {
@@ -348,6 +502,34 @@ func (p *Plugin) getInstallationMCPHandler(ctx context.Context, _ *mcp.CallToolR
 	return nil, GetInstallationMCPOutput{Installation: summary}, nil
 }
 
+func (p *Plugin) getInstallationHistoryMCPHandler(ctx context.Context, _ *mcp.CallToolRequest, input InstallationRefMCPInput) (*mcp.CallToolResult, GetInstallationHistoryMCPOutput, error) {
+	userID, err := p.requireMCPUser(ctx)
+	if err != nil {
+		return nil, GetInstallationHistoryMCPOutput{}, err
+	}
+
+	ref, err := requireMCPRef(input.InstallationID, input.Name)
+	if err != nil {
+		return nil, GetInstallationHistoryMCPOutput{}, err
+	}
+
+	install, events, err := p.getInstallationHistoryForUser(userID, ref)
+	if err != nil {
+		return nil, GetInstallationHistoryMCPOutput{}, err
+	}
+
+	summary, err := installationSummary(install, false)
+	if err != nil {
+		return nil, GetInstallationHistoryMCPOutput{}, err
+	}
+
+	return nil, GetInstallationHistoryMCPOutput{
+		Installation: summary,
+		Events:       events,
+		Count:        len(events),
+	}, nil
+}
+
 func (p *Plugin) createInstallationMCPHandler(ctx context.Context, _ *mcp.CallToolRequest, input CreateInstallationMCPInput) (*mcp.CallToolResult, InstallationActionMCPOutput, error) {
 	userID, err := p.requireMCPUser(ctx)
 	if err != nil {
@@ -358,7 +540,19 @@ func (p *Plugin) createInstallationMCPHandler(ctx context.Context, _ *mcp.CallTo
 	defer p.API.LogAuditRec(auditRec)
 	addMCPCreateInstallationAuditParams(auditRec, input)
 
-	install, err := p.createInstallationForUser(userID, CreateInstallationInput(input))
+	if input.DryRun {
+		result, previewErr := p.previewCreateInstallationForUser(userID, createInstallationInputFromMCP(input))
+		if previewErr != nil {
+			auditRec.AddErrorDesc(previewErr.Error())
+			return nil, InstallationActionMCPOutput{}, previewErr
+		}
+		addMCPInstallationActionResultAuditParams(auditRec, result)
+		auditRec.Success()
+
+		return nil, mcpActionOutput(result), nil
+	}
+
+	install, err := p.createInstallationForUser(userID, createInstallationInputFromMCP(input))
 	if err != nil {
 		auditRec.AddErrorDesc(err.Error())
 		return nil, InstallationActionMCPOutput{}, err
@@ -373,7 +567,7 @@ func (p *Plugin) createInstallationMCPHandler(ctx context.Context, _ *mcp.CallTo
 	result := InstallationActionResult{
 		Installation: summary,
 		Status:       "creation_requested",
-		Message:      "Installation creation requested. Use get_installation to poll status.",
+		Message:      "Installation creation requested. " + describeVersionResolution(install.versionSpec, install.Tag, install.Version) + " Use get_installation to poll status.",
 	}
 	addMCPInstallationActionResultAuditParams(auditRec, result)
 	auditRec.Success()
@@ -381,6 +575,57 @@ func (p *Plugin) createInstallationMCPHandler(ctx context.Context, _ *mcp.CallTo
 	return nil, mcpActionOutput(result), nil
 }
 
+func (p *Plugin) createInstallationMatrixMCPHandler(ctx context.Context, _ *mcp.CallToolRequest, input CreateInstallationMatrixMCPInput) (*mcp.CallToolResult, CreateInstallationMatrixMCPOutput, error) {
+	userID, err := p.requireMCPUser(ctx)
+	if err != nil {
+		return nil, CreateInstallationMatrixMCPOutput{}, err
+	}
+
+	auditRec := p.newMCPAuditRecord("mcpCreateInstallationMatrix", userID)
+	defer p.API.LogAuditRec(auditRec)
+	model.AddEventParameterToAuditRec(auditRec, "prefix", input.Prefix)
+	model.AddEventParameterToAuditRec(auditRec, "versions", input.Versions)
+	options := CreateInstallationInput{
+		Size:            input.Size,
+		License:         input.License,
+		Affinity:        input.Affinity,
+		Database:        input.Database,
+		Filestore:       input.Filestore,
+		Image:           input.Image,
+		TestData:        input.TestData,
+		TestDataProfile: input.TestDataProfile,
+		TestDataCounts:  input.TestDataCounts,
+		Plugins:         input.Plugins,
+		Users:           input.Users,
+		Config:          input.Config,
+		Env:             input.Env,
+		Preset:          input.Preset,
+		TTL:             input.TTL,
+	}
+	addMCPCreateOptionsAuditParams(auditRec, options)
+
+	results, err := p.createInstallationMatrixForUser(userID, CreateInstallationMatrixInput{
+		Prefix:   input.Prefix,
+		Versions: input.Versions,
+		Options:  options,
+	})
+	if err != nil {
+		auditRec.AddErrorDesc(err.Error())
+		return nil, CreateInstallationMatrixMCPOutput{}, err
+	}
+
+	createdIDs := []string{}
+	for _, result := range results {
+		if result.Installation != nil {
+			createdIDs = append(createdIDs, result.Installation.ID)
+		}
+	}
+	model.AddEventParameterToAuditRec(auditRec, "installation_ids", createdIDs)
+	auditRec.Success()
+
+	return nil, CreateInstallationMatrixMCPOutput{Results: results, Count: len(results)}, nil
+}
+
 func (p *Plugin) updateInstallationMCPHandler(ctx context.Context, _ *mcp.CallToolRequest, input UpdateInstallationMCPInput) (*mcp.CallToolResult, InstallationActionMCPOutput, error) {
 	userID, err := p.requireMCPUser(ctx)
 	if err != nil {
@@ -401,14 +646,21 @@ func (p *Plugin) updateInstallationMCPHandler(ctx context.Context, _ *mcp.CallTo
 	addMCPInstallationRefAuditParams(auditRec, ref)
 	addMCPUpdateInstallationAuditParams(auditRec, input, scope)
 
-	result, err := p.updateInstallationForUser(userID, ref, UpdateInstallationInput{
+	updateInput := UpdateInstallationInput{
 		Version:  input.Version,
 		License:  input.License,
 		Size:     input.Size,
 		Image:    input.Image,
 		SetEnv:   input.SetEnv,
 		ClearEnv: input.ClearEnv,
-	}, scope)
+	}
+
+	var result InstallationActionResult
+	if input.DryRun {
+		result, err = p.previewUpdateInstallationForUser(userID, ref, updateInput, scope)
+	} else {
+		result, err = p.updateInstallationForUser(userID, ref, updateInput, scope)
+	}
 	if err != nil {
 		auditRec.AddErrorDesc(err.Error())
 		return nil, InstallationActionMCPOutput{}, err
@@ -594,6 +846,33 @@ func (p *Plugin) deleteInstallationMCPHandler(ctx context.Context, _ *mcp.CallTo
 	return nil, mcpActionOutput(result), nil
 }
 
+func (p *Plugin) restoreInstallationMCPHandler(ctx context.Context, _ *mcp.CallToolRequest, input InstallationRefMCPInput) (*mcp.CallToolResult, InstallationActionMCPOutput, error) {
+	userID, err := p.requireMCPUser(ctx)
+	if err != nil {
+		return nil, InstallationActionMCPOutput{}, err
+	}
+
+	ref, err := requireMCPRef(input.InstallationID, input.Name)
+	if err != nil {
+		return nil, InstallationActionMCPOutput{}, err
+	}
+
+	auditRec := p.newMCPAuditRecord("mcpRestoreInstallation", userID)
+	defer p.API.LogAuditRec(auditRec)
+	addMCPInstallationRefAuditParams(auditRec, ref)
+
+	result, err := p.restoreInstallationForUser(userID, ref)
+	if err != nil {
+		auditRec.AddErrorDesc(err.Error())
+		return nil, InstallationActionMCPOutput{}, err
+	}
+
+	addMCPInstallationActionResultAuditParams(auditRec, result)
+	auditRec.Success()
+
+	return nil, mcpActionOutput(result), nil
+}
+
 func (p *Plugin) cloudStatusMCPHandler(ctx context.Context, _ *mcp.CallToolRequest, input CloudStatusMCPInput) (*mcp.CallToolResult, CloudStatusMCPOutput, error) {
 	if _, err := p.requireAdminMCPUser(ctx); err != nil {
 		return nil, CloudStatusMCPOutput{}, err
@@ -607,7 +886,8 @@ func (p *Plugin) cloudStatusMCPHandler(ctx context.Context, _ *mcp.CallToolReque
 	}
 
 	output := CloudStatusMCPOutput{
-		Installations: make([]CloudStatusInstallationSummary, 0, len(installations)),
+		Installations:      make([]CloudStatusInstallationSummary, 0, len(installations)),
+		RegistryRateLimits: p.registryRateLimits(),
 	}
 	for _, installation := range installations {
 		output.Installations = append(output.Installations, cloudStatusInstallationSummary(installation))
@@ -772,8 +1052,37 @@ func addMCPInstallationRefAuditParams(rec *model.AuditRecord, ref InstallationRe
 	}
 }
 
+func createInstallationInputFromMCP(input CreateInstallationMCPInput) CreateInstallationInput {
+	return CreateInstallationInput{
+		Name:            input.Name,
+		Version:         input.Version,
+		Size:            input.Size,
+		License:         input.License,
+		Affinity:        input.Affinity,
+		Database:        input.Database,
+		Filestore:       input.Filestore,
+		Image:           input.Image,
+		TestData:        input.TestData,
+		TestDataProfile: input.TestDataProfile,
+		TestDataCounts:  input.TestDataCounts,
+		Plugins:         input.Plugins,
+		Users:           input.Users,
+		Config:          input.Config,
+		Env:             input.Env,
+		Preset:          input.Preset,
+		TTL:             input.TTL,
+	}
+}
+
 func addMCPCreateInstallationAuditParams(rec *model.AuditRecord, input CreateInstallationMCPInput) {
 	model.AddEventParameterToAuditRec(rec, "name", input.Name)
+	addMCPCreateOptionsAuditParams(rec, createInstallationInputFromMCP(input))
+	if input.DryRun {
+		model.AddEventParameterToAuditRec(rec, "dry_run", input.DryRun)
+	}
+}
+
+func addMCPCreateOptionsAuditParams(rec *model.AuditRecord, input CreateInstallationInput) {
 	if input.Version != "" {
 		model.AddEventParameterToAuditRec(rec, "version", input.Version)
 	}
@@ -795,12 +1104,33 @@ func addMCPCreateInstallationAuditParams(rec *model.AuditRecord, input CreateIns
 	if input.Image != "" {
 		model.AddEventParameterToAuditRec(rec, "image", input.Image)
 	}
-	if input.TestData {
-		model.AddEventParameterToAuditRec(rec, "test_data", input.TestData)
+	if input.TestData != nil {
+		model.AddEventParameterToAuditRec(rec, "test_data", *input.TestData)
+	}
+	if input.TestDataProfile != "" {
+		model.AddEventParameterToAuditRec(rec, "test_data_profile", input.TestDataProfile)
+	}
+	if len(input.TestDataCounts) > 0 {
+		model.AddEventParameterToAuditRec(rec, "test_data_counts", input.TestDataCounts)
+	}
+	if len(input.Plugins) > 0 {
+		model.AddEventParameterToAuditRec(rec, "plugins", input.Plugins)
+	}
+	if len(input.Users) > 0 {
+		model.AddEventParameterToAuditRec(rec, "users", input.Users)
+	}
+	if len(input.Config) > 0 {
+		model.AddEventParameterToAuditRec(rec, "config_keys", sortedStringMapKeys(input.Config))
 	}
 	if len(input.Env) > 0 {
 		model.AddEventParameterToAuditRec(rec, "env_keys", sortedStringMapKeys(input.Env))
 	}
+	if input.Preset != "" {
+		model.AddEventParameterToAuditRec(rec, "preset", input.Preset)
+	}
+	if input.TTL != "" {
+		model.AddEventParameterToAuditRec(rec, "ttl", input.TTL)
+	}
 }
 
 func addMCPUpdateInstallationAuditParams(rec *model.AuditRecord, input UpdateInstallationMCPInput, scope InstallationScope) {
@@ -823,6 +1153,9 @@ func addMCPUpdateInstallationAuditParams(rec *model.AuditRecord, input UpdateIns
 	if len(input.ClearEnv) > 0 {
 		model.AddEventParameterToAuditRec(rec, "clear_env_keys", append([]string{}, input.ClearEnv...))
 	}
+	if input.DryRun {
+		model.AddEventParameterToAuditRec(rec, "dry_run", input.DryRun)
+	}
 }
 
 func addMCPInstallationActionResultAuditParams(rec *model.AuditRecord, result InstallationActionResult) {
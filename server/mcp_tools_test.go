@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -20,7 +21,9 @@ import (
 const (
 	mcpListInstallationsToolName      = "com_mattermost_cloud__list_installations"
 	mcpGetInstallationToolName        = "com_mattermost_cloud__get_installation"
+	mcpGetInstallationHistoryToolName = "com_mattermost_cloud__get_installation_history"
 	mcpCreateInstallationToolName     = "com_mattermost_cloud__create_installation"
+	mcpCreateMatrixToolName           = "com_mattermost_cloud__create_installation_matrix"
 	mcpUpdateInstallationToolName     = "com_mattermost_cloud__update_installation"
 	mcpRestartInstallationToolName    = "com_mattermost_cloud__restart_installation"
 	mcpHibernateInstallationToolName  = "com_mattermost_cloud__hibernate_installation"
@@ -28,7 +31,9 @@ const (
 	mcpSetInstallationSharingToolName = "com_mattermost_cloud__set_installation_sharing"
 	mcpSetDeletionLockToolName        = "com_mattermost_cloud__set_deletion_lock"
 	mcpDeleteInstallationToolName     = "com_mattermost_cloud__delete_installation"
+	mcpRestoreInstallationToolName    = "com_mattermost_cloud__restore_installation"
 	mcpCloudStatusToolName            = "com_mattermost_cloud__cloud_status"
+	mcpListVersionsToolName           = "com_mattermost_cloud__list_versions"
 )
 
 func TestMCPToolsRegistration(t *testing.T) {
@@ -38,7 +43,7 @@ func TestMCPToolsRegistration(t *testing.T) {
 
 	result, err := session.ListTools(context.Background(), &mcp.ListToolsParams{})
 	require.NoError(t, err)
-	require.Len(t, result.Tools, 11)
+	require.Len(t, result.Tools, 15)
 
 	tools := map[string]*mcp.Tool{}
 	for _, tool := range result.Tools {
@@ -67,15 +72,33 @@ func TestMCPToolsRegistration(t *testing.T) {
 	assert.False(t, *getTool.Annotations.OpenWorldHint)
 	assertMCPInputSchemaProperties(t, getTool, "installation_id", "name", "scope", "refresh", "include_log_urls")
 
+	historyTool := tools[mcpGetInstallationHistoryToolName]
+	require.NotNil(t, historyTool)
+	assert.Equal(t, "Get Cloud Installation History", historyTool.Title)
+	require.NotNil(t, historyTool.Annotations)
+	assert.True(t, historyTool.Annotations.ReadOnlyHint)
+	require.NotNil(t, historyTool.Annotations.DestructiveHint)
+	assert.False(t, *historyTool.Annotations.DestructiveHint)
+	assertMCPInputSchemaProperties(t, historyTool, "installation_id", "name")
+
+	versionsTool := tools[mcpListVersionsToolName]
+	require.NotNil(t, versionsTool)
+	assert.Equal(t, "List Mattermost Versions", versionsTool.Title)
+	require.NotNil(t, versionsTool.Annotations)
+	assert.True(t, versionsTool.Annotations.ReadOnlyHint)
+	assertMCPInputSchemaProperties(t, versionsTool, "image", "filter", "limit")
+
 	lifecycleTools := map[string][]string{
-		mcpCreateInstallationToolName:     {"name", "version", "size", "license", "affinity", "database", "filestore", "image", "test_data", "env"},
-		mcpUpdateInstallationToolName:     {"installation_id", "name", "scope", "version", "image", "license", "size", "set_env", "clear_env"},
+		mcpCreateInstallationToolName:     {"name", "version", "size", "license", "affinity", "database", "filestore", "image", "test_data", "env", "preset", "ttl", "dry_run"},
+		mcpCreateMatrixToolName:           {"prefix", "versions", "size", "license", "affinity", "database", "filestore", "image", "test_data", "env", "preset", "ttl"},
+		mcpUpdateInstallationToolName:     {"installation_id", "name", "scope", "version", "image", "license", "size", "set_env", "clear_env", "dry_run"},
 		mcpRestartInstallationToolName:    {"installation_id", "name", "scope"},
 		mcpHibernateInstallationToolName:  {"installation_id", "name"},
 		mcpWakeInstallationToolName:       {"installation_id", "name"},
 		mcpSetInstallationSharingToolName: {"installation_id", "name", "shared", "allow_updates"},
 		mcpSetDeletionLockToolName:        {"installation_id", "name", "locked"},
 		mcpDeleteInstallationToolName:     {"installation_id", "name", "confirm_name"},
+		mcpRestoreInstallationToolName:    {"installation_id", "name"},
 	}
 	for toolName, schemaProperties := range lifecycleTools {
 		tool := tools[toolName]
@@ -90,6 +113,12 @@ func TestMCPToolsRegistration(t *testing.T) {
 	}
 
 	assertMCPInputSchemaRequired(t, tools[mcpDeleteInstallationToolName], "confirm_name")
+
+	for _, toolName := range []string{mcpCreateInstallationToolName, mcpCreateMatrixToolName, mcpUpdateInstallationToolName} {
+		assert.Contains(t, mcpInputSchemaDescription(t, tools[toolName], "size"), "One of: miniSingleton, miniHA.", toolName)
+		assert.Contains(t, mcpInputSchemaDescription(t, tools[toolName], "image"), "One of: "+strings.Join(defaultAllowedImages, ", ")+".", toolName)
+	}
+	assert.Contains(t, mcpInputSchemaDescription(t, versionsTool, "image"), "One of: "+strings.Join(defaultAllowedImages, ", ")+".")
 }
 
 func TestListInstallationsMCP(t *testing.T) {
@@ -198,6 +227,7 @@ func TestListInstallationsMCP(t *testing.T) {
 		assert.NotEmpty(t, output.Installations[0].InstallationLogsURL)
 		assert.NotEmpty(t, output.Installations[0].ProvisionerLogsURL)
 		api.AssertNotCalled(t, "KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything)
+		api.AssertNotCalled(t, "KVCompareAndDelete", mock.AnythingOfType("string"), mock.Anything)
 	})
 }
 
@@ -315,6 +345,7 @@ func TestGetInstallationMCP(t *testing.T) {
 		assert.NotEmpty(t, output.Installation.InstallationLogsURL)
 		assert.NotEmpty(t, output.Installation.ProvisionerLogsURL)
 		api.AssertNotCalled(t, "KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything)
+		api.AssertNotCalled(t, "KVCompareAndDelete", mock.AnythingOfType("string"), mock.Anything)
 	})
 
 	t.Run("redacts sensitive output", func(t *testing.T) {
@@ -333,14 +364,56 @@ func TestGetInstallationMCP(t *testing.T) {
 	})
 }
 
+func TestGetInstallationHistoryMCP(t *testing.T) {
+	owned := serviceTestInstall("owned-id", "Owned", "owner")
+	sharedRead := serviceTestInstall("shared-read-id", "SharedRead", "other")
+	sharedRead.Shared = true
+	privateOther := serviceTestInstall("private-other-id", "PrivateOther", "other")
+
+	plugin, _, _ := newMCPToolsTestPlugin(t, []*Installation{owned, sharedRead, privateOther})
+	require.NoError(t, plugin.appendInstallationHistory("owned-id", InstallationHistoryEvent{Type: historyEventTypeAction, Action: historyActionCreate, ActorID: "owner"}))
+	require.NoError(t, plugin.appendInstallationHistory("owned-id", InstallationHistoryEvent{Type: historyEventTypeStateChange, OldState: cloud.InstallationStateCreationRequested, NewState: cloud.InstallationStateStable}))
+
+	session, cleanup := connectMCPToolsClient(t, plugin, "owner")
+	defer cleanup()
+
+	result, err := callMCPTool(t, session, mcpGetInstallationHistoryToolName, map[string]any{"name": "owned"})
+	require.NoError(t, err)
+	require.False(t, result.IsError)
+	output := decodeMCPStructuredOutput[GetInstallationHistoryMCPOutput](t, result)
+	assert.Equal(t, "owned-id", output.Installation.ID)
+	require.Equal(t, 2, output.Count)
+	assert.Equal(t, historyActionCreate, output.Events[0].Action)
+	assert.Equal(t, "owner", output.Events[0].ActorID)
+	assert.Equal(t, cloud.InstallationStateStable, output.Events[1].NewState)
+
+	result, err = callMCPTool(t, session, mcpGetInstallationHistoryToolName, map[string]any{"installation_id": "shared-read-id"})
+	require.NoError(t, err)
+	require.False(t, result.IsError)
+	output = decodeMCPStructuredOutput[GetInstallationHistoryMCPOutput](t, result)
+	assert.Equal(t, 0, output.Count)
+
+	result, err = callMCPTool(t, session, mcpGetInstallationHistoryToolName, map[string]any{"installation_id": "private-other-id"})
+	require.NoError(t, err)
+	assert.True(t, result.IsError)
+	assert.Contains(t, mcpToolText(t, result), "no installation with the id private-other-id found")
+}
+
 func newMCPToolsTestPlugin(t *testing.T, installs []*Installation) (*Plugin, *MockClient, *plugintest.API) {
 	t.Helper()
 
-	plugin, cloudClient, api := newServiceTestPlugin(t, installs)
+	plugin, cloudClient, api, _ := newMCPToolsTestPluginWithKV(t, installs)
+	return plugin, cloudClient, api
+}
+
+func newMCPToolsTestPluginWithKV(t *testing.T, installs []*Installation) (*Plugin, *MockClient, *plugintest.API, *fakeKVStore) {
+	t.Helper()
+
+	plugin, cloudClient, api, kv := newServiceTestPluginWithKV(t, installs)
 	cloudClient.mockedCloudInstallationsDTO = serviceDTOs(installs...)
 	require.NoError(t, plugin.ensureMCPServer())
 
-	return plugin, cloudClient, api
+	return plugin, cloudClient, api, kv
 }
 
 func connectMCPToolsClient(t *testing.T, plugin *Plugin, userID string) (*mcp.ClientSession, func()) {
@@ -401,6 +474,20 @@ func assertMCPInputSchemaProperties(t *testing.T, tool *mcp.Tool, properties ...
 	}
 }
 
+func mcpInputSchemaDescription(t *testing.T, tool *mcp.Tool, property string) string {
+	t.Helper()
+
+	data, err := json.Marshal(tool.InputSchema)
+	require.NoError(t, err)
+	var schema struct {
+		Properties map[string]struct {
+			Description string `json:"description"`
+		} `json:"properties"`
+	}
+	require.NoError(t, json.Unmarshal(data, &schema))
+	return schema.Properties[property].Description
+}
+
 func assertMCPInputSchemaRequired(t *testing.T, tool *mcp.Tool, requiredProperties ...string) {
 	t.Helper()
 
@@ -440,3 +527,25 @@ func installationSummaryIDs(summaries []InstallationSummary) []string {
 	}
 	return ids
 }
+
+func TestListVersionsMCP(t *testing.T) {
+	plugin, _, _ := newMCPToolsTestPlugin(t, nil)
+	plugin.dockerClient = &MockedDockerClient{tags: []string{"9.5.0", "10.0.0", "9.11.2", "master"}}
+
+	session, cleanup := connectMCPToolsClient(t, plugin, "owner")
+	defer cleanup()
+
+	result, err := callMCPTool(t, session, mcpListVersionsToolName, map[string]any{"filter": "9."})
+	require.NoError(t, err)
+	require.False(t, result.IsError)
+	output := decodeMCPStructuredOutput[ListVersionsMCPOutput](t, result)
+	assert.Equal(t, defaultImage, output.Image)
+	assert.Equal(t, []string{"9.11.2", "9.5.0"}, output.Tags)
+	assert.Equal(t, 2, output.Count)
+	assert.Equal(t, 2, output.Total)
+
+	result, err = callMCPTool(t, session, mcpListVersionsToolName, map[string]any{"image": "someone/else"})
+	require.NoError(t, err)
+	assert.True(t, result.IsError)
+	assert.Contains(t, mcpToolText(t, result), "invalid image name someone/else")
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/pluginapi/cluster"
+	"github.com/pkg/errors"
+)
+
+const (
+	// StoreSchemaVersionKey holds the version of the last KV schema migration
+	// that was applied.
+	StoreSchemaVersionKey = "schema_version"
+
+	schemaMigrationMutexKey     = "schema_migrations"
+	schemaMigrationLockDuration = time.Minute
+)
+
+// schemaMigration is a single step in moving stored plugin data from one
+// schema version to the next. Steps must be idempotent so that an interrupted
+// run can be safely repeated.
+type schemaMigration struct {
+	version     int
+	description string
+	migrate     func(p *Plugin) error
+}
+
+// schemaMigrations is the ordered list of KV schema migrations. New steps
+// must be appended with the next version number.
+var schemaMigrations = []schemaMigration{
+	{
+		version:     1,
+		description: "Move installations from the legacy blob to per-installation records",
+		migrate:     (*Plugin).migrateLegacyInstallations,
+	},
+}
+
+func latestSchemaVersion() int {
+	return schemaMigrations[len(schemaMigrations)-1].version
+}
+
+// getSchemaVersion returns the stored KV schema version. Stores that have
+// never been migrated are at version 0.
+func (p *Plugin) getSchemaVersion() (int, error) {
+	versionBytes, appErr := p.API.KVGet(StoreSchemaVersionKey)
+	if appErr != nil {
+		return 0, errors.Wrap(appErr, "unable to get schema version")
+	}
+	if versionBytes == nil {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(string(versionBytes))
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid schema version %q", string(versionBytes))
+	}
+
+	return version, nil
+}
+
+// runSchemaMigrations applies every migration newer than the stored schema
+// version. A cluster mutex ensures only one plugin instance migrates at a time.
+func (p *Plugin) runSchemaMigrations() error {
+	mutex, err := cluster.NewMutex(p.API, schemaMigrationMutexKey)
+	if err != nil {
+		return errors.Wrap(err, "unable to create schema migration mutex")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), schemaMigrationLockDuration)
+	defer cancel()
+	if err = mutex.LockWithContext(ctx); err != nil {
+		return errors.Wrap(err, "unable to acquire schema migration lock")
+	}
+	defer mutex.Unlock()
+
+	// Read the version only once the lock is held so steps already applied by
+	// another instance are skipped.
+	version, err := p.getSchemaVersion()
+	if err != nil {
+		return err
+	}
+	if version > latestSchemaVersion() {
+		p.API.LogWarn("Stored schema version is newer than this plugin supports", "version", version, "latest", latestSchemaVersion())
+		return nil
+	}
+
+	for _, migration := range schemaMigrations {
+		if migration.version <= version {
+			continue
+		}
+
+		p.API.LogInfo("Running schema migration", "version", migration.version, "description", migration.description)
+		if err = migration.migrate(p); err != nil {
+			return errors.Wrapf(err, "schema migration to version %d failed", migration.version)
+		}
+
+		appErr := p.API.KVSet(StoreSchemaVersionKey, []byte(strconv.Itoa(migration.version)))
+		if appErr != nil {
+			return errors.Wrapf(appErr, "unable to store schema version %d", migration.version)
+		}
+		version = migration.version
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	cloud "github.com/mattermost/mattermost-cloud/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunSchemaMigrations(t *testing.T) {
+	legacyJSON, err := json.Marshal([]*Installation{
+		{Name: "first", InstallationDTO: cloud.InstallationDTO{Installation: &cloud.Installation{ID: "id1", OwnerID: "owner1", Version: "sha256:0123456789abcdef"}}},
+		{Name: "second", Tag: "release-10.0", InstallationDTO: cloud.InstallationDTO{Installation: &cloud.Installation{ID: "id2", OwnerID: "owner1", Version: "10.0.0"}}},
+	})
+	require.NoError(t, err)
+
+	t.Run("fresh store is migrated to the latest version", func(t *testing.T) {
+		plugin, _, _ := newInstallationStoreTestPlugin()
+
+		require.NoError(t, plugin.runSchemaMigrations())
+
+		version, err := plugin.getSchemaVersion()
+		require.NoError(t, err)
+		assert.Equal(t, latestSchemaVersion(), version)
+	})
+
+	t.Run("legacy installations are migrated", func(t *testing.T) {
+		plugin, _, kv := newInstallationStoreTestPlugin()
+		kv.set(StoreInstallsKey, legacyJSON)
+
+		require.NoError(t, plugin.runSchemaMigrations())
+
+		assert.Nil(t, kv.get(StoreInstallsKey))
+		assert.Empty(t, kv.getInstallation(t, "id1").Tag)
+		assert.Equal(t, "release-10.0", kv.getInstallation(t, "id2").Tag)
+	})
+
+	t.Run("applied migrations are skipped", func(t *testing.T) {
+		plugin, _, kv := newInstallationStoreTestPlugin()
+		kv.set(StoreSchemaVersionKey, []byte("1"))
+		kv.set(StoreInstallsKey, legacyJSON)
+
+		require.NoError(t, plugin.runSchemaMigrations())
+
+		assert.NotNil(t, kv.get(StoreInstallsKey))
+		version, err := plugin.getSchemaVersion()
+		require.NoError(t, err)
+		assert.Equal(t, 1, version)
+	})
+
+	t.Run("running again changes nothing", func(t *testing.T) {
+		plugin, api, kv := newInstallationStoreTestPlugin()
+		kv.set(StoreInstallsKey, legacyJSON)
+		require.NoError(t, plugin.runSchemaMigrations())
+
+		api.Calls = nil
+		require.NoError(t, plugin.runSchemaMigrations())
+
+		api.AssertNotCalled(t, "KVCompareAndSet", mock.AnythingOfType("string"), mock.Anything, mock.Anything)
+		api.AssertNotCalled(t, "KVSet", StoreSchemaVersionKey, mock.Anything)
+	})
+
+	t.Run("concurrent instances migrate once", func(t *testing.T) {
+		plugin, api, kv := newInstallationStoreTestPlugin()
+		kv.set(StoreInstallsKey, legacyJSON)
+
+		var wg sync.WaitGroup
+		for range 3 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, plugin.runSchemaMigrations())
+			}()
+		}
+		wg.Wait()
+
+		versionWrites := 0
+		for _, call := range api.Calls {
+			if call.Method == "KVSet" && call.Arguments.String(0) == StoreSchemaVersionKey {
+				versionWrites++
+			}
+		}
+		assert.Equal(t, len(schemaMigrations), versionWrites)
+		assert.Equal(t, []string{"id1", "id2"}, kv.getOwnerIndex(t, "owner1"))
+	})
+
+	t.Run("newer stored version is left alone", func(t *testing.T) {
+		plugin, api, kv := newInstallationStoreTestPlugin()
+		api.On("LogWarn", mock.AnythingOfType("string"), mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+		kv.set(StoreSchemaVersionKey, []byte("999"))
+		kv.set(StoreInstallsKey, legacyJSON)
+
+		require.NoError(t, plugin.runSchemaMigrations())
+
+		assert.NotNil(t, kv.get(StoreInstallsKey))
+		assert.Equal(t, "999", string(kv.get(StoreSchemaVersionKey)))
+	})
+
+	t.Run("invalid stored version", func(t *testing.T) {
+		plugin, _, kv := newInstallationStoreTestPlugin()
+		kv.set(StoreSchemaVersionKey, []byte("abc"))
+
+		err := plugin.runSchemaMigrations()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid schema version")
+	})
+}
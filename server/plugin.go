@@ -13,6 +13,7 @@ import (
 	"github.com/mattermost/mattermost-plugin-agents/external/pluginmcp"
 	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/mattermost/mattermost/server/public/pluginapi/cluster"
 )
 
 // Plugin implements the interface expected by the Mattermost server to communicate between the server and plugin processes.
@@ -25,6 +26,9 @@ type Plugin struct {
 	mcpServerLock sync.RWMutex
 	mcpServer     *pluginmcp.Server
 
+	expiryReminderJob *cluster.Job
+	setupResumeJob    *cluster.Job
+
 	BotUserID string
 
 	// configurationLock synchronizes access to the configuration.
@@ -34,8 +38,12 @@ type Plugin struct {
 	// setConfiguration for usage.
 	configuration *configuration
 
-	appBarIconData          string
-	latestMattermostVersion *latestMattermostVersionCache
+	appBarIconData string
+
+	// latestMattermostVersionLock synchronizes access to the release cache.
+	// Consult getReleaseCache and setReleaseCache for usage.
+	latestMattermostVersionLock sync.RWMutex
+	latestMattermostVersion     *latestMattermostVersionCache
 }
 
 // CloudClient is the interface for managing cloud installations.
@@ -43,6 +51,7 @@ type CloudClient interface {
 	GetClusters(*cloud.GetClustersRequest) ([]*cloud.ClusterDTO, error)
 
 	CreateInstallation(request *cloud.CreateInstallationRequest) (*cloud.InstallationDTO, error)
+	RetryCreateInstallation(installationID string) error
 	GetInstallation(installationID string, request *cloud.GetInstallationRequest) (*cloud.InstallationDTO, error)
 	GetInstallationByDNS(DNS string, request *cloud.GetInstallationRequest) (*cloud.InstallationDTO, error)
 	GetInstallations(*cloud.GetInstallationsRequest) ([]*cloud.InstallationDTO, error)
@@ -50,6 +59,8 @@ type CloudClient interface {
 	HibernateInstallation(installationID string) (*cloud.InstallationDTO, error)
 	WakeupInstallation(installationID string, request *cloud.PatchInstallationRequest) (*cloud.InstallationDTO, error)
 	DeleteInstallation(installationID string) error
+	CancelInstallationDeletion(installationID string) error
+	UpdateInstallationScheduledDeletion(installationID string, request *cloud.PatchInstallationScheduledDeletionRequest) (*cloud.InstallationDTO, error)
 	LockDeletionLockForInstallation(installationID string) error
 	UnlockDeletionLockForInstallation(installationID string) error
 
@@ -65,6 +76,8 @@ type CloudClient interface {
 type DockerClientInterface interface {
 	ValidTag(desiredTag, repository string) (bool, error)
 	GetDigestForTag(desiredTag, repository string) (string, error)
+	ListTags(repository string) ([]string, error)
+	RateLimits() []RegistryRateLimit
 }
 
 // BuildHash is the full git hash of the build.
@@ -139,8 +152,12 @@ func (p *Plugin) OnActivate() error {
 	}
 	p.appBarIconData = "data:image/png;base64," + base64.StdEncoding.EncodeToString(appBarIcon)
 
+	if err = p.runSchemaMigrations(); err != nil {
+		return errors.Wrap(err, "failed to migrate stored data")
+	}
+
 	p.setCloudClient()
-	p.dockerClient = NewDockerClient()
+	p.dockerClient = NewDockerClient(config.dockerRegistries()...)
 	if err := p.API.RegisterCommand(p.getCommand()); err != nil {
 		return err
 	}
@@ -150,10 +167,28 @@ func (p *Plugin) OnActivate() error {
 	}
 	p.registerMCPServerBestEffort()
 
+	if err := p.scheduleExpiryReminderJob(); err != nil {
+		return err
+	}
+
+	if err := p.scheduleSetupResumeJob(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
 func (p *Plugin) OnDeactivate() error {
 	p.unregisterMCPServerBestEffort()
+	if p.expiryReminderJob != nil {
+		if err := p.expiryReminderJob.Close(); err != nil {
+			p.API.LogWarn("Failed to close expiry reminder job", "error", err.Error())
+		}
+	}
+	if p.setupResumeJob != nil {
+		if err := p.setupResumeJob.Close(); err != nil {
+			p.API.LogWarn("Failed to close setup resume job", "error", err.Error())
+		}
+	}
 	return nil
 }
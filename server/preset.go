@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	cloud "github.com/mattermost/mattermost-cloud/model"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	// StoreUserPresetsKeyPrefix prefixes the key holding the create presets
+	// saved by a single user.
+	StoreUserPresetsKeyPrefix = "presets_user_"
+
+	// StoreGlobalPresetsKey is the key holding the create presets saved by
+	// system administrators for every user.
+	StoreGlobalPresetsKey = "presets_global"
+)
+
+// InstallationPreset is a named set of create options that can be applied
+// when creating an installation.
+type InstallationPreset struct {
+	Name      string                  `json:"name"`
+	CreatorID string                  `json:"creator_id"`
+	UpdateAt  int64                   `json:"update_at"`
+	Input     CreateInstallationInput `json:"input"`
+}
+
+func presetsKey(userID string, global bool) string {
+	if global {
+		return StoreGlobalPresetsKey
+	}
+	return StoreUserPresetsKeyPrefix + userID
+}
+
+func (p *Plugin) getInstallationPresets(userID string, global bool) (map[string]*InstallationPreset, error) {
+	presets, _, err := p.getInstallationPresetsWithJSON(presetsKey(userID, global))
+	return presets, err
+}
+
+func (p *Plugin) getInstallationPresetsWithJSON(key string) (map[string]*InstallationPreset, []byte, error) {
+	presetsJSON, appErr := p.API.KVGet(key)
+	if appErr != nil {
+		return nil, nil, errors.Wrap(appErr, "unable to get presets")
+	}
+
+	presets := map[string]*InstallationPreset{}
+	if presetsJSON != nil {
+		if err := json.Unmarshal(presetsJSON, &presets); err != nil {
+			return nil, nil, errors.Wrap(err, "unable to unmarshal presets")
+		}
+	}
+
+	return presets, presetsJSON, nil
+}
+
+// updateInstallationPresets applies mutate to the presets stored under key
+// and saves the result, retrying when the presets were changed concurrently.
+func (p *Plugin) updateInstallationPresets(key string, mutate func(map[string]*InstallationPreset) error) error {
+	for i := 0; i < StoreInstallRetries; i++ {
+		presets, originalJSON, err := p.getInstallationPresetsWithJSON(key)
+		if err != nil {
+			return err
+		}
+
+		if err = mutate(presets); err != nil {
+			return err
+		}
+
+		var ok bool
+		var appErr *model.AppError
+		if len(presets) == 0 {
+			ok, appErr = p.API.KVCompareAndDelete(key, originalJSON)
+		} else {
+			var presetsJSON []byte
+			presetsJSON, err = json.Marshal(presets)
+			if err != nil {
+				return errors.Wrap(err, "unable to marshal presets")
+			}
+			ok, appErr = p.API.KVCompareAndSet(key, originalJSON, presetsJSON)
+		}
+		if appErr != nil {
+			return errors.Wrap(appErr, "unable to store presets")
+		}
+		if ok {
+			return nil
+		}
+
+		time.Sleep(time.Duration(i) * time.Second)
+	}
+
+	return errors.Errorf("failed %d times to store presets", StoreInstallRetries)
+}
+
+func (p *Plugin) validatePresetScope(userID string, global bool) error {
+	if global && !p.API.HasPermissionTo(userID, model.PermissionManageSystem) {
+		return errors.New("global presets can only be managed by system administrators")
+	}
+	return nil
+}
+
+// saveInstallationPresetForUser stores the create options under the given
+// preset name, replacing any preset of the same name in that scope.
+func (p *Plugin) saveInstallationPresetForUser(userID, name string, input CreateInstallationInput, global bool) (*InstallationPreset, error) {
+	name = standardizeName(name)
+	if name == "" {
+		return nil, errors.New("must provide a preset name")
+	}
+	if !validInstallationName(name) {
+		return nil, errors.Errorf("preset name %s is invalid: only letters, numbers, and hyphens are permitted", name)
+	}
+	if input.Preset != "" {
+		return nil, errors.New("a preset cannot reference another preset")
+	}
+	if err := p.validatePresetScope(userID, global); err != nil {
+		return nil, err
+	}
+
+	input.Name = ""
+	preset := &InstallationPreset{
+		Name:      name,
+		CreatorID: userID,
+		UpdateAt:  cloud.GetMillis(),
+		Input:     input,
+	}
+
+	err := p.updateInstallationPresets(presetsKey(userID, global), func(presets map[string]*InstallationPreset) error {
+		presets[name] = preset
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return preset, nil
+}
+
+func (p *Plugin) deleteInstallationPresetForUser(userID, name string, global bool) error {
+	name = standardizeName(name)
+	if name == "" {
+		return errors.New("must provide a preset name")
+	}
+	if err := p.validatePresetScope(userID, global); err != nil {
+		return err
+	}
+
+	return p.updateInstallationPresets(presetsKey(userID, global), func(presets map[string]*InstallationPreset) error {
+		if _, ok := presets[name]; !ok {
+			return errors.Errorf("no preset with the name %s found", name)
+		}
+		delete(presets, name)
+		return nil
+	})
+}
+
+// findInstallationPreset returns the preset with the given name, preferring
+// the presets of the user over the global ones.
+func (p *Plugin) findInstallationPreset(userID, name string) (*InstallationPreset, error) {
+	name = standardizeName(name)
+	for _, global := range []bool{false, true} {
+		presets, err := p.getInstallationPresets(userID, global)
+		if err != nil {
+			return nil, err
+		}
+		if preset, ok := presets[name]; ok {
+			return preset, nil
+		}
+	}
+
+	return nil, errors.Errorf("no preset with the name %s found", name)
+}
+
+// applyInstallationPreset resolves the preset named in the input, if any, and
+// fills every option the input leaves unset with the preset value.
+func (p *Plugin) applyInstallationPreset(userID string, input CreateInstallationInput) (CreateInstallationInput, error) {
+	if input.Preset == "" {
+		return input, nil
+	}
+
+	preset, err := p.findInstallationPreset(userID, input.Preset)
+	if err != nil {
+		return CreateInstallationInput{}, err
+	}
+
+	return mergeCreateInstallationInput(input, preset.Input), nil
+}
+
+func mergeCreateInstallationInput(input, preset CreateInstallationInput) CreateInstallationInput {
+	input.Version = defaultString(input.Version, preset.Version)
+	input.Size = defaultString(input.Size, preset.Size)
+	input.License = defaultString(input.License, preset.License)
+	input.Affinity = defaultString(input.Affinity, preset.Affinity)
+	input.Database = defaultString(input.Database, preset.Database)
+	input.Filestore = defaultString(input.Filestore, preset.Filestore)
+	input.Image = defaultString(input.Image, preset.Image)
+	input.TTL = defaultString(input.TTL, preset.TTL)
+	// Test data explicitly declined also declines the test data profile and
+	// counts of the preset.
+	testDataDeclined := input.TestData != nil && !*input.TestData
+	if input.TestData == nil {
+		input.TestData = preset.TestData
+	}
+	if !testDataDeclined {
+		input.TestDataProfile = defaultString(input.TestDataProfile, preset.TestDataProfile)
+	}
+	if len(preset.TestDataCounts) > 0 && !testDataDeclined {
+		counts := make(map[string]int, len(preset.TestDataCounts)+len(input.TestDataCounts))
+		for name, count := range preset.TestDataCounts {
+			counts[name] = count
+		}
+		for name, count := range input.TestDataCounts {
+			counts[name] = count
+		}
+		input.TestDataCounts = counts
+	}
+	if len(input.Plugins) == 0 {
+		input.Plugins = preset.Plugins
+	}
+	if len(input.Users) == 0 {
+		input.Users = preset.Users
+	}
+
+	if len(preset.Config) > 0 {
+		config := make(map[string]string, len(preset.Config)+len(input.Config))
+		for key, value := range preset.Config {
+			config[key] = value
+		}
+		for key, value := range input.Config {
+			config[key] = value
+		}
+		input.Config = config
+	}
+
+	if len(preset.Env) > 0 {
+		env := make(map[string]string, len(preset.Env)+len(input.Env))
+		for key, value := range preset.Env {
+			env[key] = value
+		}
+		for key, value := range input.Env {
+			env[key] = value
+		}
+		input.Env = env
+	}
+
+	return input
+}
+
+// describeCreateInstallationInput summarizes the options set in a create
+// input without revealing env var values.
+func describeCreateInstallationInput(input CreateInstallationInput) string {
+	options := []string{}
+	addOption := func(name, value string) {
+		if value != "" {
+			options = append(options, name+": "+value)
+		}
+	}
+	addOption("version", input.Version)
+	addOption("size", input.Size)
+	addOption("license", input.License)
+	addOption("affinity", input.Affinity)
+	addOption("database", input.Database)
+	addOption("filestore", input.Filestore)
+	addOption("image", input.Image)
+	addOption("ttl", input.TTL)
+	if input.TestData != nil && *input.TestData {
+		options = append(options, "test data")
+	} else if input.TestData != nil {
+		options = append(options, "no test data")
+	}
+	addOption("test data profile", input.TestDataProfile)
+	if len(input.TestDataCounts) > 0 {
+		counts := []string{}
+		for _, name := range sortedStringMapKeys(input.TestDataCounts) {
+			counts = append(counts, fmt.Sprintf("%s=%d", name, input.TestDataCounts[name]))
+		}
+		options = append(options, "test data counts: "+strings.Join(counts, ", "))
+	}
+	addOption("plugins", strings.Join(input.Plugins, ", "))
+	addOption("users", strings.Join(input.Users, ", "))
+	addOption("config", strings.Join(sortedStringMapKeys(input.Config), ", "))
+	if len(input.Env) > 0 {
+		options = append(options, "env: "+strings.Join(sortedStringMapKeys(input.Env), ", "))
+	}
+
+	if len(options) == 0 {
+		return "defaults"
+	}
+	return strings.Join(options, "; ")
+}
+
+func sortedPresetNames(presets map[string]*InstallationPreset) []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"testing"
+
+	cloud "github.com/mattermost/mattermost-cloud/model"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstallationPresets(t *testing.T) {
+	loadTest := CreateInstallationInput{
+		Size:     "miniHA",
+		License:  licenseOptionE20,
+		Database: cloud.InstallationDatabaseMysqlOperator,
+		TestData: NewBool(true),
+		Env:      map[string]string{"MM_FEATUREFLAGS_X": "true", "MM_LOGLEVEL": "debug"},
+	}
+
+	t.Run("save, find, and delete a personal preset", func(t *testing.T) {
+		plugin, _, _, kv := newServiceTestPluginWithKV(t, nil)
+
+		input := loadTest
+		input.Name = "ignored"
+		preset, err := plugin.saveInstallationPresetForUser("owner", "LoadTest", input, false)
+		require.NoError(t, err)
+		assert.Equal(t, "loadtest", preset.Name)
+		assert.Empty(t, preset.Input.Name)
+		assert.NotNil(t, kv.get(presetsKey("owner", false)))
+
+		found, err := plugin.findInstallationPreset("owner", "loadtest")
+		require.NoError(t, err)
+		assert.Equal(t, loadTest, found.Input)
+
+		_, err = plugin.findInstallationPreset("other", "loadtest")
+		require.EqualError(t, err, "no preset with the name loadtest found")
+
+		require.NoError(t, plugin.deleteInstallationPresetForUser("owner", "loadtest", false))
+		assert.Nil(t, kv.get(presetsKey("owner", false)))
+		require.EqualError(t, plugin.deleteInstallationPresetForUser("owner", "loadtest", false), "no preset with the name loadtest found")
+	})
+
+	t.Run("global presets require system administrators", func(t *testing.T) {
+		plugin, _, api, _ := newServiceTestPluginWithKV(t, nil)
+		api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+		api.On("HasPermissionTo", "owner", model.PermissionManageSystem).Return(false)
+
+		_, err := plugin.saveInstallationPresetForUser("owner", "shared", loadTest, true)
+		require.EqualError(t, err, "global presets can only be managed by system administrators")
+
+		_, err = plugin.saveInstallationPresetForUser("admin", "shared", loadTest, true)
+		require.NoError(t, err)
+
+		found, err := plugin.findInstallationPreset("owner", "shared")
+		require.NoError(t, err)
+		assert.Equal(t, "admin", found.CreatorID)
+
+		require.EqualError(t, plugin.deleteInstallationPresetForUser("owner", "shared", true), "global presets can only be managed by system administrators")
+	})
+
+	t.Run("personal presets take precedence over global ones", func(t *testing.T) {
+		plugin, _, api, _ := newServiceTestPluginWithKV(t, nil)
+		api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+
+		_, err := plugin.saveInstallationPresetForUser("admin", "shared", CreateInstallationInput{Size: "miniHA"}, true)
+		require.NoError(t, err)
+		_, err = plugin.saveInstallationPresetForUser("owner", "shared", CreateInstallationInput{Size: "miniSingleton"}, false)
+		require.NoError(t, err)
+
+		found, err := plugin.findInstallationPreset("owner", "shared")
+		require.NoError(t, err)
+		assert.Equal(t, "miniSingleton", found.Input.Size)
+	})
+
+	t.Run("rejects invalid presets", func(t *testing.T) {
+		plugin, _, _, _ := newServiceTestPluginWithKV(t, nil)
+
+		_, err := plugin.saveInstallationPresetForUser("owner", "", loadTest, false)
+		require.EqualError(t, err, "must provide a preset name")
+		_, err = plugin.saveInstallationPresetForUser("owner", "bad_name", loadTest, false)
+		require.EqualError(t, err, "preset name bad_name is invalid: only letters, numbers, and hyphens are permitted")
+		_, err = plugin.saveInstallationPresetForUser("owner", "nested", CreateInstallationInput{Preset: "loadtest"}, false)
+		require.EqualError(t, err, "a preset cannot reference another preset")
+	})
+
+	t.Run("create applies the preset with explicit options winning", func(t *testing.T) {
+		plugin, cloudClient, _, _ := newServiceTestPluginWithKV(t, nil)
+		plugin.configuration.E20License = "e20-license"
+
+		_, err := plugin.saveInstallationPresetForUser("owner", "loadtest", loadTest, false)
+		require.NoError(t, err)
+
+		install, err := plugin.createInstallationForUser("owner", CreateInstallationInput{
+			Name:   "example",
+			Size:   "miniSingleton",
+			Env:    map[string]string{"MM_LOGLEVEL": "info"},
+			Preset: "LoadTest",
+		})
+		require.NoError(t, err)
+		require.NotNil(t, cloudClient.creationRequest)
+		assert.Equal(t, "miniSingleton", cloudClient.creationRequest.Size)
+		assert.Equal(t, "e20-license", cloudClient.creationRequest.License)
+		assert.Equal(t, cloud.InstallationDatabaseMysqlOperator, cloudClient.creationRequest.Database)
+		assert.Equal(t, cloud.EnvVarMap{
+			"MM_FEATUREFLAGS_X": cloud.EnvVar{Value: "true"},
+			"MM_LOGLEVEL":       cloud.EnvVar{Value: "info"},
+		}, cloudClient.creationRequest.PriorityEnv)
+		assert.True(t, install.TestData)
+	})
+
+	t.Run("create with test data explicitly declined ignores the preset test data", func(t *testing.T) {
+		plugin, _, _, _ := newServiceTestPluginWithKV(t, nil)
+
+		preset := loadTest
+		preset.TestDataProfile = "medium"
+		preset.TestDataCounts = map[string]int{"threads": 5}
+		_, err := plugin.saveInstallationPresetForUser("owner", "loadtest", preset, false)
+		require.NoError(t, err)
+
+		install, err := plugin.createInstallationForUser("owner", CreateInstallationInput{
+			Name:     "example",
+			TestData: NewBool(false),
+			Preset:   "loadtest",
+		})
+		require.NoError(t, err)
+		assert.False(t, install.TestData)
+		assert.Empty(t, install.TestDataProfile)
+	})
+
+	t.Run("create validates the merged input", func(t *testing.T) {
+		plugin, cloudClient, _, _ := newServiceTestPluginWithKV(t, nil)
+
+		_, err := plugin.saveInstallationPresetForUser("owner", "broken", CreateInstallationInput{Size: "huge"}, false)
+		require.NoError(t, err)
+
+		_, err = plugin.createInstallationForUser("owner", CreateInstallationInput{Name: "example", Preset: "broken"})
+		require.EqualError(t, err, "Invalid size: huge")
+
+		_, err = plugin.createInstallationForUser("owner", CreateInstallationInput{Name: "example", Preset: "missing"})
+		require.EqualError(t, err, "no preset with the name missing found")
+		assert.Nil(t, cloudClient.creationRequest)
+	})
+}
+
+func TestDescribeCreateInstallationInput(t *testing.T) {
+	assert.Equal(t, "defaults", describeCreateInstallationInput(CreateInstallationInput{}))
+	assert.Equal(t, "no test data", describeCreateInstallationInput(CreateInstallationInput{TestData: NewBool(false)}))
+	assert.Equal(t, "size: miniHA; license: e20; test data; env: A, B", describeCreateInstallationInput(CreateInstallationInput{
+		Size:     "miniHA",
+		License:  licenseOptionE20,
+		TestData: NewBool(true),
+		Env:      map[string]string{"B": "secret", "A": "secret"},
+	}))
+	assert.Equal(t, "size: miniHA; license: e20; test data; plugins: com.mattermost.calls, com.mattermost.plugin-jira@4.1.0; config: ServiceSettings.EnableGifPicker; env: A, B", describeCreateInstallationInput(CreateInstallationInput{
+		Size:     "miniHA",
+		License:  licenseOptionE20,
+		TestData: NewBool(true),
+		Plugins:  []string{"com.mattermost.calls", "com.mattermost.plugin-jira@4.1.0"},
+		Config:   map[string]string{"ServiceSettings.EnableGifPicker": "false"},
+		Env:      map[string]string{"B": "secret", "A": "secret"},
+	}))
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	cloud "github.com/mattermost/mattermost-cloud/model"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/pluginapi/cluster"
+	"github.com/pkg/errors"
+)
+
+const (
+	// StoreCreationProgressKeyPrefix prefixes the key recording the creation
+	// progress of an installation and the DM reporting it.
+	StoreCreationProgressKeyPrefix = "creation_progress_"
+
+	provisionerStagePrefix = "Provisioner "
+	setupStagePrefix       = "Setup step "
+)
+
+// creationProgress records the finished stages of the creation of an
+// installation. The owner is sent a single DM which is edited in place as
+// each stage finishes.
+type creationProgress struct {
+	PostID  string          `json:"post_id"`
+	StartAt int64           `json:"start_at"`
+	Stages  []creationStage `json:"stages"`
+}
+
+// creationStage is a provisioner state or setup step. A stage with a detail
+// is still in progress, and a stage with an error failed.
+type creationStage struct {
+	Name   string `json:"name"`
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+	At     int64  `json:"at"`
+}
+
+func creationProgressKey(installationID string) string {
+	return StoreCreationProgressKeyPrefix + installationID
+}
+
+func isInstallationCreationState(state string) bool {
+	switch state {
+	case cloud.InstallationStateCreationRequested,
+		cloud.InstallationStateCreationPreProvisioning,
+		cloud.InstallationStateCreationInProgress,
+		cloud.InstallationStateCreationDNS,
+		cloud.InstallationStateCreationNoCompatibleClusters,
+		cloud.InstallationStateCreationFailed,
+		cloud.InstallationStateCreationFinalTasks:
+		return true
+	}
+	return false
+}
+
+func provisionerStageName(state string) string {
+	return provisionerStagePrefix + state
+}
+
+func setupStageName(step string) string {
+	if step == "" {
+		return "Setup"
+	}
+	return setupStagePrefix + step
+}
+
+// reportProvisionerProgress reports the provisioner finishing a creation
+// state of the installation, or failing its creation.
+func (p *Plugin) reportProvisionerProgress(payload *cloud.WebhookPayload) error {
+	if !isInstallationCreationState(payload.OldState) && !isInstallationCreationState(payload.NewState) {
+		return nil
+	}
+
+	install, err := p.getInstallation(payload.ID)
+	if err != nil {
+		return err
+	}
+	if install == nil {
+		return nil
+	}
+
+	switch payload.NewState {
+	case cloud.InstallationStateCreationFailed:
+		return p.reportCreationStage(install, creationStage{
+			Name:  provisionerStageName(payload.OldState),
+			Error: fmt.Sprintf("the provisioner moved the installation to %s", payload.NewState),
+		})
+	}
+	if isInstallationCreationState(payload.OldState) {
+		if err = p.reportCreationStage(install, creationStage{Name: provisionerStageName(payload.OldState)}); err != nil {
+			return err
+		}
+	}
+
+	// The provisioner keeps retrying an installation without compatible
+	// clusters, so waiting for capacity is reported as a stage in progress.
+	if payload.NewState == cloud.InstallationStateCreationNoCompatibleClusters {
+		return p.reportCreationStage(install, creationStage{
+			Name:   provisionerStageName(payload.NewState),
+			Detail: "waiting for a cluster with capacity",
+		})
+	}
+
+	return nil
+}
+
+// reportCreationStage records a stage of the creation of the installation and
+// updates the DM reporting the progress. A stage replaces the previous one
+// when they have the same name, so that a stage in progress is reported once.
+func (p *Plugin) reportCreationStage(install *Installation, stage creationStage) error {
+	return p.updateCreationProgress(install, func(progress *creationProgress, now time.Time) string {
+		stage.At = now.UnixMilli()
+		if last := len(progress.Stages) - 1; last >= 0 && progress.Stages[last].Name == stage.Name {
+			progress.Stages[last] = stage
+		} else {
+			progress.Stages = append(progress.Stages, stage)
+		}
+		return creationProgressMessage(install, progress, now)
+	})
+}
+
+// reportInstallationReady replaces the progress DM with the given message,
+// followed by the stages the creation went through.
+func (p *Plugin) reportInstallationReady(install *Installation, message string) error {
+	return p.updateCreationProgress(install, func(progress *creationProgress, now time.Time) string {
+		return fmt.Sprintf("%s\nCreated in %s:\n\n%s", message, elapsedSince(progress.StartAt, now), creationStagesTable(progress))
+	})
+}
+
+func (p *Plugin) updateCreationProgress(install *Installation, update func(progress *creationProgress, now time.Time) string) error {
+	mutex, err := cluster.NewMutex(p.API, creationProgressKey(install.ID))
+	if err != nil {
+		return errors.Wrap(err, "unable to create creation progress mutex")
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	progress, err := p.getCreationProgress(install.ID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if progress.StartAt == 0 {
+		progress.StartAt = now.UnixMilli()
+		if install.Installation != nil && install.CreateAt > 0 {
+			progress.StartAt = install.CreateAt
+		}
+	}
+
+	postID, err := p.upsertBotDM(install.OwnerID, progress.PostID, update(progress, now))
+	if err != nil {
+		return errors.Wrap(err, "unable to post creation progress")
+	}
+	progress.PostID = postID
+
+	return p.storeCreationProgress(install.ID, progress)
+}
+
+// upsertBotDM edits the bot DM with the given ID, or posts a new DM when it
+// is not given or can no longer be edited. The ID of the DM is returned.
+func (p *Plugin) upsertBotDM(userID, postID, message string) (string, error) {
+	if postID != "" {
+		post, appErr := p.API.GetPost(postID)
+		if appErr == nil {
+			post.Message = message
+			if _, appErr = p.API.UpdatePost(post); appErr == nil {
+				return postID, nil
+			}
+		}
+		p.API.LogWarn("Failed to edit bot DM, posting a new one", "post_id", postID, "error", appErr.Error())
+	}
+
+	channel, appErr := p.API.GetDirectChannel(userID, p.BotUserID)
+	if appErr != nil {
+		return "", appErr
+	}
+	post, appErr := p.API.CreatePost(&model.Post{
+		UserId:    p.BotUserID,
+		ChannelId: channel.Id,
+		Message:   message,
+	})
+	if appErr != nil {
+		return "", appErr
+	}
+
+	return post.Id, nil
+}
+
+func (p *Plugin) getCreationProgress(installationID string) (*creationProgress, error) {
+	progressJSON, appErr := p.API.KVGet(creationProgressKey(installationID))
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "unable to get creation progress")
+	}
+
+	progress := &creationProgress{}
+	if progressJSON == nil {
+		return progress, nil
+	}
+	if err := json.Unmarshal(progressJSON, progress); err != nil {
+		return nil, errors.Wrap(err, "unable to unmarshal creation progress")
+	}
+
+	return progress, nil
+}
+
+func (p *Plugin) storeCreationProgress(installationID string, progress *creationProgress) error {
+	progressJSON, err := json.Marshal(progress)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal creation progress")
+	}
+	if appErr := p.API.KVSet(creationProgressKey(installationID), progressJSON); appErr != nil {
+		return errors.Wrap(appErr, "unable to store creation progress")
+	}
+	return nil
+}
+
+// creationProgressMessage describes the stages of the creation so far and,
+// when the last one failed, how to resume it.
+func creationProgressMessage(install *Installation, progress *creationProgress, now time.Time) string {
+	elapsed := elapsedSince(progress.StartAt, now)
+	header := fmt.Sprintf("Installation %s is being created. Elapsed: %s", install.Name, elapsed)
+
+	if last := len(progress.Stages) - 1; last >= 0 && progress.Stages[last].Error != "" {
+		failed := progress.Stages[last]
+		header = fmt.Sprintf("Creation of installation %s failed at %s after %s: %s", install.Name, failed.Name, elapsed, failed.Error)
+		if !strings.HasPrefix(failed.Name, provisionerStagePrefix) {
+			header += fmt.Sprintf("\n\nRun `/cloud setup retry %s` to resume the setup from that step.", install.Name)
+		}
+	}
+
+	return header + "\n\n" + creationStagesTable(progress)
+}
+
+func creationStagesTable(progress *creationProgress) string {
+	table := "| Stage | Result | Elapsed |\n| -- | -- | -- |\n"
+	for _, stage := range progress.Stages {
+		result := "Done"
+		if stage.Error != "" {
+			result = "Failed: " + stage.Error
+		} else if stage.Detail != "" {
+			result = "In progress: " + stage.Detail
+		}
+		table += fmt.Sprintf("| %s | %s | %s |\n", stage.Name, result, elapsedSince(progress.StartAt, time.UnixMilli(stage.At)))
+	}
+	return table
+}
+
+func elapsedSince(startAt int64, now time.Time) time.Duration {
+	elapsed := now.Sub(time.UnixMilli(startAt)).Round(time.Second)
+	if elapsed < 0 {
+		return 0
+	}
+	return elapsed
+}
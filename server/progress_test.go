@@ -0,0 +1,117 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	cloud "github.com/mattermost/mattermost-cloud/model"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreationProgress(t *testing.T) {
+	setup := func(t *testing.T) (*Plugin, *plugintest.API, *fakeKVStore, *[]*model.Post, *Installation) {
+		install := serviceTestInstall("id1", "first", "owner1")
+		install.CreateAt = time.Now().Add(-5 * time.Minute).UnixMilli()
+		plugin, _, api, kv := newServiceTestPluginWithKV(t, []*Installation{install})
+		plugin.BotUserID = "bot-id"
+		return plugin, api, kv, captureBotPosts(api), install
+	}
+
+	webhook := func(oldState, newState string) *cloud.WebhookPayload {
+		return &cloud.WebhookPayload{Type: cloud.TypeInstallation, ID: "id1", OldState: oldState, NewState: newState}
+	}
+
+	t.Run("edits a single DM as the provisioner states finish", func(t *testing.T) {
+		plugin, _, kv, posts, install := setup(t)
+
+		require.NoError(t, plugin.reportProvisionerProgress(webhook(cloud.InstallationStateCreationRequested, cloud.InstallationStateCreationInProgress)))
+		require.NoError(t, plugin.reportProvisionerProgress(webhook(cloud.InstallationStateCreationInProgress, cloud.InstallationStateCreationDNS)))
+		require.NoError(t, plugin.reportProvisionerProgress(webhook(cloud.InstallationStateStable, cloud.InstallationStateHibernating)))
+
+		require.Len(t, *posts, 1)
+		message := (*posts)[0].Message
+		assert.Contains(t, message, "Installation first is being created. Elapsed: 5m")
+		assert.Contains(t, message, "| Provisioner creation-requested | Done | 5m")
+		assert.Contains(t, message, "| Provisioner creation-in-progress | Done | 5m")
+		assert.NotContains(t, message, "hibernat")
+
+		progress, err := plugin.getCreationProgress(install.ID)
+		require.NoError(t, err)
+		assert.Equal(t, (*posts)[0].Id, progress.PostID)
+		assert.Equal(t, install.CreateAt, progress.StartAt)
+		assert.Len(t, progress.Stages, 2)
+		assert.Nil(t, kv.get("mutex_"+creationProgressKey(install.ID)))
+	})
+
+	t.Run("reports a provisioner failure", func(t *testing.T) {
+		plugin, _, _, posts, _ := setup(t)
+
+		require.NoError(t, plugin.reportProvisionerProgress(webhook(cloud.InstallationStateCreationInProgress, cloud.InstallationStateCreationFailed)))
+
+		require.Len(t, *posts, 1)
+		message := (*posts)[0].Message
+		assert.Contains(t, message, "Creation of installation first failed at Provisioner creation-in-progress after 5m")
+		assert.Contains(t, message, "Failed: the provisioner moved the installation to creation-failed")
+		assert.NotContains(t, message, "/cloud setup retry")
+	})
+
+	t.Run("reports waiting for compatible clusters", func(t *testing.T) {
+		plugin, _, _, posts, _ := setup(t)
+
+		require.NoError(t, plugin.reportProvisionerProgress(webhook(cloud.InstallationStateCreationRequested, cloud.InstallationStateCreationNoCompatibleClusters)))
+		message := (*posts)[0].Message
+		assert.Contains(t, message, "Installation first is being created.")
+		assert.Contains(t, message, "| Provisioner creation-no-compatible-clusters | In progress: waiting for a cluster with capacity |")
+		assert.NotContains(t, message, "Failed")
+
+		require.NoError(t, plugin.reportProvisionerProgress(webhook(cloud.InstallationStateCreationNoCompatibleClusters, cloud.InstallationStateCreationInProgress)))
+		require.Len(t, *posts, 1)
+		message = (*posts)[0].Message
+		assert.Contains(t, message, "| Provisioner creation-no-compatible-clusters | Done |")
+		assert.NotContains(t, message, "In progress")
+	})
+
+	t.Run("replaces a stage in progress", func(t *testing.T) {
+		plugin, _, _, posts, install := setup(t)
+
+		require.NoError(t, plugin.reportCreationStage(install, creationStage{Name: setupStageName(setupStepTestData), Detail: "3 of 12 threads created"}))
+		message := (*posts)[0].Message
+		assert.Contains(t, message, "| Setup step test_data | In progress: 3 of 12 threads created |")
+
+		require.NoError(t, plugin.reportCreationStage(install, creationStage{Name: setupStageName(setupStepTestData)}))
+		require.Len(t, *posts, 1)
+		message = (*posts)[0].Message
+		assert.Contains(t, message, "| Setup step test_data | Done |")
+		assert.NotContains(t, message, "In progress")
+	})
+
+	t.Run("ready message replaces the progress", func(t *testing.T) {
+		plugin, _, _, posts, install := setup(t)
+
+		require.NoError(t, plugin.reportCreationStage(install, creationStage{Name: setupStageName(setupStepDNS)}))
+		require.NoError(t, plugin.reportInstallationReady(install, "Installation first is ready!\n"))
+
+		require.Len(t, *posts, 1)
+		message := (*posts)[0].Message
+		assert.Contains(t, message, "Installation first is ready!\n\nCreated in 5m")
+		assert.Contains(t, message, "| Setup step dns | Done |")
+		assert.NotContains(t, message, "is being created")
+	})
+
+	t.Run("posts a new DM when the previous one is gone", func(t *testing.T) {
+		plugin, api, _, posts, install := setup(t)
+		api.On("LogWarn", mock.AnythingOfType("string"), "post_id", "deleted-post-id", "error", mock.AnythingOfType("string")).Return()
+		require.NoError(t, plugin.storeCreationProgress(install.ID, &creationProgress{PostID: "deleted-post-id", StartAt: install.CreateAt}))
+
+		require.NoError(t, plugin.reportCreationStage(install, creationStage{Name: setupStageName(setupStepDNS)}))
+
+		require.Len(t, *posts, 1)
+		progress, err := plugin.getCreationProgress(install.ID)
+		require.NoError(t, err)
+		assert.Equal(t, (*posts)[0].Id, progress.PostID)
+	})
+}
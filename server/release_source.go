@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/blang/semver/v4"
+	"github.com/pkg/errors"
+)
+
+const (
+	releaseSourceGithub   = "github"
+	releaseSourceRegistry = "registry"
+	releaseSourcePinned   = "pinned"
+
+	// releaseCacheTTL is how long the releases of the release source are
+	// reused before asking it again.
+	releaseCacheTTL = 5 * time.Minute
+
+	// lastKnownReleasesKey stores the releases last fetched from the release
+	// source, so that all plugin nodes share them and can fall back to them
+	// when the source is unavailable.
+	lastKnownReleasesKey = "last_known_releases"
+)
+
+var validReleaseSources = []string{releaseSourceGithub, releaseSourceRegistry, releaseSourcePinned}
+
+// githubReleasesURL lists the Mattermost releases. The releases endpoint is
+// used instead of releases/latest to avoid getting a dot release.
+var githubReleasesURL = "https://api.github.com/repos/mattermost/mattermost-server/releases"
+
+type latestMattermostVersionCache struct {
+	version   string
+	tags      []string
+	timestamp time.Time
+}
+
+// knownReleases are the releases last fetched from a release source.
+type knownReleases struct {
+	Source   string   `json:"source"`
+	Latest   string   `json:"latest"`
+	Tags     []string `json:"tags"`
+	UpdateAt int64    `json:"update_at"`
+}
+
+type githubReleaseMetadata struct {
+	TagName string `json:"tag_name"`
+}
+
+// getReleaseCache returns the cached releases, or nil when none were cached
+// since the release source last changed.
+func (p *Plugin) getReleaseCache() *latestMattermostVersionCache {
+	p.latestMattermostVersionLock.RLock()
+	defer p.latestMattermostVersionLock.RUnlock()
+
+	return p.latestMattermostVersion
+}
+
+func (p *Plugin) setReleaseCache(cache *latestMattermostVersionCache) {
+	p.latestMattermostVersionLock.Lock()
+	defer p.latestMattermostVersionLock.Unlock()
+
+	p.latestMattermostVersion = cache
+}
+
+func (cache *latestMattermostVersionCache) isFresh() bool {
+	return cache != nil && cache.timestamp.After(time.Now().Add(-releaseCacheTTL))
+}
+
+// latestRelease returns the version of the newest Mattermost release
+// according to the configured release source.
+func (p *Plugin) latestRelease() (string, error) {
+	if cache := p.getReleaseCache(); cache.isFresh() && cache.version != "" {
+		return cache.version, nil
+	}
+
+	cache, err := p.refreshReleases()
+	if err != nil {
+		return "", err
+	}
+
+	return cache.version, nil
+}
+
+// releaseTags returns the versions of the recent Mattermost releases
+// according to the configured release source, without a "v" prefix.
+func (p *Plugin) releaseTags() ([]string, error) {
+	if cache := p.getReleaseCache(); cache.isFresh() && cache.tags != nil {
+		return cache.tags, nil
+	}
+
+	cache, err := p.refreshReleases()
+	if err != nil {
+		return nil, err
+	}
+
+	return cache.tags, nil
+}
+
+// refreshReleases caches the releases of the configured release source and
+// returns the cache. The releases another plugin node fetched recently are
+// reused, and the last known releases are used when the source is
+// unavailable.
+func (p *Plugin) refreshReleases() (*latestMattermostVersionCache, error) {
+	config := p.getConfiguration()
+	source := config.releaseSource()
+
+	if source == releaseSourcePinned {
+		return p.cacheReleases(&knownReleases{
+			Latest: config.PinnedReleaseVersion,
+			Tags:   []string{config.PinnedReleaseVersion},
+		}), nil
+	}
+
+	lastKnown, err := p.getLastKnownReleases()
+	if err != nil {
+		p.API.LogWarn("Failed to get the last known releases", "error", err.Error())
+	}
+	if lastKnown != nil && lastKnown.Source == source && time.Since(time.UnixMilli(lastKnown.UpdateAt)) < releaseCacheTTL {
+		return p.cacheReleases(lastKnown), nil
+	}
+
+	var releases *knownReleases
+	switch source {
+	case releaseSourceRegistry:
+		releases, err = p.fetchRegistryReleases()
+	default:
+		releases, err = fetchGithubReleases(config.GithubToken)
+	}
+	if err != nil {
+		if lastKnown == nil {
+			return nil, err
+		}
+		p.API.LogWarn("Failed to fetch releases, using the last known releases", "source", source, "last_known_source", lastKnown.Source, "error", err.Error())
+		return p.cacheReleases(lastKnown), nil
+	}
+
+	releases.Source = source
+	releases.UpdateAt = time.Now().UnixMilli()
+	if err := p.storeLastKnownReleases(releases); err != nil {
+		p.API.LogWarn("Failed to store the last known releases", "error", err.Error())
+	}
+
+	return p.cacheReleases(releases), nil
+}
+
+func (p *Plugin) cacheReleases(releases *knownReleases) *latestMattermostVersionCache {
+	cache := &latestMattermostVersionCache{
+		timestamp: time.Now(),
+		version:   releases.Latest,
+		tags:      releases.Tags,
+	}
+	p.setReleaseCache(cache)
+	return cache
+}
+
+func (p *Plugin) getLastKnownReleases() (*knownReleases, error) {
+	releasesJSON, appErr := p.API.KVGet(lastKnownReleasesKey)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if releasesJSON == nil {
+		return nil, nil
+	}
+
+	var releases knownReleases
+	if err := json.Unmarshal(releasesJSON, &releases); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the last known releases")
+	}
+	if releases.Latest == "" {
+		return nil, nil
+	}
+
+	return &releases, nil
+}
+
+func (p *Plugin) storeLastKnownReleases(releases *knownReleases) error {
+	releasesJSON, err := json.Marshal(releases)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the last known releases")
+	}
+	if appErr := p.API.KVSet(lastKnownReleasesKey, releasesJSON); appErr != nil {
+		return appErr
+	}
+	return nil
+}
+
+func fetchGithubReleases(token string) (*knownReleases, error) {
+	req, err := http.NewRequest(http.MethodGet, githubReleasesURL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create GitHub request")
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find latest release from GitHub")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("got unexpected status code %d while determining latest release from GitHub", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read response body")
+	}
+
+	grm := []githubReleaseMetadata{}
+	err = json.Unmarshal(body, &grm)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal JSON from GitHub to determine latest release")
+	}
+
+	var (
+		latestTag        string
+		latestTagVersion semver.Version
+		tags             = []string{}
+	)
+
+	for _, release := range grm {
+		if release.TagName == "" {
+			continue
+		}
+		currentTag := strings.TrimPrefix(release.TagName, "v")
+		currentTagVersion, err := semver.Parse(currentTag)
+		if err != nil {
+			continue
+		}
+		tags = append(tags, currentTag)
+
+		if latestTag == "" || currentTagVersion.GE(latestTagVersion) {
+			latestTag = currentTag
+			latestTagVersion = currentTagVersion
+		}
+	}
+
+	if latestTag == "" {
+		return nil, errors.New("failed to determine latest version of Mattermost")
+	}
+
+	return &knownReleases{Latest: latestTag, Tags: tags}, nil
+}
+
+// fetchRegistryReleases returns the release versions tagged in the registry
+// of the default image.
+func (p *Plugin) fetchRegistryReleases() (*knownReleases, error) {
+	registryTags, err := p.dockerClient.ListTags(defaultImage)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list the tags of %s", defaultImage)
+	}
+
+	tags := []string{}
+	for _, tag := range registryTags {
+		if version, err := semver.Parse(tag); err == nil && len(version.Build) == 0 {
+			tags = append(tags, tag)
+		}
+	}
+
+	latest := selectVersionTag(versionSpecLatest, tags, nil)
+	if latest == "" {
+		return nil, errors.Errorf("failed to determine latest version of Mattermost: no releases are tagged in %s", defaultImage)
+	}
+
+	return &knownReleases{Latest: latest, Tags: tags}, nil
+}
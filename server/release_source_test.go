@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newGithubReleasesServer(t *testing.T, status int) (*int, *http.Header) {
+	requests := 0
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		header = r.Header.Clone()
+		w.WriteHeader(status)
+		w.Write([]byte(`[{"tag_name":"v10.5.1"},{"tag_name":"v10.6.0-rc1"},{"tag_name":"v10.4.3"},{"tag_name":"nightly"}]`))
+	}))
+	t.Cleanup(server.Close)
+
+	originalURL := githubReleasesURL
+	githubReleasesURL = server.URL
+	t.Cleanup(func() { githubReleasesURL = originalURL })
+
+	return &requests, &header
+}
+
+func TestReleaseSource(t *testing.T) {
+	setup := func(t *testing.T) (*Plugin, *fakeKVStore) {
+		plugin, _, api, kv := newServiceTestPluginWithKV(t, nil)
+		plugin.latestMattermostVersion = nil
+		api.On("LogWarn", "Failed to fetch releases, using the last known releases", "source", releaseSourceGithub, "last_known_source", releaseSourceRegistry, "error", "got unexpected status code 503 while determining latest release from GitHub").Return(nil).Maybe()
+		return plugin, kv
+	}
+
+	storedReleases := func(t *testing.T, kv *fakeKVStore) knownReleases {
+		var releases knownReleases
+		require.NoError(t, json.Unmarshal(kv.get(lastKnownReleasesKey), &releases))
+		return releases
+	}
+
+	t.Run("github releases are fetched with the token and stored", func(t *testing.T) {
+		requests, header := newGithubReleasesServer(t, http.StatusOK)
+		plugin, kv := setup(t)
+		plugin.configuration.GithubToken = "github-token"
+
+		latest, err := plugin.latestRelease()
+		require.NoError(t, err)
+		assert.Equal(t, "10.6.0-rc1", latest)
+		assert.Equal(t, "Bearer github-token", header.Get("Authorization"))
+
+		tags, err := plugin.releaseTags()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"10.5.1", "10.6.0-rc1", "10.4.3"}, tags)
+		assert.Equal(t, 1, *requests)
+
+		releases := storedReleases(t, kv)
+		assert.Equal(t, releaseSourceGithub, releases.Source)
+		assert.Equal(t, "10.6.0-rc1", releases.Latest)
+	})
+
+	t.Run("releases stored recently by another node are reused", func(t *testing.T) {
+		requests, _ := newGithubReleasesServer(t, http.StatusOK)
+		plugin, kv := setup(t)
+		require.NoError(t, plugin.storeLastKnownReleases(&knownReleases{Source: releaseSourceGithub, Latest: "10.5.0", Tags: []string{"10.5.0"}, UpdateAt: time.Now().UnixMilli()}))
+
+		latest, err := plugin.latestRelease()
+		require.NoError(t, err)
+		assert.Equal(t, "10.5.0", latest)
+		assert.Equal(t, 0, *requests)
+		assert.Equal(t, "10.5.0", storedReleases(t, kv).Latest)
+	})
+
+	t.Run("the last known releases are used when the source is unavailable", func(t *testing.T) {
+		newGithubReleasesServer(t, http.StatusServiceUnavailable)
+		plugin, _ := setup(t)
+		require.NoError(t, plugin.storeLastKnownReleases(&knownReleases{Source: releaseSourceRegistry, Latest: "10.4.3", Tags: []string{"10.4.3"}, UpdateAt: time.Now().Add(-time.Hour).UnixMilli()}))
+
+		latest, err := plugin.latestRelease()
+		require.NoError(t, err)
+		assert.Equal(t, "10.4.3", latest)
+	})
+
+	t.Run("errors are returned without last known releases", func(t *testing.T) {
+		newGithubReleasesServer(t, http.StatusServiceUnavailable)
+		plugin, _ := setup(t)
+
+		_, err := plugin.latestRelease()
+		require.EqualError(t, err, "got unexpected status code 503 while determining latest release from GitHub")
+	})
+
+	t.Run("registry releases", func(t *testing.T) {
+		plugin, kv := setup(t)
+		plugin.configuration.ReleaseSource = releaseSourceRegistry
+		plugin.dockerClient = &MockedDockerClient{tags: testRegistryTags}
+
+		latest, err := plugin.latestRelease()
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0", latest)
+		assert.Equal(t, releaseSourceRegistry, storedReleases(t, kv).Source)
+
+		tags, err := plugin.releaseTags()
+		require.NoError(t, err)
+		assert.NotContains(t, tags, "master")
+		assert.Contains(t, tags, "10.1.0-rc10")
+	})
+
+	t.Run("registry errors are returned", func(t *testing.T) {
+		plugin, _ := setup(t)
+		plugin.configuration.ReleaseSource = releaseSourceRegistry
+		plugin.dockerClient = &MockedDockerClient{listTagsErr: errors.New("registry down")}
+
+		_, err := plugin.latestRelease()
+		require.EqualError(t, err, "failed to list the tags of mattermost/mattermost-enterprise-edition: registry down")
+	})
+
+	t.Run("pinned version", func(t *testing.T) {
+		plugin, kv := setup(t)
+		plugin.configuration.ReleaseSource = releaseSourcePinned
+		plugin.configuration.PinnedReleaseVersion = "10.4.3"
+		plugin.dockerClient = &MockedDockerClient{tags: testRegistryTags}
+
+		tag, err := plugin.resolveVersionSpec(versionSpecLatest, imageEE)
+		require.NoError(t, err)
+		assert.Equal(t, "10.4.3", tag, "the pinned version takes precedence over the registry tags")
+
+		tags, err := plugin.releaseTags()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"10.4.3"}, tags)
+		assert.Nil(t, kv.get(lastKnownReleasesKey))
+	})
+
+	t.Run("the cache can be reset while it is read", func(t *testing.T) {
+		plugin, _ := setup(t)
+		plugin.configuration.ReleaseSource = releaseSourcePinned
+		plugin.configuration.PinnedReleaseVersion = "10.4.3"
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				latest, err := plugin.latestRelease()
+				assert.NoError(t, err)
+				assert.Equal(t, "10.4.3", latest)
+			}()
+			go func() {
+				defer wg.Done()
+				plugin.setReleaseCache(nil)
+			}()
+		}
+		wg.Wait()
+	})
+}
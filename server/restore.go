@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	cloud "github.com/mattermost/mattermost-cloud/model"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	// StoreDeletedInstallationKeyPrefix prefixes the key keeping the record of
+	// an installation deleted through the plugin so it can be restored.
+	StoreDeletedInstallationKeyPrefix = "deleted_install_"
+
+	// deletedInstallationRetention is how long deleted installation records are
+	// kept. It comfortably outlasts the provisioner deletion-pending window.
+	deletedInstallationRetention = 7 * 24 * time.Hour
+)
+
+func deletedInstallationKey(installationID string) string {
+	return StoreDeletedInstallationKeyPrefix + installationID
+}
+
+// storeDeletedInstallation keeps a copy of a deleted installation record until
+// it is restored or the retention period expires.
+func (p *Plugin) storeDeletedInstallation(install *Installation) error {
+	installJSON, err := json.Marshal(install)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal installation")
+	}
+
+	_, appErr := p.API.KVSetWithOptions(deletedInstallationKey(install.ID), installJSON, model.PluginKVSetOptions{
+		ExpireInSeconds: int64(deletedInstallationRetention / time.Second),
+	})
+	if appErr != nil {
+		return errors.Wrapf(appErr, "unable to store deleted installation %s", install.ID)
+	}
+
+	return nil
+}
+
+func (p *Plugin) getDeletedInstallation(installationID string) (*Installation, error) {
+	installJSON, appErr := p.API.KVGet(deletedInstallationKey(installationID))
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "unable to get deleted installation")
+	}
+	if installJSON == nil {
+		return nil, nil
+	}
+
+	var install *Installation
+	if err := json.Unmarshal(installJSON, &install); err != nil {
+		return nil, errors.Wrap(err, "unable to unmarshal deleted installation")
+	}
+
+	return install, nil
+}
+
+// cloudInstallationName returns the plugin name of a provisioner
+// installation, falling back to the first label of its DNS name.
+func cloudInstallationName(cloudInstall *cloud.InstallationDTO) string {
+	if cloudInstall.Name != "" {
+		return standardizeName(cloudInstall.Name)
+	}
+	if len(cloudInstall.DNSRecords) > 0 && cloudInstall.DNSRecords[0] != nil {
+		return standardizeName(strings.Split(cloudInstall.DNSRecords[0].DomainName, ".")[0])
+	}
+	return ""
+}
+
+// restoreInstallationForUser cancels the pending deletion of an installation
+// owned by the user and puts it back in the KV store under its original name.
+func (p *Plugin) restoreInstallationForUser(userID string, ref InstallationRef) (InstallationActionResult, error) {
+	if err := ref.validate(); err != nil {
+		return InstallationActionResult{}, err
+	}
+	ref.Name = standardizeName(ref.Name)
+
+	cloudInstalls, err := p.cloudClient.GetInstallations(&cloud.GetInstallationsRequest{
+		OwnerID:            userID,
+		IncludeGroupConfig: true,
+		Paging:             cloud.AllPagesNotDeleted(),
+	})
+	if err != nil {
+		return InstallationActionResult{}, errors.Wrap(err, "unable to get installations from cloud server")
+	}
+
+	var target *cloud.InstallationDTO
+	for _, cloudInstall := range cloudInstalls {
+		if cloudInstall == nil || cloudInstall.Installation == nil || cloudInstall.OwnerID != userID {
+			continue
+		}
+		if cloudInstall.ID == ref.ID || (ref.Name != "" && cloudInstallationName(cloudInstall) == ref.Name) {
+			target = cloudInstall
+			break
+		}
+	}
+	if target == nil {
+		if ref.Name != "" {
+			return InstallationActionResult{}, errors.Errorf("no installation with the name %s found", ref.Name)
+		}
+		return InstallationActionResult{}, errors.Errorf("no installation with the id %s found", ref.ID)
+	}
+	if target.State != cloud.InstallationStateDeletionPending {
+		return InstallationActionResult{}, errors.Errorf("installation state is currently %s and must be %s to restore", target.State, cloud.InstallationStateDeletionPending)
+	}
+
+	install, _, err := p.getInstallationRecord(target.ID)
+	if err != nil {
+		return InstallationActionResult{}, err
+	}
+	stored := install != nil
+	if !stored {
+		install, err = p.getDeletedInstallation(target.ID)
+		if err != nil {
+			return InstallationActionResult{}, err
+		}
+		if install == nil {
+			install = &Installation{Name: cloudInstallationName(target), Tag: target.Version}
+		}
+
+		reservedID, appErr := p.API.KVGet(nameIndexKey(install.Name))
+		if appErr != nil {
+			return InstallationActionResult{}, errors.Wrap(appErr, "trouble looking up existing installations")
+		}
+		if reservedID != nil && string(reservedID) != target.ID {
+			return InstallationActionResult{}, errors.Errorf("the name %s is now used by another installation", install.Name)
+		}
+	}
+
+	if err = p.cloudClient.CancelInstallationDeletion(target.ID); err != nil {
+		return InstallationActionResult{}, errors.Wrap(err, "failed to cancel installation deletion")
+	}
+
+	install.InstallationDTO = *target
+	install.State = cloud.InstallationStateDeletionCancellationRequested
+	if stored {
+		err = p.updateInstallation(install)
+	} else {
+		err = p.storeInstallation(install)
+	}
+	if err != nil {
+		return InstallationActionResult{}, errors.Wrap(err, "failed to store restored installation")
+	}
+
+	if appErr := p.API.KVDelete(deletedInstallationKey(target.ID)); appErr != nil {
+		p.API.LogWarn("Failed to remove deleted installation record", "installation", target.ID, "error", appErr.Error())
+	}
+	p.recordInstallationAction(target.ID, userID, historyActionRestore)
+
+	summary, err := installationSummary(install, false)
+	if err != nil {
+		return InstallationActionResult{}, err
+	}
+	return InstallationActionResult{Installation: summary, Status: "restore_requested"}, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	cloud "github.com/mattermost/mattermost-cloud/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestoreInstallationForUser(t *testing.T) {
+	pendingInstall := func(id, name, ownerID string) *Installation {
+		install := serviceTestInstall(id, name, ownerID)
+		install.State = cloud.InstallationStateDeletionPending
+		return install
+	}
+
+	t.Run("restores a plugin deleted installation with its metadata", func(t *testing.T) {
+		install := serviceTestInstall("id1", "First", "owner1")
+		install.Tag = "9.4.0"
+		install.TestData = true
+		plugin, cloudClient, _, kv := newServiceTestPluginWithKV(t, []*Installation{install})
+
+		_, err := plugin.deleteInstallationForUser("owner1", InstallationRef{Name: "first"}, "first")
+		require.NoError(t, err)
+		assert.Nil(t, kv.get(nameIndexKey("first")))
+
+		cloudClient.mockedCloudInstallationsDTO = serviceDTOs(pendingInstall("id1", "First", "owner1"))
+		result, err := plugin.restoreInstallationForUser("owner1", InstallationRef{Name: "FIRST"})
+		require.NoError(t, err)
+		assert.Equal(t, "restore_requested", result.Status)
+		assert.Equal(t, cloud.InstallationStateDeletionCancellationRequested, result.Installation.State)
+		assert.Equal(t, "id1", cloudClient.canceledInstallationID)
+
+		restored := kv.getInstallation(t, "id1")
+		require.NotNil(t, restored)
+		assert.Equal(t, "9.4.0", restored.Tag)
+		assert.True(t, restored.TestData)
+		assert.Equal(t, "id1", string(kv.get(nameIndexKey("first"))))
+		assert.Equal(t, []string{"id1"}, kv.getOwnerIndex(t, "owner1"))
+		assert.Nil(t, kv.get(deletedInstallationKey("id1")))
+
+		events, err := plugin.getInstallationHistory("id1")
+		require.NoError(t, err)
+		require.NotEmpty(t, events)
+		assert.Equal(t, historyActionRestore, events[len(events)-1].Action)
+	})
+
+	t.Run("rebuilds the record when none was kept", func(t *testing.T) {
+		plugin, cloudClient, _, kv := newServiceTestPluginWithKV(t, nil)
+		cloudClient.mockedCloudInstallationsDTO = serviceDTOs(pendingInstall("id1", "First", "owner1"))
+
+		_, err := plugin.restoreInstallationForUser("owner1", InstallationRef{ID: "id1"})
+		require.NoError(t, err)
+
+		restored := kv.getInstallation(t, "id1")
+		require.NotNil(t, restored)
+		assert.Equal(t, "first", restored.Name)
+		assert.Equal(t, "id1", string(kv.get(nameIndexKey("first"))))
+	})
+
+	t.Run("updates an installation the provisioner moved to pending deletion", func(t *testing.T) {
+		install := pendingInstall("id1", "First", "owner1")
+		install.Shared = true
+		plugin, cloudClient, _, kv := newServiceTestPluginWithKV(t, []*Installation{install})
+		cloudClient.mockedCloudInstallationsDTO = serviceDTOs(install)
+
+		_, err := plugin.restoreInstallationForUser("owner1", InstallationRef{Name: "first"})
+		require.NoError(t, err)
+
+		restored := kv.getInstallation(t, "id1")
+		require.NotNil(t, restored)
+		assert.True(t, restored.Shared)
+		assert.Equal(t, cloud.InstallationStateDeletionCancellationRequested, restored.State)
+	})
+
+	t.Run("only the owner can restore", func(t *testing.T) {
+		plugin, cloudClient, _, _ := newServiceTestPluginWithKV(t, nil)
+		cloudClient.mockedCloudInstallationsDTO = serviceDTOs(pendingInstall("id1", "First", "owner1"))
+
+		_, err := plugin.restoreInstallationForUser("owner2", InstallationRef{Name: "first"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no installation with the name first found")
+		assert.Empty(t, cloudClient.canceledInstallationID)
+	})
+
+	t.Run("installation must be pending deletion", func(t *testing.T) {
+		plugin, cloudClient, _, _ := newServiceTestPluginWithKV(t, nil)
+		cloudClient.mockedCloudInstallationsDTO = serviceDTOs(serviceTestInstall("id1", "First", "owner1"))
+
+		_, err := plugin.restoreInstallationForUser("owner1", InstallationRef{Name: "first"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "must be deletion-pending to restore")
+		assert.Empty(t, cloudClient.canceledInstallationID)
+	})
+
+	t.Run("name taken by another installation", func(t *testing.T) {
+		plugin, cloudClient, _, _ := newServiceTestPluginWithKV(t, []*Installation{serviceTestInstall("id2", "First", "owner2")})
+		cloudClient.mockedCloudInstallationsDTO = serviceDTOs(pendingInstall("id1", "First", "owner1"))
+
+		_, err := plugin.restoreInstallationForUser("owner1", InstallationRef{Name: "first"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "the name first is now used by another installation")
+		assert.Empty(t, cloudClient.canceledInstallationID)
+	})
+
+	t.Run("provisioner failure leaves the store untouched", func(t *testing.T) {
+		plugin, cloudClient, _, kv := newServiceTestPluginWithKV(t, nil)
+		cloudClient.mockedCloudInstallationsDTO = serviceDTOs(pendingInstall("id1", "First", "owner1"))
+		cloudClient.cancelErr = errors.New("cancel failed")
+
+		_, err := plugin.restoreInstallationForUser("owner1", InstallationRef{Name: "first"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "cancel failed")
+		assert.Nil(t, kv.getInstallation(t, "id1"))
+		assert.Nil(t, kv.get(nameIndexKey("first")))
+	})
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	seedUserRoleSystemAdmin = "system_admin"
+	seedUserRoleUserManager = "user_manager"
+	seedUserRoleUser        = "user"
+	seedUserRoleGuest       = "guest"
+	seedUserRoleBot         = "bot"
+
+	maxSeedUsers = 50
+)
+
+var validSeedUserRoles = []string{
+	seedUserRoleSystemAdmin,
+	seedUserRoleUserManager,
+	seedUserRoleUser,
+	seedUserRoleGuest,
+	seedUserRoleBot,
+}
+
+// SeedUser is an extra user or bot account created during the setup of an
+// installation, in addition to the default admin and regular users.
+type SeedUser struct {
+	Username string   `json:"username"`
+	Role     string   `json:"role"`
+	Teams    []string `json:"teams,omitempty"`
+}
+
+// seedUserResult is the outcome of creating a seed user. The secret is the
+// password of a user or the access token of a bot.
+type seedUserResult struct {
+	SeedUser
+	Secret string `json:"secret,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// seedUserClient is the part of the Mattermost client used to create seed
+// users.
+type seedUserClient interface {
+	CreateUser(ctx context.Context, user *model.User) (*model.User, *model.Response, error)
+	GetUserByUsername(ctx context.Context, userName, etag string) (*model.User, *model.Response, error)
+	UpdateUserPassword(ctx context.Context, userId, currentPassword, newPassword string) (*model.Response, error)
+	UpdateUserRoles(ctx context.Context, userId, roles string) (*model.Response, error)
+	DemoteUserToGuest(ctx context.Context, guestId string) (*model.Response, error)
+	CreateBot(ctx context.Context, bot *model.Bot) (*model.Bot, *model.Response, error)
+	CreateUserAccessToken(ctx context.Context, userId, description string) (*model.UserAccessToken, *model.Response, error)
+	GetTeamByName(ctx context.Context, name, etag string) (*model.Team, *model.Response, error)
+	CreateTeam(ctx context.Context, team *model.Team) (*model.Team, *model.Response, error)
+	AddTeamMember(ctx context.Context, teamId, userId string) (*model.TeamMember, *model.Response, error)
+}
+
+// parseSeedUsers parses seed user specs in form username:role, optionally
+// followed by :team1+team2 to add the user to teams.
+func parseSeedUsers(values []string) ([]SeedUser, error) {
+	users := []SeedUser{}
+	usernames := []string{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		user, err := parseSeedUser(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid user %s", value)
+		}
+		if Contains(usernames, user.Username) {
+			return nil, errors.Errorf("invalid user %s: user %s is defined more than once", value, user.Username)
+		}
+		usernames = append(usernames, user.Username)
+		users = append(users, user)
+	}
+
+	if len(users) > maxSeedUsers {
+		return nil, errors.Errorf("invalid users: at most %d users can be created, got %d", maxSeedUsers, len(users))
+	}
+
+	return users, nil
+}
+
+func parseSeedUser(value string) (SeedUser, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return SeedUser{}, errors.New("must be in form username:role or username:role:team1+team2")
+	}
+
+	user := SeedUser{
+		Username: strings.ToLower(strings.TrimSpace(parts[0])),
+		Role:     strings.ToLower(strings.TrimSpace(parts[1])),
+	}
+	if !model.IsValidUsername(user.Username) {
+		return SeedUser{}, errors.Errorf("%s is not a valid username", user.Username)
+	}
+	if user.Username == defaultAdminUsername || user.Username == defaultUserUsername {
+		return SeedUser{}, errors.Errorf("username %s is reserved for the default users", user.Username)
+	}
+	if !Contains(validSeedUserRoles, user.Role) {
+		return SeedUser{}, errors.Errorf("role must be one of %s", strings.Join(validSeedUserRoles, ", "))
+	}
+
+	if len(parts) == 3 {
+		for _, team := range strings.Split(parts[2], "+") {
+			team = strings.ToLower(strings.TrimSpace(team))
+			if !model.IsValidTeamName(team) {
+				return SeedUser{}, errors.Errorf("%s is not a valid team name", team)
+			}
+			if !Contains(user.Teams, team) {
+				user.Teams = append(user.Teams, team)
+			}
+		}
+	}
+
+	return user, nil
+}
+
+// validateSeedUsersLicense checks the license of the installation supports
+// the roles of the seed users. Guest accounts require a license.
+func validateSeedUsersLicense(users []SeedUser, license string) error {
+	if license != licenseOptionTE {
+		return nil
+	}
+	for _, user := range users {
+		if user.Role == seedUserRoleGuest {
+			return errors.Errorf("invalid user %s: guest accounts require a license, license option %s has none", user.String(), licenseOptionTE)
+		}
+	}
+	return nil
+}
+
+// String returns the spec the seed user was parsed from.
+func (user SeedUser) String() string {
+	spec := user.Username + ":" + user.Role
+	if len(user.Teams) > 0 {
+		spec += ":" + strings.Join(user.Teams, "+")
+	}
+	return spec
+}
+
+func seedUserSpecs(users []SeedUser) []string {
+	specs := make([]string, 0, len(users))
+	for _, user := range users {
+		specs = append(specs, user.String())
+	}
+	return specs
+}
+
+// setupSeedUsers creates the seed users of the installation. Users failing
+// to be created don't fail the setup and are reported to the owner instead.
+func (p *Plugin) setupSeedUsers(setup *installationSetup) error {
+	if len(setup.install.SeedUsers) == 0 {
+		return nil
+	}
+
+	if err := p.enableSeedUserSettings(setup.client, setup.install.SeedUsers); err != nil {
+		return err
+	}
+
+	setup.state.SeedUsers = p.createSeedUsers(setup.client, setup.install)
+
+	return nil
+}
+
+// enableSeedUserSettings enables the guest accounts and bot settings the seed
+// users need.
+func (p *Plugin) enableSeedUserSettings(client *model.Client4, users []SeedUser) error {
+	var guests, bots bool
+	for _, user := range users {
+		guests = guests || user.Role == seedUserRoleGuest
+		bots = bots || user.Role == seedUserRoleBot
+	}
+	if !guests && !bots {
+		return nil
+	}
+
+	config, err := getInstallationConfig(client)
+	if err != nil {
+		return err
+	}
+	if guests {
+		config.GuestAccountsSettings.Enable = NewBool(true)
+	}
+	if bots {
+		config.ServiceSettings.EnableBotAccountCreation = NewBool(true)
+		config.ServiceSettings.EnableUserAccessTokens = NewBool(true)
+	}
+	if _, _, err = client.UpdateConfig(context.Background(), config); err != nil {
+		return errors.Wrap(err, "unable to enable guest accounts and bots for seed users")
+	}
+
+	return nil
+}
+
+func (p *Plugin) createSeedUsers(client seedUserClient, install *Installation) []seedUserResult {
+	results := make([]seedUserResult, 0, len(install.SeedUsers))
+	for _, user := range install.SeedUsers {
+		result := seedUserResult{SeedUser: user}
+
+		var userID string
+		var err error
+		if user.Role == seedUserRoleBot {
+			userID, result.Secret, err = createSeedBot(client, user)
+		} else {
+			result.Secret = generateRandomPassword(user.Username)
+			userID, err = createSeedUser(client, user, result.Secret)
+		}
+		if err == nil {
+			err = addSeedUserToTeams(client, user, userID)
+		}
+
+		if err != nil {
+			// A user which was created keeps its password even when it
+			// couldn't be given its role or join its teams.
+			if userID == "" {
+				result.Secret = ""
+			}
+			result.Error = err.Error()
+			p.API.LogWarn("Failed to create installation seed user", "installation", install.Name, "user", user.Username, "error", result.Error)
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// createSeedUser creates the user with the given password and role. A user
+// created by an interrupted attempt is given the new password. The ID of a
+// user which was created is returned even when it couldn't be given its role,
+// so that its password is kept.
+func createSeedUser(client seedUserClient, user SeedUser, password string) (string, error) {
+	created, _, err := client.CreateUser(context.Background(), &model.User{
+		Username: user.Username,
+		Password: password,
+		Email:    fmt.Sprintf("success+%s@simulator.amazonses.com", user.Username),
+	})
+	if err != nil {
+		existing, _, getErr := client.GetUserByUsername(context.Background(), user.Username, "")
+		if getErr != nil || existing == nil || existing.IsBot {
+			return "", errors.Wrap(err, "failed to create user")
+		}
+		if _, err = client.UpdateUserPassword(context.Background(), existing.Id, "", password); err != nil {
+			return "", errors.Wrap(err, "failed to reset the password of the existing user")
+		}
+		created = existing
+	}
+
+	switch user.Role {
+	case seedUserRoleSystemAdmin:
+		_, err = client.UpdateUserRoles(context.Background(), created.Id, model.SystemUserRoleId+" "+model.SystemAdminRoleId)
+	case seedUserRoleUserManager:
+		_, err = client.UpdateUserRoles(context.Background(), created.Id, model.SystemUserRoleId+" "+model.SystemUserManagerRoleId)
+	case seedUserRoleGuest:
+		_, err = client.DemoteUserToGuest(context.Background(), created.Id)
+	}
+	if err != nil {
+		return created.Id, errors.Wrapf(err, "failed to give the user the %s role", user.Role)
+	}
+
+	return created.Id, nil
+}
+
+// createSeedBot creates the bot and an access token for it. A bot created by
+// an interrupted attempt is given a new token.
+func createSeedBot(client seedUserClient, user SeedUser) (string, string, error) {
+	var botUserID string
+	bot, _, err := client.CreateBot(context.Background(), &model.Bot{
+		Username:    user.Username,
+		DisplayName: user.Username,
+		Description: "Seed bot created by the cloud plugin",
+	})
+	if err == nil {
+		botUserID = bot.UserId
+	} else {
+		existing, _, getErr := client.GetUserByUsername(context.Background(), user.Username, "")
+		if getErr != nil || existing == nil || !existing.IsBot {
+			return "", "", errors.Wrap(err, "failed to create bot")
+		}
+		botUserID = existing.Id
+	}
+
+	token, _, err := client.CreateUserAccessToken(context.Background(), botUserID, "Created by the cloud plugin")
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to create bot access token")
+	}
+
+	return botUserID, token.Token, nil
+}
+
+// addSeedUserToTeams adds the user to its teams, creating the teams which
+// don't exist yet.
+func addSeedUserToTeams(client seedUserClient, user SeedUser, userID string) error {
+	for _, name := range user.Teams {
+		team, _, err := client.GetTeamByName(context.Background(), name, "")
+		if err != nil || team == nil {
+			team, _, err = client.CreateTeam(context.Background(), &model.Team{
+				Name:        name,
+				DisplayName: name,
+				Type:        model.TeamOpen,
+			})
+			if err != nil {
+				return errors.Wrapf(err, "failed to create team %s", name)
+			}
+		}
+		if _, _, err = client.AddTeamMember(context.Background(), team.Id, userID); err != nil {
+			return errors.Wrapf(err, "failed to add the user to team %s", name)
+		}
+	}
+
+	return nil
+}
+
+// createdSeedUsers returns the seed users which were created.
+func createdSeedUsers(results []seedUserResult) []seedUserResult {
+	created := []seedUserResult{}
+	for _, result := range results {
+		if result.Secret != "" {
+			created = append(created, result)
+		}
+	}
+	return created
+}
+
+// seedUserTableRows describes the seed users as rows of the credentials
+// table sent to the owner.
+func seedUserTableRows(results []seedUserResult) string {
+	rows := ""
+	for _, result := range results {
+		secret := "-"
+		if result.Secret != "" {
+			secret = inlineCode(result.Secret)
+		}
+		note := seedUserNote(result.SeedUser)
+		if result.Error != "" {
+			note = "Failed: " + result.Error
+		}
+		rows += fmt.Sprintf("| %s | %s | %s |\n", inlineCode(result.Username), secret, note)
+	}
+	return rows
+}
+
+func seedUserNote(user SeedUser) string {
+	var note string
+	switch user.Role {
+	case seedUserRoleSystemAdmin:
+		note = "System admin"
+	case seedUserRoleUserManager:
+		note = "User manager"
+	case seedUserRoleGuest:
+		note = "Guest"
+	case seedUserRoleBot:
+		note = "Bot, the password is its access token"
+	default:
+		note = "Regular user"
+	}
+	if len(user.Teams) > 0 {
+		note += ", teams: " + strings.Join(user.Teams, ", ")
+	}
+	return note
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSeedUserClient struct {
+	users       map[string]*model.User
+	teams       map[string]*model.Team
+	roles       map[string]string
+	guests      []string
+	passwords   map[string]string
+	memberships map[string][]string
+	createErr   map[string]error
+	demoteErr   error
+}
+
+func newFakeSeedUserClient() *fakeSeedUserClient {
+	return &fakeSeedUserClient{
+		users:       map[string]*model.User{},
+		teams:       map[string]*model.Team{},
+		roles:       map[string]string{},
+		passwords:   map[string]string{},
+		memberships: map[string][]string{},
+		createErr:   map[string]error{},
+	}
+}
+
+func (c *fakeSeedUserClient) CreateUser(ctx context.Context, user *model.User) (*model.User, *model.Response, error) {
+	if err := c.createErr[user.Username]; err != nil {
+		return nil, nil, err
+	}
+	if _, ok := c.users[user.Username]; ok {
+		return nil, nil, errors.New("username already taken")
+	}
+	user.Id = "id-" + user.Username
+	c.users[user.Username] = user
+	c.passwords[user.Id] = user.Password
+	return user, nil, nil
+}
+
+func (c *fakeSeedUserClient) GetUserByUsername(ctx context.Context, userName, etag string) (*model.User, *model.Response, error) {
+	if user, ok := c.users[userName]; ok {
+		return user, nil, nil
+	}
+	return nil, nil, errors.New("not found")
+}
+
+func (c *fakeSeedUserClient) UpdateUserPassword(ctx context.Context, userId, currentPassword, newPassword string) (*model.Response, error) {
+	c.passwords[userId] = newPassword
+	return nil, nil
+}
+
+func (c *fakeSeedUserClient) UpdateUserRoles(ctx context.Context, userId, roles string) (*model.Response, error) {
+	c.roles[userId] = roles
+	return nil, nil
+}
+
+func (c *fakeSeedUserClient) DemoteUserToGuest(ctx context.Context, guestId string) (*model.Response, error) {
+	if c.demoteErr != nil {
+		return nil, c.demoteErr
+	}
+	c.guests = append(c.guests, guestId)
+	return nil, nil
+}
+
+func (c *fakeSeedUserClient) CreateBot(ctx context.Context, bot *model.Bot) (*model.Bot, *model.Response, error) {
+	if _, ok := c.users[bot.Username]; ok {
+		return nil, nil, errors.New("username already taken")
+	}
+	bot.UserId = "id-" + bot.Username
+	c.users[bot.Username] = &model.User{Id: bot.UserId, Username: bot.Username, IsBot: true}
+	return bot, nil, nil
+}
+
+func (c *fakeSeedUserClient) CreateUserAccessToken(ctx context.Context, userId, description string) (*model.UserAccessToken, *model.Response, error) {
+	return &model.UserAccessToken{UserId: userId, Token: "token-" + userId}, nil, nil
+}
+
+func (c *fakeSeedUserClient) GetTeamByName(ctx context.Context, name, etag string) (*model.Team, *model.Response, error) {
+	if team, ok := c.teams[name]; ok {
+		return team, nil, nil
+	}
+	return nil, nil, errors.New("not found")
+}
+
+func (c *fakeSeedUserClient) CreateTeam(ctx context.Context, team *model.Team) (*model.Team, *model.Response, error) {
+	team.Id = "team-" + team.Name
+	c.teams[team.Name] = team
+	return team, nil, nil
+}
+
+func (c *fakeSeedUserClient) AddTeamMember(ctx context.Context, teamId, userId string) (*model.TeamMember, *model.Response, error) {
+	c.memberships[teamId] = append(c.memberships[teamId], userId)
+	return &model.TeamMember{TeamId: teamId, UserId: userId}, nil, nil
+}
+
+func TestParseSeedUsers(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		users, err := parseSeedUsers([]string{"Alice:system_admin", " bob:user_manager:qa+support+qa ", "", "ci:bot"})
+		require.NoError(t, err)
+		assert.Equal(t, []SeedUser{
+			{Username: "alice", Role: seedUserRoleSystemAdmin},
+			{Username: "bob", Role: seedUserRoleUserManager, Teams: []string{"qa", "support"}},
+			{Username: "ci", Role: seedUserRoleBot},
+		}, users)
+		assert.Equal(t, []string{"alice:system_admin", "bob:user_manager:qa+support", "ci:bot"}, seedUserSpecs(users))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, values := range [][]string{
+			{"alice"},
+			{"alice:guest:qa:extra"},
+			{"alice:owner"},
+			{"admin:user"},
+			{"1x:user"},
+			{"alice:guest:q"},
+			{"alice:user", "alice:guest"},
+		} {
+			_, err := parseSeedUsers(values)
+			require.Error(t, err, values)
+			assert.Contains(t, err.Error(), "invalid user")
+		}
+	})
+}
+
+func TestCreateSeedUsers(t *testing.T) {
+	plugin, _, _ := newServiceTestPlugin(t, nil)
+	install := setupTestInstall("id1", "first", "owner1")
+	install.SeedUsers = []SeedUser{
+		{Username: "alice", Role: seedUserRoleSystemAdmin},
+		{Username: "bob", Role: seedUserRoleUserManager, Teams: []string{"qa"}},
+		{Username: "carol", Role: seedUserRoleGuest, Teams: []string{"qa", "support"}},
+		{Username: "ci", Role: seedUserRoleBot, Teams: []string{"qa"}},
+		{Username: "dave", Role: seedUserRoleUser},
+	}
+
+	t.Run("creates users, bots and teams", func(t *testing.T) {
+		client := newFakeSeedUserClient()
+		client.teams["qa"] = &model.Team{Id: "existing-qa", Name: "qa"}
+
+		results := plugin.createSeedUsers(client, install)
+
+		require.Len(t, results, 5)
+		for _, result := range results {
+			assert.Empty(t, result.Error, result.Username)
+			assert.NotEmpty(t, result.Secret, result.Username)
+		}
+		assert.Equal(t, client.passwords["id-alice"], results[0].Secret)
+		assert.Equal(t, "token-id-ci", results[3].Secret)
+
+		assert.Equal(t, "system_user system_admin", client.roles["id-alice"])
+		assert.Equal(t, "system_user system_user_manager", client.roles["id-bob"])
+		assert.Empty(t, client.roles["id-dave"])
+		assert.Equal(t, []string{"id-carol"}, client.guests)
+		assert.Equal(t, []string{"id-bob", "id-carol", "id-ci"}, client.memberships["existing-qa"])
+		assert.Equal(t, []string{"id-carol"}, client.memberships["team-support"])
+	})
+
+	t.Run("resets the password of users created by an interrupted attempt", func(t *testing.T) {
+		client := newFakeSeedUserClient()
+		client.users["alice"] = &model.User{Id: "id-alice", Username: "alice"}
+		client.users["ci"] = &model.User{Id: "id-ci", Username: "ci", IsBot: true}
+
+		results := plugin.createSeedUsers(client, install)
+
+		assert.Empty(t, results[0].Error)
+		assert.Equal(t, client.passwords["id-alice"], results[0].Secret)
+		assert.Equal(t, "token-id-ci", results[3].Secret)
+	})
+
+	t.Run("reports users failing to be created", func(t *testing.T) {
+		plugin, _, api := newServiceTestPlugin(t, nil)
+		api.On("LogWarn", "Failed to create installation seed user", "installation", "first", "user", "bob", "error", "failed to create user: email domain not allowed").Return()
+		client := newFakeSeedUserClient()
+		client.createErr["bob"] = errors.New("email domain not allowed")
+
+		results := plugin.createSeedUsers(client, install)
+
+		assert.Equal(t, "failed to create user: email domain not allowed", results[1].Error)
+		assert.Empty(t, results[1].Secret)
+		assert.Empty(t, results[2].Error)
+		assert.Len(t, createdSeedUsers(results), 4)
+
+		rows := seedUserTableRows(results)
+		assert.Contains(t, rows, "| `alice` | `"+results[0].Secret+"` | System admin |")
+		assert.Contains(t, rows, "| `bob` | - | Failed: failed to create user: email domain not allowed |")
+		assert.Contains(t, rows, "| `carol` | `"+results[2].Secret+"` | Guest, teams: qa, support |")
+		assert.Contains(t, rows, "| `ci` | `token-id-ci` | Bot, the password is its access token, teams: qa |")
+	})
+
+	t.Run("keeps the password of users failing to get their role", func(t *testing.T) {
+		plugin, _, api := newServiceTestPlugin(t, nil)
+		api.On("LogWarn", "Failed to create installation seed user", "installation", "first", "user", "carol", "error", "failed to give the user the guest role: guest accounts are disabled").Return()
+		client := newFakeSeedUserClient()
+		client.demoteErr = errors.New("guest accounts are disabled")
+
+		results := plugin.createSeedUsers(client, install)
+
+		assert.Equal(t, "failed to give the user the guest role: guest accounts are disabled", results[2].Error)
+		assert.Equal(t, client.passwords["id-carol"], results[2].Secret)
+		assert.Len(t, createdSeedUsers(results), 5)
+	})
+}
+
+func TestValidateSeedUsersLicense(t *testing.T) {
+	users := []SeedUser{{Username: "alice", Role: seedUserRoleUser}, {Username: "carol", Role: seedUserRoleGuest}}
+
+	require.NoError(t, validateSeedUsersLicense(users, licenseOptionProfessional))
+	require.NoError(t, validateSeedUsersLicense(users[:1], licenseOptionTE))
+	require.EqualError(t, validateSeedUsersLicense(users, licenseOptionTE), "invalid user carol:guest: guest accounts require a license, license option te has none")
+}
+
+func TestInstallationReadyMessageSeedUsers(t *testing.T) {
+	install := setupTestInstall("id1", "first", "owner1")
+	state := &installationSetupState{
+		AdminPassword: "admin@pass",
+		UserPassword:  "user@pass",
+		SeedUsers: []seedUserResult{
+			{SeedUser: SeedUser{Username: "alice", Role: seedUserRoleUserManager}, Secret: "alice@pass"},
+		},
+	}
+
+	message, err := installationReadyMessage(install, state)
+	require.NoError(t, err)
+	assert.Contains(t, message, "| `user` | `user@pass` | Regular user |\n| `alice` | `alice@pass` | User manager |\n")
+}
@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/blang/semver/v4"
 	cloud "github.com/mattermost/mattermost-cloud/model"
 	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/pkg/errors"
@@ -20,40 +22,342 @@ const (
 	defaultUserEmail    = "success+user@simulator.amazonses.com"
 )
 
-func (p *Plugin) setupInstallation(install *Installation, adminPassword, userPassword string) error {
-	if len(install.DNSRecords) == 0 {
-		return fmt.Errorf("Installation %s doesn't have any DNSRecords", install.ID)
+// marketplacePlugin is a plugin to install from the marketplace. The latest
+// compatible version is installed when no version is given.
+type marketplacePlugin struct {
+	ID      string
+	Version string
+}
+
+// pluginSetupResult is the outcome of installing and enabling a plugin.
+type pluginSetupResult struct {
+	Plugin  string
+	Version string
+	Err     error
+}
+
+// parseMarketplacePlugin parses a plugin given as its ID, optionally followed
+// by @ and a version, such as com.mattermost.plugin-jira@4.1.0.
+func parseMarketplacePlugin(value string) (marketplacePlugin, error) {
+	id, version, _ := strings.Cut(strings.TrimSpace(value), "@")
+	if !model.IsValidPluginId(id) {
+		return marketplacePlugin{}, errors.Errorf("invalid plugin %s: plugin IDs may only contain letters, numbers, dots, hyphens, and underscores", value)
+	}
+	if version != "" {
+		if _, err := semver.Parse(version); err != nil {
+			return marketplacePlugin{}, errors.Errorf("invalid plugin %s: %s is not a valid version", value, version)
+		}
 	}
 
-	client := model.NewAPIv4Client(fmt.Sprintf("https://%s", install.DNSRecords[0].DomainName))
-	if client == nil {
-		return errors.New("got nil APIv4 Mattermost client for some reason")
+	return marketplacePlugin{ID: id, Version: version}, nil
+}
+
+// parseMarketplacePlugins validates the plugins to install and returns them
+// with surrounding whitespace removed. Each plugin may only be given once.
+func parseMarketplacePlugins(values []string) ([]string, error) {
+	plugins := []string{}
+	ids := []string{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		plugin, err := parseMarketplacePlugin(value)
+		if err != nil {
+			return nil, err
+		}
+		if Contains(ids, plugin.ID) {
+			return nil, errors.Errorf("invalid plugin %s: plugin %s is defined more than once", value, plugin.ID)
+		}
+		ids = append(ids, plugin.ID)
+		plugins = append(plugins, value)
 	}
 
-	err := p.waitForDNS(client)
+	return plugins, nil
+}
+
+// installationSetup is a run of the setup steps of an installation.
+type installationSetup struct {
+	install *Installation
+	state   *installationSetupState
+	client  *model.Client4
+}
+
+// setupStep is a step of the installation setup. Completed steps are skipped
+// when the setup is resumed, except for repeated steps which prepare the
+// following ones, such as logging in.
+type setupStep struct {
+	Name     string
+	Run      func(p *Plugin, setup *installationSetup) error
+	Repeated bool
+}
+
+// installationSetupSteps are run in order to set up a new installation.
+var installationSetupSteps = []setupStep{
+	{Name: setupStepDNS, Run: (*Plugin).setupWaitForDNS},
+	{Name: setupStepAdmin, Run: (*Plugin).setupCreateAdmin},
+	{Name: setupStepLogin, Run: (*Plugin).setupLogin, Repeated: true},
+	{Name: setupStepConfiguration, Run: (*Plugin).setupConfiguration},
+	{Name: setupStepConfigOverrides, Run: (*Plugin).setupConfigOverrides},
+	{Name: setupStepPlugins, Run: (*Plugin).setupPlugins},
+	{Name: setupStepTestData, Run: (*Plugin).setupTestData},
+	{Name: setupStepUser, Run: (*Plugin).setupCreateUser},
+	{Name: setupStepSeedUsers, Run: (*Plugin).setupSeedUsers},
+}
+
+// runInstallationSetup runs the setup steps of the installation which
+// haven't completed yet, recording the progress after each step, and sends
+// the owner the installation details once it is ready. The setup must have
+// been claimed with claimInstallationSetup.
+func (p *Plugin) runInstallationSetup(install *Installation, state *installationSetupState) {
+	if err := p.runSetupSteps(install, state, installationSetupSteps); err != nil {
+		p.API.LogError(err.Error(), "installation", install.Name)
+		return
+	}
+
+	message, err := installationReadyMessage(install, state)
 	if err != nil {
-		return errors.Wrap(err, "encountered an error waiting for installation DNS")
+		p.API.LogError(err.Error(), "installation", install.Name)
+		return
+	}
+	if err = p.reportInstallationReady(install, message); err != nil {
+		p.API.LogError(err.Error(), "installation", install.Name)
+		p.PostBotDM(install.OwnerID, message)
 	}
 
-	err = p.createAndLoginAdminUser(client, adminPassword)
+	// The passwords were sent to the owner and are only kept encrypted, so
+	// that they can be sent again with /cloud credentials.
+	err = p.storeInstallationCredentials(install.ID, &installationCredentials{
+		AdminPassword: state.AdminPassword,
+		UserPassword:  state.UserPassword,
+		SeedUsers:     createdSeedUsers(state.SeedUsers),
+	})
 	if err != nil {
-		return errors.Wrap(err, "encountered an error creating installation admin account")
+		p.API.LogWarn("Failed to store installation credentials", "installation", install.Name, "error", err.Error())
+	}
+
+	state.Status = setupStatusComplete
+	state.AdminPassword = ""
+	state.UserPassword = ""
+	state.SeedUsers = nil
+	if err = p.storeInstallationSetupState(install.ID, state); err != nil {
+		p.API.LogError(err.Error(), "installation", install.Name)
+	}
+}
+
+func (p *Plugin) runSetupSteps(install *Installation, state *installationSetupState, steps []setupStep) error {
+	if len(install.DNSRecords) == 0 {
+		return p.failInstallationSetup(install, state, "", errors.Errorf("Installation %s doesn't have any DNSRecords", install.ID))
+	}
+
+	setup := &installationSetup{
+		install: install,
+		state:   state,
+		client:  model.NewAPIv4Client(fmt.Sprintf("https://%s", install.DNSRecords[0].DomainName)),
+	}
+
+	// Steps such as waiting for DNS and creating test data take minutes.
+	stopHeartbeat := p.startInstallationSetupHeartbeat(install)
+	defer stopHeartbeat()
+
+	for _, step := range steps {
+		if !step.Repeated && Contains(state.CompletedSteps, step.Name) {
+			continue
+		}
+
+		if err := step.Run(p, setup); err != nil {
+			return p.failInstallationSetup(install, state, step.Name, err)
+		}
+
+		if !step.Repeated {
+			state.CompletedSteps = append(state.CompletedSteps, step.Name)
+			if err := p.storeInstallationSetupState(install.ID, state); err != nil {
+				return err
+			}
+			p.reportSetupProgress(install, creationStage{Name: setupStageName(step.Name)})
+		}
+	}
+
+	return nil
+}
+
+// failInstallationSetup records the step the setup failed at, so that it can
+// be retried from that step.
+func (p *Plugin) failInstallationSetup(install *Installation, state *installationSetupState, step string, err error) error {
+	state.Status = setupStatusFailed
+	state.FailedStep = step
+	state.Error = err.Error()
+	if storeErr := p.storeInstallationSetupState(install.ID, state); storeErr != nil {
+		p.API.LogWarn(storeErr.Error(), "installation", install.Name)
+	}
+	p.reportSetupProgress(install, creationStage{Name: setupStageName(step), Error: err.Error()})
+
+	if step == "" {
+		return err
 	}
+	return errors.Wrapf(err, "installation setup failed at step %s", step)
+}
+
+// reportSetupProgress reports a setup stage to the owner. Failing to report
+// it doesn't fail the setup.
+func (p *Plugin) reportSetupProgress(install *Installation, stage creationStage) {
+	if err := p.reportCreationStage(install, stage); err != nil {
+		p.API.LogWarn(err.Error(), "installation", install.Name)
+	}
+}
 
-	err = p.setupInstallationConfiguration(client, install)
+func (p *Plugin) setupWaitForDNS(setup *installationSetup) error {
+	return errors.Wrap(p.waitForDNS(setup.client), "encountered an error waiting for installation DNS")
+}
+
+// setupCreateAdmin creates the admin user. An admin created by an
+// interrupted attempt is kept when its stored password still works.
+func (p *Plugin) setupCreateAdmin(setup *installationSetup) error {
+	err := p.createUser(setup.client, defaultAdminUsername, setup.state.AdminPassword, defaultAdminEmail)
+	if err == nil {
+		return nil
+	}
+	if _, _, loginErr := setup.client.Login(context.Background(), defaultAdminUsername, setup.state.AdminPassword); loginErr == nil {
+		return nil
+	}
+	return errors.Wrap(err, "encountered an error creating installation admin account")
+}
+
+func (p *Plugin) setupLogin(setup *installationSetup) error {
+	_, _, err := setup.client.Login(context.Background(), defaultAdminUsername, setup.state.AdminPassword)
+	return errors.Wrap(err, "encountered an error logging in as the installation admin")
+}
+
+// setupConfiguration sets some basic config when the installation is not in
+// a group.
+func (p *Plugin) setupConfiguration(setup *installationSetup) error {
+	pluginConfig := p.getConfiguration()
+	if pluginConfig.GroupID != "" {
+		return nil
+	}
+
+	config, err := getInstallationConfig(setup.client)
 	if err != nil {
-		return errors.Wrap(err, "encountered an error configuring the installation")
+		return err
+	}
+
+	p.configureEmail(config, pluginConfig)
+
+	config.ServiceSettings.EnableDeveloper = NewBool(true)
+	config.TeamSettings.EnableOpenServer = NewBool(true)
+	config.PluginSettings.EnableUploads = NewBool(true)
+
+	if _, _, err = setup.client.UpdateConfig(context.Background(), config); err != nil {
+		return errors.Wrap(err, "unable to update installation config")
+	}
+
+	return nil
+}
+
+// setupConfigOverrides applies the config overrides of the installation.
+// Overrides failing to apply don't fail the setup and are reported to the
+// owner instead.
+func (p *Plugin) setupConfigOverrides(setup *installationSetup) error {
+	if len(setup.install.ConfigOverrides) == 0 {
+		return nil
 	}
 
-	// Create normal user
-	err = p.createUser(client, defaultUserUsername, userPassword, defaultUserEmail)
+	config, err := getInstallationConfig(setup.client)
 	if err != nil {
-		return errors.Wrap(err, "encountered an error creating installation user account")
+		return err
 	}
 
+	setup.state.ConfigOverrideReport = configOverrideMessage(p.applyConfigOverrides(setup.client, config, setup.install))
+
+	return nil
+}
+
+// setupPlugins installs the plugins of the installation. Plugins failing to
+// install don't fail the setup and are reported to the owner instead.
+func (p *Plugin) setupPlugins(setup *installationSetup) error {
+	setup.state.PluginReport = pluginSetupMessage(p.installPlugins(setup.client, setup.install))
 	return nil
 }
 
+func (p *Plugin) setupTestData(setup *installationSetup) error {
+	return errors.Wrap(p.createTestData(setup.client, setup.install), "unable to generate installation sample data")
+}
+
+// setupCreateUser creates the regular user, keeping a user created by an
+// interrupted attempt.
+func (p *Plugin) setupCreateUser(setup *installationSetup) error {
+	err := p.createUser(setup.client, defaultUserUsername, setup.state.UserPassword, defaultUserEmail)
+	if err == nil {
+		return nil
+	}
+	if user, _, getErr := setup.client.GetUserByUsername(context.Background(), defaultUserUsername, ""); getErr == nil && user != nil {
+		return nil
+	}
+	return errors.Wrap(err, "encountered an error creating installation user account")
+}
+
+func getInstallationConfig(client *model.Client4) (*model.Config, error) {
+	config, resp, err := client.GetConfig(context.Background())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get Mattermost config")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("got unexpected status %d while getting Mattermost config", resp.StatusCode)
+	}
+	return config, nil
+}
+
+// installationReadyMessage tells the owner how to access the installation
+// once it is set up.
+func installationReadyMessage(install *Installation, state *installationSetupState) (string, error) {
+	install.HideSensitiveFields()
+
+	installationLogsURL, err := getStringFromTemplate(installationLogsURLTmpl, install)
+	if err != nil {
+		return "", err
+	}
+
+	provisionerLogsURL, err := getStringFromTemplate(provisionerLogsURLTmpl, install)
+	if err != nil {
+		return "", err
+	}
+
+	var dnsRecord string
+	if len(install.DNSRecords) > 0 {
+		dnsRecord = install.DNSRecords[0].DomainName
+	}
+
+	return fmt.Sprintf(`
+Installation %s is ready!
+
+Access at: https://%s
+
+Login with:
+
+| Username | Password | Note |
+| -- | -- | -- |
+| %s | %s | Admin user |
+| %s | %s | Regular user |
+%s
+%sGrafana logs for this installation:
+
+- [Installation logs](%s)
+- [Provisioner logs](%s)
+
+Installation details:
+%s
+`,
+		install.Name,
+		dnsRecord,
+		inlineCode(defaultAdminUsername), inlineCode(state.AdminPassword),
+		inlineCode(defaultUserUsername), inlineCode(state.UserPassword),
+		seedUserTableRows(state.SeedUsers),
+		state.ConfigOverrideReport+state.PluginReport,
+		installationLogsURL, provisionerLogsURL,
+		jsonCodeBlock(install.ToPrettyJSON()),
+	), nil
+}
+
 func (p *Plugin) waitForDNS(client *model.Client4) error {
 	for i := 0; i < 60; i++ {
 		_, resp, err := client.GetPing(context.Background())
@@ -81,51 +385,59 @@ func (p *Plugin) createUser(client *model.Client4, username, password, email str
 	return err
 }
 
-func (p *Plugin) createAndLoginAdminUser(client *model.Client4, password string) error {
-	err := p.createUser(client, defaultAdminUsername, password, defaultAdminEmail)
-	if err != nil {
-		return err
-	}
+// installPlugins installs the plugins of the installation from the
+// marketplace and enables them.
+func (p *Plugin) installPlugins(client *model.Client4, install *Installation) []pluginSetupResult {
+	results := make([]pluginSetupResult, 0, len(install.Plugins))
+	for _, value := range install.Plugins {
+		result := pluginSetupResult{Plugin: value}
 
-	_, _, err = client.Login(context.Background(), defaultAdminUsername, password)
-	if err != nil {
-		return err
-	}
+		plugin, err := parseMarketplacePlugin(value)
+		if err != nil {
+			result.Err = err
+			results = append(results, result)
+			continue
+		}
 
-	return nil
-}
+		manifest, _, err := client.InstallMarketplacePlugin(context.Background(), &model.InstallMarketplacePluginRequest{
+			Id:      plugin.ID,
+			Version: plugin.Version,
+		})
+		if err != nil {
+			result.Err = errors.Wrap(err, "failed to install plugin")
+		} else if _, err = client.EnablePlugin(context.Background(), manifest.Id); err != nil {
+			result.Version = manifest.Version
+			result.Err = errors.Wrap(err, "failed to enable plugin")
+		} else {
+			result.Version = manifest.Version
+		}
 
-func (p *Plugin) setupInstallationConfiguration(client *model.Client4, install *Installation) error {
-	config, resp, err := client.GetConfig(context.Background())
-	if err != nil {
-		return errors.Wrap(err, "failed to get Mattermost config")
-	}
-	if resp.StatusCode != http.StatusOK {
-		return errors.New("got unexpected status %d while getting Mattermost config")
+		if result.Err != nil {
+			p.API.LogWarn("Failed to set up installation plugin", "installation", install.Name, "plugin", value, "error", result.Err.Error())
+		}
+		results = append(results, result)
 	}
 
-	pluginConfig := p.getConfiguration()
-
-	if pluginConfig.GroupID == "" {
-		// Set some basic config due to not being in a group.
-		p.configureEmail(config, pluginConfig)
-
-		config.ServiceSettings.EnableDeveloper = NewBool(true)
-		config.TeamSettings.EnableOpenServer = NewBool(true)
-		config.PluginSettings.EnableUploads = NewBool(true)
+	return results
+}
 
-		_, _, err = client.UpdateConfig(context.Background(), config)
-		if err != nil {
-			return errors.Wrap(err, "unable to update installation config")
-		}
+// pluginSetupMessage describes the outcome of installing the plugins of an
+// installation, or returns an empty string when it has no plugins.
+func pluginSetupMessage(results []pluginSetupResult) string {
+	if len(results) == 0 {
+		return ""
 	}
 
-	err = p.createTestData(client, install)
-	if err != nil {
-		return errors.Wrap(err, "unable to generate installation sample data")
+	message := "Plugins:\n\n| Plugin | Result |\n| -- | -- |\n"
+	for _, result := range results {
+		outcome := fmt.Sprintf("Installed and enabled version %s", result.Version)
+		if result.Err != nil {
+			outcome = "Failed: " + result.Err.Error()
+		}
+		message += fmt.Sprintf("| %s | %s |\n", inlineCode(result.Plugin), outcome)
 	}
 
-	return nil
+	return message
 }
 
 func (p *Plugin) configureEmail(config *model.Config, pluginConfig *configuration) {
@@ -140,32 +452,6 @@ func (p *Plugin) configureEmail(config *model.Config, pluginConfig *configuratio
 	}
 }
 
-func (p *Plugin) createTestData(client *model.Client4, install *Installation) error {
-	if !install.TestData {
-		return nil
-	}
-
-	clusterInstallations, err := p.cloudClient.GetClusterInstallations(
-		&cloud.GetClusterInstallationsRequest{
-			Paging:         cloud.AllPagesNotDeleted(),
-			InstallationID: install.ID,
-		})
-	if err != nil {
-		return errors.Wrap(err, "failed to get ClusterInstallations for Installation")
-	}
-	if len(clusterInstallations) != 1 {
-		return errors.Errorf("got unexpected number of ClusterInstallations (%d)", len(clusterInstallations))
-	}
-
-	_, err = p.cloudClient.ExecClusterInstallationCLI(clusterInstallations[0].ID, "mmctl", []string{"sampledata", "--local"})
-	if err != nil {
-		// Hitting a timeout is likely, so log and continue.
-		p.API.LogWarn(errors.Wrapf(err, "Unable to finish generating test data for cloud installation %s", install.Name).Error())
-	}
-
-	return nil
-}
-
 func generateRandomPassword(prefix string) string {
 	return fmt.Sprintf("%s@%s", prefix, cloud.NewID())
 }
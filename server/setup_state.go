@@ -0,0 +1,386 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	cloud "github.com/mattermost/mattermost-cloud/model"
+	"github.com/mattermost/mattermost/server/public/pluginapi/cluster"
+	"github.com/pkg/errors"
+)
+
+const (
+	// StoreSetupStateKeyPrefix prefixes the key recording the progress of the
+	// setup of an installation.
+	StoreSetupStateKeyPrefix = "setup_state_"
+
+	setupStatusRunning  = "running"
+	setupStatusFailed   = "failed"
+	setupStatusComplete = "complete"
+
+	setupStepDNS             = "dns"
+	setupStepAdmin           = "admin"
+	setupStepLogin           = "login"
+	setupStepConfiguration   = "configuration"
+	setupStepConfigOverrides = "config_overrides"
+	setupStepPlugins         = "plugins"
+	setupStepTestData        = "test_data"
+	setupStepUser            = "user"
+	setupStepSeedUsers       = "seed_users"
+
+	setupResumeJobKey = "setup_resume"
+
+	// setupHeartbeatInterval is how often a running setup refreshes the
+	// update time of its state.
+	setupHeartbeatInterval = 30 * time.Second
+)
+
+// setupStaleAfter is how long a running setup goes without a heartbeat before
+// it is considered interrupted and can be resumed by another node. The
+// interrupted setups are looked for at the same interval.
+var setupStaleAfter = 4 * setupHeartbeatInterval
+
+// installationSetupState records the progress of the setup of an
+// installation, so that it is resumed rather than started over when the
+// plugin restarts, and skipped when a webhook is delivered twice. The
+// passwords, including those of the seed users, are kept until the owner is
+// sent the installation details. They are only stored sealed with
+// encryptCredentials, in Credentials.
+type installationSetupState struct {
+	Status               string           `json:"status"`
+	CompletedSteps       []string         `json:"completed_steps"`
+	FailedStep           string           `json:"failed_step,omitempty"`
+	Error                string           `json:"error,omitempty"`
+	AdminPassword        string           `json:"-"`
+	UserPassword         string           `json:"-"`
+	SeedUsers            []seedUserResult `json:"-"`
+	Credentials          []byte           `json:"credentials,omitempty"`
+	ConfigOverrideReport string           `json:"config_override_report,omitempty"`
+	PluginReport         string           `json:"plugin_report,omitempty"`
+	StartAt              int64            `json:"start_at"`
+	UpdateAt             int64            `json:"update_at"`
+}
+
+func setupStateKey(installationID string) string {
+	return StoreSetupStateKeyPrefix + installationID
+}
+
+// isStale returns true when the setup is running but hasn't been updated
+// recently enough to still be run by a plugin node.
+func (state *installationSetupState) isStale(now time.Time) bool {
+	return state.Status == setupStatusRunning && now.Sub(time.UnixMilli(state.UpdateAt)) > setupStaleAfter
+}
+
+func (p *Plugin) getInstallationSetupState(installationID string) (*installationSetupState, []byte, error) {
+	stateJSON, appErr := p.API.KVGet(setupStateKey(installationID))
+	if appErr != nil {
+		return nil, nil, errors.Wrap(appErr, "unable to get installation setup state")
+	}
+	if stateJSON == nil {
+		return nil, nil, nil
+	}
+
+	var state installationSetupState
+	if err := json.Unmarshal(stateJSON, &state); err != nil {
+		return nil, nil, errors.Wrap(err, "unable to unmarshal installation setup state")
+	}
+
+	if state.Credentials != nil {
+		credentials, err := decryptCredentials(p.getConfiguration().CredentialsEncryptionKey, state.Credentials)
+		if err != nil {
+			p.API.LogWarn("Failed to unseal the installation setup passwords", "installation", installationID, "error", err.Error())
+		} else {
+			state.AdminPassword = credentials.AdminPassword
+			state.UserPassword = credentials.UserPassword
+			state.SeedUsers = credentials.SeedUsers
+		}
+	}
+
+	return &state, stateJSON, nil
+}
+
+// marshalInstallationSetupState seals the passwords of the setup state. When
+// they can't be sealed, because the encryption key isn't configured, they are
+// kept in memory only and an interrupted setup can't be resumed past the
+// creation of the admin user.
+func (p *Plugin) marshalInstallationSetupState(installationID string, state *installationSetupState) ([]byte, error) {
+	stored := *state
+	stored.Credentials = nil
+	if state.AdminPassword != "" || state.UserPassword != "" || len(state.SeedUsers) > 0 {
+		sealed, err := encryptCredentials(p.getConfiguration().CredentialsEncryptionKey, &installationCredentials{
+			AdminPassword: state.AdminPassword,
+			UserPassword:  state.UserPassword,
+			SeedUsers:     state.SeedUsers,
+		})
+		if err != nil {
+			p.API.LogWarn("Failed to seal the installation setup passwords, they are not stored", "installation", installationID, "error", err.Error())
+		}
+		stored.Credentials = sealed
+	}
+
+	stateJSON, err := json.Marshal(&stored)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to marshal installation setup state")
+	}
+	return stateJSON, nil
+}
+
+func (p *Plugin) storeInstallationSetupState(installationID string, state *installationSetupState) error {
+	state.UpdateAt = time.Now().UnixMilli()
+	stateJSON, err := p.marshalInstallationSetupState(installationID, state)
+	if err != nil {
+		return err
+	}
+	if appErr := p.API.KVSet(setupStateKey(installationID), stateJSON); appErr != nil {
+		return errors.Wrap(appErr, "unable to store installation setup state")
+	}
+	return nil
+}
+
+// claimInstallationSetup marks the setup of the installation as running if
+// its status is fromStatus, an empty fromStatus meaning the setup never
+// started. The claim is atomic, so a setup is run by a single webhook or
+// plugin node at a time. The claimed state is returned, or nil when the setup
+// has another status or was claimed elsewhere.
+func (p *Plugin) claimInstallationSetup(installationID, fromStatus string) (*installationSetupState, error) {
+	state, originalJSON, err := p.getInstallationSetupState(installationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if state == nil {
+		if fromStatus != "" {
+			return nil, nil
+		}
+		state = &installationSetupState{
+			AdminPassword: generateRandomPassword(defaultAdminUsername),
+			UserPassword:  generateRandomPassword(defaultUserUsername),
+		}
+	} else if state.Status != fromStatus {
+		return nil, nil
+	} else if fromStatus == setupStatusRunning && !state.isStale(time.Now()) {
+		// The setup is still run by another plugin node.
+		return nil, nil
+	}
+
+	state.Status = setupStatusRunning
+	state.FailedStep = ""
+	state.Error = ""
+	state.StartAt = time.Now().UnixMilli()
+	state.UpdateAt = state.StartAt
+
+	stateJSON, err := p.marshalInstallationSetupState(installationID, state)
+	if err != nil {
+		return nil, err
+	}
+	ok, appErr := p.API.KVCompareAndSet(setupStateKey(installationID), originalJSON, stateJSON)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "unable to claim installation setup")
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	return state, nil
+}
+
+// heartbeatInstallationSetup refreshes the update time of a running setup,
+// so that other plugin nodes don't resume it. The state is only updated if it
+// didn't change since it was read.
+func (p *Plugin) heartbeatInstallationSetup(installationID string) error {
+	originalJSON, appErr := p.API.KVGet(setupStateKey(installationID))
+	if appErr != nil {
+		return errors.Wrap(appErr, "unable to get installation setup state")
+	}
+	if originalJSON == nil {
+		return nil
+	}
+
+	// The state is updated as stored, keeping its sealed passwords as is.
+	var state installationSetupState
+	if err := json.Unmarshal(originalJSON, &state); err != nil {
+		return errors.Wrap(err, "unable to unmarshal installation setup state")
+	}
+	if state.Status != setupStatusRunning {
+		return nil
+	}
+	state.UpdateAt = time.Now().UnixMilli()
+	stateJSON, err := json.Marshal(&state)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal installation setup state")
+	}
+
+	if _, appErr = p.API.KVCompareAndSet(setupStateKey(installationID), originalJSON, stateJSON); appErr != nil {
+		return errors.Wrap(appErr, "unable to update installation setup state")
+	}
+	return nil
+}
+
+// startInstallationSetupHeartbeat heartbeats the setup until the returned
+// function is called.
+func (p *Plugin) startInstallationSetupHeartbeat(install *Installation) func() {
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(setupHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := p.heartbeatInstallationSetup(install.ID); err != nil {
+					p.API.LogWarn("Failed to heartbeat installation setup", "installation", install.Name, "error", err.Error())
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-stopped
+	}
+}
+
+// scheduleSetupResumeJob starts the job resuming the setups interrupted by a
+// restart of the plugin. As an interrupted setup is only resumed once its
+// heartbeat is stale, the job runs periodically rather than once on
+// activation. The job runs on a single plugin instance at a time.
+func (p *Plugin) scheduleSetupResumeJob() error {
+	job, err := cluster.Schedule(p.API, setupResumeJobKey, cluster.MakeWaitForInterval(setupStaleAfter), p.resumeInstallationSetups)
+	if err != nil {
+		return errors.Wrap(err, "unable to schedule setup resume job")
+	}
+	p.setupResumeJob = job
+
+	return nil
+}
+
+// resumeInstallationSetups resumes the setups left running when the plugin
+// was last stopped. Setups which were updated recently are still run by
+// another plugin node and are left alone. The setups are resumed concurrently
+// as waiting for DNS can take several minutes.
+func (p *Plugin) resumeInstallationSetups() {
+	installs, err := p.getInstallations()
+	if err != nil {
+		p.API.LogError(errors.Wrap(err, "failed to get installations to resume setup").Error())
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, install := range installs {
+		state, _, err := p.getInstallationSetupState(install.ID)
+		if err != nil {
+			p.API.LogWarn("Failed to get installation setup state", "installation", install.Name, "error", err.Error())
+			continue
+		}
+		if state == nil || !state.isStale(time.Now()) {
+			continue
+		}
+
+		wg.Add(1)
+		go func(install *Installation) {
+			defer wg.Done()
+			p.resumeInstallationSetup(install)
+		}(install)
+	}
+	wg.Wait()
+}
+
+func (p *Plugin) resumeInstallationSetup(install *Installation) {
+	if err := p.refreshInstallationForSetup(install); err != nil {
+		p.API.LogWarn("Failed to resume installation setup", "installation", install.Name, "error", err.Error())
+		return
+	}
+
+	state, err := p.claimInstallationSetup(install.ID, setupStatusRunning)
+	if err != nil {
+		p.API.LogWarn("Failed to resume installation setup", "installation", install.Name, "error", err.Error())
+		return
+	}
+	if state == nil {
+		return
+	}
+
+	p.API.LogInfo("Resuming installation setup", "installation", install.Name, "completed_steps", strings.Join(state.CompletedSteps, ","))
+	p.runInstallationSetup(install, state)
+}
+
+// refreshInstallationForSetup fetches the installation from the provisioner
+// and checks it is ready to be set up.
+func (p *Plugin) refreshInstallationForSetup(install *Installation) error {
+	installation, err := p.cloudClient.GetInstallation(install.ID, &cloud.GetInstallationRequest{
+		IncludeGroupConfig:          true,
+		IncludeGroupConfigOverrides: false,
+	})
+	if err != nil {
+		return err
+	}
+	if installation == nil {
+		return errors.Errorf("failed to find installation %s", install.ID)
+	}
+	if installation.State != cloud.InstallationStateStable {
+		return errors.Errorf("installation state is currently %s and must be %s to set it up", installation.State, cloud.InstallationStateStable)
+	}
+
+	install.Installation = installation.Installation
+	install.HideSensitiveFields()
+
+	return nil
+}
+
+// retryInstallationSetupForUser resumes the failed or interrupted setup of an
+// installation owned by the user from the step it stopped at.
+func (p *Plugin) retryInstallationSetupForUser(userID string, ref InstallationRef) (InstallationActionResult, error) {
+	install, err := p.findInstallationForUser(userID, ref, InstallationScopeMine)
+	if err != nil {
+		return InstallationActionResult{}, err
+	}
+
+	state, _, err := p.getInstallationSetupState(install.ID)
+	if err != nil {
+		return InstallationActionResult{}, err
+	}
+	if state == nil || (state.Status != setupStatusFailed && !state.isStale(time.Now())) {
+		status := "not started"
+		if state != nil {
+			status = state.Status
+		}
+		return InstallationActionResult{}, errors.Errorf("setup of installation %s has not failed, it is %s", install.Name, status)
+	}
+	fromStatus := state.Status
+	failedStep := state.FailedStep
+
+	if err = p.refreshInstallationForSetup(install); err != nil {
+		return InstallationActionResult{}, err
+	}
+
+	state, err = p.claimInstallationSetup(install.ID, fromStatus)
+	if err != nil {
+		return InstallationActionResult{}, err
+	}
+	if state == nil {
+		return InstallationActionResult{}, errors.Errorf("setup of installation %s has not failed, it is already being retried", install.Name)
+	}
+
+	// The summary is built before the setup starts changing the installation.
+	summary, err := installationSummary(install, false)
+	if err != nil {
+		return InstallationActionResult{}, err
+	}
+
+	go p.runInstallationSetup(install, state)
+	message := fmt.Sprintf("Retrying setup of installation %s.", install.Name)
+	if failedStep != "" {
+		message = fmt.Sprintf("Retrying setup of installation %s from step %s.", install.Name, failedStep)
+	}
+	return InstallationActionResult{
+		Installation: summary,
+		Status:       "setup_retrying",
+		Message:      message,
+	}, nil
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	cloud "github.com/mattermost/mattermost-cloud/model"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSetupSteps replaces the installation setup steps with steps recording
+// their runs, failing the step named by failStep.
+type fakeSetupSteps struct {
+	runs     []string
+	failStep string
+	done     chan struct{}
+}
+
+func (f *fakeSetupSteps) install(t *testing.T) {
+	original := installationSetupSteps
+	t.Cleanup(func() { installationSetupSteps = original })
+
+	installationSetupSteps = nil
+	lastStep := original[len(original)-1].Name
+	for _, step := range original {
+		name := step.Name
+		installationSetupSteps = append(installationSetupSteps, setupStep{
+			Name:     name,
+			Repeated: step.Repeated,
+			Run: func(p *Plugin, setup *installationSetup) error {
+				f.runs = append(f.runs, name)
+				if name == f.failStep {
+					return errors.New("boom")
+				}
+				if f.done != nil && name == lastStep {
+					close(f.done)
+				}
+				return nil
+			},
+		})
+	}
+}
+
+func setupTestInstall(id, name, ownerID string) *Installation {
+	install := serviceTestInstall(id, name, ownerID)
+	install.DNSRecords = []*cloud.InstallationDNS{{DomainName: name + ".example.com"}}
+	return install
+}
+
+// storeSetupState stores the setup state the way the plugin does, sealing
+// its passwords with the test encryption key.
+func storeSetupState(t *testing.T, kv *fakeKVStore, installationID string, state *installationSetupState) {
+	stored := *state
+	if state.AdminPassword != "" || state.UserPassword != "" || len(state.SeedUsers) > 0 {
+		sealed, err := encryptCredentials(testCredentialsEncryptionKey, &installationCredentials{
+			AdminPassword: state.AdminPassword,
+			UserPassword:  state.UserPassword,
+			SeedUsers:     state.SeedUsers,
+		})
+		require.NoError(t, err)
+		stored.Credentials = sealed
+	}
+	stateJSON, err := json.Marshal(&stored)
+	require.NoError(t, err)
+	kv.set(setupStateKey(installationID), stateJSON)
+}
+
+func storedSetupState(t *testing.T, kv *fakeKVStore, installationID string) *installationSetupState {
+	var state installationSetupState
+	require.NoError(t, json.Unmarshal(kv.get(setupStateKey(installationID)), &state))
+	if state.Credentials != nil {
+		credentials, err := decryptCredentials(testCredentialsEncryptionKey, state.Credentials)
+		require.NoError(t, err)
+		state.AdminPassword = credentials.AdminPassword
+		state.UserPassword = credentials.UserPassword
+		state.SeedUsers = credentials.SeedUsers
+	}
+	return &state
+}
+
+func TestClaimInstallationSetup(t *testing.T) {
+	plugin, _, _, kv := newServiceTestPluginWithKV(t, nil)
+
+	t.Run("new setup", func(t *testing.T) {
+		state, err := plugin.claimInstallationSetup("id1", "")
+		require.NoError(t, err)
+		require.NotNil(t, state)
+		assert.Equal(t, setupStatusRunning, state.Status)
+		assert.Contains(t, state.AdminPassword, "admin@")
+		assert.Contains(t, state.UserPassword, "user@")
+		assert.Equal(t, state.AdminPassword, storedSetupState(t, kv, "id1").AdminPassword)
+		assert.NotContains(t, string(kv.get(setupStateKey("id1"))), state.AdminPassword)
+		assert.NotContains(t, string(kv.get(setupStateKey("id1"))), state.UserPassword)
+	})
+
+	t.Run("duplicate webhook", func(t *testing.T) {
+		state, err := plugin.claimInstallationSetup("id1", "")
+		require.NoError(t, err)
+		assert.Nil(t, state)
+	})
+
+	t.Run("failed setup", func(t *testing.T) {
+		storeSetupState(t, kv, "id2", &installationSetupState{Status: setupStatusFailed, FailedStep: setupStepPlugins, Error: "boom", AdminPassword: "admin@pass"})
+
+		state, err := plugin.claimInstallationSetup("id2", setupStatusRunning)
+		require.NoError(t, err)
+		assert.Nil(t, state)
+
+		state, err = plugin.claimInstallationSetup("id2", setupStatusFailed)
+		require.NoError(t, err)
+		require.NotNil(t, state)
+		assert.Equal(t, setupStatusRunning, state.Status)
+		assert.Empty(t, state.FailedStep)
+		assert.Empty(t, state.Error)
+		assert.Equal(t, "admin@pass", state.AdminPassword)
+	})
+
+	t.Run("setup running on another node", func(t *testing.T) {
+		storeSetupState(t, kv, "id4", &installationSetupState{Status: setupStatusRunning, UpdateAt: time.Now().UnixMilli()})
+
+		state, err := plugin.claimInstallationSetup("id4", setupStatusRunning)
+		require.NoError(t, err)
+		assert.Nil(t, state)
+	})
+
+	t.Run("claimed elsewhere", func(t *testing.T) {
+		storeSetupState(t, kv, "id3", &installationSetupState{Status: setupStatusRunning})
+		kv.onWrite = func(key string) {
+			kv.onWrite = nil
+			storeSetupState(t, kv, "id3", &installationSetupState{Status: setupStatusRunning, StartAt: 1})
+		}
+
+		state, err := plugin.claimInstallationSetup("id3", setupStatusRunning)
+		require.NoError(t, err)
+		assert.Nil(t, state)
+	})
+}
+
+func TestRunInstallationSetup(t *testing.T) {
+	setup := func(t *testing.T, state *installationSetupState) (*Plugin, *fakeKVStore, *[]*model.Post, *Installation) {
+		install := setupTestInstall("id1", "first", "owner1")
+		plugin, _, api, kv := newServiceTestPluginWithKV(t, []*Installation{install})
+		plugin.BotUserID = "bot-id"
+		if state != nil {
+			storeSetupState(t, kv, install.ID, state)
+		}
+		return plugin, kv, captureBotPosts(api), install
+	}
+
+	t.Run("runs every step", func(t *testing.T) {
+		plugin, kv, posts, install := setup(t, nil)
+		steps := &fakeSetupSteps{}
+		steps.install(t)
+
+		state, err := plugin.claimInstallationSetup(install.ID, "")
+		require.NoError(t, err)
+		adminPassword, userPassword := state.AdminPassword, state.UserPassword
+		plugin.runInstallationSetup(install, state)
+
+		assert.Equal(t, []string{setupStepDNS, setupStepAdmin, setupStepLogin, setupStepConfiguration, setupStepConfigOverrides, setupStepPlugins, setupStepTestData, setupStepUser, setupStepSeedUsers}, steps.runs)
+		require.Len(t, *posts, 1)
+		assert.Contains(t, (*posts)[0].Message, "Installation first is ready!")
+		assert.Contains(t, (*posts)[0].Message, adminPassword)
+
+		credentials, err := plugin.getInstallationCredentials(install.ID)
+		require.NoError(t, err)
+		require.NotNil(t, credentials)
+		assert.Equal(t, adminPassword, credentials.AdminPassword)
+		assert.Equal(t, userPassword, credentials.UserPassword)
+
+		stored := storedSetupState(t, kv, install.ID)
+		assert.Equal(t, setupStatusComplete, stored.Status)
+		assert.NotContains(t, stored.CompletedSteps, setupStepLogin)
+		assert.Empty(t, stored.AdminPassword)
+		assert.Empty(t, stored.UserPassword)
+	})
+
+	t.Run("resumes after the completed steps", func(t *testing.T) {
+		plugin, kv, posts, install := setup(t, &installationSetupState{
+			Status:         setupStatusRunning,
+			CompletedSteps: []string{setupStepDNS, setupStepAdmin, setupStepConfiguration},
+			AdminPassword:  "admin@pass",
+			UserPassword:   "user@pass",
+		})
+		steps := &fakeSetupSteps{}
+		steps.install(t)
+
+		state, err := plugin.claimInstallationSetup(install.ID, setupStatusRunning)
+		require.NoError(t, err)
+		require.NotNil(t, state)
+		plugin.runInstallationSetup(install, state)
+
+		assert.Equal(t, []string{setupStepLogin, setupStepConfigOverrides, setupStepPlugins, setupStepTestData, setupStepUser, setupStepSeedUsers}, steps.runs)
+		require.Len(t, *posts, 1)
+		assert.Contains(t, (*posts)[0].Message, "admin@pass")
+		assert.Equal(t, setupStatusComplete, storedSetupState(t, kv, install.ID).Status)
+	})
+
+	t.Run("records the failed step", func(t *testing.T) {
+		plugin, kv, posts, install := setup(t, nil)
+		steps := &fakeSetupSteps{failStep: setupStepPlugins}
+		steps.install(t)
+
+		state, err := plugin.claimInstallationSetup(install.ID, "")
+		require.NoError(t, err)
+		plugin.runInstallationSetup(install, state)
+
+		require.Len(t, *posts, 1)
+		assert.Contains(t, (*posts)[0].Message, "Creation of installation first failed at Setup step plugins")
+		assert.Contains(t, (*posts)[0].Message, "Run `/cloud setup retry first`")
+		assert.NotContains(t, (*posts)[0].Message, "is ready")
+		stored := storedSetupState(t, kv, install.ID)
+		assert.Equal(t, setupStatusFailed, stored.Status)
+		assert.Equal(t, setupStepPlugins, stored.FailedStep)
+		assert.Equal(t, "boom", stored.Error)
+		assert.Equal(t, []string{setupStepDNS, setupStepAdmin, setupStepConfiguration, setupStepConfigOverrides}, stored.CompletedSteps)
+		assert.NotEmpty(t, stored.AdminPassword)
+	})
+
+	t.Run("fails without DNS records", func(t *testing.T) {
+		plugin, kv, _, install := setup(t, nil)
+		install.DNSRecords = nil
+		steps := &fakeSetupSteps{}
+		steps.install(t)
+
+		state, err := plugin.claimInstallationSetup(install.ID, "")
+		require.NoError(t, err)
+		plugin.runInstallationSetup(install, state)
+
+		assert.Empty(t, steps.runs)
+		stored := storedSetupState(t, kv, install.ID)
+		assert.Equal(t, setupStatusFailed, stored.Status)
+		assert.Contains(t, stored.Error, "doesn't have any DNSRecords")
+	})
+}
+
+func TestResumeInstallationSetups(t *testing.T) {
+	running := setupTestInstall("someid", "running", "owner1")
+	complete := setupTestInstall("complete-id", "complete", "owner1")
+	active := setupTestInstall("active-id", "active", "owner1")
+	plugin, _, api, kv := newServiceTestPluginWithKV(t, []*Installation{running, complete, active})
+	api.On("LogInfo", mock.AnythingOfType("string"), mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	plugin.BotUserID = "bot-id"
+	posts := captureBotPosts(api)
+	storeSetupState(t, kv, running.ID, &installationSetupState{Status: setupStatusRunning, CompletedSteps: []string{setupStepDNS, setupStepAdmin}, AdminPassword: "admin@pass"})
+	storeSetupState(t, kv, complete.ID, &installationSetupState{Status: setupStatusComplete})
+	storeSetupState(t, kv, active.ID, &installationSetupState{Status: setupStatusRunning, CompletedSteps: []string{setupStepDNS}, UpdateAt: time.Now().UnixMilli()})
+	steps := &fakeSetupSteps{}
+	steps.install(t)
+
+	plugin.resumeInstallationSetups()
+
+	assert.Equal(t, []string{setupStepLogin, setupStepConfiguration, setupStepConfigOverrides, setupStepPlugins, setupStepTestData, setupStepUser, setupStepSeedUsers}, steps.runs)
+	require.Len(t, *posts, 1)
+	assert.Contains(t, (*posts)[0].Message, "Installation running is ready!")
+	assert.Equal(t, setupStatusComplete, storedSetupState(t, kv, running.ID).Status)
+	assert.Equal(t, setupStatusRunning, storedSetupState(t, kv, active.ID).Status)
+}
+
+func TestResumeInstallationSetupsAfterRestart(t *testing.T) {
+	originalStaleAfter := setupStaleAfter
+	setupStaleAfter = 200 * time.Millisecond
+	t.Cleanup(func() { setupStaleAfter = originalStaleAfter })
+
+	install := setupTestInstall("someid", "restarted", "owner1")
+	plugin, _, api, kv := newServiceTestPluginWithKV(t, []*Installation{install})
+	api.On("LogInfo", mock.AnythingOfType("string"), mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	plugin.BotUserID = "bot-id"
+	posts := captureBotPosts(api)
+	// The plugin restarted shortly after the last heartbeat of the setup.
+	storeSetupState(t, kv, install.ID, &installationSetupState{
+		Status:         setupStatusRunning,
+		CompletedSteps: []string{setupStepDNS, setupStepAdmin},
+		AdminPassword:  "admin@pass",
+		UpdateAt:       time.Now().Add(-setupStaleAfter / 4).UnixMilli(),
+	})
+	steps := &fakeSetupSteps{}
+	steps.install(t)
+
+	plugin.resumeInstallationSetups()
+	assert.Empty(t, steps.runs)
+	assert.Equal(t, setupStatusRunning, storedSetupState(t, kv, install.ID).Status)
+
+	// A later run of the resume job finds the setup stale and resumes it.
+	require.Eventually(t, func() bool {
+		plugin.resumeInstallationSetups()
+		return storedSetupState(t, kv, install.ID).Status == setupStatusComplete
+	}, 5*time.Second, setupStaleAfter/4)
+	assert.Equal(t, []string{setupStepLogin, setupStepConfiguration, setupStepConfigOverrides, setupStepPlugins, setupStepTestData, setupStepUser, setupStepSeedUsers}, steps.runs)
+	require.Len(t, *posts, 1)
+	assert.Contains(t, (*posts)[0].Message, "Installation restarted is ready!")
+}
+
+func TestHeartbeatInstallationSetup(t *testing.T) {
+	plugin, _, _, kv := newServiceTestPluginWithKV(t, nil)
+
+	t.Run("running setup", func(t *testing.T) {
+		storeSetupState(t, kv, "id1", &installationSetupState{Status: setupStatusRunning, AdminPassword: "admin@pass", UpdateAt: 1})
+
+		require.NoError(t, plugin.heartbeatInstallationSetup("id1"))
+		state := storedSetupState(t, kv, "id1")
+		assert.False(t, state.isStale(time.Now()))
+		assert.Equal(t, "admin@pass", state.AdminPassword)
+	})
+
+	t.Run("finished setup", func(t *testing.T) {
+		storeSetupState(t, kv, "id2", &installationSetupState{Status: setupStatusFailed, UpdateAt: 1})
+
+		require.NoError(t, plugin.heartbeatInstallationSetup("id2"))
+		assert.Equal(t, int64(1), storedSetupState(t, kv, "id2").UpdateAt)
+	})
+
+	t.Run("no setup", func(t *testing.T) {
+		require.NoError(t, plugin.heartbeatInstallationSetup("id3"))
+		assert.Nil(t, kv.get(setupStateKey("id3")))
+	})
+}
+
+func TestSetupRetryCommand(t *testing.T) {
+	setup := func(t *testing.T) (*Plugin, *fakeKVStore, *Installation) {
+		install := setupTestInstall("someid", "first", "owner1")
+		plugin, _, api, kv := newServiceTestPluginWithKV(t, []*Installation{install})
+		plugin.BotUserID = "bot-id"
+		captureBotPosts(api)
+		return plugin, kv, install
+	}
+
+	t.Run("retries from the failed step", func(t *testing.T) {
+		plugin, kv, install := setup(t)
+		storeSetupState(t, kv, install.ID, &installationSetupState{
+			Status:         setupStatusFailed,
+			FailedStep:     setupStepTestData,
+			CompletedSteps: []string{setupStepDNS, setupStepAdmin, setupStepConfiguration, setupStepConfigOverrides, setupStepPlugins},
+		})
+		steps := &fakeSetupSteps{done: make(chan struct{})}
+		steps.install(t)
+
+		resp, isUserError, err := plugin.runSetupCommand([]string{"retry", "first"}, &model.CommandArgs{UserId: "owner1"})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "Retrying setup of installation first from step test_data.")
+
+		<-steps.done
+		assert.Equal(t, []string{setupStepLogin, setupStepTestData, setupStepUser, setupStepSeedUsers}, steps.runs)
+	})
+
+	t.Run("setup has not failed", func(t *testing.T) {
+		plugin, kv, install := setup(t)
+
+		_, isUserError, err := plugin.runSetupCommand([]string{"retry", "first"}, &model.CommandArgs{UserId: "owner1"})
+		require.EqualError(t, err, "setup of installation first has not failed, it is not started")
+		assert.True(t, isUserError)
+
+		storeSetupState(t, kv, install.ID, &installationSetupState{Status: setupStatusRunning, UpdateAt: time.Now().UnixMilli()})
+		_, isUserError, err = plugin.runSetupCommand([]string{"retry", "first"}, &model.CommandArgs{UserId: "owner1"})
+		require.EqualError(t, err, "setup of installation first has not failed, it is running")
+		assert.True(t, isUserError)
+	})
+
+	t.Run("takes over an interrupted setup", func(t *testing.T) {
+		plugin, kv, install := setup(t)
+		storeSetupState(t, kv, install.ID, &installationSetupState{
+			Status:         setupStatusRunning,
+			CompletedSteps: []string{setupStepDNS, setupStepAdmin, setupStepConfiguration},
+			AdminPassword:  "admin@pass",
+			UpdateAt:       time.Now().Add(-2 * setupStaleAfter).UnixMilli(),
+		})
+		steps := &fakeSetupSteps{done: make(chan struct{})}
+		steps.install(t)
+
+		resp, isUserError, err := plugin.runSetupCommand([]string{"retry", "first"}, &model.CommandArgs{UserId: "owner1"})
+		require.NoError(t, err)
+		assert.False(t, isUserError)
+		assert.Contains(t, resp.Text, "Retrying setup of installation first.")
+
+		<-steps.done
+		assert.Equal(t, []string{setupStepLogin, setupStepConfigOverrides, setupStepPlugins, setupStepTestData, setupStepUser, setupStepSeedUsers}, steps.runs)
+	})
+
+	t.Run("not owned", func(t *testing.T) {
+		plugin, _, _ := setup(t)
+
+		_, isUserError, err := plugin.runSetupCommand([]string{"retry", "first"}, &model.CommandArgs{UserId: "someone-else"})
+		require.Error(t, err)
+		assert.True(t, isUserError)
+	})
+
+	t.Run("bad usage", func(t *testing.T) {
+		plugin, _, _ := setup(t)
+
+		_, isUserError, err := plugin.runSetupCommand([]string{}, &model.CommandArgs{UserId: "owner1"})
+		require.EqualError(t, err, "must provide a setup subcommand")
+		assert.True(t, isUserError)
+
+		_, isUserError, err = plugin.runSetupCommand([]string{"retry"}, &model.CommandArgs{UserId: "owner1"})
+		require.EqualError(t, err, "must provide an installation name")
+		assert.True(t, isUserError)
+
+		_, isUserError, err = plugin.runSetupCommand([]string{"bogus"}, &model.CommandArgs{UserId: "owner1"})
+		require.EqualError(t, err, "unknown setup subcommand bogus")
+		assert.True(t, isUserError)
+	})
+}
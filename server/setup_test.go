@@ -4,6 +4,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -40,3 +41,41 @@ func TestGenerateRandomPassword(t *testing.T) {
 		assert.Len(t, parts[1], 26)
 	})
 }
+
+func TestParseMarketplacePlugins(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		plugins, err := parseMarketplacePlugins([]string{"com.mattermost.plugin-jira@4.1.0", " com.mattermost.calls ", ""})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"com.mattermost.plugin-jira@4.1.0", "com.mattermost.calls"}, plugins)
+
+		plugin, err := parseMarketplacePlugin(plugins[0])
+		require.NoError(t, err)
+		assert.Equal(t, marketplacePlugin{ID: "com.mattermost.plugin-jira", Version: "4.1.0"}, plugin)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for value, expected := range map[string]string{
+			"com.mattermost/jira":     "invalid plugin com.mattermost/jira: plugin IDs may only contain letters, numbers, dots, hyphens, and underscores",
+			"com.mattermost.calls@v1": "invalid plugin com.mattermost.calls@v1: v1 is not a valid version",
+			"@1.0.0":                  "invalid plugin @1.0.0: plugin IDs may only contain letters, numbers, dots, hyphens, and underscores",
+		} {
+			_, err := parseMarketplacePlugins([]string{value})
+			require.EqualError(t, err, expected)
+		}
+
+		_, err := parseMarketplacePlugins([]string{"com.mattermost.calls", "com.mattermost.calls@1.0.0"})
+		require.EqualError(t, err, "invalid plugin com.mattermost.calls@1.0.0: plugin com.mattermost.calls is defined more than once")
+	})
+}
+
+func TestPluginSetupMessage(t *testing.T) {
+	assert.Empty(t, pluginSetupMessage(nil))
+
+	message := pluginSetupMessage([]pluginSetupResult{
+		{Plugin: "com.mattermost.plugin-jira@4.1.0", Version: "4.1.0"},
+		{Plugin: "com.mattermost.calls", Err: errors.New("failed to install plugin: not found")},
+	})
+	assert.Equal(t, "Plugins:\n\n| Plugin | Result |\n| -- | -- |\n"+
+		"| `com.mattermost.plugin-jira@4.1.0` | Installed and enabled version 4.1.0 |\n"+
+		"| `com.mattermost.calls` | Failed: failed to install plugin: not found |\n", message)
+}
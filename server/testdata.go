@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	cloud "github.com/mattermost/mattermost-cloud/model"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	// StoreTestDataProgressKeyPrefix prefixes the key recording how far the
+	// test data of an installation was generated.
+	StoreTestDataProgressKeyPrefix = "testdata_progress_"
+
+	testDataCountTeams    = "teams"
+	testDataCountChannels = "channels"
+	testDataCountUsers    = "users"
+	testDataCountPosts    = "posts"
+	testDataCountThreads  = "threads"
+
+	maxTestDataCount = 10000
+
+	// testDataRepliesPerThread is the number of replies posted to each
+	// generated thread.
+	testDataRepliesPerThread = 3
+
+	// testDataProgressInterval is the number of threads created between
+	// saving and reporting the progress of the test data generation.
+	testDataProgressInterval = 10
+
+	// sampleDataDefaultTeams is the number of teams mmctl sampledata creates
+	// when no profile is given.
+	sampleDataDefaultTeams = 2
+)
+
+// sampleDataPollInterval and sampleDataPollAttempts bound the wait for mmctl
+// sampledata to create its teams when it didn't complete before the
+// connection was closed.
+var (
+	sampleDataPollInterval = 10 * time.Second
+	sampleDataPollAttempts = 90
+)
+
+var validTestDataCounts = []string{testDataCountTeams, testDataCountChannels, testDataCountUsers, testDataCountPosts, testDataCountThreads}
+
+// TestDataProfile selects the amount of test data generated for an
+// installation.
+type TestDataProfile struct {
+	Name            string `json:"name"`
+	Teams           int    `json:"teams"`
+	ChannelsPerTeam int    `json:"channels_per_team"`
+	Users           int    `json:"users"`
+	PostsPerChannel int    `json:"posts_per_channel"`
+	Threads         int    `json:"threads"`
+}
+
+// defaultTestDataProfiles are offered when TestDataProfiles is not
+// configured. The first profile is used when no profile is requested.
+var defaultTestDataProfiles = []TestDataProfile{
+	{Name: "small", Teams: 2, ChannelsPerTeam: 10, Users: 15, PostsPerChannel: 100, Threads: 10},
+	{Name: "medium", Teams: 5, ChannelsPerTeam: 20, Users: 100, PostsPerChannel: 250, Threads: 50},
+	{Name: "large", Teams: 10, ChannelsPerTeam: 50, Users: 500, PostsPerChannel: 500, Threads: 200},
+}
+
+// testDataProgress records the completed steps of the test data generation
+// of an installation, so that an interrupted setup can resume it.
+type testDataProgress struct {
+	SampleData bool  `json:"sample_data"`
+	Threads    int   `json:"threads"`
+	UpdateAt   int64 `json:"update_at"`
+}
+
+// testDataClient is the part of the Mattermost client used to generate
+// threads.
+type testDataClient interface {
+	GetAllTeams(ctx context.Context, etag string, page int, perPage int) ([]*model.Team, *model.Response, error)
+	GetPublicChannelsForTeam(ctx context.Context, teamID string, page int, perPage int, etag string) ([]*model.Channel, *model.Response, error)
+	CreatePost(ctx context.Context, post *model.Post) (*model.Post, *model.Response, error)
+}
+
+func testDataProgressKey(installationID string) string {
+	return StoreTestDataProgressKeyPrefix + installationID
+}
+
+func parseTestDataProfiles(value string) ([]TestDataProfile, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	var profiles []TestDataProfile
+	if err := json.Unmarshal([]byte(value), &profiles); err != nil {
+		return nil, errors.Wrap(err, "TestDataProfiles must be a JSON list of profiles")
+	}
+
+	names := []string{}
+	for i, profile := range profiles {
+		if profile.Name == "" {
+			return nil, errors.Errorf("TestDataProfiles entry %d must specify a name", i)
+		}
+		if Contains(names, profile.Name) {
+			return nil, errors.Errorf("TestDataProfiles entry %s is defined more than once", profile.Name)
+		}
+		names = append(names, profile.Name)
+		if err := profile.validate(); err != nil {
+			return nil, errors.Wrapf(err, "TestDataProfiles entry %s is invalid", profile.Name)
+		}
+	}
+
+	return profiles, nil
+}
+
+func (profile TestDataProfile) validate() error {
+	counts := profile.counts()
+	for _, name := range validTestDataCounts {
+		if count := counts[name]; count < 0 || count > maxTestDataCount {
+			return errors.Errorf("%s must be between 0 and %d, got %d", name, maxTestDataCount, count)
+		}
+	}
+	return nil
+}
+
+func (profile TestDataProfile) counts() map[string]int {
+	return map[string]int{
+		testDataCountTeams:    profile.Teams,
+		testDataCountChannels: profile.ChannelsPerTeam,
+		testDataCountUsers:    profile.Users,
+		testDataCountPosts:    profile.PostsPerChannel,
+		testDataCountThreads:  profile.Threads,
+	}
+}
+
+// withCounts returns the profile with the given counts replaced.
+func (profile TestDataProfile) withCounts(counts map[string]int) (TestDataProfile, error) {
+	for name, count := range counts {
+		switch name {
+		case testDataCountTeams:
+			profile.Teams = count
+		case testDataCountChannels:
+			profile.ChannelsPerTeam = count
+		case testDataCountUsers:
+			profile.Users = count
+		case testDataCountPosts:
+			profile.PostsPerChannel = count
+		case testDataCountThreads:
+			profile.Threads = count
+		default:
+			return TestDataProfile{}, errors.Errorf("invalid test data count %s, valid counts are %s", name, strings.Join(validTestDataCounts, ", "))
+		}
+	}
+
+	if err := profile.validate(); err != nil {
+		return TestDataProfile{}, errors.Wrap(err, "invalid test data count")
+	}
+
+	return profile, nil
+}
+
+func testDataProfileName(profile *TestDataProfile) string {
+	if profile == nil {
+		return ""
+	}
+	return profile.Name
+}
+
+// describe summarizes the amount of test data the profile generates.
+func (profile TestDataProfile) describe() string {
+	return fmt.Sprintf("%d teams, %d channels per team, %d users, %d posts per channel and %d threads",
+		profile.Teams, profile.ChannelsPerTeam, profile.Users, profile.PostsPerChannel, profile.Threads)
+}
+
+// parseTestDataCounts parses test data counts given in the form name=count.
+func parseTestDataCounts(values []string) (map[string]int, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	counts := make(map[string]int, len(values))
+	for _, value := range values {
+		name, rawCount, found := strings.Cut(value, "=")
+		name = strings.TrimSpace(name)
+		count, err := strconv.Atoi(strings.TrimSpace(rawCount))
+		if !found || err != nil {
+			return nil, errors.Errorf("invalid test data count %s, must be in the form name=count", value)
+		}
+		if _, ok := counts[name]; ok {
+			return nil, errors.Errorf("invalid test data count %s, %s is defined more than once", value, name)
+		}
+		counts[name] = count
+	}
+
+	return counts, nil
+}
+
+// resolveTestDataProfile returns the configured profile with the given name,
+// or the first profile when no name is given, with the counts replaced.
+func (p *Plugin) resolveTestDataProfile(name string, counts map[string]int) (*TestDataProfile, error) {
+	config := p.getConfiguration()
+	profiles := config.testDataProfiles()
+
+	var profile *TestDataProfile
+	for i := range profiles {
+		if profiles[i].Name == name || name == "" {
+			profile = &profiles[i]
+			break
+		}
+	}
+	if profile == nil {
+		return nil, errors.Errorf("invalid test data profile %s, valid profiles are %s", name, strings.Join(config.testDataProfileNames(), ", "))
+	}
+
+	resolved, err := profile.withCounts(counts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resolved, nil
+}
+
+func (p *Plugin) getTestDataProgress(installationID string) (*testDataProgress, error) {
+	progressJSON, appErr := p.API.KVGet(testDataProgressKey(installationID))
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get test data progress")
+	}
+
+	progress := &testDataProgress{}
+	if progressJSON == nil {
+		return progress, nil
+	}
+	if err := json.Unmarshal(progressJSON, progress); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal test data progress")
+	}
+
+	return progress, nil
+}
+
+func (p *Plugin) storeTestDataProgress(installationID string, progress *testDataProgress) error {
+	progress.UpdateAt = time.Now().UnixMilli()
+	progressJSON, err := json.Marshal(progress)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal test data progress")
+	}
+	if appErr := p.API.KVSet(testDataProgressKey(installationID), progressJSON); appErr != nil {
+		return errors.Wrap(appErr, "failed to store test data progress")
+	}
+	return nil
+}
+
+// createTestData generates the sample data and threads of the test data
+// profile of the installation. Completed steps are recorded so that the
+// generation resumes where it stopped when the setup is run again, and the
+// owner is sent the progress after each step.
+func (p *Plugin) createTestData(client testDataClient, install *Installation) error {
+	if !install.TestData {
+		return nil
+	}
+
+	progress, err := p.getTestDataProgress(install.ID)
+	if err != nil {
+		return err
+	}
+
+	if !progress.SampleData {
+		if err = p.createSampleData(client, install); err != nil {
+			return err
+		}
+		progress.SampleData = true
+		if err = p.storeTestDataProgress(install.ID, progress); err != nil {
+			return err
+		}
+		p.reportTestDataProgress(install, progress)
+	}
+
+	if install.TestDataProfile == nil || progress.Threads >= install.TestDataProfile.Threads {
+		return nil
+	}
+
+	if err = p.createTestDataThreads(client, install, progress); err != nil {
+		// Keep the threads created so far for when the setup is resumed.
+		if storeErr := p.storeTestDataProgress(install.ID, progress); storeErr != nil {
+			p.API.LogWarn(storeErr.Error(), "installation", install.Name)
+		}
+		return err
+	}
+	if err = p.storeTestDataProgress(install.ID, progress); err != nil {
+		return err
+	}
+	p.reportTestDataProgress(install, progress)
+
+	return nil
+}
+
+// createSampleData generates teams, channels, users and posts with the
+// mmctl sampledata command. The command often doesn't complete before the
+// connection to the provisioner is closed, in which case it keeps running
+// and its teams are waited for.
+func (p *Plugin) createSampleData(client testDataClient, install *Installation) error {
+	clusterInstallations, err := p.cloudClient.GetClusterInstallations(
+		&cloud.GetClusterInstallationsRequest{
+			Paging:         cloud.AllPagesNotDeleted(),
+			InstallationID: install.ID,
+		})
+	if err != nil {
+		return errors.Wrap(err, "failed to get ClusterInstallations for Installation")
+	}
+	if len(clusterInstallations) != 1 {
+		return errors.Errorf("got unexpected number of ClusterInstallations (%d)", len(clusterInstallations))
+	}
+
+	args := []string{"sampledata", "--local"}
+	if profile := install.TestDataProfile; profile != nil {
+		args = append(args,
+			"--teams", strconv.Itoa(profile.Teams),
+			"--channels-per-team", strconv.Itoa(profile.ChannelsPerTeam),
+			"--users", strconv.Itoa(profile.Users),
+			"--posts-per-channel", strconv.Itoa(profile.PostsPerChannel),
+		)
+	}
+
+	_, err = p.cloudClient.ExecClusterInstallationCLI(clusterInstallations[0].ID, "mmctl", args)
+	if isMmctlTimeout(err) {
+		p.API.LogWarn(errors.Wrapf(err, "Sample data generation for cloud installation %s didn't complete before the connection was closed, waiting for its teams", install.Name).Error())
+		return p.waitForSampleDataTeams(client, install)
+	} else if err != nil {
+		return errors.Wrap(err, "failed to generate sample data")
+	}
+
+	return nil
+}
+
+// waitForSampleDataTeams waits until the installation has the teams mmctl
+// sampledata creates.
+func (p *Plugin) waitForSampleDataTeams(client testDataClient, install *Installation) error {
+	expected := sampleDataDefaultTeams
+	if profile := install.TestDataProfile; profile != nil {
+		expected = profile.Teams
+	}
+
+	for i := 0; i < sampleDataPollAttempts; i++ {
+		teams, _, err := client.GetAllTeams(context.Background(), "", 0, 200)
+		if err == nil && len(teams) >= expected {
+			return nil
+		}
+		if err != nil {
+			p.API.LogDebug(err.Error())
+		}
+		time.Sleep(sampleDataPollInterval)
+	}
+
+	return errors.Errorf("timed out waiting for sample data to create %d teams", expected)
+}
+
+// createTestDataThreads posts threads with replies to the public channels
+// of the installation, round robin, until the profile is complete.
+func (p *Plugin) createTestDataThreads(client testDataClient, install *Installation, progress *testDataProgress) error {
+	teams, _, err := client.GetAllTeams(context.Background(), "", 0, 200)
+	if err != nil {
+		return errors.Wrap(err, "failed to get teams for test data threads")
+	}
+
+	channels := []*model.Channel{}
+	for _, team := range teams {
+		teamChannels, _, err := client.GetPublicChannelsForTeam(context.Background(), team.Id, 0, 200, "")
+		if err != nil {
+			return errors.Wrapf(err, "failed to get channels of team %s for test data threads", team.Name)
+		}
+		channels = append(channels, teamChannels...)
+	}
+	if len(channels) == 0 {
+		return errors.New("failed to create test data threads: the installation has no public channels")
+	}
+
+	for progress.Threads < install.TestDataProfile.Threads {
+		channel := channels[progress.Threads%len(channels)]
+		root, _, err := client.CreatePost(context.Background(), &model.Post{
+			ChannelId: channel.Id,
+			Message:   fmt.Sprintf("Test thread %d", progress.Threads+1),
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to create test data thread")
+		}
+		for i := 0; i < testDataRepliesPerThread; i++ {
+			_, _, err = client.CreatePost(context.Background(), &model.Post{
+				ChannelId: channel.Id,
+				RootId:    root.Id,
+				Message:   fmt.Sprintf("Reply %d to test thread %d", i+1, progress.Threads+1),
+			})
+			if err != nil {
+				return errors.Wrap(err, "failed to create test data reply")
+			}
+		}
+
+		progress.Threads++
+		if progress.Threads%testDataProgressInterval == 0 {
+			if err = p.storeTestDataProgress(install.ID, progress); err != nil {
+				return err
+			}
+			p.reportTestDataProgress(install, progress)
+		}
+	}
+
+	return nil
+}
+
+func (p *Plugin) reportTestDataProgress(install *Installation, progress *testDataProgress) {
+	detail := "sample data generated"
+	if profile := install.TestDataProfile; profile != nil {
+		detail = fmt.Sprintf("profile %s (%s), sample data generated, %d of %d threads created",
+			profile.Name, profile.describe(), progress.Threads, profile.Threads)
+	}
+
+	p.reportSetupProgress(install, creationStage{Name: setupStageName(setupStepTestData), Detail: detail})
+}
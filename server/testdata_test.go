@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	cloud "github.com/mattermost/mattermost-cloud/model"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeTestDataClient struct {
+	channels   []*model.Channel
+	posts      []*model.Post
+	failAfter  int
+	createPost error
+	// teamsAfter is the number of team lookups returning no teams, as if
+	// sample data was still being generated.
+	teamsAfter int
+	teamCalls  int
+}
+
+func (c *fakeTestDataClient) GetAllTeams(ctx context.Context, etag string, page int, perPage int) ([]*model.Team, *model.Response, error) {
+	c.teamCalls++
+	if c.teamCalls <= c.teamsAfter {
+		return []*model.Team{}, nil, nil
+	}
+	return []*model.Team{{Id: "team-id", Name: "team"}}, nil, nil
+}
+
+func (c *fakeTestDataClient) GetPublicChannelsForTeam(ctx context.Context, teamID string, page int, perPage int, etag string) ([]*model.Channel, *model.Response, error) {
+	return c.channels, nil, nil
+}
+
+func (c *fakeTestDataClient) CreatePost(ctx context.Context, post *model.Post) (*model.Post, *model.Response, error) {
+	if c.createPost != nil && len(c.posts) >= c.failAfter {
+		return nil, nil, c.createPost
+	}
+	post.Id = model.NewId()
+	c.posts = append(c.posts, post)
+	return post, nil, nil
+}
+
+func (c *fakeTestDataClient) roots() []*model.Post {
+	roots := []*model.Post{}
+	for _, post := range c.posts {
+		if post.RootId == "" {
+			roots = append(roots, post)
+		}
+	}
+	return roots
+}
+
+func TestParseTestDataCounts(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		counts, err := parseTestDataCounts([]string{"users=50", " threads = 5"})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int{"users": 50, "threads": 5}, counts)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, values := range [][]string{{"users"}, {"users=many"}, {"users=1", "users=2"}} {
+			_, err := parseTestDataCounts(values)
+			require.Error(t, err, values)
+			assert.Contains(t, err.Error(), "invalid test data count")
+		}
+	})
+}
+
+func TestResolveTestDataProfile(t *testing.T) {
+	plugin, _, _ := newServiceTestPlugin(t, nil)
+
+	t.Run("defaults to the first profile", func(t *testing.T) {
+		profile, err := plugin.resolveTestDataProfile("", nil)
+		require.NoError(t, err)
+		assert.Equal(t, defaultTestDataProfiles[0], *profile)
+	})
+
+	t.Run("named profile with counts", func(t *testing.T) {
+		profile, err := plugin.resolveTestDataProfile("medium", map[string]int{"users": 42, "threads": 0})
+		require.NoError(t, err)
+		assert.Equal(t, TestDataProfile{Name: "medium", Teams: 5, ChannelsPerTeam: 20, Users: 42, PostsPerChannel: 250, Threads: 0}, *profile)
+	})
+
+	t.Run("configured profiles", func(t *testing.T) {
+		plugin.configuration.TestDataProfiles = `[{"name": "tiny", "teams": 1}]`
+		defer func() { plugin.configuration.TestDataProfiles = "" }()
+
+		profile, err := plugin.resolveTestDataProfile("", nil)
+		require.NoError(t, err)
+		assert.Equal(t, "tiny", profile.Name)
+
+		_, err = plugin.resolveTestDataProfile("small", nil)
+		require.EqualError(t, err, "invalid test data profile small, valid profiles are tiny")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := plugin.resolveTestDataProfile("huge", nil)
+		require.EqualError(t, err, "invalid test data profile huge, valid profiles are small, medium, large")
+
+		_, err = plugin.resolveTestDataProfile("small", map[string]int{"emojis": 1})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid test data count emojis")
+
+		_, err = plugin.resolveTestDataProfile("small", map[string]int{"users": maxTestDataCount + 1})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid test data count")
+	})
+}
+
+func TestCreateTestData(t *testing.T) {
+	setup := func(t *testing.T, progress *testDataProgress) (*Plugin, *MockClient, *fakeKVStore, *[]*model.Post, *Installation) {
+		install := serviceTestInstall("id1", "first", "owner1")
+		install.TestData = true
+		install.TestDataProfile = &TestDataProfile{Name: "custom", Teams: 1, ChannelsPerTeam: 2, Users: 3, PostsPerChannel: 4, Threads: 12}
+
+		plugin, cloudClient, api, kv := newServiceTestPluginWithKV(t, []*Installation{install})
+		plugin.BotUserID = "bot-id"
+		cloudClient.mockedCloudClusterInstallations = []*cloud.ClusterInstallation{{ID: "ci1"}}
+		if progress != nil {
+			progressJSON, err := json.Marshal(progress)
+			require.NoError(t, err)
+			kv.set(testDataProgressKey(install.ID), progressJSON)
+		}
+
+		return plugin, cloudClient, kv, captureBotPosts(api), install
+	}
+
+	storedProgress := func(t *testing.T, kv *fakeKVStore, installationID string) testDataProgress {
+		var progress testDataProgress
+		require.NoError(t, json.Unmarshal(kv.get(testDataProgressKey(installationID)), &progress))
+		return progress
+	}
+
+	t.Run("generates the profile", func(t *testing.T) {
+		plugin, cloudClient, kv, posts, install := setup(t, nil)
+		client := &fakeTestDataClient{channels: []*model.Channel{{Id: "c1"}, {Id: "c2"}}}
+
+		require.NoError(t, plugin.createTestData(client, install))
+
+		assert.Equal(t, [][]string{{"mmctl", "sampledata", "--local", "--teams", "1", "--channels-per-team", "2", "--users", "3", "--posts-per-channel", "4"}}, cloudClient.execCLICalls)
+		roots := client.roots()
+		require.Len(t, roots, 12)
+		assert.Len(t, client.posts, 12*(1+testDataRepliesPerThread))
+		assert.Equal(t, "c1", roots[0].ChannelId)
+		assert.Equal(t, "c2", roots[1].ChannelId)
+
+		progress := storedProgress(t, kv, install.ID)
+		assert.True(t, progress.SampleData)
+		assert.Equal(t, 12, progress.Threads)
+
+		require.Len(t, *posts, 1)
+		assert.Contains(t, (*posts)[0].Message, "In progress: profile custom")
+		assert.Contains(t, (*posts)[0].Message, "12 of 12 threads created")
+	})
+
+	t.Run("resumes interrupted generation", func(t *testing.T) {
+		plugin, cloudClient, kv, _, install := setup(t, &testDataProgress{SampleData: true, Threads: 10})
+		client := &fakeTestDataClient{channels: []*model.Channel{{Id: "c1"}}}
+
+		require.NoError(t, plugin.createTestData(client, install))
+
+		assert.Empty(t, cloudClient.execCLICalls)
+		roots := client.roots()
+		require.Len(t, roots, 2)
+		assert.Equal(t, "Test thread 11", roots[0].Message)
+		assert.Equal(t, 12, storedProgress(t, kv, install.ID).Threads)
+	})
+
+	t.Run("keeps partial progress on failure", func(t *testing.T) {
+		plugin, _, kv, _, install := setup(t, nil)
+		client := &fakeTestDataClient{
+			channels:   []*model.Channel{{Id: "c1"}},
+			failAfter:  3 * (1 + testDataRepliesPerThread),
+			createPost: errors.New("server unavailable"),
+		}
+
+		require.Error(t, plugin.createTestData(client, install))
+
+		progress := storedProgress(t, kv, install.ID)
+		assert.True(t, progress.SampleData)
+		assert.Equal(t, 3, progress.Threads)
+	})
+
+	t.Run("sample data which failed is generated again", func(t *testing.T) {
+		plugin, cloudClient, kv, _, install := setup(t, nil)
+		cloudClient.execCLIErr = errors.New("sampledata failed")
+
+		require.EqualError(t, plugin.createTestData(&fakeTestDataClient{}, install), "failed to generate sample data: sampledata failed")
+		assert.Nil(t, kv.get(testDataProgressKey(install.ID)))
+
+		cloudClient.execCLIErr = nil
+		require.NoError(t, plugin.createTestData(&fakeTestDataClient{channels: []*model.Channel{{Id: "c1"}}}, install))
+		assert.Len(t, cloudClient.execCLICalls, 2)
+		assert.True(t, storedProgress(t, kv, install.ID).SampleData)
+	})
+
+	t.Run("sample data which didn't complete in time is waited for", func(t *testing.T) {
+		plugin, cloudClient, kv, _, install := setup(t, nil)
+		cloudClient.execCLIErr = errors.New("failed with status code 504")
+		originalInterval := sampleDataPollInterval
+		sampleDataPollInterval = 0
+		t.Cleanup(func() { sampleDataPollInterval = originalInterval })
+		client := &fakeTestDataClient{channels: []*model.Channel{{Id: "c1"}}, teamsAfter: 2}
+
+		require.NoError(t, plugin.createTestData(client, install))
+		assert.True(t, storedProgress(t, kv, install.ID).SampleData)
+		assert.Len(t, client.roots(), 12)
+		// Two lookups without teams, one finding them and one listing the
+		// channels for the threads.
+		assert.Equal(t, 4, client.teamCalls)
+	})
+
+	t.Run("nothing to do without test data", func(t *testing.T) {
+		plugin, cloudClient, _, _, install := setup(t, nil)
+		install.TestData = false
+
+		require.NoError(t, plugin.createTestData(&fakeTestDataClient{}, install))
+		assert.Empty(t, cloudClient.execCLICalls)
+	})
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	cloud "github.com/mattermost/mattermost-cloud/model"
+	"github.com/pkg/errors"
+)
+
+// minInstallationTTL is the shortest TTL or extension accepted. The
+// provisioner rejects deletion times less than five minutes away.
+const minInstallationTTL = time.Hour
+
+// parseInstallationTTL parses a duration such as 48h, 90m, or 7d.
+func parseInstallationTTL(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+
+	var duration time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		count, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, errors.Errorf("invalid duration %s: use a value such as 48h or 7d", value)
+		}
+		duration = time.Duration(count) * 24 * time.Hour
+	} else {
+		var err error
+		duration, err = time.ParseDuration(value)
+		if err != nil {
+			return 0, errors.Errorf("invalid duration %s: use a value such as 48h or 7d", value)
+		}
+	}
+
+	if duration < minInstallationTTL {
+		return 0, errors.Errorf("invalid duration %s: must be at least %s", value, formatDuration(minInstallationTTL))
+	}
+
+	return duration, nil
+}
+
+// validateInstallationTTL parses the requested TTL and checks it against
+// the configured maximum.
+func (p *Plugin) validateInstallationTTL(value string) (time.Duration, error) {
+	ttl, err := parseInstallationTTL(value)
+	if err != nil {
+		return 0, err
+	}
+
+	maxTTL := p.getConfiguration().maxInstallationTTL()
+	if maxTTL > 0 && ttl > maxTTL {
+		return 0, errors.Errorf("ttl %s exceeds the maximum of %s", formatDuration(ttl), formatDuration(maxTTL))
+	}
+
+	return ttl, nil
+}
+
+// formatDuration renders a duration in days, hours, and minutes, e.g. 2d 3h.
+func formatDuration(duration time.Duration) string {
+	if duration < time.Minute {
+		return "less than 1m"
+	}
+
+	days := duration / (24 * time.Hour)
+	duration -= days * 24 * time.Hour
+	hours := duration / time.Hour
+	duration -= hours * time.Hour
+	minutes := duration / time.Minute
+
+	parts := []string{}
+	if days > 0 {
+		parts = append(parts, fmt.Sprintf("%dd", days))
+	}
+	if hours > 0 {
+		parts = append(parts, fmt.Sprintf("%dh", hours))
+	}
+	if minutes > 0 && days == 0 {
+		parts = append(parts, fmt.Sprintf("%dm", minutes))
+	}
+	return strings.Join(parts, " ")
+}
+
+// installationTimeRemaining describes how long is left until the scheduled
+// deletion of an installation. It is empty when no deletion is scheduled.
+func installationTimeRemaining(scheduledDeletionTime int64, now time.Time) string {
+	if scheduledDeletionTime <= 0 {
+		return ""
+	}
+
+	remaining := time.UnixMilli(scheduledDeletionTime).Sub(now)
+	if remaining <= 0 {
+		return "expired"
+	}
+	return formatDuration(remaining)
+}
+
+// extendInstallationForUser pushes back the scheduled deletion of an
+// installation owned by the user.
+func (p *Plugin) extendInstallationForUser(userID string, ref InstallationRef, by string) (InstallationActionResult, error) {
+	extension, err := parseInstallationTTL(by)
+	if err != nil {
+		return InstallationActionResult{}, err
+	}
+
+	installToExtend, err := p.findRefInRefreshedList(userID, ref, InstallationScopeMine)
+	if err != nil {
+		return InstallationActionResult{}, err
+	}
+	if installToExtend.ScheduledDeletionTime == 0 {
+		return InstallationActionResult{}, errors.Errorf("installation %s is not scheduled for deletion", installToExtend.Name)
+	}
+
+	now := time.Now()
+	deletionTime := time.UnixMilli(installToExtend.ScheduledDeletionTime)
+	if deletionTime.Before(now) {
+		deletionTime = now
+	}
+	deletionTime = deletionTime.Add(extension)
+
+	maxTTL := p.getConfiguration().maxInstallationTTL()
+	if maxTTL > 0 && deletionTime.Sub(now) > maxTTL {
+		return InstallationActionResult{}, errors.Errorf("extending by %s would leave %s until deletion, which exceeds the maximum of %s", formatDuration(extension), formatDuration(deletionTime.Sub(now)), formatDuration(maxTTL))
+	}
+
+	scheduledDeletionTime := deletionTime.UnixMilli()
+	_, err = p.cloudClient.UpdateInstallationScheduledDeletion(installToExtend.ID, &cloud.PatchInstallationScheduledDeletionRequest{
+		ScheduledDeletionTime: &scheduledDeletionTime,
+	})
+	if err != nil {
+		return InstallationActionResult{}, errors.Wrap(err, "failed to update installation scheduled deletion")
+	}
+
+	installToExtend.ScheduledDeletionTime = scheduledDeletionTime
+	if err = p.updateInstallation(installToExtend); err != nil {
+		p.API.LogWarn("Failed to store extended installation", "installation", installToExtend.ID, "error", err.Error())
+	}
+	p.recordInstallationAction(installToExtend.ID, userID, historyActionExtend, "by "+formatDuration(extension))
+
+	summary, err := installationSummary(installToExtend, false)
+	if err != nil {
+		return InstallationActionResult{}, err
+	}
+	return InstallationActionResult{
+		Installation: summary,
+		Status:       "extended",
+		Message:      fmt.Sprintf("Deletion scheduled for %s.", cloud.DateTimeStringFromMillis(scheduledDeletionTime)),
+	}, nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseInstallationTTL(t *testing.T) {
+	tests := []struct {
+		value       string
+		expected    time.Duration
+		errContains string
+	}{
+		{"48h", 48 * time.Hour, ""},
+		{"90m", 90 * time.Minute, ""},
+		{"7d", 7 * 24 * time.Hour, ""},
+		{" 2d ", 2 * 24 * time.Hour, ""},
+		{"30m", 0, "must be at least 1h"},
+		{"0d", 0, "must be at least 1h"},
+		{"xd", 0, "invalid duration xd"},
+		{"forever", 0, "invalid duration forever"},
+		{"", 0, "invalid duration"},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			duration, err := parseInstallationTTL(test.value)
+			if test.errContains != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.errContains)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, duration)
+		})
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	assert.Equal(t, "less than 1m", formatDuration(30*time.Second))
+	assert.Equal(t, "45m", formatDuration(45*time.Minute))
+	assert.Equal(t, "3h 5m", formatDuration(3*time.Hour+5*time.Minute))
+	assert.Equal(t, "2d 3h", formatDuration(51*time.Hour+20*time.Minute))
+	assert.Equal(t, "7d", formatDuration(7*24*time.Hour))
+}
+
+func TestInstallationTimeRemaining(t *testing.T) {
+	now := time.Now()
+	assert.Equal(t, "", installationTimeRemaining(0, now))
+	assert.Equal(t, "expired", installationTimeRemaining(now.Add(-time.Minute).UnixMilli(), now))
+	assert.Equal(t, "1d 2h", installationTimeRemaining(now.Add(26*time.Hour+30*time.Minute).UnixMilli(), now))
+}
+
+func TestCreateInstallationTTL(t *testing.T) {
+	t.Run("ttl sets the scheduled deletion time", func(t *testing.T) {
+		plugin, cloudClient, _ := newServiceTestPlugin(t, nil)
+		plugin.configuration.ScheduledDeletionHours = "24"
+
+		before := time.Now()
+		_, err := plugin.createInstallationForUser("owner", CreateInstallationInput{Name: "ttl", TTL: "72h"})
+		require.NoError(t, err)
+		require.NotNil(t, cloudClient.creationRequest)
+		assert.WithinDuration(t, before.Add(72*time.Hour), time.UnixMilli(cloudClient.creationRequest.ScheduledDeletionTime), time.Minute)
+	})
+
+	t.Run("the configured default applies without a ttl", func(t *testing.T) {
+		plugin, cloudClient, _ := newServiceTestPlugin(t, nil)
+		plugin.configuration.ScheduledDeletionHours = "24"
+
+		before := time.Now()
+		_, err := plugin.createInstallationForUser("owner", CreateInstallationInput{Name: "default"})
+		require.NoError(t, err)
+		assert.WithinDuration(t, before.Add(24*time.Hour), time.UnixMilli(cloudClient.creationRequest.ScheduledDeletionTime), time.Minute)
+	})
+
+	t.Run("ttl above the maximum is rejected", func(t *testing.T) {
+		plugin, cloudClient, _ := newServiceTestPlugin(t, nil)
+		plugin.configuration.MaxInstallationTTLHours = "168"
+
+		_, err := plugin.createInstallationForUser("owner", CreateInstallationInput{Name: "ttl", TTL: "8d"})
+		require.EqualError(t, err, "ttl 8d exceeds the maximum of 7d")
+		assert.Nil(t, cloudClient.creationRequest)
+	})
+}
+
+func TestExtendInstallationForUser(t *testing.T) {
+	scheduledInstall := func(deletion time.Time) *Installation {
+		install := serviceTestInstall("id1", "first", "owner1")
+		install.ScheduledDeletionTime = deletion.UnixMilli()
+		return install
+	}
+
+	t.Run("extends the scheduled deletion", func(t *testing.T) {
+		deletion := time.Now().Add(10 * time.Hour)
+		install := scheduledInstall(deletion)
+		plugin, cloudClient, _, kv := newServiceTestPluginWithKV(t, []*Installation{install})
+		cloudClient.mockedCloudInstallationsDTO = serviceDTOs(install)
+
+		result, err := plugin.extendInstallationForUser("owner1", InstallationRef{Name: "first"}, "2d")
+		require.NoError(t, err)
+		assert.Equal(t, "extended", result.Status)
+		assert.Equal(t, "id1", cloudClient.scheduledDeletionID)
+		assert.Equal(t, deletion.Add(48*time.Hour).UnixMilli(), cloudClient.scheduledDeletionTime)
+		assert.Equal(t, cloudClient.scheduledDeletionTime, result.Installation.ScheduledDeletionTime)
+		assert.Contains(t, result.Installation.TimeRemaining, "2d")
+		assert.Equal(t, cloudClient.scheduledDeletionTime, kv.getInstallation(t, "id1").ScheduledDeletionTime)
+
+		events, err := plugin.getInstallationHistory("id1")
+		require.NoError(t, err)
+		require.NotEmpty(t, events)
+		assert.Equal(t, historyActionExtend, events[len(events)-1].Action)
+		assert.Equal(t, "by 2d", events[len(events)-1].Details)
+	})
+
+	t.Run("an overdue deletion is extended from now", func(t *testing.T) {
+		install := scheduledInstall(time.Now().Add(-time.Hour))
+		plugin, cloudClient, _ := newServiceTestPlugin(t, []*Installation{install})
+		cloudClient.mockedCloudInstallationsDTO = serviceDTOs(install)
+
+		before := time.Now()
+		_, err := plugin.extendInstallationForUser("owner1", InstallationRef{Name: "first"}, "5h")
+		require.NoError(t, err)
+		assert.WithinDuration(t, before.Add(5*time.Hour), time.UnixMilli(cloudClient.scheduledDeletionTime), time.Minute)
+	})
+
+	t.Run("the extension is capped by the maximum", func(t *testing.T) {
+		install := scheduledInstall(time.Now().Add(100 * time.Hour))
+		plugin, cloudClient, _ := newServiceTestPlugin(t, []*Installation{install})
+		plugin.configuration.MaxInstallationTTLHours = "168"
+		cloudClient.mockedCloudInstallationsDTO = serviceDTOs(install)
+
+		_, err := plugin.extendInstallationForUser("owner1", InstallationRef{Name: "first"}, "3d")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "exceeds the maximum of 7d")
+		assert.Empty(t, cloudClient.scheduledDeletionID)
+	})
+
+	t.Run("installations without a scheduled deletion are rejected", func(t *testing.T) {
+		install := serviceTestInstall("id1", "first", "owner1")
+		plugin, cloudClient, _ := newServiceTestPlugin(t, []*Installation{install})
+		cloudClient.mockedCloudInstallationsDTO = serviceDTOs(install)
+
+		_, err := plugin.extendInstallationForUser("owner1", InstallationRef{Name: "first"}, "1d")
+		require.EqualError(t, err, "installation first is not scheduled for deletion")
+	})
+
+	t.Run("provisioner errors are returned", func(t *testing.T) {
+		install := scheduledInstall(time.Now().Add(time.Hour))
+		plugin, cloudClient, _ := newServiceTestPlugin(t, []*Installation{install})
+		cloudClient.mockedCloudInstallationsDTO = serviceDTOs(install)
+		cloudClient.scheduleErr = errors.New("provisioner unavailable")
+
+		_, err := plugin.extendInstallationForUser("owner1", InstallationRef{Name: "first"}, "1d")
+		require.EqualError(t, err, "failed to update installation scheduled deletion: provisioner unavailable")
+	})
+}
@@ -31,6 +31,18 @@ func inlineCode(in string) string {
 	return fmt.Sprintf("`%s`", in)
 }
 
+// quotedList joins the items for help texts, e.g. 'a', 'b', or 'c'.
+func quotedList(items []string) string {
+	quoted := make([]string, 0, len(items))
+	for _, item := range items {
+		quoted = append(quoted, fmt.Sprintf("'%s'", item))
+	}
+	if len(quoted) <= 2 {
+		return strings.Join(quoted, " or ")
+	}
+	return strings.Join(quoted[:len(quoted)-1], ", ") + ", or " + quoted[len(quoted)-1]
+}
+
 func standardizeName(name string) string {
 	return strings.ToLower(name)
 }
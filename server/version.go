@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/blang/semver/v4"
+	"github.com/pkg/errors"
+)
+
+const (
+	versionSpecLatest    = "latest"
+	versionSpecLatestESR = "latest-esr"
+	versionSpecLatestRC  = "latest-rc"
+	versionSpecMaster    = "master"
+
+	defaultVersionListLimit = 50
+	maxVersionListLimit     = 500
+)
+
+// ListVersionsInput selects the tags to list from an image repository.
+type ListVersionsInput struct {
+	Image  string
+	Filter string
+	Limit  int
+}
+
+// VersionList holds the newest tags of an image repository matching a filter.
+type VersionList struct {
+	Image string   `json:"image"`
+	Tags  []string `json:"tags"`
+	Total int      `json:"total"`
+}
+
+// versionRangeMatcher matches version specs such as 9.11.x or 10.x, which
+// select the newest release of a release line.
+var versionRangeMatcher = regexp.MustCompile(`^(\d+)\.(?:(\d+)\.)?x$`)
+
+// pullRequestVersionMatcher matches version specs such as pr-12345, which
+// select the development build of a pull request.
+var pullRequestVersionMatcher = regexp.MustCompile(`^(?i)pr-\d+$`)
+
+// isDevBuildVersionSpec returns true for version specs that are only
+// published to the development image repositories.
+func isDevBuildVersionSpec(spec string) bool {
+	return spec == versionSpecMaster || pullRequestVersionMatcher.MatchString(spec)
+}
+
+// devImageFor returns the development image repository matching the edition
+// of the given image.
+func devImageFor(image string) string {
+	switch image {
+	case imageTE, imageTeamEdition, imageTETest, imageTEDev:
+		return imageTEDev
+	}
+	return imageEEDev
+}
+
+// isDevImage returns true for the image repositories development builds are
+// published to.
+func isDevImage(image string) bool {
+	return image == imageEEDev || image == imageTEDev
+}
+
+// createImageForVersion returns the image to create an installation running
+// the given version spec from. Development builds default to a development
+// image when no image was requested.
+func createImageForVersion(image, spec string) string {
+	if image == "" && isDevBuildVersionSpec(spec) {
+		return devImageFor(defaultImage)
+	}
+	return defaultString(image, defaultImage)
+}
+
+// resolveVersionSpec returns the docker tag the given version spec selects in
+// the image repository. The latest version is the latest release of the
+// configured release source. The other channels and release lines are
+// resolved against the registry tags and fall back to the releases of the
+// release source. Any other spec is returned as a literal tag.
+func (p *Plugin) resolveVersionSpec(spec, image string) (string, error) {
+	config := p.getConfiguration()
+
+	switch {
+	case spec == versionSpecLatest && config.releaseSource() == releaseSourcePinned:
+		return config.PinnedReleaseVersion, nil
+
+	case spec == versionSpecLatest && config.releaseSource() != releaseSourceRegistry:
+		return p.resolveLatestRelease()
+
+	case spec == versionSpecLatest, spec == versionSpecLatestESR, spec == versionSpecLatestRC, versionRangeMatcher.MatchString(spec):
+		esrVersions := config.esrVersions()
+		if tag := selectVersionTag(spec, p.registryTags(image), esrVersions); tag != "" {
+			return tag, nil
+		}
+
+		if spec == versionSpecLatest {
+			return p.resolveLatestRelease()
+		}
+
+		releases, err := p.releaseTags()
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to determine tag for requested version '%s'", spec)
+		}
+		if tag := selectVersionTag(spec, releases, esrVersions); tag != "" {
+			return tag, nil
+		}
+
+		return "", errors.Errorf("no release matching version %s was found", spec)
+
+	case pullRequestVersionMatcher.MatchString(spec):
+		for _, tag := range p.registryTags(image) {
+			if strings.EqualFold(tag, spec) {
+				return tag, nil
+			}
+		}
+	}
+
+	return spec, nil
+}
+
+// resolveLatestRelease returns the latest release of the configured release
+// source as the tag of the latest version.
+func (p *Plugin) resolveLatestRelease() (string, error) {
+	latest, err := p.latestRelease()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to determine latest tag for requested version 'latest'")
+	}
+	if latest == "" {
+		return "", errors.New("failed to determine latest tag for requested version 'latest': got empty version")
+	}
+	return latest, nil
+}
+
+// listVersions returns the tags of an allowed image repository starting
+// with the filter, newest release first.
+func (p *Plugin) listVersions(input ListVersionsInput) (VersionList, error) {
+	image := defaultString(input.Image, defaultImage)
+	if !p.validImageName(image) {
+		return VersionList{}, p.invalidImageNameError(image)
+	}
+
+	limit := input.Limit
+	if limit <= 0 {
+		limit = defaultVersionListLimit
+	}
+	limit = min(limit, maxVersionListLimit)
+
+	tags, err := p.dockerClient.ListTags(image)
+	if err != nil {
+		return VersionList{}, errors.Wrapf(err, "failed to list the tags of %s", image)
+	}
+
+	matching := []string{}
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, input.Filter) {
+			matching = append(matching, tag)
+		}
+	}
+	matching = sortVersionTags(matching)
+
+	return VersionList{
+		Image: image,
+		Tags:  matching[:min(limit, len(matching))],
+		Total: len(matching),
+	}, nil
+}
+
+// sortVersionTags returns the tags with the release versions first, newest
+// first, followed by the other tags in alphabetical order.
+func sortVersionTags(tags []string) []string {
+	type parsedTag struct {
+		tag     string
+		version semver.Version
+		valid   bool
+	}
+
+	parsed := make([]parsedTag, 0, len(tags))
+	for _, tag := range tags {
+		version, err := semver.Parse(tag)
+		parsed = append(parsed, parsedTag{tag: tag, version: version, valid: err == nil})
+	}
+	sort.SliceStable(parsed, func(i, j int) bool {
+		a, b := parsed[i], parsed[j]
+		switch {
+		case a.valid && b.valid:
+			return compareReleaseVersions(a.version, b.version) > 0
+		case a.valid != b.valid:
+			return a.valid
+		}
+		return a.tag < b.tag
+	})
+
+	sorted := make([]string, 0, len(parsed))
+	for _, tag := range parsed {
+		sorted = append(sorted, tag.tag)
+	}
+	return sorted
+}
+
+// registryTags returns the tags of the image repository, or nil when they
+// cannot be listed so that callers can fall back to other sources.
+func (p *Plugin) registryTags(image string) []string {
+	tags, err := p.dockerClient.ListTags(image)
+	if err != nil {
+		p.API.LogWarn("Failed to list registry tags", "image", image, "error", err.Error())
+		return nil
+	}
+	return tags
+}
+
+// selectVersionTag returns the newest of the tags the version spec selects,
+// or an empty string when none match.
+func selectVersionTag(spec string, tags []string, esrVersions []semver.Version) string {
+	var (
+		selectedTag     string
+		selectedVersion semver.Version
+	)
+	for _, tag := range tags {
+		version, err := semver.Parse(tag)
+		if err != nil || len(version.Build) > 0 || !versionSpecMatches(spec, version, esrVersions) {
+			continue
+		}
+		if selectedTag == "" || compareReleaseVersions(version, selectedVersion) > 0 {
+			selectedTag = tag
+			selectedVersion = version
+		}
+	}
+
+	return selectedTag
+}
+
+// compareReleaseVersions compares versions like semver does, except that
+// release candidates are ordered by their number so that rc10 follows rc9.
+func compareReleaseVersions(a, b semver.Version) int {
+	if a.Major == b.Major && a.Minor == b.Minor && a.Patch == b.Patch && len(a.Pre) > 0 && len(b.Pre) > 0 {
+		aRC, aErr := strconv.Atoi(strings.TrimPrefix(a.Pre[0].String(), "rc"))
+		bRC, bErr := strconv.Atoi(strings.TrimPrefix(b.Pre[0].String(), "rc"))
+		if aErr == nil && bErr == nil && aRC != bRC {
+			if aRC > bRC {
+				return 1
+			}
+			return -1
+		}
+	}
+	return a.Compare(b)
+}
+
+func versionSpecMatches(spec string, version semver.Version, esrVersions []semver.Version) bool {
+	if spec == versionSpecLatestRC {
+		return len(version.Pre) > 0 && strings.HasPrefix(version.Pre[0].String(), "rc")
+	}
+	if len(version.Pre) > 0 {
+		return false
+	}
+
+	switch spec {
+	case versionSpecLatest:
+		return true
+	case versionSpecLatestESR:
+		for _, esr := range esrVersions {
+			if version.Major == esr.Major && version.Minor == esr.Minor {
+				return true
+			}
+		}
+		return false
+	}
+
+	match := versionRangeMatcher.FindStringSubmatch(spec)
+	if match == nil {
+		return false
+	}
+	major, _ := strconv.ParseUint(match[1], 10, 64)
+	if version.Major != major {
+		return false
+	}
+	if match[2] == "" {
+		return true
+	}
+	minor, _ := strconv.ParseUint(match[2], 10, 64)
+	return version.Minor == minor
+}
+
+// describeVersionResolution explains which tag and digest a requested version
+// spec resolved to.
+func describeVersionResolution(spec, tag, digest string) string {
+	if spec == "" || spec == tag {
+		return fmt.Sprintf("Version %s resolved to digest %s.", tag, digest)
+	}
+	return fmt.Sprintf("Version %s resolved to tag %s (digest %s).", spec, tag, digest)
+}
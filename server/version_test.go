@@ -0,0 +1,234 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blang/semver/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testRegistryTags = []string{
+	"9.5.0", "9.5.3", "9.11.0", "9.11.4", "9.11.10", "10.0.0-rc1",
+	"10.0.0", "10.1.0-rc2", "10.1.0-rc10", "release-10.1", "master", "PR-12345", "latest",
+}
+
+func TestSelectVersionTag(t *testing.T) {
+	esrVersions := []semver.Version{semver.MustParse("9.5.0"), semver.MustParse("9.11.0")}
+
+	tests := []struct {
+		spec     string
+		expected string
+	}{
+		{versionSpecLatest, "10.0.0"},
+		{versionSpecLatestESR, "9.11.10"},
+		{versionSpecLatestRC, "10.1.0-rc10"},
+		{"9.11.x", "9.11.10"},
+		{"9.5.x", "9.5.3"},
+		{"9.x", "9.11.10"},
+		{"8.1.x", ""},
+		{"master", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			assert.Equal(t, tt.expected, selectVersionTag(tt.spec, testRegistryTags, esrVersions))
+		})
+	}
+}
+
+func TestResolveVersionSpec(t *testing.T) {
+	setup := func(t *testing.T, tags []string) *Plugin {
+		plugin, _, _ := newServiceTestPlugin(t, nil)
+		plugin.configuration.ESRVersions = "9.11"
+		plugin.dockerClient = &MockedDockerClient{tagExists: true, tags: tags}
+		return plugin
+	}
+
+	t.Run("channels and release lines resolve against the registry tags", func(t *testing.T) {
+		plugin := setup(t, testRegistryTags)
+		plugin.configuration.ReleaseSource = releaseSourceRegistry
+
+		for spec, expected := range map[string]string{
+			versionSpecLatest:    "10.0.0",
+			versionSpecLatestESR: "9.11.10",
+			versionSpecLatestRC:  "10.1.0-rc10",
+			"9.5.x":              "9.5.3",
+		} {
+			tag, err := plugin.resolveVersionSpec(spec, imageEE)
+			require.NoError(t, err)
+			assert.Equal(t, expected, tag, spec)
+		}
+	})
+
+	t.Run("latest is the latest Github release even when the registry has a newer tag", func(t *testing.T) {
+		plugin := setup(t, testRegistryTags)
+		plugin.configuration.ReleaseSource = releaseSourceGithub
+		plugin.latestMattermostVersion = &latestMattermostVersionCache{version: "9.11.10", tags: []string{"9.11.10"}, timestamp: time.Now()}
+
+		tag, err := plugin.resolveVersionSpec(versionSpecLatest, imageEE)
+		require.NoError(t, err)
+		assert.Equal(t, "9.11.10", tag)
+
+		tag, err = plugin.resolveVersionSpec(versionSpecLatestRC, imageEE)
+		require.NoError(t, err)
+		assert.Equal(t, "10.1.0-rc10", tag)
+	})
+
+	t.Run("literal tags and dev builds are kept", func(t *testing.T) {
+		plugin := setup(t, testRegistryTags)
+
+		for spec, expected := range map[string]string{
+			"9.4.0":    "9.4.0",
+			"master":   "master",
+			"pr-12345": "PR-12345",
+			"pr-99999": "pr-99999",
+		} {
+			tag, err := plugin.resolveVersionSpec(spec, imageEEDev)
+			require.NoError(t, err)
+			assert.Equal(t, expected, tag, spec)
+		}
+	})
+
+	t.Run("falls back to the Github releases", func(t *testing.T) {
+		plugin := setup(t, nil)
+		plugin.latestMattermostVersion.tags = []string{"9.5.0", "9.11.2", "9.11.3", "10.0.0-rc1"}
+
+		tag, err := plugin.resolveVersionSpec(versionSpecLatest, imageEE)
+		require.NoError(t, err)
+		assert.Equal(t, "9.5.0", tag)
+
+		tag, err = plugin.resolveVersionSpec("9.11.x", imageEE)
+		require.NoError(t, err)
+		assert.Equal(t, "9.11.3", tag)
+
+		tag, err = plugin.resolveVersionSpec(versionSpecLatestRC, imageEE)
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0-rc1", tag)
+
+		_, err = plugin.resolveVersionSpec("8.1.x", imageEE)
+		require.EqualError(t, err, "no release matching version 8.1.x was found")
+	})
+
+	t.Run("registry errors fall back to the Github releases", func(t *testing.T) {
+		plugin, _, api := newServiceTestPlugin(t, nil)
+		plugin.dockerClient = &MockedDockerClient{listTagsErr: errors.New("registry down")}
+		plugin.latestMattermostVersion.tags = []string{"9.11.3"}
+		api.On("LogWarn", "Failed to list registry tags", "image", imageEE, "error", "registry down").Return(nil)
+
+		tag, err := plugin.resolveVersionSpec("9.11.x", imageEE)
+		require.NoError(t, err)
+		assert.Equal(t, "9.11.3", tag)
+	})
+}
+
+func TestCreateInstallationVersionSpecs(t *testing.T) {
+	t.Run("release lines resolve to the newest patch", func(t *testing.T) {
+		plugin, cloudClient, _ := newServiceTestPlugin(t, nil)
+		plugin.dockerClient = &MockedDockerClient{tagExists: true, tags: testRegistryTags, digest: "sha256:abc"}
+
+		install, err := plugin.createInstallationForUser("owner", CreateInstallationInput{Name: "lts", Version: "9.11.x"})
+		require.NoError(t, err)
+		assert.Equal(t, "9.11.10", install.Tag)
+		require.NotNil(t, cloudClient.creationRequest)
+		assert.Equal(t, "sha256:abc", cloudClient.creationRequest.Version)
+		assert.Equal(t, imageEE, cloudClient.creationRequest.Image)
+		assert.Equal(t, "Version 9.11.x resolved to tag 9.11.10 (digest sha256:abc).", describeVersionResolution(install.versionSpec, install.Tag, install.Version))
+	})
+
+	t.Run("dev builds default to the development image", func(t *testing.T) {
+		plugin, cloudClient, _ := newServiceTestPlugin(t, nil)
+		dockerClient := &MockedDockerClient{tagExists: true}
+		plugin.dockerClient = dockerClient
+
+		_, err := plugin.createInstallationForUser("owner", CreateInstallationInput{Name: "nightly", Version: "master"})
+		require.NoError(t, err)
+		assert.Equal(t, imageEEDev, cloudClient.creationRequest.Image)
+		assert.Equal(t, []dockerClientCall{{tag: "master", repository: imageEEDev}}, dockerClient.validTagCalls)
+	})
+
+	t.Run("an explicit image is kept for dev builds", func(t *testing.T) {
+		plugin, cloudClient, _ := newServiceTestPlugin(t, nil)
+
+		_, err := plugin.createInstallationForUser("owner", CreateInstallationInput{Name: "nightly", Version: "master", Image: imageTEDev})
+		require.NoError(t, err)
+		assert.Equal(t, imageTEDev, cloudClient.creationRequest.Image)
+	})
+}
+
+func TestUpdateInstallationVersionSpecs(t *testing.T) {
+	t.Run("release lines resolve to the newest patch", func(t *testing.T) {
+		install := serviceTestInstall("id1", "first", "owner1")
+		plugin, cloudClient, _, kv := newServiceTestPluginWithKV(t, []*Installation{install})
+		plugin.dockerClient = &MockedDockerClient{tagExists: true, tags: testRegistryTags, digest: "sha256:def"}
+
+		result, err := plugin.updateInstallationForUser("owner1", InstallationRef{Name: "first"}, UpdateInstallationInput{Version: "9.11.x"}, InstallationScopeMine)
+		require.NoError(t, err)
+		assert.Equal(t, "Version 9.11.x resolved to tag 9.11.10 (digest sha256:def).", result.Message)
+		require.NotNil(t, cloudClient.patchRequest.Version)
+		assert.Equal(t, "sha256:def", *cloudClient.patchRequest.Version)
+		assert.Equal(t, "9.11.10", kv.getInstallation(t, "id1").Tag)
+	})
+
+	t.Run("dev builds switch to the development image of the same edition", func(t *testing.T) {
+		install := serviceTestInstall("id1", "first", "owner1")
+		install.Image = imageTeamEdition
+		plugin, cloudClient, _, kv := newServiceTestPluginWithKV(t, []*Installation{install})
+
+		result, err := plugin.updateInstallationForUser("owner1", InstallationRef{Name: "first"}, UpdateInstallationInput{Version: "master"}, InstallationScopeMine)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"image", "version"}, result.ChangedFields)
+		require.NotNil(t, cloudClient.patchRequest.Image)
+		assert.Equal(t, imageTEDev, *cloudClient.patchRequest.Image)
+		assert.Equal(t, imageTEDev, kv.getInstallation(t, "id1").Image)
+	})
+
+	t.Run("unknown release lines are rejected", func(t *testing.T) {
+		install := serviceTestInstall("id1", "first", "owner1")
+		plugin, cloudClient, _ := newServiceTestPlugin(t, []*Installation{install})
+		plugin.latestMattermostVersion = &latestMattermostVersionCache{version: "9.5.0", tags: []string{"9.5.0"}, timestamp: time.Now()}
+
+		_, err := plugin.updateInstallationForUser("owner1", InstallationRef{Name: "first"}, UpdateInstallationInput{Version: "8.1.x"}, InstallationScopeMine)
+		require.EqualError(t, err, "no release matching version 8.1.x was found")
+		assert.True(t, isUpdateUserError(err))
+		assert.Nil(t, cloudClient.patchRequest)
+	})
+}
+
+func TestSortVersionTags(t *testing.T) {
+	sorted := sortVersionTags([]string{"master", "9.5.0", "10.1.0-rc2", "release-10.1", "10.0.0", "10.1.0-rc10", "9.11.0"})
+	assert.Equal(t, []string{"10.1.0-rc10", "10.1.0-rc2", "10.0.0", "9.11.0", "9.5.0", "master", "release-10.1"}, sorted)
+}
+
+func TestListVersions(t *testing.T) {
+	plugin, _, _ := newServiceTestPlugin(t, nil)
+	plugin.dockerClient = &MockedDockerClient{tags: testRegistryTags}
+
+	t.Run("filters and sorts the tags", func(t *testing.T) {
+		list, err := plugin.listVersions(ListVersionsInput{Filter: "9.11."})
+		require.NoError(t, err)
+		assert.Equal(t, VersionList{Image: defaultImage, Tags: []string{"9.11.10", "9.11.4", "9.11.0"}, Total: 3}, list)
+	})
+
+	t.Run("limits the tags", func(t *testing.T) {
+		list, err := plugin.listVersions(ListVersionsInput{Image: imageEEDev, Limit: 2})
+		require.NoError(t, err)
+		assert.Equal(t, imageEEDev, list.Image)
+		assert.Equal(t, []string{"10.1.0-rc10", "10.1.0-rc2"}, list.Tags)
+		assert.Equal(t, len(testRegistryTags), list.Total)
+	})
+
+	t.Run("only whitelisted images are listed", func(t *testing.T) {
+		_, err := plugin.listVersions(ListVersionsInput{Image: "someone/else"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid image name someone/else")
+	})
+
+	t.Run("registry errors are returned", func(t *testing.T) {
+		plugin.dockerClient = &MockedDockerClient{listTagsErr: errors.New("registry down")}
+
+		_, err := plugin.listVersions(ListVersionsInput{})
+		require.EqualError(t, err, "failed to list the tags of mattermost/mattermost-enterprise-edition: registry down")
+	})
+}
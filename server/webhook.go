@@ -88,12 +88,28 @@ func (p *Plugin) processWebhookEvent(payload *cloud.WebhookPayload) {
 			p.API.LogError(err.Error())
 		}
 
+		err = p.recordInstallationStateChange(payload)
+		if err != nil {
+			p.API.LogError(errors.Wrap(err, "failed to record installation state change").Error())
+		}
+
+		err = p.reportProvisionerProgress(payload)
+		if err != nil {
+			p.API.LogError(errors.Wrap(err, "failed to report installation creation progress").Error())
+		}
+
+		if payload.NewState == cloud.InstallationStateDeleted {
+			p.deleteInstallationRecords(payload.ID)
+		}
+
 		// Don't return so that any installation finalization can be processed.
 	default:
 		return
 	}
 
 	if payload.NewState != cloud.InstallationStateStable &&
+		!isInstallationCreationFailedState(payload.NewState) &&
+		payload.NewState != cloud.InstallationStateCreationNoCompatibleClusters &&
 		payload.NewState != cloud.InstallationStateHibernating &&
 		payload.NewState != cloud.InstallationStateDeletionPending &&
 		payload.NewState != cloud.InstallationStateDeleted {
@@ -132,10 +148,10 @@ func (p *Plugin) processWebhookEvent(payload *cloud.WebhookPayload) {
 
 	if payload.NewState == cloud.InstallationStateDeletionPending {
 		if payload.ExtraData["actor_id"] == p.configuration.ProvisioningServerClientID {
-			p.PostBotDM(install.OwnerID, fmt.Sprintf("Installation %s is pending final deletion. If this was a mistake, please contact the Cloud Platform team within 24 hours of this message, or your data will be lost forever.", install.Name))
+			p.PostBotDM(install.OwnerID, fmt.Sprintf("Installation %s is pending final deletion. If this was a mistake, run `/cloud restore %s` within 24 hours of this message, or your data will be lost forever.", install.Name, install.Name))
 			return
 		}
-		p.PostBotDM(install.OwnerID, fmt.Sprintf("Installation %s has automatically been moved to pending deletion state. If you believe this to be a mistake, please contact the Cloud Platform team for restoration. You have 24 hours to initiate before your data is lost forever.", install.Name))
+		p.PostBotDM(install.OwnerID, fmt.Sprintf("Installation %s has automatically been moved to pending deletion state. If you believe this to be a mistake, run `/cloud restore %s`. You have 24 hours to restore it before your data is lost forever.", install.Name, install.Name))
 		return
 	}
 
@@ -144,9 +160,17 @@ func (p *Plugin) processWebhookEvent(payload *cloud.WebhookPayload) {
 		return
 	}
 
-	var dnsRecord string
-	if len(install.DNSRecords) > 0 {
-		dnsRecord = install.DNSRecords[0].DomainName
+	if payload.NewState == cloud.InstallationStateCreationNoCompatibleClusters {
+		p.PostBotDM(install.OwnerID, fmt.Sprintf("Installation %s is waiting for capacity: no cluster can currently host it. The provisioner keeps retrying its creation, so there is nothing to do. Run `/cloud delete %s` if you no longer need it.", install.Name, install.Name))
+		return
+	}
+
+	// A failed creation is not set up, as the installation doesn't work.
+	if isInstallationCreationFailedState(payload.NewState) {
+		if err = p.reportCreationFailure(install, payload.OldState); err != nil {
+			p.API.LogError(err.Error(), "installation", install.Name)
+		}
+		return
 	}
 
 	switch payload.OldState {
@@ -169,61 +193,21 @@ Installation details:
 		cloud.InstallationStateCreationPreProvisioning,
 		cloud.InstallationStateCreationInProgress,
 		cloud.InstallationStateCreationDNS,
-		cloud.InstallationStateCreationNoCompatibleClusters,
-		cloud.InstallationStateCreationFailed,
 		cloud.InstallationStateCreationFinalTasks:
 
-		adminPassword := generateRandomPassword(defaultAdminUsername)
-		userPassword := generateRandomPassword(defaultUserUsername)
-		err = p.setupInstallation(install, adminPassword, userPassword)
+		// The provisioner may deliver the webhook more than once, so the setup
+		// is only started by the first delivery.
+		state, err := p.claimInstallationSetup(install.ID, "")
 		if err != nil {
 			p.API.LogError(err.Error(), "installation", install.Name)
 			return
 		}
-
-		install.HideSensitiveFields()
-
-		installationLogsURL, err := getStringFromTemplate(installationLogsURLTmpl, install)
-		if err != nil {
-			p.API.LogError(err.Error(), "installation", install.Name)
+		if state == nil {
+			p.API.LogDebug("Skipping installation setup which was already started", "installation", install.Name)
 			return
 		}
 
-		provisionerLogsURL, err := getStringFromTemplate(provisionerLogsURLTmpl, install)
-		if err != nil {
-			p.API.LogError(err.Error(), "installation", install.Name)
-			return
-		}
-
-		message := fmt.Sprintf(`
-Installation %s is ready!
-
-Access at: https://%s
-
-Login with:
-
-| Username | Password | Note |
-| -- | -- | -- |
-| %s | %s | Admin user |
-| %s | %s | Regular user |
-
-Grafana logs for this installation:
-
-- [Installation logs](%s)
-- [Provisioner logs](%s)
-
-Installation details:
-%s
-`,
-			install.Name,
-			dnsRecord,
-			inlineCode(defaultAdminUsername), inlineCode(adminPassword),
-			inlineCode(defaultUserUsername), inlineCode(userPassword),
-			installationLogsURL, provisionerLogsURL,
-			jsonCodeBlock(install.ToPrettyJSON()),
-		)
-
-		p.PostBotDM(install.OwnerID, message)
+		p.runInstallationSetup(install, state)
 	}
 }
 
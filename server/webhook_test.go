@@ -2,8 +2,13 @@ package main
 
 import (
 	"net/http"
+	"strings"
 	"testing"
 
+	cloud "github.com/mattermost/mattermost-cloud/model"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
 
@@ -68,3 +73,162 @@ func TestAuthenticateWebhook(t *testing.T) {
 		require.NoError(t, plugin.authenticateWebhook(request))
 	})
 }
+
+func TestProcessInstallationWebhook(t *testing.T) {
+	testCases := []struct {
+		name     string
+		oldState string
+		newState string
+		actorID  string
+		// expectedDMs are contained, in order, in the messages of the DMs sent.
+		expectedDMs   []string
+		expectSetup   bool
+		expectFailure bool
+	}{
+		{
+			name:        "creation finished",
+			oldState:    cloud.InstallationStateCreationFinalTasks,
+			newState:    cloud.InstallationStateStable,
+			expectedDMs: []string{"Installation first is ready!"},
+			expectSetup: true,
+		},
+		{
+			name:          "creation failed",
+			oldState:      cloud.InstallationStateCreationInProgress,
+			newState:      cloud.InstallationStateCreationFailed,
+			expectedDMs:   []string{"Creation of installation first failed at Provisioner creation-in-progress", "Creation of installation first failed."},
+			expectFailure: true,
+		},
+		{
+			name:        "no compatible clusters",
+			oldState:    cloud.InstallationStateCreationRequested,
+			newState:    cloud.InstallationStateCreationNoCompatibleClusters,
+			expectedDMs: []string{"Installation first is being created.", "Installation first is waiting for capacity"},
+		},
+		{
+			name:        "creation in progress",
+			oldState:    cloud.InstallationStateCreationRequested,
+			newState:    cloud.InstallationStateCreationInProgress,
+			expectedDMs: []string{"Installation first is being created."},
+		},
+		{
+			name:        "updated",
+			oldState:    cloud.InstallationStateUpdateInProgress,
+			newState:    cloud.InstallationStateStable,
+			expectedDMs: []string{"Installation first has been updated!"},
+		},
+		{
+			name:        "hibernated",
+			oldState:    cloud.InstallationStateHibernationInProgress,
+			newState:    cloud.InstallationStateHibernating,
+			expectedDMs: []string{"Installation first has been hibernated"},
+		},
+		{
+			name:        "deletion scheduled by the provisioner",
+			oldState:    cloud.InstallationStateStable,
+			newState:    cloud.InstallationStateDeletionPending,
+			actorID:     "provisioner-client",
+			expectedDMs: []string{"Installation first is pending final deletion."},
+		},
+		{
+			name:        "deletion pending",
+			oldState:    cloud.InstallationStateStable,
+			newState:    cloud.InstallationStateDeletionPending,
+			expectedDMs: []string{"Installation first has automatically been moved to pending deletion state."},
+		},
+		{
+			name:        "deleted",
+			oldState:    cloud.InstallationStateDeletionInProgress,
+			newState:    cloud.InstallationStateDeleted,
+			expectedDMs: []string{"Installation first has been deleted"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			install := setupTestInstall("id1", "first", "owner1")
+			plugin, cloudClient, api, kv := newServiceTestPluginWithKV(t, []*Installation{install})
+			plugin.BotUserID = "bot-id"
+			plugin.configuration.ProvisioningServerClientID = "provisioner-client"
+			api.On("LogDebug", mock.AnythingOfType("string")).Return()
+			posts := captureBotPosts(api)
+
+			provisionerInstall := *install.Installation
+			provisionerInstall.State = tc.newState
+			cloudClient.overrideGetInstallationDTO = &cloud.InstallationDTO{Installation: &provisionerInstall, DNSRecords: install.DNSRecords}
+			cloudClient.mockedCloudClusterInstallations = []*cloud.ClusterInstallation{{ID: "ci1", ClusterID: "cluster1", State: cloud.ClusterInstallationStateCreationRequested}}
+
+			steps := &fakeSetupSteps{}
+			steps.install(t)
+
+			plugin.processWebhookEvent(&cloud.WebhookPayload{
+				Type:      cloud.TypeInstallation,
+				ID:        install.ID,
+				OldState:  tc.oldState,
+				NewState:  tc.newState,
+				ExtraData: map[string]string{"actor_id": tc.actorID},
+			})
+
+			require.Len(t, *posts, len(tc.expectedDMs))
+			for i, expected := range tc.expectedDMs {
+				assert.Contains(t, (*posts)[i].Message, expected)
+			}
+
+			if tc.expectSetup {
+				assert.NotEmpty(t, steps.runs)
+				assert.Equal(t, setupStatusComplete, storedSetupState(t, kv, install.ID).Status)
+			} else {
+				assert.Empty(t, steps.runs)
+				assert.Nil(t, kv.get(setupStateKey(install.ID)))
+			}
+
+			var failurePost *model.Post
+			for _, post := range *posts {
+				if len(post.Attachments()) > 0 {
+					failurePost = post
+				}
+			}
+			if !tc.expectFailure {
+				assert.Nil(t, failurePost)
+				return
+			}
+			require.NotNil(t, failurePost)
+			attachment := failurePost.Attachments()[0]
+			assert.Contains(t, attachment.Text, "from `"+tc.oldState+"` to `"+tc.newState+"`")
+			assert.Contains(t, attachment.Text, "| `ci1` | `cluster1` | creation-requested |")
+			assert.Contains(t, attachment.Text, "[Provisioner logs](https://grafana.internal.mattermost.com/")
+			require.Len(t, attachment.Actions, 2)
+			assert.Equal(t, creationFailureActionRetry, attachment.Actions[0].Id)
+			assert.True(t, strings.HasSuffix(attachment.Actions[0].Integration.URL, "/api/v1/creation-failure/retry"))
+			assert.Equal(t, creationFailureActionDelete, attachment.Actions[1].Id)
+		})
+	}
+}
+
+func TestWebhookDeletedRemovesInstallationRecords(t *testing.T) {
+	install := setupTestInstall("id1", "first", "owner1")
+	plugin, cloudClient, api, kv := newServiceTestPluginWithKV(t, []*Installation{install})
+	plugin.BotUserID = "bot-id"
+	api.On("LogDebug", mock.AnythingOfType("string")).Return()
+	captureBotPosts(api)
+
+	provisionerInstall := *install.Installation
+	provisionerInstall.State = cloud.InstallationStateDeleted
+	cloudClient.overrideGetInstallationDTO = &cloud.InstallationDTO{Installation: &provisionerInstall, DNSRecords: install.DNSRecords}
+	storeSetupState(t, kv, install.ID, &installationSetupState{Status: setupStatusFailed, AdminPassword: "admin@pass"})
+	require.NoError(t, plugin.storeInstallationCredentials(install.ID, &installationCredentials{AdminPassword: "admin@pass"}))
+	kv.set(creationProgressKey(install.ID), []byte(`{}`))
+	kv.set(testDataProgressKey(install.ID), []byte(`{}`))
+
+	plugin.processWebhookEvent(&cloud.WebhookPayload{
+		Type:     cloud.TypeInstallation,
+		ID:       install.ID,
+		OldState: cloud.InstallationStateDeletionInProgress,
+		NewState: cloud.InstallationStateDeleted,
+	})
+
+	assert.Nil(t, kv.get(setupStateKey(install.ID)))
+	assert.Nil(t, kv.get(credentialsKey(install.ID)))
+	assert.Nil(t, kv.get(creationProgressKey(install.ID)))
+	assert.Nil(t, kv.get(testDataProgressKey(install.ID)))
+}